@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// CreateAccessToken creates a personal access token of the logged-in user, limited to the given scopes (e.g.,
+// "read:conversations", "write:messages"), for scripts. If expiresAt is nil the token does not expire. The token is
+// returned only here; scripts use it with SetToken, like a session.
+func (c *Client) CreateAccessToken(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (*types.AccessTokenResponse, error) {
+	path, err := c.userPath("access-tokens")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.CreateAccessTokenRequest{
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.AccessTokenResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AccessTokens returns the personal access tokens of the logged-in user, newest first
+func (c *Client) AccessTokens(ctx context.Context) ([]types.AccessTokenResponse, error) {
+	path, err := c.userPath("access-tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.AccessTokensResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Tokens, nil
+}
+
+// RevokeAccessToken deletes a personal access token, which stops working at once
+func (c *Client) RevokeAccessToken(ctx context.Context, tokenID string) error {
+	path, err := c.userPath("access-tokens", tokenID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// CreateBot creates a bot account owned by the logged-in user. The bot token is returned only here and by
+// RegenerateBotToken; a client for the bot is created with New and WithToken(bot.Token, bot.ID).
+func (c *Client) CreateBot(ctx context.Context, name string) (*types.BotResponse, error) {
+	path, err := c.userPath("bots")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.CreateBotRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.BotResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Bots returns the bots owned by the logged-in user, without their tokens
+func (c *Client) Bots(ctx context.Context) ([]types.BotResponse, error) {
+	path, err := c.userPath("bots")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.BotsResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Bots, nil
+}
+
+// RegenerateBotToken revokes the token of a bot and returns the bot with a new one
+func (c *Client) RegenerateBotToken(ctx context.Context, botID string) (*types.BotResponse, error) {
+	path, err := c.userPath("bots", botID, "token")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.BotResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteBot deletes a bot account of the logged-in user
+func (c *Client) DeleteBot(ctx context.Context, botID string) error {
+	path, err := c.userPath("bots", botID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
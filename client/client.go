@@ -0,0 +1,309 @@
+/*
+Package client is the Go SDK for the WASAText API. It wraps every route registered by the api package in a typed
+Client, so that bots and integration scripts do not need to hand-roll HTTP calls and request/response structures.
+
+Request and response bodies reuse the structures of the service/api/types package, shared with the server, so they
+always match what the server sends. The client does not depend on the server itself.
+
+Example:
+
+	c, err := client.New("http://localhost:3000")
+	if err != nil {
+		return err
+	}
+	if _, err := c.Login(ctx, "Maria"); err != nil {
+		return err
+	}
+	conversations, err := c.GetMyConversations(ctx)
+
+Every method accepts a context.Context that is attached to the underlying HTTP request. Idempotent calls (GET, PUT and
+DELETE) are retried on network errors and on transient server errors, and so are the calls sending messages and creating
+groups, which carry an idempotency key so that a retry never creates a duplicate. Errors returned by the server are
+decoded into *APIError values.
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/gofrs/uuid"
+)
+
+// ErrNotLoggedIn is returned by methods requiring authentication when the client has no session token
+var ErrNotLoggedIn = errors.New("client is not logged in")
+
+// Client is a WASAText API client. It is safe for concurrent use by multiple goroutines.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+
+	// maxRetries is the number of additional attempts for idempotent requests
+	maxRetries int
+
+	// retryBackoff is the delay before the first retry; it doubles on every further attempt
+	retryBackoff time.Duration
+
+	mu     sync.RWMutex
+	token  string
+	userID string
+}
+
+// Option configures a Client in New
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to send requests (default: http.DefaultClient)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken sets an existing session token, so that Login is not needed. Bots authenticate this way, with their bot
+// token and their ID.
+func WithToken(token, userID string) Option {
+	return func(c *Client) {
+		c.token = token
+		c.userID = userID
+	}
+}
+
+// WithRetries sets how many times idempotent requests are retried and the initial backoff between attempts
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// New returns a new Client for the API server at baseURL (e.g., "http://localhost:3000")
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL must be http or https, got %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:      u,
+		httpClient:   http.DefaultClient,
+		maxRetries:   3,
+		retryBackoff: 200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Token returns the current session token (empty if not logged in)
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// UserID returns the identifier of the logged-in user (empty if not logged in)
+func (c *Client) UserID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.userID
+}
+
+// SetToken replaces the session token and user identifier used for authenticated requests
+func (c *Client) SetToken(token, userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.userID = userID
+}
+
+// session returns the current token and user ID, or ErrNotLoggedIn
+func (c *Client) session() (string, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.token == "" || c.userID == "" {
+		return "", "", ErrNotLoggedIn
+	}
+	return c.token, c.userID, nil
+}
+
+// request describes a single API call
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+	auth        bool
+
+	// idempotencyKey is sent in the Idempotency-Key header; requests with a key are retried whatever their method
+	idempotencyKey string
+}
+
+// jsonRequest builds a request with a JSON-encoded body
+func jsonRequest(method, path string, payload interface{}) (request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return request{}, fmt.Errorf("encoding request body: %w", err)
+	}
+	return request{
+		method:      method,
+		path:        path,
+		body:        body,
+		contentType: "application/json",
+		auth:        true,
+	}, nil
+}
+
+// do sends the request, retrying idempotent calls, and decodes a successful JSON response into out (if not nil). If
+// out is an io.Writer, the response body is copied to it as is.
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	token := ""
+	if req.auth {
+		var err error
+		token, _, err = c.session()
+		if err != nil {
+			return err
+		}
+	}
+
+	attempts := 1
+	if isIdempotent(req.method) || req.idempotencyKey != "" {
+		attempts += c.maxRetries
+	}
+
+	var lastErr error
+	backoff := c.retryBackoff
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		retry, err := c.send(ctx, req, token, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+// send performs a single HTTP round trip. It returns whether the failure is transient and worth retrying.
+func (c *Client) send(ctx context.Context, req request, token string, out interface{}) (bool, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	if len(req.query) > 0 {
+		u.RawQuery = req.query.Encode()
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set(types.IdempotencyKeyHeader, req.idempotencyKey)
+	}
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return true, fmt.Errorf("%s %s: %w", req.method, req.path, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		apiErr := decodeError(res)
+		return isTransientStatus(res.StatusCode), apiErr
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	if w, ok := out.(io.Writer); ok {
+		if _, err := io.Copy(w, res.Body); err != nil {
+			return false, fmt.Errorf("reading %s %s response: %w", req.method, req.path, err)
+		}
+		return false, nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return false, nil
+}
+
+// withIdempotencyKey gives a request a new idempotency key, so that retrying it cannot apply it twice
+func withIdempotencyKey(req request) request {
+	req.idempotencyKey = uuid.Must(uuid.NewV4()).String()
+	return req
+}
+
+// isIdempotent reports whether requests with the given method can be safely retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientStatus reports whether an HTTP status code indicates a temporary failure
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// userPath builds a path under /users/{userId} for the logged-in user
+func (c *Client) userPath(elem ...string) (string, error) {
+	_, userID, err := c.session()
+	if err != nil {
+		return "", err
+	}
+	return pathOf(append([]string{"users", userID}, elem...)...), nil
+}
+
+// pathOf joins path elements, escaping each one
+func pathOf(elem ...string) string {
+	var sb strings.Builder
+	for _, e := range elem {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(e))
+	}
+	return sb.String()
+}
@@ -0,0 +1,459 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/api"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	// The database package logs through the standard logger
+	log.SetOutput(io.Discard)
+
+	// Uploaded files are written under the working directory: run inside a scratch directory
+	dir, err := os.MkdirTemp("", "wasatext-client-")
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "creating working directory:", err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "entering working directory:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// flakyHandler wraps the API router, failing the first requests with 503 Service Unavailable after handling them, as
+// if the response had been lost. It records the idempotency key of every request it receives.
+type flakyHandler struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	failures int
+	keys     []string
+}
+
+func (h *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	fail := h.failures > 0
+	if fail {
+		h.failures--
+	}
+	h.keys = append(h.keys, r.Header.Get(types.IdempotencyKeyHeader))
+	h.mu.Unlock()
+
+	if !fail {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	h.next.ServeHTTP(httptest.NewRecorder(), r)
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// failNext makes the next n requests fail and forgets the requests received so far
+func (h *flakyHandler) failNext(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = n
+	h.keys = nil
+}
+
+// received returns the idempotency keys of the requests received since the last failNext
+func (h *flakyHandler) received() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.keys...)
+}
+
+// newServer starts the API server on a new database, behind a flakyHandler. The configuration can be changed by
+// configure.
+func newServer(t *testing.T, configure ...func(*api.Config)) (*httptest.Server, *flakyHandler) {
+	t.Helper()
+
+	dbconn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wasatext.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = dbconn.Close() })
+	db, err := database.New(dbconn)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := api.Config{
+		Logger:            logger,
+		Database:          db,
+		ValidateRequests:  true,
+		ValidateResponses: true,
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	router, err := api.New(cfg)
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	handler := &flakyHandler{next: router.Handler()}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv, handler
+}
+
+// newClient returns a client logged in as name, retrying quickly
+func newClient(t *testing.T, srv *httptest.Server, name string) *client.Client {
+	t.Helper()
+
+	c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	if _, err := c.Login(context.Background(), name); err != nil {
+		t.Fatalf("logging in as %s: %v", name, err)
+	}
+	return c
+}
+
+func TestNewRejectsInvalidURL(t *testing.T) {
+	for _, baseURL := range []string{"localhost:3000", "ftp://localhost", "://"} {
+		if _, err := client.New(baseURL); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", baseURL)
+		}
+	}
+}
+
+func TestConversation(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t)
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+
+	if alice.UserID() == "" || alice.Token() == "" {
+		t.Fatal("Login did not store the session")
+	}
+
+	users, err := alice.SearchUsers(ctx, "bob")
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != bob.UserID() {
+		t.Fatalf("SearchUsers returned %+v, want bobby", users)
+	}
+
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	sent, err := alice.SendMessage(ctx, conversation.ID, "hello", nil)
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if sent.Content == nil || *sent.Content != "hello" || sent.SenderID != alice.UserID() {
+		t.Fatalf("SendMessage returned %+v", sent)
+	}
+
+	conversations, err := bob.GetMyConversations(ctx)
+	if err != nil {
+		t.Fatalf("GetMyConversations: %v", err)
+	}
+	if len(conversations) != 1 || conversations[0].ID != conversation.ID {
+		t.Fatalf("GetMyConversations returned %+v", conversations)
+	}
+
+	comment, err := bob.CommentMessage(ctx, sent.ID, "👍")
+	if err != nil {
+		t.Fatalf("CommentMessage: %v", err)
+	}
+	detail, err := bob.GetConversation(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	if len(detail.Messages) != 1 || len(detail.Messages[0].Comments) != 1 || detail.Messages[0].Comments[0].ID != comment.ID {
+		t.Fatalf("GetConversation returned %+v", detail.Messages)
+	}
+
+	if err := alice.DeleteMessage(ctx, sent.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if err := alice.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if alice.Token() != "" {
+		t.Fatal("Logout did not clear the session")
+	}
+}
+
+func TestRetryWithIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	srv, flaky := newServer(t)
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	// The server handles every attempt, but the client sees only the last response
+	flaky.failNext(2)
+	if _, err := alice.SendMessage(ctx, conversation.ID, "only once", nil); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	keys := flaky.received()
+	if len(keys) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(keys))
+	}
+	for _, key := range keys {
+		if key == "" || key != keys[0] {
+			t.Fatalf("attempts carried idempotency keys %q, want the same key", keys)
+		}
+	}
+
+	detail, err := bob.GetConversation(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	if len(detail.Messages) != 1 {
+		t.Fatalf("retries created %d messages, want 1", len(detail.Messages))
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ctx := context.Background()
+	srv, flaky := newServer(t)
+	alice := newClient(t, srv, "alice")
+
+	// Idempotent calls stop after the configured retries, returning the last error
+	flaky.failNext(10)
+	_, err := alice.GetMyConversations(ctx)
+	if client.StatusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("GetMyConversations returned %v, want 503", err)
+	}
+	if n := len(flaky.received()); n != 4 {
+		t.Fatalf("got %d attempts, want 4", n)
+	}
+
+	// Calls that are not idempotent and carry no key are sent once
+	flaky.failNext(1)
+	if _, err := alice.CreateBot(ctx, "helper"); client.StatusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("CreateBot returned %v, want 503", err)
+	}
+	if n := len(flaky.received()); n != 1 {
+		t.Fatalf("got %d attempts, want 1", n)
+	}
+
+	// Cancelling the context stops the retries
+	flaky.failNext(10)
+	cancelled, cancel := context.WithCancel(ctx)
+	slow, err := client.New(srv.URL, client.WithToken(alice.Token(), alice.UserID()), client.WithRetries(3, time.Hour))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := slow.GetMyConversations(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetMyConversations returned %v, want context.Canceled", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t)
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+	carol := newClient(t, srv, "carol")
+
+	anonymous, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	if _, err := anonymous.GetMyConversations(ctx); !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Fatalf("GetMyConversations without session returned %v, want ErrNotLoggedIn", err)
+	}
+
+	anonymous.SetToken("not-a-token", alice.UserID())
+	if _, err := anonymous.GetMyConversations(ctx); !client.IsUnauthorized(err) {
+		t.Fatalf("GetMyConversations with an invalid token returned %v, want 401", err)
+	}
+
+	_, err = alice.GetConversation(ctx, "00000000-0000-0000-0000-000000000000")
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("GetConversation of a missing conversation returned %v, want 403", err)
+	}
+	if apiErr.Message != "Unauthorized access to conversation" {
+		t.Fatalf("APIError carries message %q, want the message of the error response", apiErr.Message)
+	}
+
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, err := carol.SendMessage(ctx, conversation.ID, "intruder", nil); !client.IsForbidden(err) {
+		t.Fatalf("SendMessage to another conversation returned %v, want 403", err)
+	}
+	if _, err := alice.SendMessage(ctx, conversation.ID, "", nil); client.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("SendMessage without content returned %v, want 400", err)
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t)
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	content := []byte("%PDF-1.4\n% wasatext\n")
+	sent, err := alice.SendFile(ctx, conversation.ID, "notes.pdf", bytes.NewReader(content), nil)
+	if err != nil {
+		t.Fatalf("SendFile: %v", err)
+	}
+	if sent.Attachment == nil || sent.Attachment.Filename != "notes.pdf" {
+		t.Fatalf("SendFile returned attachment %+v", sent.Attachment)
+	}
+
+	var buf bytes.Buffer
+	if err := bob.DownloadAttachment(ctx, sent.ID, &buf); err != nil {
+		t.Fatalf("DownloadAttachment: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("DownloadAttachment returned %q, want %q", buf.Bytes(), content)
+	}
+}
+
+func TestMessageTimerEvent(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newServer(t)
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	for _, timer := range []time.Duration{24 * time.Hour, 0} {
+		if err := alice.SetMessageTimer(ctx, conversation.ID, timer); err != nil {
+			t.Fatalf("SetMessageTimer(%v): %v", timer, err)
+		}
+	}
+
+	detail, err := bob.GetConversation(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	var durations []int64
+	for _, message := range detail.Messages {
+		event := message.Event
+		if event == nil || event.Type != "timer_changed" || event.ActorID != alice.UserID() || event.Duration == nil {
+			t.Fatalf("timer change announced with event %+v", event)
+		}
+		durations = append(durations, *event.Duration)
+	}
+	if len(durations) != 2 || durations[0]*durations[1] != 0 || durations[0]+durations[1] != 86400 {
+		t.Fatalf("timer changes announced durations %v, want 86400 and 0", durations)
+	}
+}
+
+// delivery is a webhook delivery received by a test receiver
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookSignature(t *testing.T) {
+	ctx := context.Background()
+	deliveries := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{header: r.Header.Clone(), body: body}
+	}))
+	t.Cleanup(receiver.Close)
+
+	// The receiver listens on a loopback address, refused by the default webhook client
+	srv, _ := newServer(t, func(cfg *api.Config) {
+		cfg.WebhookClient = receiver.Client()
+		cfg.WebhookInterval = 10 * time.Millisecond
+	})
+	alice := newClient(t, srv, "alice")
+	bob := newClient(t, srv, "bobby")
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	webhook, err := alice.CreateWebhook(ctx, receiver.URL, &conversation.ID, []string{"message.created"})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if _, err := bob.SendMessage(ctx, conversation.ID, "signed", nil); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivery received")
+	}
+	timestamp, signature := d.header.Get(types.WebhookTimestampHeader), d.header.Get(types.WebhookSignatureHeader)
+	if err := client.VerifyWebhook(webhook.Secret, d.body, timestamp, signature); err != nil {
+		t.Fatalf("VerifyWebhook of a delivery: %v", err)
+	}
+
+	// The signature covers both the body and the timestamp
+	tampered := bytes.Replace(d.body, []byte("signed"), []byte("forged"), 1)
+	if err := client.VerifyWebhook(webhook.Secret, tampered, timestamp, signature); !errors.Is(err, client.ErrInvalidSignature) {
+		t.Errorf("VerifyWebhook of a changed body returned %v, want ErrInvalidSignature", err)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp %q: %v", timestamp, err)
+	}
+	later := strconv.FormatInt(seconds+1, 10)
+	if err := client.VerifyWebhook(webhook.Secret, d.body, later, signature); !errors.Is(err, client.ErrInvalidSignature) {
+		t.Errorf("VerifyWebhook of a changed timestamp returned %v, want ErrInvalidSignature", err)
+	}
+	if err := client.VerifyWebhook("another secret", d.body, timestamp, signature); !errors.Is(err, client.ErrInvalidSignature) {
+		t.Errorf("VerifyWebhook with another secret returned %v, want ErrInvalidSignature", err)
+	}
+
+	// A correctly signed but old delivery is a replay
+	stale := strconv.FormatInt(time.Now().Add(-client.WebhookTolerance-time.Minute).Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(stale + "."))
+	mac.Write(d.body)
+	staleSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if err := client.VerifyWebhook(webhook.Secret, d.body, stale, staleSignature); !errors.Is(err, client.ErrStaleWebhook) {
+		t.Errorf("VerifyWebhook of a stale delivery returned %v, want ErrStaleWebhook", err)
+	}
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// StartConversation creates (or returns the existing) direct conversation with the given user
+func (c *Client) StartConversation(ctx context.Context, targetUserID string) (*types.ConversationDetailResponse, error) {
+	path, err := c.userPath("conversations")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.StartConversationRequest{UserID: targetUserID})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ConversationDetailResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetMyConversations returns the conversations of the logged-in user, most recent first
+func (c *Client) GetMyConversations(ctx context.Context) ([]types.ConversationResponse, error) {
+	path, err := c.userPath("conversations")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ConversationsResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Conversations, nil
+}
+
+// Sync returns the changes to the conversations of the logged-in user since a cursor, with the cursor to pass next
+// time. An empty since returns only the current cursor, to start syncing after loading the conversations; when the
+// result has more changes pending, Sync should be called again right away. IsGone reports whether the cursor expired
+// and everything has to be loaded again.
+func (c *Client) Sync(ctx context.Context, since string) (*types.SyncResponse, error) {
+	path, err := c.userPath("sync")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	var res types.SyncResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: query, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetConversation returns a conversation with its members and messages. The server marks it as read.
+func (c *Client) GetConversation(ctx context.Context, conversationID string) (*types.ConversationDetailResponse, error) {
+	path, err := c.userPath("conversations", conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ConversationDetailResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SetMessageTimer sets how long new messages of a conversation last before disappearing; 0 turns the timer off.
+// The timer has a resolution of one second.
+func (c *Client) SetMessageTimer(ctx context.Context, conversationID string, timer time.Duration) error {
+	path, err := c.userPath("conversations", conversationID, "timer")
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.SetMessageTimerRequest{Seconds: int64(timer / time.Second)})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// GetDraft returns the draft saved for a conversation
+func (c *Client) GetDraft(ctx context.Context, conversationID string) (*types.DraftResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "draft")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.DraftResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SaveDraft saves the text being written in a conversation, so that other devices can pick it up
+func (c *Client) SaveDraft(ctx context.Context, conversationID, content string, replyTo *string) (*types.DraftResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "draft")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.SaveDraftRequest{Content: content, ReplyTo: replyTo})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.DraftResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteDraft discards the draft of a conversation
+func (c *Client) DeleteDraft(ctx context.Context, conversationID string) error {
+	path, err := c.userPath("conversations", conversationID, "draft")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
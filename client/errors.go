@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// APIError is an error returned by the API server. Message is decoded from the types.ErrorResponse body when present,
+// otherwise it contains the raw response body (e.g., for the plain-text "Unauthorized" reply).
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("wasatext: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("wasatext: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// SecondFactorRequiredError is returned by Login and LoginWithPassword for users with two-factor authentication
+// enabled: the login is completed by CompleteLogin with the challenge and a TOTP or recovery code before ExpiresAt
+type SecondFactorRequiredError struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (e *SecondFactorRequiredError) Error() string {
+	return "wasatext: two-factor code required to log in"
+}
+
+// decodeError builds an APIError from a failed response
+func decodeError(res *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: res.StatusCode}
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return apiErr
+	}
+
+	var body types.ErrorResponse
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") && json.Unmarshal(raw, &body) == nil {
+		apiErr.Message = body.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+	return apiErr
+}
+
+// StatusCode returns the HTTP status code carried by err if it is (or wraps) an *APIError, otherwise 0
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is an API error with status 404 Not Found
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an API error with status 401 Unauthorized
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is an API error with status 403 Forbidden
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// IsConflict reports whether err is an API error with status 409 Conflict
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsGone reports whether err is an API error with status 410 Gone, e.g. for an expired sync cursor
+func IsGone(err error) bool {
+	return StatusCode(err) == http.StatusGone
+}
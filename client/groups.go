@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// CreateGroup creates a new group with the logged-in user as creator. members must not include the creator.
+func (c *Client) CreateGroup(ctx context.Context, name string, members []string) (*types.GroupResponse, error) {
+	path, err := c.userPath("groups")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.CreateGroupRequest{Name: name, Members: members})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.GroupResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AddToGroup adds a user to a group the logged-in user is a member of
+func (c *Client) AddToGroup(ctx context.Context, groupID, userID string) error {
+	path, err := c.userPath("groups", groupID, "members")
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.AddToGroupRequest{UserID: userID})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// LeaveGroup removes the logged-in user from a group
+func (c *Client) LeaveGroup(ctx context.Context, groupID string) error {
+	path, err := c.userPath("groups", groupID, "members")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// RemoveMemberFromGroup removes another member from a group
+func (c *Client) RemoveMemberFromGroup(ctx context.Context, groupID, memberID string) error {
+	path, err := c.userPath("groups", groupID, "members", memberID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// SetGroupName renames a group
+func (c *Client) SetGroupName(ctx context.Context, groupID, name string) error {
+	path, err := c.userPath("groups", groupID, "name")
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.UpdateGroupNameRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// SetGroupPhoto uploads a new photo for a group
+func (c *Client) SetGroupPhoto(ctx context.Context, groupID, filename string, photo io.Reader) error {
+	path, err := c.userPath("groups", groupID, "photo")
+	if err != nil {
+		return err
+	}
+	req, err := multipartRequest(http.MethodPut, path, "photo", filename, photo, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
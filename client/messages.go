@@ -0,0 +1,350 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// SendMessage sends a text message to a conversation. replyTo is optional. If conversationID is the identifier of a
+// user, the server creates (or reuses) the direct conversation with that user.
+func (c *Client) SendMessage(ctx context.Context, conversationID, content string, replyTo *string) (*types.MessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.SendMessageRequest{Content: content, ReplyTo: replyTo})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SendPhoto sends a photo message to a conversation. replyTo is optional.
+func (c *Client) SendPhoto(ctx context.Context, conversationID, filename string, photo io.Reader, replyTo *string) (*types.MessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	if replyTo != nil {
+		fields["replyTo"] = *replyTo
+	}
+	req, err := multipartRequest(http.MethodPost, path, "photo", filename, photo, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Photo is a photo of an album, see SendAlbum
+type Photo struct {
+	Filename string
+	Content  io.Reader
+}
+
+// SendAlbum sends one or more photos as a single message, in order, with an optional caption (empty for none).
+// replyTo is optional.
+func (c *Client) SendAlbum(ctx context.Context, conversationID string, photos []Photo, caption string, replyTo *string) (*types.MessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	if caption != "" {
+		fields["caption"] = caption
+	}
+	if replyTo != nil {
+		fields["replyTo"] = *replyTo
+	}
+	files := make([]formFile, len(photos))
+	for i, photo := range photos {
+		files[i] = formFile{"photo", photo.Filename, photo.Content}
+	}
+	req, err := multipartFilesRequest(http.MethodPost, path, files, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SendFile sends a file message to a conversation. The server detects the type of the file from its content and may
+// refuse it by size (StatusCode 413) or type (StatusCode 415). replyTo is optional.
+func (c *Client) SendFile(ctx context.Context, conversationID, filename string, file io.Reader, replyTo *string) (*types.MessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	if replyTo != nil {
+		fields["replyTo"] = *replyTo
+	}
+	req, err := multipartRequest(http.MethodPost, path, "file", filename, file, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DownloadAttachment writes the file attached to a message to w. Its name and type are in the attachment of the
+// message.
+func (c *Client) DownloadAttachment(ctx context.Context, messageID string, w io.Writer) error {
+	path, err := c.userPath("messages", messageID, "attachment")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, w)
+}
+
+// ForwardMessage forwards a message to another conversation and returns the new message
+func (c *Client) ForwardMessage(ctx context.Context, messageID, conversationID string) (*types.MessageResponse, error) {
+	path, err := c.userPath("messages", messageID, "forward")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.ForwardMessageRequest{ConversationID: conversationID})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteMessage deletes a message sent by the logged-in user
+func (c *Client) DeleteMessage(ctx context.Context, messageID string) error {
+	path, err := c.userPath("messages", messageID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// CommentMessage adds (or replaces) the reaction of the logged-in user to a message
+func (c *Client) CommentMessage(ctx context.Context, messageID, emoticon string) (*types.CommentResponse, error) {
+	path, err := c.userPath("messages", messageID, "comments")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.CommentMessageRequest{Emoticon: emoticon})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.CommentResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UncommentMessage removes a reaction of the logged-in user from a message
+func (c *Client) UncommentMessage(ctx context.Context, messageID, commentID string) error {
+	path, err := c.userPath("messages", messageID, "comments", commentID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// ScheduleMessage schedules a text message to be sent to a conversation at sendAt. replyTo is optional.
+func (c *Client) ScheduleMessage(ctx context.Context, conversationID, content string, replyTo *string, sendAt time.Time) (*types.ScheduledMessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.SendMessageRequest{Content: content, ReplyTo: replyTo, SendAt: &sendAt})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ScheduledMessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SchedulePhoto schedules a photo message to be sent to a conversation at sendAt. replyTo is optional.
+func (c *Client) SchedulePhoto(ctx context.Context, conversationID, filename string, photo io.Reader, replyTo *string, sendAt time.Time) (*types.ScheduledMessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{"sendAt": sendAt.Format(time.RFC3339)}
+	if replyTo != nil {
+		fields["replyTo"] = *replyTo
+	}
+	req, err := multipartRequest(http.MethodPost, path, "photo", filename, photo, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ScheduledMessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ScheduleAlbum schedules one or more photos, with an optional caption (empty for none), to be sent as a single
+// message at sendAt, as SendAlbum does. replyTo is optional.
+func (c *Client) ScheduleAlbum(ctx context.Context, conversationID string, photos []Photo, caption string, replyTo *string, sendAt time.Time) (*types.ScheduledMessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "messages")
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{"sendAt": sendAt.Format(time.RFC3339)}
+	if caption != "" {
+		fields["caption"] = caption
+	}
+	if replyTo != nil {
+		fields["replyTo"] = *replyTo
+	}
+	files := make([]formFile, len(photos))
+	for i, photo := range photos {
+		files[i] = formFile{"photo", photo.Filename, photo.Content}
+	}
+	req, err := multipartFilesRequest(http.MethodPost, path, files, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ScheduledMessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ScheduledMessages returns the pending messages of the logged-in user, the next to be sent first
+func (c *Client) ScheduledMessages(ctx context.Context) ([]types.ScheduledMessageResponse, error) {
+	path, err := c.userPath("scheduled-messages")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ScheduledMessagesResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.ScheduledMessages, nil
+}
+
+// UpdateScheduledMessage changes the text and/or the sending time of a pending message; nil values are left unchanged
+func (c *Client) UpdateScheduledMessage(ctx context.Context, scheduledMessageID string, content *string, sendAt *time.Time) (*types.ScheduledMessageResponse, error) {
+	path, err := c.userPath("scheduled-messages", scheduledMessageID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.UpdateScheduledMessageRequest{Content: content, SendAt: sendAt})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.ScheduledMessageResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CancelScheduledMessage deletes a pending message before it is sent
+func (c *Client) CancelScheduledMessage(ctx context.Context, scheduledMessageID string) error {
+	path, err := c.userPath("scheduled-messages", scheduledMessageID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// Mentions returns up to limit messages mentioning the logged-in user, newest first. If beforeID is not empty, only
+// messages older than that message are returned, to read older pages; a limit of 0 uses the server default.
+func (c *Client) Mentions(ctx context.Context, beforeID string, limit int) ([]types.MentionedMessageResponse, error) {
+	path, err := c.userPath("mentions")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if beforeID != "" {
+		query.Set("before", beforeID)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res types.MentionsResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: query, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Mentions, nil
+}
+
+// StarMessage bookmarks a message for the logged-in user
+func (c *Client) StarMessage(ctx context.Context, messageID string) error {
+	path, err := c.userPath("messages", messageID, "star")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodPut, path: path, auth: true}, nil)
+}
+
+// UnstarMessage removes the bookmark of the logged-in user from a message
+func (c *Client) UnstarMessage(ctx context.Context, messageID string) error {
+	path, err := c.userPath("messages", messageID, "star")
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// StarredMessages returns up to limit messages starred by the logged-in user, most recently starred first. If
+// beforeID is not empty, only messages starred before that message are returned, to read older pages; a limit of 0
+// uses the server default.
+func (c *Client) StarredMessages(ctx context.Context, beforeID string, limit int) ([]types.StarredMessageResponse, error) {
+	path, err := c.userPath("starred")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if beforeID != "" {
+		query.Set("before", beforeID)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res types.StarredMessagesResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: query, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Starred, nil
+}
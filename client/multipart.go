@@ -0,0 +1,53 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+// formFile is a file of a multipart/form-data body
+type formFile struct {
+	field, filename string
+	content         io.Reader
+}
+
+// multipartRequest builds a request with a multipart/form-data body holding one file and optional text fields. The
+// body is fully buffered, so the request can be replayed when retried.
+func multipartRequest(method, path, fileField, filename string, file io.Reader, fields map[string]string) (request, error) {
+	return multipartFilesRequest(method, path, []formFile{{fileField, filename, file}}, fields)
+}
+
+// multipartFilesRequest is like multipartRequest, with several files written in order
+func multipartFilesRequest(method, path string, files []formFile, fields map[string]string) (request, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			return request{}, fmt.Errorf("writing form field %s: %w", name, err)
+		}
+	}
+
+	for _, file := range files {
+		fw, err := mw.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			return request{}, fmt.Errorf("creating form file: %w", err)
+		}
+		if _, err := io.Copy(fw, file.content); err != nil {
+			return request{}, fmt.Errorf("copying %s: %w", file.filename, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return request{}, fmt.Errorf("closing multipart body: %w", err)
+	}
+
+	return request{
+		method:      method,
+		path:        path,
+		body:        buf.Bytes(),
+		contentType: mw.FormDataContentType(),
+		auth:        true,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// CreatePoll sends a poll to a group and returns the poll message
+func (c *Client) CreatePoll(ctx context.Context, conversationID string, poll types.CreatePollRequest) (*types.MessageResponse, error) {
+	path, err := c.userPath("conversations", conversationID, "polls")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, withIdempotencyKey(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// VotePoll sets the options chosen by the logged-in user in a poll, by index, replacing any previous vote. It returns
+// the poll message with the updated results.
+func (c *Client) VotePoll(ctx context.Context, messageID string, options ...int) (*types.MessageResponse, error) {
+	path, err := c.userPath("messages", messageID, "vote")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.VotePollRequest{Options: options})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RetractPollVote removes the vote of the logged-in user from a poll
+func (c *Client) RetractPollVote(ctx context.Context, messageID string) (*types.MessageResponse, error) {
+	path, err := c.userPath("messages", messageID, "vote")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ClosePoll closes a poll created by the logged-in user; votes can no longer be changed
+func (c *Client) ClosePoll(ctx context.Context, messageID string) (*types.MessageResponse, error) {
+	path, err := c.userPath("messages", messageID, "poll", "close")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.MessageResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
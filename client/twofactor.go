@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// CompleteLogin completes the login of a user with two-factor authentication, exchanging the challenge of a
+// *SecondFactorRequiredError and a TOTP or recovery code for a session, which is stored in the client like Login does
+func (c *Client) CompleteLogin(ctx context.Context, challenge, code string) (*types.LoginResponse, error) {
+	req, err := jsonRequest(http.MethodPost, "/session/two-factor", types.CompleteLoginRequest{Challenge: challenge, Code: code})
+	if err != nil {
+		return nil, err
+	}
+	req.auth = false
+
+	var res types.LoginResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	c.SetToken(res.Identifier, res.UserID)
+	return &res, nil
+}
+
+// GetTwoFactor returns the two-factor authentication settings of the logged-in user
+func (c *Client) GetTwoFactor(ctx context.Context) (*types.TwoFactorResponse, error) {
+	path, err := c.userPath("two-factor")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.TwoFactorResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the logged-in user, to add to an authenticator app (e.g., by showing
+// the otpauth URI as a QR code). Two-factor authentication is enabled by EnableTwoFactor.
+func (c *Client) EnrollTwoFactor(ctx context.Context) (*types.TwoFactorEnrollmentResponse, error) {
+	path, err := c.userPath("two-factor")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.TwoFactorEnrollmentResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// EnableTwoFactor confirms the enrollment with a code of the authenticator app and returns the recovery codes, which
+// the server does not show again. Every other session of the user is logged out.
+func (c *Client) EnableTwoFactor(ctx context.Context, code string) ([]string, error) {
+	path, err := c.userPath("two-factor", "activate")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.TwoFactorCodeRequest{Code: code})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.RecoveryCodesResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return res.RecoveryCodes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off with a TOTP or recovery code. A pending enrollment is cancelled
+// with an empty code.
+func (c *Client) DisableTwoFactor(ctx context.Context, code string) error {
+	path, err := c.userPath("two-factor")
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(http.MethodDelete, path, types.TwoFactorCodeRequest{Code: code})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// Liveness checks whether the API server is able to serve requests
+func (c *Client) Liveness(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodGet, path: "/liveness"}, nil)
+}
+
+// Login logs in (or registers) the user with the given name. On success, the session token and user identifier are
+// stored in the client and used for all subsequent requests. Users with two-factor authentication get a
+// *SecondFactorRequiredError, and log in with CompleteLogin.
+func (c *Client) Login(ctx context.Context, name string) (*types.LoginResponse, error) {
+	return c.login(ctx, "/session", types.LoginRequest{Name: name})
+}
+
+// LoginWithPassword is like Login for accounts secured with a password. Registering this way secures the new account.
+// Servers not allowing passwords ignore it.
+func (c *Client) LoginWithPassword(ctx context.Context, name, password string) (*types.LoginResponse, error) {
+	return c.login(ctx, "/session", types.LoginRequest{Name: name, Password: &password})
+}
+
+// StartOIDCLogin starts a single sign-on login. The user logs in at the returned authorization URL, and the identity
+// provider sends them back to the redirect URL of the server with the code and the state for CompleteOIDCLogin.
+func (c *Client) StartOIDCLogin(ctx context.Context) (*types.OIDCLoginResponse, error) {
+	var res types.OIDCLoginResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/session/oidc"}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CompleteOIDCLogin completes a single sign-on login with the code and the state the identity provider sent the user
+// back with, storing the session in the client like Login does
+func (c *Client) CompleteOIDCLogin(ctx context.Context, code, state string) (*types.LoginResponse, error) {
+	return c.login(ctx, "/session/oidc/callback", types.CompleteOIDCLoginRequest{Code: code, State: state})
+}
+
+// Logout revokes the session of the client, which is cleared
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, request{method: http.MethodDelete, path: "/session", auth: true}, nil); err != nil {
+		return err
+	}
+	c.SetToken("", "")
+	return nil
+}
+
+func (c *Client) login(ctx context.Context, path string, body interface{}) (*types.LoginResponse, error) {
+	req, err := jsonRequest(http.MethodPost, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.auth = false
+
+	// Users with two-factor authentication get a challenge instead of a session
+	var res struct {
+		types.LoginResponse
+		types.LoginChallengeResponse
+	}
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	if res.Challenge != "" {
+		return nil, &SecondFactorRequiredError{Challenge: res.Challenge, ExpiresAt: res.ExpiresAt}
+	}
+	c.SetToken(res.Identifier, res.UserID)
+	return &res.LoginResponse, nil
+}
+
+// SearchUsers searches users whose username contains query. The logged-in user is excluded from results.
+func (c *Client) SearchUsers(ctx context.Context, query string) ([]types.UserResponse, error) {
+	req := request{method: http.MethodGet, path: "/users", query: url.Values{"q": {query}}, auth: true}
+
+	var res types.SearchUsersResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return res.Users, nil
+}
+
+// GetUserProfile returns the profile of the user with the given identifier
+func (c *Client) GetUserProfile(ctx context.Context, userID string) (*types.UserResponse, error) {
+	req := request{method: http.MethodGet, path: pathOf("users", userID), auth: true}
+
+	var res types.UserResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SetMyUserName changes the username of the logged-in user
+func (c *Client) SetMyUserName(ctx context.Context, name string) error {
+	path, err := c.userPath("username")
+	if err != nil {
+		return err
+	}
+	req, err := jsonRequest(http.MethodPut, path, types.UpdateUsernameRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// SetMyPassword secures the account of the logged-in user with a password, or changes it. currentPassword is required
+// (non-empty) for accounts already secured. Every other session of the user is logged out.
+func (c *Client) SetMyPassword(ctx context.Context, currentPassword, newPassword string) error {
+	path, err := c.userPath("password")
+	if err != nil {
+		return err
+	}
+	body := types.SetPasswordRequest{NewPassword: newPassword}
+	if currentPassword != "" {
+		body.CurrentPassword = &currentPassword
+	}
+	req, err := jsonRequest(http.MethodPut, path, body)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// SetMyPhoto uploads a new profile photo for the logged-in user. filename is used by the server to check the image
+// type (JPG, PNG, GIF or WebP).
+func (c *Client) SetMyPhoto(ctx context.Context, filename string, photo io.Reader) error {
+	path, err := c.userPath("photo")
+	if err != nil {
+		return err
+	}
+	req, err := multipartRequest(http.MethodPut, path, "photo", filename, photo, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// DeleteAccount permanently deletes the account of the logged-in user and forgets the session token, which the server
+// revokes
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	path, err := c.userPath()
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil); err != nil {
+		return err
+	}
+	c.SetToken("", "")
+	return nil
+}
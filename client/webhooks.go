@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// ErrInvalidSignature is returned by VerifyWebhook when a delivery was not signed with the secret of the webhook
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// ErrStaleWebhook is returned by VerifyWebhook when the timestamp of a delivery is too far from the current time,
+// e.g. because the delivery is being replayed
+var ErrStaleWebhook = errors.New("stale webhook delivery")
+
+// WebhookTolerance is the maximum difference between the timestamp of a delivery and the current time accepted by
+// VerifyWebhook
+const WebhookTolerance = 5 * time.Minute
+
+// CreateWebhook registers a webhook receiving the given events (e.g., "message.created"). If conversationID is nil
+// the webhook receives the events of all the direct conversations of the logged-in user. The secret used to sign the
+// deliveries is returned only here.
+func (c *Client) CreateWebhook(ctx context.Context, webhookURL string, conversationID *string, events []string) (*types.WebhookResponse, error) {
+	path, err := c.userPath("webhooks")
+	if err != nil {
+		return nil, err
+	}
+	req, err := jsonRequest(http.MethodPost, path, types.CreateWebhookRequest{
+		URL:            webhookURL,
+		ConversationID: conversationID,
+		Events:         events,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.WebhookResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Webhooks returns the webhooks registered by the logged-in user
+func (c *Client) Webhooks(ctx context.Context) ([]types.WebhookResponse, error) {
+	path, err := c.userPath("webhooks")
+	if err != nil {
+		return nil, err
+	}
+
+	var res types.WebhooksResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook with its pending deliveries
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	path, err := c.userPath("webhooks", webhookID)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, request{method: http.MethodDelete, path: path, auth: true}, nil)
+}
+
+// WebhookDeliveries returns up to limit recent deliveries of a webhook, newest first; a limit of 0 uses the server
+// default
+func (c *Client) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]types.WebhookDeliveryResponse, error) {
+	path, err := c.userPath("webhooks", webhookID, "deliveries")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res types.WebhookDeliveriesResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: query, auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Deliveries, nil
+}
+
+// VerifyWebhook checks the signature of a webhook delivery received by a webhook server: body is the raw request
+// body, timestamp and signature the values of its types.WebhookTimestampHeader and types.WebhookSignatureHeader
+// headers. Deliveries whose timestamp is more than WebhookTolerance away from the current time are rejected with
+// ErrStaleWebhook, so that a captured delivery cannot be replayed.
+func VerifyWebhook(secret string, body []byte, timestamp, signature string) error {
+	digest, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(digest, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	// The timestamp is trusted only once the signature is valid
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > WebhookTolerance || age < -WebhookTolerance {
+		return ErrStaleWebhook
+	}
+	return nil
+}
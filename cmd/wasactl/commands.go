@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/export"
+)
+
+// environment holds what commands need to run
+type environment struct {
+	db             database.AppDatabase
+	out            *printer
+	uploadsDir     string
+	attachmentsDir string
+	limit          int
+	policy         database.DeletionPolicy
+}
+
+// command is a wasactl subcommand with its fixed number of positional arguments
+type command struct {
+	args int
+	run  func(env *environment, args []string) error
+}
+
+var commands = map[string]command{
+	"users":           {0, listUsers},
+	"search":          {1, searchUsers},
+	"user":            {1, showUser},
+	"conversations":   {1, listConversations},
+	"sessions":        {1, listSessions},
+	"revoke-sessions": {1, revokeSessions},
+	"revoke-session":  {1, revokeSession},
+	"rename":          {2, renameUser},
+	"delete-user":     {1, deleteUser},
+	"members":         {1, listMembers},
+	"set-owner":       {2, setOwner},
+	"stats":           {0, showStats},
+
+	"export-conversation": {2, exportConversation},
+}
+
+// usernamePattern mirrors the username rules enforced by the API
+var usernamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]{3,16}$")
+
+// userRow is the output format of a user
+type userRow struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	PhotoURL  *string   `json:"photoUrl,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// sessionRow is the output format of a session. Only the hash of the token is stored, and it is truncated: operators
+// only need to tell sessions apart.
+type sessionRow struct {
+	TokenHashPrefix string    `json:"tokenHashPrefix"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// resolveUser finds a user by identifier first, then by username
+func resolveUser(db database.AppDatabase, ref string) (*database.User, error) {
+	user, err := db.GetUserByID(ref)
+	if err == nil {
+		return user, nil
+	}
+	user, err = db.GetUserByUsername(ref)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", ref, err)
+	}
+	return user, nil
+}
+
+func printUsers(env *environment, users []database.User) error {
+	out := make([]userRow, len(users))
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		out[i] = userRow{ID: u.ID, Username: u.Username, PhotoURL: u.PhotoURL, CreatedAt: u.CreatedAt}
+		rows[i] = []string{u.ID, u.Username, formatOptional(u.PhotoURL), formatTime(u.CreatedAt)}
+	}
+	return env.out.table(out, []string{"ID", "USERNAME", "PHOTO", "CREATED"}, rows)
+}
+
+func listUsers(env *environment, _ []string) error {
+	users, err := env.db.ListUsers(env.limit, 0)
+	if err != nil {
+		return err
+	}
+	return printUsers(env, users)
+}
+
+func searchUsers(env *environment, args []string) error {
+	users, err := env.db.SearchUsers(args[0], "")
+	if err != nil {
+		return err
+	}
+	return printUsers(env, users)
+}
+
+func showUser(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	return printUsers(env, []database.User{*user})
+}
+
+func listConversations(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	conversations, err := env.db.GetUserConversations(user.ID)
+	if err != nil {
+		return err
+	}
+	if len(conversations) > env.limit {
+		conversations = conversations[:env.limit]
+	}
+
+	rows := make([][]string, len(conversations))
+	for i, c := range conversations {
+		rows[i] = []string{c.ID, c.Type, formatOptional(c.Name), formatTime(c.LastMessageAt), strconv.Itoa(c.UnreadCount)}
+	}
+	return env.out.table(conversations, []string{"ID", "TYPE", "NAME", "LAST MESSAGE", "UNREAD"}, rows)
+}
+
+func listSessions(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	sessions, err := env.db.GetUserSessions(user.ID)
+	if err != nil {
+		return err
+	}
+
+	out := make([]sessionRow, len(sessions))
+	rows := make([][]string, len(sessions))
+	for i, s := range sessions {
+		prefix := s.TokenHash
+		if len(prefix) > 8 {
+			prefix = prefix[:8] + "..."
+		}
+		out[i] = sessionRow{TokenHashPrefix: prefix, CreatedAt: s.CreatedAt}
+		rows[i] = []string{prefix, formatTime(s.CreatedAt)}
+	}
+	return env.out.table(out, []string{"TOKEN HASH", "CREATED"}, rows)
+}
+
+func revokeSessions(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	revoked, err := env.db.DeleteUserSessions(user.ID)
+	if err != nil {
+		return err
+	}
+	return env.out.message(map[string]interface{}{"userId": user.ID, "revoked": revoked},
+		"revoked %d session(s) of %s", revoked, user.Username)
+}
+
+func revokeSession(env *environment, args []string) error {
+	// sessions prints truncated hashes as "1a2b3c4d...", so they can be pasted as they are
+	if err := env.db.DeleteUserSessionByHash(strings.TrimSuffix(args[0], "...")); err != nil {
+		return err
+	}
+	return env.out.message(map[string]interface{}{"revoked": 1}, "session revoked")
+}
+
+func renameUser(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	if !usernamePattern.MatchString(args[1]) {
+		return fmt.Errorf("invalid username %q: 3-16 letters, numbers, underscores or hyphens", args[1])
+	}
+	if err := env.db.UpdateUsername(user.ID, args[1]); err != nil {
+		return err
+	}
+	return env.out.message(map[string]string{"id": user.ID, "username": args[1]},
+		"renamed %s to %s", user.Username, args[1])
+}
+
+func deleteUser(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[0])
+	if err != nil {
+		return err
+	}
+	deleted, err := env.db.DeleteUserAndBots(user.ID, env.policy)
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, url := range deleted.MediaURLs {
+		path, err := export.MediaPath(env.uploadsDir, url)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing media: %w", err)
+		} else if err == nil {
+			removed++
+		}
+	}
+
+	return env.out.message(deleted,
+		"deleted user %s (%s): %d session(s) revoked, %d message(s) deleted, %d message(s) anonymised, "+
+			"%d group(s) handed off, %d conversation(s) deleted, %d bot(s) deleted, %d file(s) removed",
+		user.Username, user.ID, deleted.SessionsRevoked, deleted.MessagesDeleted, deleted.MessagesAnonymized,
+		deleted.GroupsHandedOff, deleted.ConversationsDeleted, len(deleted.BotsDeleted), removed)
+}
+
+func listMembers(env *environment, args []string) error {
+	group, err := env.db.GetConversation(args[0], "")
+	if err != nil {
+		return err
+	}
+	if group.Type != database.ConversationTypeGroup {
+		return fmt.Errorf("conversation %s is not a group", group.ID)
+	}
+
+	out := make([]userRow, len(group.Participants))
+	rows := make([][]string, len(group.Participants))
+	for i, u := range group.Participants {
+		role := "member"
+		if group.CreatedBy != nil && *group.CreatedBy == u.ID {
+			role = "owner"
+		}
+		out[i] = userRow{ID: u.ID, Username: u.Username, PhotoURL: u.PhotoURL, CreatedAt: u.CreatedAt}
+		rows[i] = []string{u.ID, u.Username, role}
+	}
+	return env.out.table(out, []string{"ID", "USERNAME", "ROLE"}, rows)
+}
+
+func setOwner(env *environment, args []string) error {
+	user, err := resolveUser(env.db, args[1])
+	if err != nil {
+		return err
+	}
+	if err := env.db.UpdateGroupOwner(args[0], user.ID); err != nil {
+		return err
+	}
+	return env.out.message(map[string]string{"groupId": args[0], "ownerId": user.ID},
+		"%s is now the owner of group %s", user.Username, args[0])
+}
+
+// mediaUsage is the disk usage of one uploads category
+type mediaUsage struct {
+	Category string `json:"category"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+func showStats(env *environment, _ []string) error {
+	stats, err := env.db.GetDatabaseStats(env.limit)
+	if err != nil {
+		return err
+	}
+	usage, err := diskUsage(env.uploadsDir, env.attachmentsDir)
+	if err != nil {
+		return err
+	}
+
+	if env.out.json {
+		return env.out.encode(struct {
+			*database.DatabaseStats
+			DiskUsage []mediaUsage `json:"diskUsage"`
+		}{stats, usage})
+	}
+
+	tables := make([]string, 0, len(stats.TableCounts))
+	for table := range stats.TableCounts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	rows := make([][]string, 0, len(tables))
+	for _, table := range tables {
+		rows = append(rows, []string{table, strconv.FormatInt(stats.TableCounts[table], 10)})
+	}
+	if err := env.out.table(nil, []string{"TABLE", "ROWS"}, rows); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(env.out.w)
+
+	rows = rows[:0]
+	for _, c := range stats.LargestConversations {
+		rows = append(rows, []string{c.ID, c.Type, formatOptional(c.Name),
+			strconv.FormatInt(c.MessageCount, 10), strconv.FormatInt(c.ParticipantCount, 10)})
+	}
+	if err := env.out.table(nil, []string{"CONVERSATION", "TYPE", "NAME", "MESSAGES", "MEMBERS"}, rows); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(env.out.w)
+
+	referenced := map[string]int64{
+		"profiles":    stats.Media.ProfilePhotos,
+		"groups":      stats.Media.GroupPhotos,
+		"messages":    stats.Media.MessagePhotos,
+		"attachments": stats.Media.Attachments,
+	}
+	rows = rows[:0]
+	for _, u := range usage {
+		rows = append(rows, []string{u.Category, strconv.FormatInt(referenced[u.Category], 10),
+			strconv.FormatInt(u.Files, 10), formatBytes(u.Bytes)})
+	}
+	return env.out.table(nil, []string{"MEDIA", "REFERENCED", "FILES", "SIZE"}, rows)
+}
+
+// diskUsage walks each uploads category and the attachments directory, and sums the size of their files
+func diskUsage(uploadsDir, attachmentsDir string) ([]mediaUsage, error) {
+	categories := []string{"profiles", "groups", "messages", "attachments"}
+	dirs := map[string]string{
+		"profiles":    filepath.Join(uploadsDir, "profiles"),
+		"groups":      filepath.Join(uploadsDir, "groups"),
+		"messages":    filepath.Join(uploadsDir, "messages"),
+		"attachments": attachmentsDir,
+	}
+	usage := make([]mediaUsage, 0, len(categories))
+
+	for _, category := range categories {
+		u := mediaUsage{Category: category}
+		err := filepath.WalkDir(dirs[category], func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			u.Files++
+			u.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("computing disk usage of %s: %w", category, err)
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, nil
+}
+
+// createOutput opens the destination of an archive: a new file, or standard output for "-"
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func exportConversation(env *environment, args []string) error {
+	out, err := createOutput(args[1])
+	if err != nil {
+		return err
+	}
+
+	exporter := &export.Exporter{DB: env.db, MediaDir: env.uploadsDir, AttachmentDir: env.attachmentsDir}
+	if err := exporter.WriteConversation(out, args[0]); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if args[1] == "-" {
+		return nil
+	}
+	return env.out.message(map[string]string{"conversationId": args[0], "file": args[1]},
+		"conversation %s exported to %s", args[0], args[1])
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newEnvironment opens a new database and returns an environment printing tables to out
+func newEnvironment(t *testing.T, out *bytes.Buffer) *environment {
+	t.Helper()
+	dir := t.TempDir()
+	dbconn, err := sql.Open("sqlite3", filepath.Join(dir, "wasa.db"))
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { _ = dbconn.Close() })
+	db, err := database.New(dbconn)
+	if err != nil {
+		t.Fatalf("creating AppDatabase: %v", err)
+	}
+	return &environment{
+		db:             db,
+		out:            newPrinter(out, "table"),
+		uploadsDir:     filepath.Join(dir, "uploads"),
+		attachmentsDir: filepath.Join(dir, "attachments"),
+		limit:          50,
+		policy:         database.DeletionPolicyAnonymize,
+	}
+}
+
+// newUser creates a user with the given number of sessions
+func newUser(t *testing.T, env *environment, username string, sessions int) *database.User {
+	t.Helper()
+	user, err := env.db.CreateUser(username)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for i := 0; i < sessions; i++ {
+		if _, err := env.db.CreateUserSession(user.ID); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+	}
+	return user
+}
+
+func TestRevokeSession(t *testing.T) {
+	var out bytes.Buffer
+	env := newEnvironment(t, &out)
+	user := newUser(t, env, "alice", 2)
+
+	// 1. The truncated hash printed by sessions revokes that session only
+	out.Reset()
+	if err := listSessions(env, []string{"alice"}); err != nil {
+		t.Fatalf("sessions: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("sessions printed %q, want a header and two sessions", out.String())
+	}
+	printed := strings.Fields(lines[1])[0]
+	if err := revokeSession(env, []string{printed}); err != nil {
+		t.Fatalf("revoke-session %s: %v", printed, err)
+	}
+	sessions, err := env.db.GetUserSessions(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserSessions: %v", err)
+	}
+	if len(sessions) != 1 || strings.HasPrefix(sessions[0].TokenHash, strings.TrimSuffix(printed, "...")) {
+		t.Fatalf("sessions after revoking %s: %+v", printed, sessions)
+	}
+
+	// 2. So does the full hash
+	if err := revokeSession(env, []string{sessions[0].TokenHash}); err != nil {
+		t.Fatalf("revoke-session with the full hash: %v", err)
+	}
+	if err := revokeSession(env, []string{sessions[0].TokenHash}); err == nil {
+		t.Fatal("revoke-session of a revoked session succeeded")
+	}
+	if sessions, err := env.db.GetUserSessions(user.ID); err != nil || len(sessions) != 0 {
+		t.Fatalf("sessions after revoking all: %+v, %v", sessions, err)
+	}
+}
+
+func TestRevokeSessionAmbiguousPrefix(t *testing.T) {
+	var out bytes.Buffer
+	env := newEnvironment(t, &out)
+
+	// 17 sessions have at least two hashes with the same first digit
+	user := newUser(t, env, "alice", 17)
+	sessions, err := env.db.GetUserSessions(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserSessions: %v", err)
+	}
+	seen := map[string]bool{}
+	var prefix string
+	for _, s := range sessions {
+		if seen[s.TokenHash[:1]] {
+			prefix = s.TokenHash[:1]
+			break
+		}
+		seen[s.TokenHash[:1]] = true
+	}
+
+	for _, arg := range []string{prefix, "", "...", "not-a-hash"} {
+		if err := revokeSession(env, []string{arg}); err == nil {
+			t.Errorf("revoke-session %q succeeded", arg)
+		}
+	}
+	if after, err := env.db.GetUserSessions(user.ID); err != nil || len(after) != len(sessions) {
+		t.Fatalf("failed revokes left %d sessions (%v), want %d", len(after), err, len(sessions))
+	}
+}
+
+func TestDeleteUserDeletesBots(t *testing.T) {
+	var out bytes.Buffer
+	env := newEnvironment(t, &out)
+	alice := newUser(t, env, "alice", 1)
+	bob := newUser(t, env, "bobby", 1)
+	bot, token, err := env.db.CreateBot(alice.ID, "alice_bot")
+	if err != nil {
+		t.Fatalf("CreateBot: %v", err)
+	}
+	other, _, err := env.db.CreateBot(bob.ID, "bobby_bot")
+	if err != nil {
+		t.Fatalf("CreateBot: %v", err)
+	}
+
+	// The photo of the bot is removed with it
+	if err := os.MkdirAll(env.uploadsDir, 0o755); err != nil {
+		t.Fatalf("creating uploads directory: %v", err)
+	}
+	photo := filepath.Join(env.uploadsDir, "bot.png")
+	if err := os.WriteFile(photo, []byte("photo"), 0o600); err != nil {
+		t.Fatalf("writing photo: %v", err)
+	}
+	if err := env.db.UpdateUserPhoto(bot.ID, "/uploads/bot.png"); err != nil {
+		t.Fatalf("UpdateUserPhoto: %v", err)
+	}
+
+	if err := deleteUser(env, []string{"alice"}); err != nil {
+		t.Fatalf("delete-user: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 bot(s) deleted, 1 file(s) removed") {
+		t.Fatalf("delete-user printed %q, want one bot and its photo", out.String())
+	}
+	if _, err := env.db.GetUserByID(bot.ID); err == nil {
+		t.Fatal("the bot of the deleted user still exists")
+	}
+	if _, err := env.db.GetUserByToken(token); err == nil {
+		t.Fatal("the token of the deleted bot still works")
+	}
+	if _, err := os.Stat(photo); !os.IsNotExist(err) {
+		t.Fatalf("photo of the deleted bot: %v, want it removed", err)
+	}
+
+	// The bots of other users are left alone
+	if _, err := env.db.GetUserByID(other.ID); err != nil {
+		t.Fatalf("GetUserByID of the bot of another user: %v", err)
+	}
+}
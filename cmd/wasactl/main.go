@@ -0,0 +1,143 @@
+/*
+Wasactl is the administrative command line tool for WASAText operators. It opens the SQLite database of a deployment
+through database.AppDatabase and allows inspecting and fixing users, sessions and groups without touching the file by
+hand.
+
+Usage:
+
+	wasactl [flags] <command> [arguments]
+
+The flags are:
+
+	-db <path>
+		Path of the SQLite database file (default: /tmp/decaf.db).
+	-uploads <path>
+		Path of the uploads directory, used to compute media disk usage and to remove the media of deleted users
+		(default: tmp/uploads).
+	-attachments <path>
+		Path of the attachments directory, used to compute attachments disk usage and to export the files attached
+		to messages (default: tmp/attachments).
+	-format <table|json>
+		Output format (default: table).
+	-limit <n>
+		Maximum number of rows for listing commands (default: 50).
+	-policy <anonymize|delete>
+		What delete-user does with the messages of the user (default: anonymize).
+
+The commands are:
+
+	users                       list users
+	search <query>              search users by username
+	user <user>                 show a user
+	conversations <user>        list the conversations of a user
+	sessions <user>             list the sessions of a user
+	revoke-sessions <user>      revoke all sessions of a user
+	revoke-session <hash>       revoke a single session by its token hash, or a unique prefix of it
+	rename <user> <username>    change the username of a user
+	delete-user <user>          delete a user, their bots, reactions, sessions and media, handing off their groups
+	members <groupId>           list the members of a group
+	set-owner <groupId> <user>  transfer the ownership of a group
+	stats                       print database statistics
+	export-conversation <conversationId> <file>
+	                            export a conversation as a ZIP archive ("-" for standard output)
+
+A <user> argument can be either a user identifier or a username.
+
+Return values (exit codes):
+
+	0
+		The command completed successfully
+
+	> 0
+		The command failed (invalid arguments, missing records, database errors)
+*/
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// errUsage is returned when the command line is not valid
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "error: ", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the command line, opens the database and executes the requested command
+func run() error {
+	var dbPath = flag.String("db", "/tmp/decaf.db", "path of the SQLite database file")
+	var uploadsDir = flag.String("uploads", "tmp/uploads", "path of the uploads directory")
+	var attachmentsDir = flag.String("attachments", "tmp/attachments", "path of the attachments directory")
+	var format = flag.String("format", "table", "output format: table or json")
+	var limit = flag.Int("limit", 50, "maximum number of rows for listing commands")
+	var policy = flag.String("policy", "anonymize", "what delete-user does with messages: anonymize or delete")
+
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Usage: wasactl [flags] <command> [arguments]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		return fmt.Errorf("%w: missing command", errUsage)
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	if *limit < 1 {
+		return fmt.Errorf("%w: limit must be positive", errUsage)
+	}
+	deletionPolicy := database.DeletionPolicy(*policy)
+	if deletionPolicy != database.DeletionPolicyAnonymize && deletionPolicy != database.DeletionPolicyDelete {
+		return fmt.Errorf("%w: unknown policy %q", errUsage, *policy)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q", errUsage, flag.Arg(0))
+	}
+	args := flag.Args()[1:]
+	if len(args) != cmd.args {
+		return fmt.Errorf("%w: %s expects %d argument(s)", errUsage, flag.Arg(0), cmd.args)
+	}
+
+	// Refuse to create an empty database when the path is wrong
+	if _, err := os.Stat(*dbPath); err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+
+	dbconn, err := sql.Open("sqlite3", *dbPath)
+	if err != nil {
+		return fmt.Errorf("opening SQLite: %w", err)
+	}
+	defer func() { _ = dbconn.Close() }()
+
+	db, err := database.New(dbconn)
+	if err != nil {
+		return fmt.Errorf("creating AppDatabase: %w", err)
+	}
+
+	env := &environment{
+		db:             db,
+		out:            newPrinter(os.Stdout, *format),
+		uploadsDir:     *uploadsDir,
+		attachmentsDir: *attachmentsDir,
+		limit:          *limit,
+		policy:         deletionPolicy,
+	}
+	return cmd.run(env, args)
+}
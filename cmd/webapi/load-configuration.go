@@ -22,11 +22,64 @@ type WebAPIConfiguration struct {
 		ReadTimeout     time.Duration `conf:"default:5s"`
 		WriteTimeout    time.Duration `conf:"default:5s"`
 		ShutdownTimeout time.Duration `conf:"default:5s"`
+
+		// ValidateRequests rejects requests not matching doc/api.yaml; responses are validated too in debug mode
+		ValidateRequests bool
 	}
 	Debug bool
 	DB    struct {
 		Filename string `conf:"default:/tmp/decaf.db"`
 	}
+	Accounts struct {
+		DeletionPolicy string `conf:"default:anonymize"`
+		// Passwords lets users secure their accounts with a password; accounts without one keep logging in by name
+		Passwords bool `conf:"default:false"`
+	}
+	OIDC struct {
+		// Issuer enables single sign-on with the OpenID Connect provider at this URL, registered with the client
+		// credentials below; users are sent back to RedirectURL, where the web UI completes the login
+		Issuer       string
+		ClientID     string
+		ClientSecret string `conf:"mask"`
+		RedirectURL  string
+	}
+	Scheduler struct {
+		// Interval is how often scheduled messages that are due are delivered
+		Interval time.Duration `conf:"default:5s"`
+	}
+	Reaper struct {
+		// Interval is how often expired disappearing messages are deleted
+		Interval time.Duration `conf:"default:1m"`
+	}
+	LinkPreviews struct {
+		// Enabled fetches the pages linked in messages to show their previews
+		Enabled bool `conf:"default:true"`
+
+		// Timeout and MaxSize limit the time spent and the bytes read fetching a page
+		Timeout time.Duration `conf:"default:5s"`
+		MaxSize int64         `conf:"default:524288"`
+	}
+	Webhooks struct {
+		// Interval is how often pending webhook deliveries are sent
+		Interval time.Duration `conf:"default:5s"`
+	}
+	Idempotency struct {
+		// Window is how long the responses of requests sent with an idempotency key are replayed
+		Window time.Duration `conf:"default:24h"`
+	}
+	Sessions struct {
+		// CacheSize and CacheTTL bound the session tokens cached in memory; sessions revoked with wasactl stop working
+		// within CacheTTL
+		CacheSize int           `conf:"default:10000"`
+		CacheTTL  time.Duration `conf:"default:30s"`
+	}
+	Attachments struct {
+		// MaxSize is the size of the largest file that can be attached to a message, in bytes
+		MaxSize int64 `conf:"default:26214400"`
+
+		// Types lists the allowed MIME types (e.g., "application/pdf,audio/*"); any type is allowed if empty
+		Types []string
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
@@ -37,6 +37,8 @@ import (
 	"github.com/Daniel200273/WASA-project/service/api"
 	"github.com/Daniel200273/WASA-project/service/database"
 	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/linkpreview"
+	"github.com/Daniel200273/WASA-project/service/oidc"
 	"github.com/ardanlabs/conf"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
@@ -124,10 +126,48 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	// Link previews are fetched only if enabled
+	var linkPreviews linkpreview.Fetcher
+	if cfg.LinkPreviews.Enabled {
+		linkPreviews = linkpreview.New(linkpreview.Config{
+			Timeout:     cfg.LinkPreviews.Timeout,
+			MaxBodySize: cfg.LinkPreviews.MaxSize,
+		})
+	}
+
+	// Single sign-on is enabled only if an identity provider is configured
+	var oidcProvider oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		oidcProvider, err = oidc.New(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		if err != nil {
+			logger.WithError(err).Error("error configuring single sign-on")
+			return fmt.Errorf("configuring single sign-on: %w", err)
+		}
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                logger,
+		Database:              db,
+		AccountDeletionPolicy: database.DeletionPolicy(cfg.Accounts.DeletionPolicy),
+		Passwords:             cfg.Accounts.Passwords,
+		OIDC:                  oidcProvider,
+		ValidateRequests:      cfg.Web.ValidateRequests,
+		ValidateResponses:     cfg.Debug,
+		SchedulerInterval:     cfg.Scheduler.Interval,
+		ReaperInterval:        cfg.Reaper.Interval,
+		LinkPreviews:          linkPreviews,
+		WebhookInterval:       cfg.Webhooks.Interval,
+		IdempotencyWindow:     cfg.Idempotency.Window,
+		SessionCacheSize:      cfg.Sessions.CacheSize,
+		SessionCacheTTL:       cfg.Sessions.CacheTTL,
+		AttachmentMaxSize:     cfg.Attachments.MaxSize,
+		AttachmentTypes:       cfg.Attachments.Types,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
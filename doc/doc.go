@@ -0,0 +1,14 @@
+/*
+Package doc embeds the OpenAPI specification of the WASAText API, so that the executables can serve it and validate
+traffic against it without reading files at runtime.
+*/
+package doc
+
+import (
+	_ "embed"
+)
+
+// OpenAPI is the content of api.yaml
+//
+//go:embed api.yaml
+var OpenAPI []byte
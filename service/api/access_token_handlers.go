@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Scopes of personal access tokens. Each route declares in Handler the scope a token needs to call it; routes without
+// a scope (e.g., account settings and the management of the tokens themselves) are reserved to sessions.
+const (
+	scopeReadUsers          = "read:users"
+	scopeReadConversations  = "read:conversations"
+	scopeWriteConversations = "write:conversations"
+	scopeWriteMessages      = "write:messages"
+	scopeManageGroups       = "manage:groups"
+	scopeManageWebhooks     = "manage:webhooks"
+	scopeManageBots         = "manage:bots"
+)
+
+// accessTokenScopes lists the scopes personal access tokens can be granted
+var accessTokenScopes = []string{
+	scopeReadUsers, scopeReadConversations, scopeWriteConversations, scopeWriteMessages, scopeManageGroups,
+	scopeManageWebhooks, scopeManageBots,
+}
+
+// accessTokenPrefix starts every personal access token, telling them apart from session tokens (and making leaked
+// tokens easy to find)
+const accessTokenPrefix = "wasa_pat_"
+
+// maxAccessTokensPerUser is the maximum number of personal access tokens a user can have
+const maxAccessTokensPerUser = 20
+
+// maxAccessTokenLifetime is the latest expiry of a personal access token, from its creation
+const maxAccessTokenLifetime = 366 * 24 * time.Hour
+
+// maxAccessTokenNameLength is the longest name of a personal access token
+const maxAccessTokenNameLength = 64
+
+// accessTokenTouchInterval is how often the last use of a personal access token is recorded, to avoid a write on each
+// request
+const accessTokenTouchInterval = time.Minute
+
+// createAccessToken handles creating a personal access token of the user, limited to some scopes
+func (rt *_router) createAccessToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only create your own access tokens", ctx)
+		return
+	}
+
+	// 2. Parse and validate request body
+	var req types.CreateAccessTokenRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAccessTokenNameLength {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("name must be between 1 and %d characters", maxAccessTokenNameLength), ctx)
+		return
+	}
+	scopes, err := validateScopes(req.Scopes)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	now := globaltime.Now()
+	if req.ExpiresAt != nil && (!req.ExpiresAt.After(now) || req.ExpiresAt.After(now.Add(maxAccessTokenLifetime))) {
+		sendErrorResponse(w, http.StatusBadRequest, "expiresAt must be in the future, within a year", ctx)
+		return
+	}
+
+	// 3. Bots authenticate with their bot token only
+	user, err := rt.db.GetUserByID(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get user")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create access token", ctx)
+		return
+	}
+	if user.IsBot {
+		sendErrorResponse(w, http.StatusForbidden, "Bots cannot have access tokens", ctx)
+		return
+	}
+
+	// 4. Generate the token and store its hash
+	token, err := generateAccessToken()
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to generate access token")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create access token", ctx)
+		return
+	}
+	accessToken, err := rt.db.CreateAccessToken(userID, req.Name, hashAccessToken(token), scopes, req.ExpiresAt, maxAccessTokensPerUser)
+	if err != nil {
+		if strings.Contains(err.Error(), "limit reached") {
+			sendErrorResponse(w, http.StatusConflict, "Too many access tokens, revoke one first", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to create access token")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create access token", ctx)
+		return
+	}
+
+	// 5. Return the token, which is never shown again
+	response := toAccessTokenResponse(*accessToken)
+	response.Token = token
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send access token response")
+	}
+	ctx.Logger.Info("Access token created successfully", "tokenID", accessToken.ID)
+}
+
+// getAccessTokens handles listing the personal access tokens of the user
+func (rt *_router) getAccessTokens(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own access tokens", ctx)
+		return
+	}
+
+	// 2. Get the tokens from database
+	tokens, err := rt.db.GetUserAccessTokens(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get access tokens")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get access tokens", ctx)
+		return
+	}
+
+	// 3. Convert to response format
+	response := types.AccessTokensResponse{
+		Tokens: make([]types.AccessTokenResponse, len(tokens)),
+	}
+	for i, token := range tokens {
+		response.Tokens[i] = toAccessTokenResponse(token)
+	}
+
+	// 4. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send access tokens response")
+	}
+}
+
+// revokeAccessToken handles deleting a personal access token of the user, which stops working at once
+func (rt *_router) revokeAccessToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only revoke your own access tokens", ctx)
+		return
+	}
+
+	// 2. Validate tokenId format
+	tokenID := ps.ByName("tokenId")
+	if err := validateID(tokenID, "tokenId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Delete the token
+	if err := rt.db.DeleteAccessToken(tokenID, userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Access token not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to revoke access token")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke access token", ctx)
+		}
+		return
+	}
+
+	// 4. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Access token revoked successfully", "tokenID", tokenID)
+}
+
+// validateScopes checks that the requested scopes exist, returning them without duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	var valid []string
+	for _, scope := range scopes {
+		if !hasScope(accessTokenScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	return valid, nil
+}
+
+// hasScope reports whether scopes contains scope
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsScope reports whether the scopes granted to a personal access token include one of the scopes of a route
+func grantsScope(granted, route []string) bool {
+	for _, scope := range route {
+		if hasScope(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAccessToken returns a new personal access token: the prefix and 256 random bits
+func generateAccessToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return accessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAccessToken returns the hash a personal access token is stored as. The token is random enough that a fast hash
+// cannot be reversed.
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// pruneAccessTokens deletes the expired personal access tokens
+func (rt *_router) pruneAccessTokens() {
+	deleted, err := rt.db.DeleteExpiredAccessTokens(globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting expired access tokens")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("expired access tokens deleted")
+	}
+}
+
+func toAccessTokenResponse(token database.AccessToken) types.AccessTokenResponse {
+	return types.AccessTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
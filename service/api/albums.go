@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/gofrs/uuid"
+)
+
+// maxAlbumPhotos is the largest number of photos sent together in a single message
+const maxAlbumPhotos = 10
+
+// maxAlbumSize is the total size of the largest album, in bytes. Each photo is also limited to maxImageSize.
+const maxAlbumSize = 30 << 20
+
+// errAlbumTooLarge is returned for albums whose photos exceed maxAlbumSize together
+var errAlbumTooLarge = errors.New("album is too large")
+
+// parsePhotoForm reads a photo message from the parsed multipart form of sendMessage: one or more "photo" fields,
+// stored in order as an album, and the optional caption, replyTo and sendAt fields. The photos are stored right away;
+// on errors a response is sent and ok is false.
+func (rt *_router) parsePhotoForm(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext) (photoURLs []string, caption *string, ok bool) {
+	// 1. Check the photos before storing any of them
+	headers := r.MultipartForm.File["photo"]
+	if len(headers) == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "missing or invalid photo file", ctx)
+		return nil, nil, false
+	}
+	if len(headers) > maxAlbumPhotos {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("an album can have at most %d photos", maxAlbumPhotos), ctx)
+		return nil, nil, false
+	}
+	if err := validateAlbum(headers); err != nil {
+		if errors.Is(err, errAlbumTooLarge) {
+			sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("album size exceeds %d bytes limit", maxAlbumSize), ctx)
+			return nil, nil, false
+		}
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return nil, nil, false
+	}
+
+	// 2. Check the optional caption, shown below the photos
+	if value := r.FormValue("caption"); value != "" {
+		if err := validateMessageContent(value); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return nil, nil, false
+		}
+		caption = &value
+	}
+
+	// 3. Store the photos in order
+	photoURLs, err := savePhotos(headers)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to save message photos")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save photo", ctx)
+		return nil, nil, false
+	}
+	return photoURLs, caption, true
+}
+
+// validateAlbum checks each photo of an album and their total size
+func validateAlbum(headers []*multipart.FileHeader) error {
+	var total int64
+	for _, header := range headers {
+		if err := validateImageHeader(header); err != nil {
+			return err
+		}
+		total += header.Size
+	}
+	if total > maxAlbumSize {
+		return errAlbumTooLarge
+	}
+	return nil
+}
+
+// savePhotos stores the photos of a message, returning their URLs in the same order. Photos are named by the server,
+// keeping only their extension. On errors, the photos already stored are removed.
+func savePhotos(headers []*multipart.FileHeader) ([]string, error) {
+	photoURLs := make([]string, 0, len(headers))
+	for _, header := range headers {
+		photoURL, err := savePhoto(header)
+		if err != nil {
+			if _, removeErr := removeUploadedFiles(photoURLs); removeErr != nil {
+				err = fmt.Errorf("%w (cleanup failed: %v)", err, removeErr)
+			}
+			return nil, err
+		}
+		photoURLs = append(photoURLs, photoURL)
+	}
+	return photoURLs, nil
+}
+
+// savePhoto stores a single photo of a message
+func savePhoto(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded photo: %w", err)
+	}
+	defer file.Close()
+
+	filename := uuid.Must(uuid.NewV4()).String() + strings.ToLower(path.Ext(header.Filename))
+	return saveUploadedImage(file, "messages", filename)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -13,8 +14,10 @@ import (
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
 
-// wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
-func (rt *_router) wrap(fn httpRouterHandler, auth bool) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+// wrap parses the request and adds a reqcontext.RequestContext instance related to the request. Personal access tokens
+// can call authenticated routes only if they were granted one of the scopes of the route; routes without scopes are
+// reserved to sessions.
+func (rt *_router) wrap(fn httpRouterHandler, auth bool, scopes ...string) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		reqUUID, err := uuid.NewV4()
 		if err != nil {
@@ -26,10 +29,21 @@ func (rt *_router) wrap(fn httpRouterHandler, auth bool) func(http.ResponseWrite
 		userID := ""
 		token := ""
 		if auth {
-			userID, token = isAuthorized(r.Header, rt.db)
+			var granted []string
+			userID, token, granted = rt.isAuthorized(r.Header)
 
 			if userID == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				if err := sendJSONResponse(w, http.StatusUnauthorized, types.ErrorResponse{Message: "Unauthorized"}); err != nil {
+					rt.baseLogger.WithError(err).Error("failed to send error response")
+				}
+				return
+			}
+
+			// Check the scopes of personal access tokens
+			if granted != nil && !grantsScope(granted, scopes) {
+				if err := sendJSONResponse(w, http.StatusForbidden, types.ErrorResponse{Message: "The access token lacks the scope of this operation"}); err != nil {
+					rt.baseLogger.WithError(err).Error("failed to send error response")
+				}
 				return
 			}
 		}
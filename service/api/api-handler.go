@@ -7,41 +7,106 @@ import (
 // Handler returns an instance of httprouter.Router that handle APIs registered here
 func (rt *_router) Handler() http.Handler {
 
-	// Register all API endpoints here
+	// Register all API endpoints here. Authenticated routes list the scopes that let personal access tokens call
+	// them; the others can be called with a session only.
 	// Liveness endpoint for health checks
 	rt.router.GET("/liveness", rt.wrap(rt.liveness, false))
 
+	// OpenAPI specification of this API
+	rt.router.GET("/openapi.yaml", rt.wrap(rt.getOpenAPISpec, false))
+
 	// Authentication endpoints
 	rt.router.POST("/session", rt.wrap(rt.doLogin, false)) // ❌ NO auth (è il login!)
+	rt.router.DELETE("/session", rt.wrap(rt.doLogout, true))
+	rt.router.POST("/session/two-factor", rt.wrap(rt.completeLogin, false))
+	rt.router.POST("/session/oidc", rt.wrap(rt.startOIDCLogin, false))
+	rt.router.POST("/session/oidc/callback", rt.wrap(rt.completeOIDCLogin, false))
 
 	// User Management endpoints - consistent pattern with userId
-	rt.router.GET("/users", rt.wrap(rt.searchUsers, true))
-	rt.router.GET("/users/:userId", rt.wrap(rt.getUserProfile, true))
+	rt.router.GET("/users", rt.wrap(rt.searchUsers, true, scopeReadUsers))
+	rt.router.GET("/users/:userId", rt.wrap(rt.getUserProfile, true, scopeReadUsers))
 	rt.router.PUT("/users/:userId/username", rt.wrap(rt.setMyUserName, true))
 	rt.router.PUT("/users/:userId/photo", rt.wrap(rt.setMyPhoto, true))
+	rt.router.PUT("/users/:userId/password", rt.wrap(rt.setMyPassword, true))
+
+	// Two-factor authentication endpoints - TOTP enrollment, required at login once enabled
+	rt.router.GET("/users/:userId/two-factor", rt.wrap(rt.getTwoFactor, true))
+	rt.router.POST("/users/:userId/two-factor", rt.wrap(rt.enrollTwoFactor, true))
+	rt.router.POST("/users/:userId/two-factor/activate", rt.wrap(rt.enableTwoFactor, true))
+	rt.router.DELETE("/users/:userId/two-factor", rt.wrap(rt.disableTwoFactor, true))
+	rt.router.DELETE("/users/:userId", rt.wrap(rt.deleteAccount, true))
+	rt.router.GET("/users/:userId/export", rt.wrap(rt.exportAccount, true))
+
+	// Personal access tokens endpoints - scoped tokens for scripts, managed with a session only
+	rt.router.POST("/users/:userId/access-tokens", rt.wrap(rt.createAccessToken, true))
+	rt.router.GET("/users/:userId/access-tokens", rt.wrap(rt.getAccessTokens, true))
+	rt.router.DELETE("/users/:userId/access-tokens/:tokenId", rt.wrap(rt.revokeAccessToken, true))
 
 	// Conversations endpoints - consistent with user-centric pattern
-	rt.router.POST("/users/:userId/conversations", rt.wrap(rt.startConversation, true))
-	rt.router.GET("/users/:userId/conversations", rt.wrap(rt.getMyConversations, true))
-	rt.router.GET("/users/:userId/conversations/:conversationId", rt.wrap(rt.getConversation, true))
+	rt.router.POST("/users/:userId/conversations", rt.wrap(rt.startConversation, true, scopeWriteConversations))
+	rt.router.GET("/users/:userId/conversations", rt.wrap(rt.getMyConversations, true, scopeReadConversations))
+	rt.router.GET("/users/:userId/conversations/:conversationId", rt.wrap(rt.getConversation, true, scopeReadConversations))
+	rt.router.GET("/users/:userId/conversations/:conversationId/export", rt.wrap(rt.exportConversation, true, scopeReadConversations))
+	rt.router.PUT("/users/:userId/conversations/:conversationId/timer", rt.wrap(rt.setMessageTimer, true, scopeWriteConversations))
+	rt.router.GET("/users/:userId/conversations/:conversationId/draft", rt.wrap(rt.getDraft, true, scopeReadConversations))
+	rt.router.PUT("/users/:userId/conversations/:conversationId/draft", rt.wrap(rt.saveDraft, true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/conversations/:conversationId/draft", rt.wrap(rt.deleteDraft, true, scopeWriteMessages))
 
 	// Messages endpoints - nested under conversations
-	rt.router.POST("/users/:userId/conversations/:conversationId/messages", rt.wrap(rt.sendMessage, true))
-	rt.router.POST("/users/:userId/messages/:messageId/forward", rt.wrap(rt.forwardMessage, true))
-	rt.router.DELETE("/users/:userId/messages/:messageId", rt.wrap(rt.deleteMessage, true))
-	rt.router.POST("/users/:userId/messages/:messageId/comments", rt.wrap(rt.commentMessage, true))
-	rt.router.DELETE("/users/:userId/messages/:messageId/comments/:commentId", rt.wrap(rt.uncommentMessage, true))
+	rt.router.POST("/users/:userId/conversations/:conversationId/messages", rt.wrap(rt.idempotent(rt.sendMessage), true, scopeWriteMessages))
+	rt.router.POST("/users/:userId/messages/:messageId/forward", rt.wrap(rt.idempotent(rt.forwardMessage), true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/messages/:messageId", rt.wrap(rt.deleteMessage, true, scopeWriteMessages))
+	rt.router.GET("/users/:userId/messages/:messageId/attachment", rt.wrap(rt.getMessageAttachment, true, scopeReadConversations))
+	rt.router.POST("/users/:userId/messages/:messageId/comments", rt.wrap(rt.commentMessage, true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/messages/:messageId/comments/:commentId", rt.wrap(rt.uncommentMessage, true, scopeWriteMessages))
+
+	// Polls
+	rt.router.POST("/users/:userId/conversations/:conversationId/polls", rt.wrap(rt.idempotent(rt.createPoll), true, scopeWriteMessages))
+	rt.router.PUT("/users/:userId/messages/:messageId/vote", rt.wrap(rt.votePoll, true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/messages/:messageId/vote", rt.wrap(rt.retractPollVote, true, scopeWriteMessages))
+	rt.router.POST("/users/:userId/messages/:messageId/poll/close", rt.wrap(rt.closePoll, true, scopeWriteMessages))
+
+	// Sync endpoint - changes since a cursor, for clients refreshing their state
+	rt.router.GET("/users/:userId/sync", rt.wrap(rt.syncChanges, true, scopeReadConversations))
+
+	// Mentions endpoint - messages mentioning the user
+	rt.router.GET("/users/:userId/mentions", rt.wrap(rt.getMyMentions, true, scopeReadConversations))
+
+	// Starred messages endpoints - messages bookmarked by the user across their conversations
+	rt.router.PUT("/users/:userId/messages/:messageId/star", rt.wrap(rt.starMessage, true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/messages/:messageId/star", rt.wrap(rt.unstarMessage, true, scopeWriteMessages))
+	rt.router.GET("/users/:userId/starred", rt.wrap(rt.getStarredMessages, true, scopeReadConversations))
+
+	// Scheduled messages endpoints - pending messages of the user
+	rt.router.GET("/users/:userId/scheduled-messages", rt.wrap(rt.getScheduledMessages, true, scopeReadConversations))
+	rt.router.PUT("/users/:userId/scheduled-messages/:scheduledMessageId", rt.wrap(rt.updateScheduledMessage, true, scopeWriteMessages))
+	rt.router.DELETE("/users/:userId/scheduled-messages/:scheduledMessageId", rt.wrap(rt.cancelScheduledMessage, true, scopeWriteMessages))
+
+	// Webhooks endpoints - conversation events sent to URLs registered by the user
+	rt.router.POST("/users/:userId/webhooks", rt.wrap(rt.createWebhook, true, scopeManageWebhooks))
+	rt.router.GET("/users/:userId/webhooks", rt.wrap(rt.getWebhooks, true, scopeManageWebhooks))
+	rt.router.DELETE("/users/:userId/webhooks/:webhookId", rt.wrap(rt.deleteWebhook, true, scopeManageWebhooks))
+	rt.router.GET("/users/:userId/webhooks/:webhookId/deliveries", rt.wrap(rt.getWebhookDeliveries, true, scopeManageWebhooks))
+
+	// Bots endpoints - automation accounts owned by the user
+	rt.router.POST("/users/:userId/bots", rt.wrap(rt.createBot, true, scopeManageBots))
+	rt.router.GET("/users/:userId/bots", rt.wrap(rt.getMyBots, true, scopeManageBots))
+	rt.router.DELETE("/users/:userId/bots/:botId", rt.wrap(rt.deleteBot, true, scopeManageBots))
+	rt.router.POST("/users/:userId/bots/:botId/token", rt.wrap(rt.regenerateBotToken, true, scopeManageBots))
 
 	// Groups endpoints - consistent with user-centric pattern
-	rt.router.POST("/users/:userId/groups", rt.wrap(rt.createGroup, true))
-	rt.router.POST("/users/:userId/groups/:groupId/members", rt.wrap(rt.addToGroup, true))
-	rt.router.DELETE("/users/:userId/groups/:groupId/members", rt.wrap(rt.leaveGroup, true))
-	rt.router.DELETE("/users/:userId/groups/:groupId/members/:memberId", rt.wrap(rt.removeMemberFromGroup, true))
-	rt.router.PUT("/users/:userId/groups/:groupId/name", rt.wrap(rt.setGroupName, true))
-	rt.router.PUT("/users/:userId/groups/:groupId/photo", rt.wrap(rt.setGroupPhoto, true))
+	rt.router.POST("/users/:userId/groups", rt.wrap(rt.idempotent(rt.createGroup), true, scopeManageGroups))
+	rt.router.POST("/users/:userId/groups/:groupId/members", rt.wrap(rt.addToGroup, true, scopeManageGroups))
+	rt.router.DELETE("/users/:userId/groups/:groupId/members", rt.wrap(rt.leaveGroup, true, scopeManageGroups))
+	rt.router.DELETE("/users/:userId/groups/:groupId/members/:memberId", rt.wrap(rt.removeMemberFromGroup, true, scopeManageGroups))
+	rt.router.PUT("/users/:userId/groups/:groupId/name", rt.wrap(rt.setGroupName, true, scopeManageGroups))
+	rt.router.PUT("/users/:userId/groups/:groupId/photo", rt.wrap(rt.setGroupPhoto, true, scopeManageGroups))
 
-	// Static file serving for uploaded images (temporary storage)
-	rt.router.ServeFiles("/uploads/*filepath", http.Dir("tmp/uploads"))
+	// Static file serving for uploaded images (temporary storage), cacheable by clients
+	rt.router.GET("/uploads/*filepath", serveUploads("tmp/uploads"))
 
+	if rt.spec != nil {
+		return rt.validateTraffic(rt.router)
+	}
 	return rt.router
 }
@@ -38,9 +38,18 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/Daniel200273/WASA-project/doc"
 	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/linkpreview"
+	"github.com/Daniel200273/WASA-project/service/netguard"
+	"github.com/Daniel200273/WASA-project/service/oidc"
+	"github.com/Daniel200273/WASA-project/service/openapi"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
@@ -52,6 +61,61 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// AccountDeletionPolicy decides whether the messages of deleted accounts are deleted or anonymised
+	// (default: database.DeletionPolicyAnonymize)
+	AccountDeletionPolicy database.DeletionPolicy
+
+	// Passwords lets users secure their accounts with a password, required to log in from then on. Accounts without a
+	// password can still be logged in to by name until they are claimed. When disabled, passwords are ignored.
+	Passwords bool
+
+	// OIDC is the OpenID Connect provider users can log in with (e.g., oidc.New), alongside the login by name. If nil,
+	// single sign-on is disabled.
+	OIDC oidc.Provider
+
+	// ValidateRequests rejects requests that do not conform to the OpenAPI specification (doc/api.yaml)
+	ValidateRequests bool
+
+	// ValidateResponses logs responses that do not conform to the OpenAPI specification. Responses are buffered for
+	// validation, so this is meant for debugging.
+	ValidateResponses bool
+
+	// SchedulerInterval is how often scheduled messages that are due are delivered (default: 5 seconds)
+	SchedulerInterval time.Duration
+
+	// ReaperInterval is how often expired messages are deleted (default: 1 minute)
+	ReaperInterval time.Duration
+
+	// LinkPreviews fetches the previews of the links sent in messages (e.g., linkpreview.New). If nil, messages have
+	// no link previews.
+	LinkPreviews linkpreview.Fetcher
+
+	// WebhookInterval is how often pending webhook deliveries are sent (default: 5 seconds)
+	WebhookInterval time.Duration
+
+	// WebhookClient sends the webhook deliveries (default: a netguard client, refusing private addresses)
+	WebhookClient *http.Client
+
+	// IdempotencyWindow is how long the response of a request sent with an idempotency key is returned again when the
+	// request is retried (default: 24 hours)
+	IdempotencyWindow time.Duration
+
+	// SessionCacheSize is how many session tokens are cached in memory, to authenticate requests without querying
+	// the database (default: 10000)
+	SessionCacheSize int
+
+	// SessionCacheTTL is how long a session token is cached (default: 30 seconds). Sessions revoked by this server
+	// stop working at once, those revoked by other processes (e.g., wasactl) within this time.
+	SessionCacheTTL time.Duration
+
+	// AttachmentMaxSize is the size of the largest file that can be attached to a message, in bytes (default: 25MB)
+	AttachmentMaxSize int64
+
+	// AttachmentTypes lists the MIME types of the files that can be attached to messages, either exact (e.g.,
+	// "application/pdf") or by top-level type (e.g., "audio/*"). Types are sniffed from the content of the files. Any
+	// type is allowed if empty.
+	AttachmentTypes []string
 }
 
 // Router is the package API interface representing an API handler builder
@@ -72,6 +136,63 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	switch cfg.AccountDeletionPolicy {
+	case "":
+		cfg.AccountDeletionPolicy = database.DeletionPolicyAnonymize
+	case database.DeletionPolicyDelete, database.DeletionPolicyAnonymize:
+	default:
+		return nil, fmt.Errorf("unknown account deletion policy %q", cfg.AccountDeletionPolicy)
+	}
+
+	if cfg.SchedulerInterval < 0 {
+		return nil, errors.New("scheduler interval must be positive")
+	}
+	if cfg.SchedulerInterval == 0 {
+		cfg.SchedulerInterval = defaultSchedulerInterval
+	}
+	if cfg.ReaperInterval < 0 {
+		return nil, errors.New("reaper interval must be positive")
+	}
+	if cfg.ReaperInterval == 0 {
+		cfg.ReaperInterval = defaultReaperInterval
+	}
+	if cfg.WebhookInterval < 0 {
+		return nil, errors.New("webhook interval must be positive")
+	}
+	if cfg.WebhookInterval == 0 {
+		cfg.WebhookInterval = defaultWebhookInterval
+	}
+	if cfg.WebhookClient == nil {
+		cfg.WebhookClient = netguard.NewClient(netguard.Config{Timeout: 10 * time.Second})
+	}
+	if cfg.IdempotencyWindow < 0 {
+		return nil, errors.New("idempotency window must be positive")
+	}
+	if cfg.IdempotencyWindow == 0 {
+		cfg.IdempotencyWindow = defaultIdempotencyWindow
+	}
+	if cfg.SessionCacheSize < 0 {
+		return nil, errors.New("session cache size must be positive")
+	}
+	if cfg.SessionCacheSize == 0 {
+		cfg.SessionCacheSize = defaultSessionCacheSize
+	}
+	if cfg.SessionCacheTTL < 0 {
+		return nil, errors.New("session cache TTL must be positive")
+	}
+	if cfg.SessionCacheTTL == 0 {
+		cfg.SessionCacheTTL = defaultSessionCacheTTL
+	}
+	if cfg.AttachmentMaxSize < 0 {
+		return nil, errors.New("attachment max size must be positive")
+	}
+	if cfg.AttachmentMaxSize == 0 {
+		cfg.AttachmentMaxSize = defaultAttachmentMaxSize
+	}
+	attachments, err := newAttachmentPolicy(cfg.AttachmentMaxSize, cfg.AttachmentTypes)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -85,12 +206,65 @@ func New(cfg Config) (Router, error) {
 		return nil, errors.New("failed to initialize uploads directory")
 	}
 	cfg.Logger.Info("uploads directory initialized successfully")
+	if err := os.MkdirAll(attachmentsDir, 0755); err != nil {
+		cfg.Logger.WithError(err).Error("error initializing attachments directory")
+		return nil, errors.New("failed to initialize attachments directory")
+	}
+
+	// Load the OpenAPI specification used to validate the traffic
+	var spec *openapi.Spec
+	if cfg.ValidateRequests || cfg.ValidateResponses {
+		var err error
+		spec, err = openapi.Load(doc.OpenAPI)
+		if err != nil {
+			return nil, fmt.Errorf("loading the OpenAPI specification: %w", err)
+		}
+	}
 
-	return &_router{
+	rt := &_router{
 		router:     router,
 		baseLogger: cfg.Logger,
 		db:         cfg.Database,
-	}, nil
+
+		deletionPolicy:    cfg.AccountDeletionPolicy,
+		passwords:         cfg.Passwords,
+		oidc:              cfg.OIDC,
+		spec:              spec,
+		validateRequests:  cfg.ValidateRequests,
+		validateResponses: cfg.ValidateResponses,
+
+		linkPreviews:  cfg.LinkPreviews,
+		webhookClient: cfg.WebhookClient,
+
+		idempotencyWindow: cfg.IdempotencyWindow,
+
+		sessions: newSessionCache(cfg.SessionCacheSize, cfg.SessionCacheTTL),
+
+		attachments: attachments,
+
+		stop: make(chan struct{}),
+	}
+
+	// Deliver scheduled messages and webhook events, delete expired data and fetch link previews in background until
+	// Close is called
+	rt.runEvery(cfg.SchedulerInterval, rt.dispatchScheduledMessages)
+	rt.runEvery(cfg.ReaperInterval, rt.reapExpiredMessages)
+	rt.runEvery(cfg.WebhookInterval, rt.dispatchWebhooks)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneWebhookDeliveries)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneIdempotencyKeys)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneChangeLog)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneLoginChallenges)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneAccessTokens)
+	rt.runEvery(cfg.ReaperInterval, rt.pruneAttachments)
+	if rt.oidc != nil {
+		rt.runEvery(cfg.ReaperInterval, rt.pruneOIDCLogins)
+	}
+	if rt.linkPreviews != nil {
+		rt.linkPreviewQueue = make(chan string, linkPreviewQueueSize)
+		rt.runLinkPreviewWorker()
+	}
+
+	return rt, nil
 }
 
 type _router struct {
@@ -101,4 +275,39 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	// deletionPolicy is applied to the messages of deleted accounts
+	deletionPolicy database.DeletionPolicy
+
+	// passwords is true if accounts can be secured with a password
+	passwords bool
+
+	// oidc is the OpenID Connect provider for single sign-on, nil if disabled
+	oidc oidc.Provider
+
+	// spec is the OpenAPI specification used to validate the traffic, nil if validation is disabled
+	spec              *openapi.Spec
+	validateRequests  bool
+	validateResponses bool
+
+	// linkPreviews fetches link previews, nil if disabled; linkPreviewQueue holds the links waiting for a preview
+	linkPreviews     linkpreview.Fetcher
+	linkPreviewQueue chan string
+
+	// webhookClient sends the webhook deliveries
+	webhookClient *http.Client
+
+	// idempotencyWindow is how long the responses of requests sent with an idempotency key are kept
+	idempotencyWindow time.Duration
+
+	// sessions caches the users of session tokens
+	sessions *sessionCache
+
+	// attachments decides which files can be attached to messages
+	attachments attachmentPolicy
+
+	// stop is closed to stop the background goroutines (see runEvery), background waits for them to exit
+	stop       chan struct{}
+	stopOnce   sync.Once
+	background sync.WaitGroup
 }
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// parseAttachmentForm reads a file message from the parsed multipart form of sendMessage: the "file" field and the
+// optional replyTo field. The file is stored right away; on errors a response is sent and ok is false.
+func (rt *_router) parseAttachmentForm(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext) (attachment *database.Attachment, replyTo *string, ok bool) {
+	// 1. Files are stored when the message is sent, so they cannot be scheduled; they are sent without photos or a
+	// caption
+	if r.FormValue("sendAt") != "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Messages with an attachment cannot be scheduled", ctx)
+		return nil, nil, false
+	}
+	if _, ok := r.MultipartForm.File["photo"]; ok || r.FormValue("caption") != "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Messages with an attachment cannot have photos or a caption", ctx)
+		return nil, nil, false
+	}
+
+	// 2. Check and store the file
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "missing or invalid file", ctx)
+		return nil, nil, false
+	}
+	defer file.Close()
+
+	attachment, err = rt.saveAttachment(file, header)
+	switch {
+	case errors.Is(err, errAttachmentEmpty):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return nil, nil, false
+	case errors.Is(err, errAttachmentTooLarge):
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file size exceeds %d bytes limit", rt.attachments.maxSize), ctx)
+		return nil, nil, false
+	case errors.Is(err, errAttachmentType):
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, err.Error(), ctx)
+		return nil, nil, false
+	case err != nil:
+		ctx.Logger.WithError(err).Error("Failed to save attachment")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save attachment", ctx)
+		return nil, nil, false
+	}
+
+	// 3. Check for optional replyTo in form data
+	if replyToStr := r.FormValue("replyTo"); replyToStr != "" {
+		replyTo = &replyToStr
+	}
+	return attachment, replyTo, true
+}
+
+// getMessageAttachment handles downloading the file attached to a message, for the participants of its conversation
+func (rt *_router) getMessageAttachment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+
+	// 2. Validate messageId format
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Get the message, whose conversation must include the current user
+	message, err := rt.db.GetMessage(messageID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Message not found", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get message")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get message", ctx)
+		return
+	}
+
+	isParticipant, err := rt.db.IsUserInConversation(message.ConversationID, ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check user participation")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to check conversation participation", ctx)
+		return
+	}
+	if !isParticipant {
+		sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to conversation", ctx)
+		return
+	}
+
+	// 4. Open the attached file
+	attachment := message.Attachment
+	if attachment == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Message has no attachment", ctx)
+		return
+	}
+	file, err := os.Open(filepath.Join(attachmentsDir, filepath.Base(attachment.StorageKey)))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to open attachment file")
+		if os.IsNotExist(err) {
+			sendErrorResponse(w, http.StatusNotFound, "Attachment file not found", ctx)
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to open attachment", ctx)
+		return
+	}
+	defer file.Close()
+
+	// 5. Serve the file with its sniffed type, never sniffed again by browsers, supporting range requests
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", contentDisposition(attachment.MimeType, attachment.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt, file)
+}
+
+// contentDisposition returns the Content-Disposition of a downloaded attachment. Images, audio and video are shown
+// inline by browsers; everything else, including SVG images that can run scripts, is saved as a file.
+func contentDisposition(mimeType, filename string) string {
+	disposition := "attachment"
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case mediaType == "image/svg+xml":
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		disposition = "inline"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); header != "" {
+		return header
+	}
+	return disposition
+}
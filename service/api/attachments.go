@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/gofrs/uuid"
+)
+
+// defaultAttachmentMaxSize is the size of the largest file that can be attached to a message, unless configured
+// otherwise
+const defaultAttachmentMaxSize = 25 << 20
+
+// maxImageSize is the size of the largest photo that can be uploaded
+const maxImageSize = 10 << 20
+
+// multipartFormOverhead is the room left in multipart bodies for the other form fields and the multipart framing
+const multipartFormOverhead = 1 << 20
+
+// maxAttachmentFilenameLength is the length of the longest attachment filename, in bytes; longer names are truncated
+const maxAttachmentFilenameLength = 255
+
+// attachmentsDir is where attachment files are stored. Unlike photos, attachments are not served under /uploads/:
+// they are downloaded by the participants of the conversation only (see getMessageAttachment).
+var attachmentsDir = filepath.Join("tmp", "attachments")
+
+// Errors of attachments refused by the attachment policy
+var (
+	errAttachmentEmpty    = errors.New("file is empty")
+	errAttachmentTooLarge = errors.New("file is too large")
+	errAttachmentType     = errors.New("file type is not allowed")
+)
+
+// attachmentPolicy decides which files can be attached to messages
+type attachmentPolicy struct {
+	// maxSize is the size of the largest file, in bytes
+	maxSize int64
+
+	// types lists the allowed MIME types, either exact ("application/pdf") or by top-level type ("audio/*"). Any
+	// type is allowed if empty.
+	types []string
+}
+
+// newAttachmentPolicy validates the allowed MIME types of an attachment policy
+func newAttachmentPolicy(maxSize int64, types []string) (attachmentPolicy, error) {
+	policy := attachmentPolicy{maxSize: maxSize}
+	for _, pattern := range types {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		parts := strings.Split(pattern, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[0] == "*" || parts[1] == "" {
+			return attachmentPolicy{}, fmt.Errorf("invalid attachment type %q: must be type/subtype or type/*", pattern)
+		}
+		policy.types = append(policy.types, pattern)
+	}
+	return policy, nil
+}
+
+// allows reports whether files of the given MIME type can be attached
+func (p attachmentPolicy) allows(mimeType string) bool {
+	if len(p.types) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range p.types {
+		if pattern == mediaType || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxUploadSize returns the size of the largest multipart body accepted when sending a message: the largest album or
+// attachment with the rest of the form
+func (rt *_router) maxUploadSize() int64 {
+	size := rt.attachments.maxSize
+	if size < maxAlbumSize {
+		size = maxAlbumSize
+	}
+	return size + multipartFormOverhead
+}
+
+// saveAttachment checks an uploaded file against the attachment policy and stores it under a new storage key. The MIME
+// type is sniffed from the content of the file, never taken from the client. Files refused by the policy are reported
+// with errAttachmentEmpty, errAttachmentTooLarge or errAttachmentType.
+func (rt *_router) saveAttachment(file multipart.File, header *multipart.FileHeader) (*database.Attachment, error) {
+	// 1. Check the size declared by the form, before storing anything
+	if header.Size == 0 {
+		return nil, errAttachmentEmpty
+	}
+	if header.Size > rt.attachments.maxSize {
+		return nil, errAttachmentTooLarge
+	}
+
+	// 2. Sniff the type of the file
+	filename := attachmentFilename(header.Filename)
+	mimeType, err := sniffMimeType(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	if !rt.attachments.allows(mimeType) {
+		return nil, errAttachmentType
+	}
+
+	// 3. Store the file under a random key: filenames are chosen by users and are not unique
+	storageKey := uuid.Must(uuid.NewV4()).String()
+	size, err := writeAttachmentFile(file, storageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.Attachment{
+		Filename:   filename,
+		MimeType:   mimeType,
+		Size:       size,
+		StorageKey: storageKey,
+	}, nil
+}
+
+// sniffMimeType detects the MIME type of a file from its first bytes. Generic results are refined with the extension
+// of the filename, as many formats are zip files (e.g., docx, odt) or are unknown to the sniffer.
+func sniffMimeType(file multipart.File, filename string) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to reset file pointer: %w", err)
+	}
+
+	mimeType := http.DetectContentType(head[:n])
+	if mimeType == "application/octet-stream" || mimeType == "application/zip" {
+		if byExtension := mime.TypeByExtension(strings.ToLower(path.Ext(filename))); byExtension != "" {
+			mimeType = byExtension
+		}
+	}
+	return mimeType, nil
+}
+
+// attachmentFilename cleans the filename sent by the client: directories, control characters and invalid UTF-8 are
+// removed, and long names are truncated
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(name, ""))
+	name = strings.TrimSpace(name)
+
+	for len(name) > maxAttachmentFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// writeAttachmentFile copies an uploaded file to the attachments directory, returning its size
+func writeAttachmentFile(file multipart.File, storageKey string) (int64, error) {
+	if err := os.MkdirAll(attachmentsDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create attachments directory: %w", err)
+	}
+
+	dest, err := os.OpenFile(filepath.Join(attachmentsDir, storageKey), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create attachment file: %w", err)
+	}
+	size, err := io.Copy(dest, file)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dest.Name())
+		return 0, fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return size, nil
+}
+
+// removeAttachmentFiles deletes the files of the given storage keys. Missing files are ignored; returns the number
+// of removed files.
+func removeAttachmentFiles(storageKeys []string) (int, error) {
+	removed := 0
+	for _, key := range storageKeys {
+		if err := os.Remove(filepath.Join(attachmentsDir, filepath.Base(key))); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, fmt.Errorf("failed to remove attachment file: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// pruneAttachments deletes the attachments no message refers to anymore, with their files
+func (rt *_router) pruneAttachments() {
+	keys, err := rt.db.DeleteUnreferencedAttachments()
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting unreferenced attachments")
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	removed, err := removeAttachmentFiles(keys)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error removing attachment files")
+	}
+	rt.baseLogger.WithField("deleted", len(keys)).WithField("removed", removed).Info("unreferenced attachments deleted")
+}
@@ -4,38 +4,58 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
 )
 
 /*
 isAuthorized checks if the user is authorized to perform the action, by checking the Authorization header.
-The auth token must be in the format "Bearer <sessionToken>" where sessionToken is the string token
-returned from the login endpoint (/session).
-If the user is authorized, the function returns the userID and token, otherwise it returns empty strings.
+The auth token must be in the format "Bearer <token>" where token is either the session token returned from the login
+endpoint (/session), or a personal access token (see createAccessToken).
+If the user is authorized, the function returns the userID and token, otherwise it returns empty strings. The scopes
+of personal access tokens are returned too; they are nil for session tokens, which are not limited.
+The users of session tokens are cached (see sessionCache), so that most requests do not query the database.
 */
-func isAuthorized(header http.Header, db database.AppDatabase) (string, string) {
+func (rt *_router) isAuthorized(header http.Header) (string, string, []string) {
 	authHeader := header.Get("Authorization")
 	if authHeader == "" {
-		return "", ""
+		return "", "", nil
 	}
 
 	// Check if the header starts with "Bearer "
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return "", ""
+		return "", "", nil
 	}
 
 	// Extract the token part after "Bearer "
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 	if token == "" {
-		return "", ""
+		return "", "", nil
 	}
 
-	// Look up the user by session token
-	user, err := db.GetUserByToken(token)
+	// Personal access tokens are stored as hashes, and must not have expired
+	if strings.HasPrefix(token, accessTokenPrefix) {
+		now := globaltime.Now()
+		accessToken, err := rt.db.GetAccessTokenByHash(hashAccessToken(token), now)
+		if err != nil {
+			return "", "", nil
+		}
+		if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= accessTokenTouchInterval {
+			// The last use is informative only, failing to record it does not fail the request
+			_ = rt.db.TouchAccessToken(accessToken.ID, now)
+		}
+		return accessToken.UserID, token, accessToken.Scopes
+	}
+
+	// Look up the user by session token, in the cache first
+	if user, ok := rt.sessions.get(token); ok {
+		return user.ID, token, nil
+	}
+	user, err := rt.db.GetUserByToken(token)
 	if err != nil {
 		// Token is invalid or expired
-		return "", ""
+		return "", "", nil
 	}
+	rt.sessions.put(token, *user)
 
-	return user.ID, token
+	return user.ID, token, nil
 }
@@ -0,0 +1,31 @@
+package api
+
+import "time"
+
+// runEvery starts a background goroutine calling task every interval, until stopBackground is called
+func (rt *_router) runEvery(interval time.Duration, task func()) {
+	rt.background.Add(1)
+
+	go func() {
+		defer rt.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rt.stop:
+				return
+			case <-ticker.C:
+				task()
+			}
+		}
+	}()
+}
+
+// stopBackground stops the background goroutines and waits for the running tasks to finish
+func (rt *_router) stopBackground() {
+	rt.stopOnce.Do(func() {
+		close(rt.stop)
+	})
+	rt.background.Wait()
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxBotsPerUser is the maximum number of bots a user can own
+const maxBotsPerUser = 10
+
+// createBot handles creating a bot account owned by the user. The bot token is returned only here and when it is
+// regenerated.
+func (rt *_router) createBot(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only create your own bots", ctx)
+		return
+	}
+
+	// 2. Parse and validate request body
+	var req types.CreateBotRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validateUsername(req.Name); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Check the number of bots of the user
+	bots, err := rt.db.GetUserBots(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get bots")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create bot", ctx)
+		return
+	}
+	if len(bots) >= maxBotsPerUser {
+		sendErrorResponse(w, http.StatusConflict, "Too many bots, delete one first", ctx)
+		return
+	}
+
+	// 4. Create the bot with its token
+	bot, token, err := rt.db.CreateBot(userID, req.Name)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to create bot")
+		switch {
+		case strings.Contains(err.Error(), "already taken"):
+			sendErrorResponse(w, http.StatusConflict, "Username already taken", ctx)
+		case strings.Contains(err.Error(), "bots cannot"):
+			sendErrorResponse(w, http.StatusForbidden, "Bots cannot create bots", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create bot", ctx)
+		}
+		return
+	}
+
+	// 5. Return the bot with its token
+	response := toBotResponse(*bot)
+	response.Token = token
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send bot response")
+	}
+	ctx.Logger.Info("Bot created successfully", "botID", bot.ID, "ownerID", userID)
+}
+
+// getMyBots handles listing the bots owned by the user
+func (rt *_router) getMyBots(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own bots", ctx)
+		return
+	}
+
+	// 2. Get the bots from database
+	bots, err := rt.db.GetUserBots(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get bots")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get bots", ctx)
+		return
+	}
+
+	// 3. Convert to response format
+	response := types.BotsResponse{
+		Bots: make([]types.BotResponse, len(bots)),
+	}
+	for i, bot := range bots {
+		response.Bots[i] = toBotResponse(bot)
+	}
+
+	// 4. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send bots response")
+	}
+}
+
+// regenerateBotToken handles revoking the token of a bot of the user and issuing a new one
+func (rt *_router) regenerateBotToken(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only manage your own bots", ctx)
+		return
+	}
+
+	// 2. Validate botId format
+	botID := ps.ByName("botId")
+	if err := validateID(botID, "botId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Replace the token
+	token, err := rt.db.RegenerateBotToken(botID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Bot not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to regenerate bot token")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to regenerate bot token", ctx)
+		}
+		return
+	}
+	rt.sessions.removeUser(botID)
+	bot, err := rt.db.GetBot(botID, userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get bot")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to regenerate bot token", ctx)
+		return
+	}
+
+	// 4. Return the bot with its new token
+	response := toBotResponse(*bot)
+	response.Token = token
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send bot response")
+	}
+	ctx.Logger.Info("Bot token regenerated successfully", "botID", botID)
+}
+
+// deleteBot handles deleting a bot of the user. The bot account is deleted like any other account.
+func (rt *_router) deleteBot(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only delete your own bots", ctx)
+		return
+	}
+
+	// 2. Validate botId format
+	botID := ps.ByName("botId")
+	if err := validateID(botID, "botId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Check the ownership and delete the bot
+	if _, err := rt.db.GetBot(botID, userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Bot not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to get bot")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete bot", ctx)
+		}
+		return
+	}
+	if err := rt.deleteBotAccount(botID, ctx); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to delete bot")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete bot", ctx)
+		return
+	}
+
+	// 4. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Bot deleted successfully", "botID", botID)
+}
+
+// deleteBotAccount deletes a bot account with its media files, applying the configured deletion policy to its
+// messages. Failures to remove the files are only logged.
+func (rt *_router) deleteBotAccount(botID string, ctx reqcontext.RequestContext) error {
+	deleted, err := rt.db.DeleteUser(botID, rt.deletionPolicy)
+	if err != nil {
+		return err
+	}
+	rt.sessions.removeUser(botID)
+	if _, err := removeUploadedFiles(deleted.MediaURLs); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to remove media files of deleted bot")
+	}
+	return nil
+}
+
+// toBotResponse converts a bot account to its response format, without the token
+func toBotResponse(bot database.User) types.BotResponse {
+	return types.BotResponse{
+		ID:        bot.ID,
+		Username:  bot.Username,
+		PhotoURL:  bot.PhotoURL,
+		CreatedAt: bot.CreatedAt,
+	}
+}
@@ -0,0 +1,331 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/api"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/oidc"
+	"github.com/Daniel200273/WASA-project/service/oidc/oidctest"
+	"github.com/Daniel200273/WASA-project/service/totp"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// fixture is a running API server with known data. Requests are sent on behalf of alice.
+type fixture struct {
+	server *httptest.Server
+	router api.Router
+	dbconn *sql.DB
+
+	alice, bob, carol *client.Client
+
+	// direct is the conversation between alice and bob, group is a group of alice and bob
+	direct, group string
+
+	// message is a message of alice in the direct conversation, starred by her; comment is her reaction to it
+	message, comment string
+
+	// attachment is a file message of alice in the direct conversation
+	attachment string
+
+	// poll is a poll of alice in the group, voted by alice and bob
+	poll string
+
+	// scheduled is a message of alice scheduled for the direct conversation
+	scheduled string
+
+	// webhook is a webhook of alice for the direct conversation
+	webhook string
+
+	// bot is a bot of alice, member of the group
+	bot string
+
+	// accessToken is a personal access token of alice
+	accessToken string
+
+	// twoFactorSecret is the secret of a pending two-factor enrollment of alice. carol has two-factor authentication
+	// enabled: challenge is a login of carol waiting for a code, recoveryCode one of her recovery codes.
+	twoFactorSecret, challenge, recoveryCode string
+
+	// provider is the identity provider for single sign-on. oidcCode and oidcState are the parameters it sent dave
+	// back with, completing his first login.
+	provider            *oidctest.Provider
+	oidcCode, oidcState string
+
+	// operation is the operation checked with the fixture
+	operation string
+}
+
+// newFixture starts the API router on a new database inside dir and seeds it
+func newFixture(dir string, name string) (*fixture, error) {
+	dbconn, err := sql.Open("sqlite3", filepath.Join(dir, name+".db"))
+	if err != nil {
+		return nil, fmt.Errorf("opening SQLite: %w", err)
+	}
+	db, err := database.New(dbconn)
+	if err != nil {
+		_ = dbconn.Close()
+		return nil, fmt.Errorf("creating AppDatabase: %w", err)
+	}
+
+	provider := oidctest.New("wasatext", "contract")
+	provider.SetUser("dave-1", "dave", "dave@example.com")
+	sso, err := oidc.New(oidc.Config{
+		Issuer:       provider.URL,
+		ClientID:     "wasatext",
+		ClientSecret: "contract",
+		RedirectURL:  "https://wasatext.invalid/login",
+	})
+	if err != nil {
+		provider.Close()
+		_ = dbconn.Close()
+		return nil, fmt.Errorf("configuring single sign-on: %w", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	router, err := api.New(api.Config{Logger: logger, Database: db, Passwords: true, OIDC: sso})
+	if err != nil {
+		provider.Close()
+		_ = dbconn.Close()
+		return nil, fmt.Errorf("creating the API router: %w", err)
+	}
+
+	f := &fixture{
+		server:    httptest.NewServer(router.Handler()),
+		router:    router,
+		dbconn:    dbconn,
+		provider:  provider,
+		operation: name,
+	}
+	if err := f.seed(); err != nil {
+		f.close()
+		return nil, fmt.Errorf("seeding: %w", err)
+	}
+	return f, nil
+}
+
+func (f *fixture) seed() error {
+	ctx := context.Background()
+
+	users := map[string]**client.Client{"alice": &f.alice, "bobby": &f.bob, "carol": &f.carol}
+	for name, c := range users {
+		cl, err := client.New(f.server.URL)
+		if err != nil {
+			return err
+		}
+		if _, err := cl.Login(ctx, name); err != nil {
+			return err
+		}
+		*c = cl
+	}
+
+	direct, err := f.alice.StartConversation(ctx, f.bob.UserID())
+	if err != nil {
+		return err
+	}
+	f.direct = direct.ID
+
+	group, err := f.alice.CreateGroup(ctx, "contract", []string{f.bob.UserID()})
+	if err != nil {
+		return err
+	}
+	f.group = group.ID
+
+	message, err := f.alice.SendMessage(ctx, f.direct, "hello", nil)
+	if err != nil {
+		return err
+	}
+	f.message = message.ID
+
+	comment, err := f.alice.CommentMessage(ctx, f.message, "👍")
+	if err != nil {
+		return err
+	}
+	f.comment = comment.ID
+
+	if _, err := f.bob.CommentMessage(ctx, f.message, "🎉"); err != nil {
+		return err
+	}
+	if err := f.alice.StarMessage(ctx, f.message); err != nil {
+		return err
+	}
+	attachment, err := f.alice.SendFile(ctx, f.direct, "notes.txt", strings.NewReader("contract notes"), nil)
+	if err != nil {
+		return err
+	}
+	f.attachment = attachment.ID
+
+	if _, err := f.bob.SendMessage(ctx, f.group, "@alice welcome", nil); err != nil {
+		return err
+	}
+	poll, err := f.alice.CreatePoll(ctx, f.group, types.CreatePollRequest{
+		Question: "When do we meet?",
+		Options:  []string{"Monday", "Tuesday"},
+	})
+	if err != nil {
+		return err
+	}
+	f.poll = poll.ID
+	if _, err := f.alice.VotePoll(ctx, f.poll, 0); err != nil {
+		return err
+	}
+	if _, err := f.bob.VotePoll(ctx, f.poll, 1); err != nil {
+		return err
+	}
+	scheduled, err := f.alice.ScheduleMessage(ctx, f.direct, "later", nil, time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	f.scheduled = scheduled.ID
+
+	if _, err := f.alice.SaveDraft(ctx, f.direct, "draft", nil); err != nil {
+		return err
+	}
+
+	webhook, err := f.alice.CreateWebhook(ctx, "https://example.invalid/hook", &f.direct, []string{database.WebhookEventMessageCreated})
+	if err != nil {
+		return err
+	}
+	f.webhook = webhook.ID
+
+	bot, err := f.alice.CreateBot(ctx, "contractbot")
+	if err != nil {
+		return err
+	}
+	f.bot = bot.ID
+	if err := f.alice.AddToGroup(ctx, f.group, f.bot); err != nil {
+		return err
+	}
+
+	if err := f.alice.SetGroupPhoto(ctx, f.group, "group.png", bytes.NewReader(samplePNG())); err != nil {
+		return err
+	}
+	accessToken, err := f.alice.CreateAccessToken(ctx, "contract", []string{"read:conversations"}, nil)
+	if err != nil {
+		return err
+	}
+	f.accessToken = accessToken.ID
+
+	if err := f.seedTwoFactor(ctx); err != nil {
+		return err
+	}
+	return f.seedOIDC(ctx)
+}
+
+// seedTwoFactor enables two-factor authentication for carol, starts a login of hers, and starts the enrollment of alice
+func (f *fixture) seedTwoFactor(ctx context.Context) error {
+	enrollment, err := f.carol.EnrollTwoFactor(ctx)
+	if err != nil {
+		return err
+	}
+	code, err := totp.Code(enrollment.Secret, totp.Counter(time.Now()))
+	if err != nil {
+		return err
+	}
+	recoveryCodes, err := f.carol.EnableTwoFactor(ctx, code)
+	if err != nil {
+		return err
+	}
+	f.recoveryCode = recoveryCodes[0]
+
+	cl, err := client.New(f.server.URL)
+	if err != nil {
+		return err
+	}
+	var challenge *client.SecondFactorRequiredError
+	if _, err := cl.Login(ctx, "carol"); !errors.As(err, &challenge) {
+		return fmt.Errorf("expected a login challenge for carol, got %v", err)
+	}
+	f.challenge = challenge.Challenge
+
+	enrollment, err = f.alice.EnrollTwoFactor(ctx)
+	if err != nil {
+		return err
+	}
+	f.twoFactorSecret = enrollment.Secret
+	return nil
+}
+
+// seedOIDC starts a single sign-on login of dave, who comes back from the identity provider with a code
+func (f *fixture) seedOIDC(ctx context.Context) error {
+	cl, err := client.New(f.server.URL)
+	if err != nil {
+		return err
+	}
+	login, err := cl.StartOIDCLogin(ctx)
+	if err != nil {
+		return err
+	}
+	redirect, err := f.provider.Authorize(login.AuthorizationURL)
+	if err != nil {
+		return err
+	}
+	f.oidcCode, f.oidcState = redirect.Query().Get("code"), redirect.Query().Get("state")
+	return nil
+}
+
+// twoFactorCode returns a code for the operation: a recovery code of carol to complete her login, otherwise a TOTP
+// code confirming the enrollment of alice
+func (f *fixture) twoFactorCode() string {
+	if f.operation == "completeLogin" {
+		return f.recoveryCode
+	}
+	code, _ := totp.Code(f.twoFactorSecret, totp.Counter(time.Now()))
+	return code
+}
+
+// pathValue returns the fixture value of a path parameter
+func (f *fixture) pathValue(name string) (string, bool) {
+	values := map[string]string{
+		"userId":         f.alice.UserID(),
+		"conversationId": f.direct,
+		"groupId":        f.group,
+		"messageId":      f.message,
+		"commentId":      f.comment,
+		"memberId":       f.bob.UserID(),
+
+		"scheduledMessageId": f.scheduled,
+		"webhookId":          f.webhook,
+		"botId":              f.bot,
+		"tokenId":            f.accessToken,
+	}
+	switch f.operation {
+	case "getMessageAttachment":
+		values["messageId"] = f.attachment
+	case "createPoll":
+		values["conversationId"] = f.group
+	case "votePoll", "retractPollVote", "closePoll":
+		values["messageId"] = f.poll
+	}
+	v, ok := values[name]
+	return v, ok
+}
+
+func (f *fixture) close() {
+	f.server.Close()
+	f.provider.Close()
+	_ = f.router.Close()
+	_ = f.dbconn.Close()
+}
+
+// samplePNG returns a small valid PNG image
+func samplePNG() []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2)))
+	return buf.Bytes()
+}
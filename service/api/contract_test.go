@@ -0,0 +1,326 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Daniel200273/WASA-project/doc"
+	"github.com/Daniel200273/WASA-project/service/openapi"
+)
+
+// TestContract checks that the API server conforms to its OpenAPI specification (doc/api.yaml). Every operation is
+// called on a fresh fixture (see newFixture) with a request built from the specification, and both the request and the
+// response are validated against it. Secured operations are also called without credentials, checking the documented
+// 401 response. A single operation is checked with -run TestContract/<operationId>.
+func TestContract(t *testing.T) {
+	spec, err := openapi.Load(doc.OpenAPI)
+	if err != nil {
+		t.Fatalf("loading specification: %v", err)
+	}
+
+	for _, op := range spec.Operations() {
+		op := op
+		t.Run(op.ID, func(t *testing.T) {
+			results, err := checkOperation(spec, op, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, res := range results {
+				if res.ok() {
+					continue
+				}
+				t.Errorf("%s %s (%s):\n\t%s\n\tresponse: %d %s", op.Method, op.Path, res.name,
+					strings.Join(res.problems, "\n\t"), res.statusCode, res.body)
+			}
+		})
+	}
+}
+
+// result is the outcome of a single check
+type result struct {
+	name       string
+	statusCode int
+	body       []byte
+	problems   []string
+}
+
+func (r result) ok() bool {
+	return len(r.problems) == 0
+}
+
+// checkOperation calls an operation on a fresh fixture, with and without credentials
+func checkOperation(spec *openapi.Spec, op *openapi.Operation, dir string) ([]result, error) {
+	f, err := newFixture(dir, op.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer f.close()
+
+	results := []result{checkExamples(op), checkCall(spec, op, f, "success", f.alice.Token())}
+	if op.Secured {
+		res := checkCall(spec, op, f, "unauthenticated", "")
+		if res.statusCode != http.StatusUnauthorized {
+			res.problems = append(res.problems, fmt.Sprintf("expected status 401, got %d", res.statusCode))
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// checkExamples validates the JSON examples of the request body and of the responses against their schemas
+func checkExamples(op *openapi.Operation) result {
+	res := result{name: "examples"}
+	check := func(location string, content map[string]openapi.MediaType) {
+		for mt, entry := range content {
+			if len(entry.Example) == 0 || mt != "application/json" {
+				continue
+			}
+			if err := entry.Schema.ValidateJSON(entry.Example); err != nil {
+				res.problems = append(res.problems, location+" example: "+err.Error())
+			}
+		}
+	}
+
+	if op.RequestBody != nil {
+		check("request", op.RequestBody.Content)
+	}
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		check(code, op.Responses[code].Content)
+	}
+	return res
+}
+
+// checkCall sends a request built from the specification and validates the request and the response. A successful
+// (2xx) status is expected when a token is given.
+func checkCall(spec *openapi.Spec, op *openapi.Operation, f *fixture, name string, token string) result {
+	res := result{name: name}
+
+	req, err := buildRequest(op, f)
+	if err != nil {
+		res.problems = append(res.problems, "building request: "+err.Error())
+		return res
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// Validate a clone of the request: validation consumes multipart bodies
+	clone, err := cloneRequest(req)
+	if err != nil {
+		res.problems = append(res.problems, "cloning request: "+err.Error())
+		return res
+	}
+	if _, err := spec.ValidateRequest(clone); err != nil {
+		res.problems = append(res.problems, "request: "+err.Error())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		res.problems = append(res.problems, "sending request: "+err.Error())
+		return res
+	}
+	defer resp.Body.Close()
+	res.statusCode = resp.StatusCode
+	res.body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		res.problems = append(res.problems, "reading response: "+err.Error())
+		return res
+	}
+
+	if token != "" && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		res.problems = append(res.problems, fmt.Sprintf("expected a successful status, got %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(res.body))))
+	}
+	if err := op.ValidateResponse(resp.StatusCode, resp.Header, res.body); err != nil {
+		res.problems = append(res.problems, "response: "+err.Error())
+	}
+	return res
+}
+
+// buildRequest builds the request for an operation: path parameters come from the fixture, required query parameters
+// and the body are generated from their schemas
+func buildRequest(op *openapi.Operation, f *fixture) (*http.Request, error) {
+	path := op.Path
+	query := url.Values{}
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			value, ok := f.pathValue(p.Name)
+			if !ok {
+				return nil, fmt.Errorf("no fixture value for path parameter %q", p.Name)
+			}
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(value))
+		case "query":
+			if p.Required {
+				query.Set(p.Name, fmt.Sprint(sampleValue(p.Name, p.Schema, f)))
+			}
+		}
+	}
+	target := f.server.URL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	if op.RequestBody == nil {
+		return http.NewRequest(op.Method, target, nil)
+	}
+
+	types := make([]string, 0, len(op.RequestBody.Content))
+	for mt := range op.RequestBody.Content {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	contentType := types[0]
+	for _, mt := range types {
+		if mt == "application/json" {
+			contentType = mt
+		}
+	}
+	schema := op.RequestBody.Content[contentType].Schema
+
+	var body bytes.Buffer
+	switch contentType {
+	case "application/json":
+		if err := json.NewEncoder(&body).Encode(sampleValue("body", schema, f)); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		mw := multipart.NewWriter(&body)
+		if err := writeSampleForm(mw, schema, f); err != nil {
+			return nil, err
+		}
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		contentType = mw.FormDataContentType()
+	default:
+		return nil, fmt.Errorf("unsupported request content type %q", contentType)
+	}
+
+	req, err := http.NewRequest(op.Method, target, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// writeSampleForm writes the required fields of a multipart schema; binary fields are sent as PNG files
+func writeSampleForm(mw *multipart.Writer, schema *openapi.Schema, f *fixture) error {
+	schema = schema.Resolved()
+	for _, name := range schema.Required {
+		prop := schema.Properties[name].Resolved()
+		if prop.Format == "binary" {
+			fw, err := mw.CreateFormFile(name, name+".png")
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(samplePNG()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mw.WriteField(name, fmt.Sprint(sampleValue(name, prop, f))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sampleValue generates a valid value for a schema. Identifiers are taken from the fixture by property name, so that
+// requests refer to existing users, conversations and messages.
+func sampleValue(name string, schema *openapi.Schema, f *fixture) interface{} {
+	switch name {
+	case "userId", "targetUserId", "memberId":
+		return f.carol.UserID()
+	case "conversationId":
+		return f.group
+	case "replyTo", "replyToId", "messageId":
+		return f.message
+	case "members":
+		return []string{f.carol.UserID()}
+	case "q":
+		return "bob"
+	case "challenge":
+		return f.challenge
+	case "code":
+		if f.operation == "completeOIDCLogin" {
+			return f.oidcCode
+		}
+		return f.twoFactorCode()
+	case "state":
+		return f.oidcState
+	case "options":
+		// The options of a poll must be unique
+		if f.operation == "createPoll" {
+			return []string{"Monday", "Tuesday"}
+		}
+	}
+
+	if schema == nil {
+		return "contract"
+	}
+	schema = schema.Resolved()
+	if schema.Example != nil {
+		return schema.Example
+	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
+
+	switch schema.Type {
+	case "object":
+		obj := make(map[string]interface{})
+		for _, prop := range schema.Required {
+			obj[prop] = sampleValue(prop, schema.Properties[prop], f)
+		}
+		return obj
+	case "array":
+		n := 1
+		if schema.MinItems != nil && *schema.MinItems > n {
+			n = *schema.MinItems
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = sampleValue(name, schema.Items, f)
+		}
+		return items
+	case "integer", "number":
+		if schema.Minimum != nil {
+			return *schema.Minimum
+		}
+		return 1
+	case "boolean":
+		return true
+	default:
+		return "contract"
+	}
+}
+
+// cloneRequest copies a request, including its body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil {
+		return clone, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	clone.Body = io.NopCloser(bytes.NewReader(data))
+	return clone, nil
+}
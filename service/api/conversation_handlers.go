@@ -2,8 +2,11 @@ package api
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -28,7 +31,7 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 	}
 
 	// 2. Parse request body to get target user ID
-	var req StartConversationRequest
+	var req types.StartConversationRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -64,11 +67,12 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 	}
 
 	// 7. Return conversation details
-	response := ConversationDetailResponse{
-		ID:       conversation.ID,
-		Type:     conversation.Type,
-		Members:  make([]UserResponse, len(conversation.Participants)),
-		Messages: []MessageResponse{}, // Empty for new conversations
+	response := types.ConversationDetailResponse{
+		ID:           conversation.ID,
+		Type:         conversation.Type,
+		MessageTimer: conversation.MessageTTL,
+		Members:      make([]types.UserResponse, len(conversation.Participants)),
+		Messages:     []types.MessageResponse{}, // Empty for new conversations
 	}
 
 	// Set conversation name to other participant's name
@@ -80,10 +84,11 @@ func (rt *_router) startConversation(w http.ResponseWriter, r *http.Request, ps
 
 	// Convert participants to response format
 	for i, participant := range conversation.Participants {
-		response.Members[i] = UserResponse{
+		response.Members[i] = types.UserResponse{
 			ID:       participant.ID,
 			Username: participant.Username,
 			PhotoURL: participant.PhotoURL,
+			IsBot:    participant.IsBot,
 		}
 	}
 
@@ -109,7 +114,19 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	// 2. Retrieve all conversations for the user from database
+	// 2. Answer conditional requests without loading the conversations when nothing changed
+	etag := ""
+	if version, err := rt.db.GetConversationsVersion(ctx.UserID); err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to compute conversations version") // The full list is sent
+	} else {
+		etag = weakETag(version)
+		if matchesETag(r, etag) {
+			sendNotModified(w, etag)
+			return
+		}
+	}
+
+	// 3. Retrieve all conversations for the user from database
 	dbConversations, err := rt.db.GetUserConversations(ctx.UserID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("failed to retrieve user conversations")
@@ -117,57 +134,73 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	// 3. Map database models to API response format
-	response := ConversationsResponse{
-		Conversations: make([]ConversationResponse, len(dbConversations)),
+	// 4. Map database models to API response format
+	response := types.ConversationsResponse{
+		Conversations: make([]types.ConversationResponse, len(dbConversations)),
 	}
 
 	for i, dbConv := range dbConversations {
-		// Convert each ConversationPreview to ConversationResponse
-		convResp := ConversationResponse{
-			ID:          dbConv.ID,
-			Type:        dbConv.Type,
-			UnreadCount: dbConv.UnreadCount,
-		}
+		response.Conversations[i] = toConversationResponse(dbConv)
+	}
 
-		// Handle name - check if direct conversation and use other participant's name if available
-		switch {
-		case dbConv.Type == "direct" && dbConv.OtherParticipant != nil:
-			convResp.Name = dbConv.OtherParticipant.Username
-		case dbConv.Name != nil:
-			convResp.Name = *dbConv.Name
-		default:
-			convResp.Name = ConversationTypeDefault // Fallback name
-		}
+	// 5. Return the response as JSON
+	if etag != "" {
+		setETag(w, etag)
+	}
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send conversations response")
+	}
 
-		// Handle photo URL - for direct conversations, use other participant's photo
-		switch {
-		case dbConv.Type == "direct" && dbConv.OtherParticipant != nil:
-			convResp.PhotoURL = dbConv.OtherParticipant.PhotoURL
-		default:
-			convResp.PhotoURL = dbConv.PhotoURL
-		}
+	ctx.Logger.Info("Retrieved conversations successfully", "count", len(dbConversations))
+}
 
-		// Convert last message if present
-		if dbConv.LastMessage != nil {
-			convResp.LastMessage = &MessagePreview{
-				ID:             dbConv.LastMessage.ID,
-				Content:        dbConv.LastMessage.Content,
-				Timestamp:      dbConv.LastMessage.Timestamp,
-				SenderUsername: dbConv.LastMessage.SenderUsername,
-				HasPhoto:       dbConv.LastMessage.HasPhoto,
-			}
-		}
+// toConversationResponse converts a conversation preview to its response format
+func toConversationResponse(dbConv database.ConversationPreview) types.ConversationResponse {
+	convResp := types.ConversationResponse{
+		ID:             dbConv.ID,
+		Type:           dbConv.Type,
+		UnreadCount:    dbConv.UnreadCount,
+		UnreadMentions: dbConv.UnreadMentions,
+		MessageTimer:   dbConv.MessageTTL,
+	}
 
-		response.Conversations[i] = convResp
+	// Handle name - check if direct conversation and use other participant's name if available
+	switch {
+	case dbConv.Type == "direct" && dbConv.OtherParticipant != nil:
+		convResp.Name = dbConv.OtherParticipant.Username
+	case dbConv.Name != nil:
+		convResp.Name = *dbConv.Name
+	default:
+		convResp.Name = ConversationTypeDefault // Fallback name
 	}
 
-	// 4. Return the response as JSON
-	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
-		ctx.Logger.WithError(err).Error("failed to send conversations response")
+	// Handle photo URL - for direct conversations, use other participant's photo
+	switch {
+	case dbConv.Type == "direct" && dbConv.OtherParticipant != nil:
+		convResp.PhotoURL = dbConv.OtherParticipant.PhotoURL
+	default:
+		convResp.PhotoURL = dbConv.PhotoURL
 	}
 
-	ctx.Logger.Info("Retrieved conversations successfully", "count", len(dbConversations))
+	// Convert last message if present
+	if dbConv.LastMessage != nil {
+		convResp.LastMessage = &types.MessagePreview{
+			ID:             dbConv.LastMessage.ID,
+			Content:        dbConv.LastMessage.Content,
+			Timestamp:      dbConv.LastMessage.Timestamp,
+			SenderUsername: dbConv.LastMessage.SenderUsername,
+			HasPhoto:       dbConv.LastMessage.HasPhoto,
+			AttachmentName: dbConv.LastMessage.AttachmentName,
+		}
+	}
+
+	// Convert the draft of the user if present
+	if dbConv.Draft != nil {
+		draft := toDraftResponse(*dbConv.Draft)
+		convResp.Draft = &draft
+	}
+
+	return convResp
 }
 
 // getConversation handles getting messages in a specific conversation
@@ -206,6 +239,14 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
+	// Answer conditional requests without loading the messages when nothing changed
+	if version, err := rt.db.GetConversationVersion(conversationID, ctx.UserID); err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to compute conversation version")
+	} else if etag := weakETag(version); matchesETag(r, etag) {
+		sendNotModified(w, etag)
+		return
+	}
+
 	// 5. Get conversation details (type, name, photo, members)
 	conversationDetails, err := rt.db.GetConversation(conversationID, ctx.UserID)
 	if err != nil {
@@ -219,6 +260,14 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 		ctx.Logger.WithError(err).Warn("Failed to mark conversation as read") // Don't fail the request for this
 	}
 
+	// The entity tag is computed once the conversation is read, as reading changes it
+	etag := ""
+	if version, err := rt.db.GetConversationVersion(conversationID, ctx.UserID); err != nil {
+		ctx.Logger.WithError(err).Warn("Failed to compute conversation version") // The response is sent without it
+	} else {
+		etag = weakETag(version)
+	}
+
 	// 7. Get all messages in conversation with sender info
 	messages, err := rt.db.GetConversationMessages(conversationID)
 	if err != nil {
@@ -228,9 +277,10 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 	}
 
 	// 8. Format response as JSON with conversation details and messages
-	response := ConversationDetailResponse{
-		ID:   conversationDetails.ID,
-		Type: conversationDetails.Type,
+	response := types.ConversationDetailResponse{
+		ID:           conversationDetails.ID,
+		Type:         conversationDetails.Type,
+		MessageTimer: conversationDetails.MessageTTL,
 	}
 
 	// Handle conversation name - for direct conversations, use other participant's name
@@ -256,48 +306,72 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 	response.LastMessageAt = &conversationDetails.LastMessageAt
 
 	// Convert participants to members format
-	response.Members = make([]UserResponse, len(conversationDetails.Participants))
+	response.Members = make([]types.UserResponse, len(conversationDetails.Participants))
 	for i, participant := range conversationDetails.Participants {
-		response.Members[i] = UserResponse{
+		response.Members[i] = types.UserResponse{
 			ID:       participant.ID,
 			Username: participant.Username,
 			PhotoURL: participant.PhotoURL,
+			IsBot:    participant.IsBot,
 		}
 	}
 
 	// Convert messages to response format
-	response.Messages = make([]MessageResponse, len(messages))
+	response.Messages = make([]types.MessageResponse, len(messages))
 	for i, msg := range messages {
-		// Convert comments/reactions
-		comments := make([]CommentResponse, len(msg.Comments))
-		for j, comment := range msg.Comments {
-			comments[j] = CommentResponse{
-				ID:        comment.ID,
-				UserID:    comment.UserID,
-				Username:  comment.Username,
-				Emoticon:  comment.Emoticon,
-				Timestamp: comment.CreatedAt,
-			}
-		}
-
-		response.Messages[i] = MessageResponse{
-			ID:             msg.ID,
-			SenderID:       msg.SenderID,
-			SenderUsername: msg.SenderUsername,
-			Content:        msg.Content,
-			PhotoURL:       msg.PhotoURL,
-			ReplyToID:      msg.ReplyToID,
-			Forwarded:      msg.Forwarded,
-			Timestamp:      msg.CreatedAt,
-			Status:         msg.Status,
-			Comments:       comments,
-		}
+		response.Messages[i] = toMessageResponse(msg, ctx.UserID)
 	}
 
 	// 8. Return the response as JSON
+	if etag != "" {
+		setETag(w, etag)
+	}
 	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
 		ctx.Logger.WithError(err).Error("failed to send conversation response")
 	}
 
 	ctx.Logger.Info("Retrieved conversation successfully", "conversationID", conversationID, "messageCount", len(messages))
 }
+
+// setMessageTimer handles changing how long new messages of a conversation last before disappearing
+func (rt *_router) setMessageTimer(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only change your own conversations", ctx)
+		return
+	}
+
+	// 2. Validate conversationId format
+	conversationID := ps.ByName("conversationId")
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Parse and validate request body
+	var req types.SetMessageTimerRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validateMessageTimer(req.Seconds); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 4. Update the timer; the database announces the change in the conversation
+	if _, err := rt.db.SetMessageTimer(conversationID, userID, req.Seconds); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to set message timer")
+		if strings.Contains(err.Error(), "not a participant") {
+			sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to conversation", ctx)
+		} else {
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to set message timer", ctx)
+		}
+		return
+	}
+
+	// 5. Return success response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Message timer updated successfully", "conversationID", conversationID, "seconds", req.Seconds)
+}
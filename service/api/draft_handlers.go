@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getDraft handles retrieving the draft of the user in a conversation
+func (rt *_router) getDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only access your own drafts", ctx)
+		return
+	}
+
+	// 2. Validate conversationId format
+	conversationID := ps.ByName("conversationId")
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Get the draft from database
+	draft, err := rt.db.GetDraft(conversationID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Draft not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to get draft")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get draft", ctx)
+		}
+		return
+	}
+
+	// 4. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, toDraftResponse(*draft)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send draft response")
+	}
+}
+
+// saveDraft handles creating or replacing the draft of the user in a conversation
+func (rt *_router) saveDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only save your own drafts", ctx)
+		return
+	}
+
+	// 2. Validate conversationId format
+	conversationID := ps.ByName("conversationId")
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Parse and validate request body
+	var req types.SaveDraftRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validateMessageContent(req.Content); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 4. Save the draft
+	draft, err := rt.db.SaveDraft(conversationID, userID, req.Content, req.ReplyTo)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to save draft")
+		switch {
+		case strings.Contains(err.Error(), "not a participant"):
+			sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to conversation", ctx)
+		case strings.Contains(err.Error(), "reply"):
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid reply target", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to save draft", ctx)
+		}
+		return
+	}
+
+	// 5. Return the saved draft
+	if err := sendJSONResponse(w, http.StatusOK, toDraftResponse(*draft)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send draft response")
+	}
+}
+
+// deleteDraft handles discarding the draft of the user in a conversation
+func (rt *_router) deleteDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only delete your own drafts", ctx)
+		return
+	}
+
+	// 2. Validate conversationId format
+	conversationID := ps.ByName("conversationId")
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Delete the draft
+	if err := rt.db.DeleteDraft(conversationID, userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Draft not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to delete draft")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete draft", ctx)
+		}
+		return
+	}
+
+	// 4. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toDraftResponse converts a draft to its response format
+func toDraftResponse(draft database.Draft) types.DraftResponse {
+	return types.DraftResponse{
+		Content:   draft.Content,
+		ReplyToID: draft.ReplyToID,
+		UpdatedAt: draft.UpdatedAt,
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// uploadsCacheControl is sent with uploaded media: files are never changed once written (every upload gets a new
+// name), so clients can keep them for a year without asking again
+const uploadsCacheControl = "public, max-age=31536000, immutable"
+
+// weakETag builds a weak entity tag from the version of a resource (see e.g. database.GetConversationsVersion).
+// Responses are only semantically equivalent for the same version, as their JSON encoding may vary.
+func weakETag(version string) string {
+	sum := sha256.Sum256([]byte(version))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchesETag reports whether the If-None-Match header of a request matches etag, using the weak comparison required
+// for GET requests
+func matchesETag(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// setETag sets the entity tag of a response. Responses are private to the user and must be revalidated before being
+// reused, which is cheap with the entity tag.
+func setETag(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+}
+
+// sendNotModified answers a conditional request whose entity tag still matches
+func sendNotModified(w http.ResponseWriter, etag string) {
+	setETag(w, etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// serveUploads serves the files of dir like httprouter's ServeFiles, making them cacheable for a long time. Errors
+// (e.g., a deleted file) are not cached.
+func serveUploads(dir string) httprouter.Handle {
+	fileServer := http.FileServer(http.Dir(dir))
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		r.URL.Path = ps.ByName("filepath")
+		fileServer.ServeHTTP(&cachingWriter{ResponseWriter: w}, r)
+	}
+}
+
+// cachingWriter adds the Cache-Control header of uploads to successful responses
+type cachingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (cw *cachingWriter) WriteHeader(statusCode int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if statusCode == http.StatusOK || statusCode == http.StatusPartialContent || statusCode == http.StatusNotModified {
+			cw.Header().Set("Cache-Control", uploadsCacheControl)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *cachingWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/export"
+	"github.com/julienschmidt/httprouter"
+)
+
+// exporter returns the archive writer backed by the router database and the uploads and attachments directories
+func (rt *_router) exporter() *export.Exporter {
+	return &export.Exporter{
+		DB:            rt.db,
+		MediaDir:      filepath.Join("tmp", "uploads"),
+		AttachmentDir: attachmentsDir,
+	}
+}
+
+// exportConversation handles downloading a conversation as a ZIP archive (JSON document + HTML transcript)
+func (rt *_router) exportConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only export your own conversations", ctx)
+		return
+	}
+
+	// 2. Get and validate conversationId
+	conversationID := ps.ByName("conversationId")
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Only participants can export a conversation
+	isParticipant, err := rt.db.IsUserInConversation(conversationID, ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check user participation")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to check conversation participation", ctx)
+		return
+	}
+	if !isParticipant {
+		sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to conversation", ctx)
+		return
+	}
+
+	// 4. Stream the archive
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%s.zip"`, conversationID))
+
+	sw := &streamWriter{w: w}
+	if err := rt.exporter().WriteConversation(sw, conversationID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to export conversation")
+		sw.fail(http.StatusInternalServerError, "Failed to export conversation", ctx)
+		return
+	}
+
+	ctx.Logger.Info("Conversation exported successfully", "conversationID", conversationID)
+}
+
+// streamWriter tracks whether a streamed response has started. Once the first byte is written the status code cannot
+// change anymore, so later errors can only be logged (the client receives a truncated archive).
+type streamWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.started = true
+	return sw.w.Write(p)
+}
+
+// fail sends an error response if nothing has been streamed yet
+func (sw *streamWriter) fail(statusCode int, message string, ctx reqcontext.RequestContext) {
+	if sw.started {
+		return
+	}
+	sw.w.Header().Del("Content-Disposition")
+	sendErrorResponse(sw.w, statusCode, message, ctx)
+}
+
+// exportAccount handles downloading the personal data of the authenticated user as a ZIP archive
+func (rt *_router) exportAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only export your own account", ctx)
+		return
+	}
+
+	// 2. Stream the archive
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%s.zip"`, userID))
+
+	sw := &streamWriter{w: w}
+	if err := rt.exporter().WriteAccount(sw, userID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to export account")
+		sw.fail(http.StatusInternalServerError, "Failed to export account", ctx)
+		return
+	}
+
+	ctx.Logger.Info("Account exported successfully", "userID", userID)
+}
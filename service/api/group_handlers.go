@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 )
@@ -13,7 +15,7 @@ import (
 // createGroup handles creating a new group conversation
 func (rt *_router) createGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// 1. Parse request body to get group name and member IDs
-	var req CreateGroupRequest
+	var req types.CreateGroupRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -79,16 +81,17 @@ func (rt *_router) createGroup(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 
 	// 7. Convert to response format
-	members := make([]UserResponse, len(group.Participants))
+	members := make([]types.UserResponse, len(group.Participants))
 	for i, participant := range group.Participants {
-		members[i] = UserResponse{
+		members[i] = types.UserResponse{
 			ID:       participant.ID,
 			Username: participant.Username,
 			PhotoURL: participant.PhotoURL,
+			IsBot:    participant.IsBot,
 		}
 	}
 
-	response := GroupResponse{
+	response := types.GroupResponse{
 		ID:        group.ID,
 		Name:      *group.Name, // Groups always have names
 		PhotoURL:  group.PhotoURL,
@@ -118,7 +121,7 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 	}
 
 	// 3. Parse request body to get userId to add
-	var req AddToGroupRequest
+	var req types.AddToGroupRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -167,7 +170,7 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 	}
 
 	// 8. Add user to group participants
-	err = rt.db.AddUserToGroup(groupID, req.UserID)
+	err = rt.db.AddUserToGroup(groupID, req.UserID, currentUserID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to add user to group")
 		if strings.Contains(err.Error(), "not found") {
@@ -178,7 +181,8 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	// 9. Return success response
+	// 9. Notify the webhooks and return success response
+	rt.emitWebhookEvent(groupID, database.WebhookEventMemberJoined, MemberEventData{UserID: req.UserID, ActorID: currentUserID})
 	w.WriteHeader(http.StatusNoContent)
 	ctx.Logger.Info("User added to group successfully", "groupID", groupID, "userID", req.UserID, "addedBy", currentUserID)
 }
@@ -223,7 +227,8 @@ func (rt *_router) leaveGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	// 6. Return 204 No Content response
+	// 6. Notify the webhooks and return 204 No Content response
+	rt.emitWebhookEvent(groupID, database.WebhookEventMemberLeft, MemberEventData{UserID: userID})
 	w.WriteHeader(http.StatusNoContent)
 	ctx.Logger.Info("User left group successfully", "groupID", groupID, "userID", userID)
 }
@@ -241,7 +246,7 @@ func (rt *_router) setGroupName(w http.ResponseWriter, r *http.Request, ps httpr
 	}
 
 	// 3. Parse request body to get new group name
-	var req UpdateGroupNameRequest
+	var req types.UpdateGroupNameRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -270,7 +275,7 @@ func (rt *_router) setGroupName(w http.ResponseWriter, r *http.Request, ps httpr
 	}
 
 	// 7. Update group name in database
-	err = rt.db.UpdateGroupName(groupID, req.Name)
+	err = rt.db.UpdateGroupName(groupID, req.Name, userID)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("Failed to update group name")
 		if strings.Contains(err.Error(), "not found") {
@@ -395,7 +400,8 @@ func (rt *_router) removeMemberFromGroup(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// 5. Return success response
+	// 5. Notify the webhooks and return success response
+	rt.emitWebhookEvent(groupID, database.WebhookEventMemberLeft, MemberEventData{UserID: memberID, ActorID: adminUserID})
 	w.WriteHeader(http.StatusNoContent)
 	ctx.Logger.Info("Member removed from group successfully", "groupID", groupID, "memberID", memberID, "adminID", adminUserID)
 }
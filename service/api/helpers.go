@@ -6,12 +6,18 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/export"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
 )
 
 // === VALIDATION HELPERS ===
@@ -72,6 +78,44 @@ func validateMessageContent(content string) error {
 	return nil
 }
 
+// Bounds of a custom disappearing messages timer, in seconds
+const (
+	minMessageTimer = 60
+	maxMessageTimer = 365 * 24 * 60 * 60
+)
+
+// validateMessageTimer validates a disappearing messages timer: 0 (off) or between one minute and one year
+func validateMessageTimer(seconds int64) error {
+	if seconds != 0 && (seconds < minMessageTimer || seconds > maxMessageTimer) {
+		return fmt.Errorf("message timer must be 0 (off) or between %d and %d seconds", minMessageTimer, maxMessageTimer)
+	}
+	return nil
+}
+
+// validateSendAt validates the sending time of a scheduled message, which must be in the future
+func validateSendAt(sendAt time.Time) error {
+	if !sendAt.After(globaltime.Now()) {
+		return fmt.Errorf("sendAt must be in the future")
+	}
+	return nil
+}
+
+// parseSendAt parses the sendAt field of a multipart form (RFC 3339); nil is returned if the field is missing
+func parseSendAt(r *http.Request) (*time.Time, error) {
+	value := r.FormValue("sendAt")
+	if value == "" {
+		return nil, nil
+	}
+	sendAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("sendAt must be an RFC 3339 date-time")
+	}
+	if err := validateSendAt(sendAt); err != nil {
+		return nil, err
+	}
+	return &sendAt, nil
+}
+
 // validateEmoticon validates emoticon format
 func validateEmoticon(emoticon string) error {
 	if emoticon == "" {
@@ -83,6 +127,46 @@ func validateEmoticon(emoticon string) error {
 	return nil
 }
 
+// validateWebhookURL validates the URL of a webhook: an absolute http(s) URL of at most 2048 characters. Private
+// addresses are refused when delivering, since host names can change address.
+func validateWebhookURL(rawURL string) error {
+	if len(rawURL) > 2048 {
+		return fmt.Errorf("url must be at most 2048 characters")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not contain credentials")
+	}
+	return nil
+}
+
+// validateWebhookEvents validates the events a webhook subscribes to, returning them without duplicates
+func validateWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("events must list at least one event")
+	}
+
+	var unique []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		known := false
+		for _, supported := range database.WebhookEvents {
+			known = known || event == supported
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			unique = append(unique, event)
+		}
+	}
+	return unique, nil
+}
+
 // === HTTP HELPERS ===
 
 // parseJSONRequest parses JSON request body into the provided struct
@@ -121,7 +205,7 @@ func sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) e
 func sendErrorResponse(w http.ResponseWriter, statusCode int, message string, ctx reqcontext.RequestContext) {
 	ctx.Logger.WithField("error", message).Error("API error response")
 
-	response := ErrorResponse{Message: message}
+	response := types.ErrorResponse{Message: message}
 	if err := sendJSONResponse(w, statusCode, response); err != nil {
 		ctx.Logger.WithError(err).Error("failed to send error response")
 	}
@@ -137,7 +221,7 @@ func getQueryParam(r *http.Request, paramName string) string {
 // validateImageFile validates uploaded image file (for profile/group photos)
 func validateImageFile(r *http.Request, fieldName string) error {
 	// Parse multipart form (max 10MB)
-	err := r.ParseMultipartForm(10 * 1024 * 1024) // 10MB
+	err := r.ParseMultipartForm(maxImageSize)
 	if err != nil {
 		return fmt.Errorf("failed to parse multipart form: %w", err)
 	}
@@ -148,8 +232,13 @@ func validateImageFile(r *http.Request, fieldName string) error {
 	}
 	defer file.Close()
 
+	return validateImageHeader(header)
+}
+
+// validateImageHeader validates the size and the type of an uploaded image
+func validateImageHeader(header *multipart.FileHeader) error {
 	// Validate file size
-	if header.Size > 10*1024*1024 { // 10MB
+	if header.Size > maxImageSize {
 		return fmt.Errorf("file size exceeds 10MB limit")
 	}
 
@@ -210,6 +299,26 @@ func saveUploadedImage(file multipart.File, category, filename string) (string,
 	return urlPath, nil
 }
 
+// removeUploadedFiles deletes the files behind the given uploads URLs (e.g., "/uploads/profiles/x.png")
+// Missing files are ignored; returns the number of removed files
+func removeUploadedFiles(urls []string) (int, error) {
+	removed := 0
+	for _, url := range urls {
+		path, err := export.MediaPath(filepath.Join("tmp", "uploads"), url)
+		if err != nil {
+			return removed, err
+		}
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, fmt.Errorf("failed to remove uploaded file: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
 // initializeUploadsDirectory creates the temporary uploads directory structure
 // Call this at application startup to ensure directories exist
 func initializeUploadsDirectory() error {
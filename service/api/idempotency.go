@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultIdempotencyWindow is how long the responses of requests sent with an idempotency key are kept, unless
+// configured otherwise
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyPendingTimeout is how long a request holding an idempotency key can take. Keys held longer are
+// considered abandoned (e.g., the server stopped while handling the request) and can be used again.
+const idempotencyPendingTimeout = 5 * time.Minute
+
+// maxIdempotencyKeyLength is the maximum length of an idempotency key
+const maxIdempotencyKeyLength = 255
+
+// idempotent makes a handler honour idempotency keys. The first request with a key is handled normally and its
+// response is saved; retries with the same key and the same request get the saved response again, with the original
+// status, while requests reusing the key for something else are rejected. Requests without a key are passed through.
+// Responses with a 5xx status are not saved, so that the request can be retried.
+func (rt *_router) idempotent(fn httpRouterHandler) httpRouterHandler {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		// 1. Requests without a key are handled right away. JSON bodies may hold the key, so they are always read.
+		if r.Header.Get(types.IdempotencyKeyHeader) == "" && !isJSONRequest(r) {
+			fn(w, r, ps, ctx)
+			return
+		}
+
+		// 2. Read the request body, which is both fingerprinted and handled. Bodies can be as large as the largest
+		// upload (see maxUploadSize).
+		maxBodySize := rt.maxUploadSize()
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Failed to read request body", ctx)
+			return
+		}
+		if int64(len(body)) > maxBodySize {
+			sendErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large", ctx)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 3. Get the idempotency key, if any
+		key, err := idempotencyKey(r, body)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+		if key == "" {
+			fn(w, r, ps, ctx)
+			return
+		}
+
+		// 4. Reserve the key, or get the request that used it first
+		hash := requestHash(r, body)
+		now := globaltime.Now()
+		record, err := rt.db.ReserveIdempotencyKey(ctx.UserID, key, hash, now.Add(-rt.idempotencyWindow),
+			now.Add(-idempotencyPendingTimeout))
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to reserve idempotency key")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to process request", ctx)
+			return
+		}
+		if record != nil {
+			switch {
+			case record.RequestHash != hash:
+				sendErrorResponse(w, http.StatusUnprocessableEntity, "Idempotency key already used for a different request", ctx)
+			case record.StatusCode == nil:
+				sendErrorResponse(w, http.StatusConflict, "A request with this idempotency key is still being processed", ctx)
+			default:
+				replayResponse(w, *record.StatusCode, record.Response, ctx)
+				ctx.Logger.Info("Idempotent response replayed", "status", *record.StatusCode)
+			}
+			return
+		}
+
+		// 5. Handle the request, saving its response
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		completed := false
+		defer func() {
+			if !completed {
+				if err := rt.db.ReleaseIdempotencyKey(ctx.UserID, key); err != nil {
+					ctx.Logger.WithError(err).Error("Failed to release idempotency key")
+				}
+			}
+		}()
+		fn(rec, r, ps, ctx)
+
+		if rec.statusCode >= 500 || rec.truncated {
+			return
+		}
+		if err := rt.db.CompleteIdempotencyKey(ctx.UserID, key, rec.statusCode, rec.body.Bytes()); err != nil {
+			// The response has been sent, the key is released so that a retry is handled again
+			ctx.Logger.WithError(err).Error("Failed to save idempotent response")
+			return
+		}
+		completed = true
+	}
+}
+
+// idempotencyKey returns the idempotency key of a request, from the Idempotency-Key header or from the clientMessageId
+// field of a JSON body; an empty string means the request has no key
+func idempotencyKey(r *http.Request, body []byte) (string, error) {
+	key := r.Header.Get(types.IdempotencyKeyHeader)
+
+	if isJSONRequest(r) {
+		var fields struct {
+			ClientMessageID *string `json:"clientMessageId"`
+		}
+		// Malformed bodies are rejected by the handler
+		if json.Unmarshal(body, &fields) == nil && fields.ClientMessageID != nil {
+			if key != "" && key != *fields.ClientMessageID {
+				return "", fmt.Errorf("%s header and clientMessageId differ", types.IdempotencyKeyHeader)
+			}
+			key = *fields.ClientMessageID
+			if key == "" {
+				return "", fmt.Errorf("clientMessageId cannot be empty")
+			}
+		}
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			return "", fmt.Errorf("idempotency key must contain only printable ASCII characters")
+		}
+	}
+	return key, nil
+}
+
+// isJSONRequest reports whether the body of a request is JSON
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+// requestHash returns the fingerprint of a request: its method, path and body. The boundary of multipart bodies is
+// left out, as clients may pick a new one when they retry.
+func requestHash(r *http.Request, body []byte) string {
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayResponse sends again the saved response of an idempotent request
+func replayResponse(w http.ResponseWriter, statusCode int, body []byte, ctx reqcontext.RequestContext) {
+	if len(body) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set(types.IdempotencyReplayedHeader, "true")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send replayed response")
+	}
+}
+
+// pruneIdempotencyKeys deletes the idempotency keys older than the idempotency window
+func (rt *_router) pruneIdempotencyKeys() {
+	deleted, err := rt.db.DeleteExpiredIdempotencyKeys(globaltime.Now().Add(-rt.idempotencyWindow))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting expired idempotency keys")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("expired idempotency keys deleted")
+	}
+}
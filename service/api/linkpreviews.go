@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/linkpreview"
+)
+
+// linkPreviewQueueSize is the number of links waiting for their preview; links sent while the queue is full get no
+// preview
+const linkPreviewQueueSize = 100
+
+// Cached previews are fetched again when a message links them after these durations
+const (
+	linkPreviewCacheTTL   = 24 * time.Hour
+	linkPreviewRetryAfter = time.Hour
+)
+
+// queueLinkPreview requests the preview of the link in a message, unless it is already available. Previews are
+// fetched in background by the goroutine started with runLinkPreviewWorker.
+func (rt *_router) queueLinkPreview(message *database.Message) {
+	if rt.linkPreviews == nil || message.LinkURL == nil {
+		return
+	}
+	if message.LinkPreview != nil && globaltime.Since(message.LinkPreview.FetchedAt) < linkPreviewCacheTTL {
+		return
+	}
+
+	select {
+	case rt.linkPreviewQueue <- *message.LinkURL:
+	default:
+		rt.baseLogger.WithField("messageID", message.ID).Warning("link preview queue is full, skipping preview")
+	}
+}
+
+// runLinkPreviewWorker starts a background goroutine fetching the queued link previews, until stopBackground is
+// called. Requests in progress are cancelled when stopping.
+func (rt *_router) runLinkPreviewWorker() {
+	rt.background.Add(1)
+
+	go func() {
+		defer rt.background.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-rt.stop
+			cancel()
+		}()
+
+		for {
+			select {
+			case <-rt.stop:
+				return
+			case link := <-rt.linkPreviewQueue:
+				rt.updateLinkPreview(ctx, link)
+			}
+		}
+	}()
+}
+
+// updateLinkPreview fetches the preview of a link and caches it. Failures are cached as well, so that pages without
+// a preview are not requested again for every message.
+func (rt *_router) updateLinkPreview(ctx context.Context, link string) {
+	logger := rt.baseLogger.WithField("url", link)
+
+	// 1. The same link may have been queued more than once
+	cached, err := rt.db.GetLinkPreview(link)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		logger.WithError(err).Error("error retrieving cached link preview")
+		return
+	}
+	if cached != nil {
+		ttl := linkPreviewCacheTTL
+		if cached.Failed {
+			ttl = linkPreviewRetryAfter
+		}
+		if globaltime.Since(cached.FetchedAt) < ttl {
+			return
+		}
+	}
+
+	// 2. Fetch the page
+	preview := database.LinkPreview{URL: link}
+	fetched, err := rt.linkPreviews.Fetch(ctx, link)
+	switch {
+	case ctx.Err() != nil:
+		// Shutting down: the link will be fetched again when it is sent next time
+		return
+	case errors.Is(err, linkpreview.ErrNoPreview):
+		preview.Failed = true
+	case err != nil:
+		logger.WithError(err).Info("error fetching link preview")
+		preview.Failed = true
+	default:
+		preview.Title = fetched.Title
+		if fetched.Description != "" {
+			preview.Description = &fetched.Description
+		}
+		if fetched.ImageURL != "" {
+			preview.ImageURL = &fetched.ImageURL
+		}
+	}
+
+	// 3. Cache the result
+	preview.FetchedAt = globaltime.Now()
+	if err := rt.db.SaveLinkPreview(preview); err != nil {
+		logger.WithError(err).Error("error saving link preview")
+	}
+}
@@ -2,15 +2,19 @@ package api
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
 	"github.com/julienschmidt/httprouter"
 )
 
-// doLogin handles user login/registration
+// doLogin handles user login/registration. When passwords are enabled, accounts secured with a password require it,
+// while the others are logged in by name as usual.
 func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// Parse request body
-	var req LoginRequest
+	var req types.LoginRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -22,29 +26,126 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 		return
 	}
 
+	// Passwords are only considered when the server allows securing accounts
+	if !rt.passwords {
+		req.Password = nil
+	}
+	if req.Password != nil {
+		if err := validatePassword(*req.Password); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid password", ctx)
+			return
+		}
+	}
+
 	// Try to get existing user by username
 	user, err := rt.db.GetUserByUsername(req.Name)
 	if err != nil {
-		// User doesn't exist, create new user
+		// User doesn't exist, create new user, secured by the password if one was given
 		ctx.Logger.WithField("username", req.Name).Info("creating new user")
-		user, err = rt.db.CreateUser(req.Name)
+		if req.Password != nil {
+			var hash string
+			if hash, err = hashPassword(*req.Password); err == nil {
+				user, err = rt.db.CreateSecuredUser(req.Name, hash)
+			}
+		} else {
+			user, err = rt.db.CreateUser(req.Name)
+		}
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+			return
+		}
+	} else if user.IsBot {
+		// Bots authenticate with the token issued to their owner, never by name
+		sendErrorResponse(w, http.StatusForbidden, "Bots cannot log in, use the bot token", ctx)
+		return
+	} else if rt.passwords {
+		// Secured accounts require their password, legacy ones are logged in by name until they are claimed
+		hash, err := rt.db.GetUserPasswordHash(user.ID)
 		if err != nil {
+			ctx.Logger.WithError(err).Error("failed to get password")
 			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
 			return
 		}
+		if hash != "" && (req.Password == nil || !checkPassword(hash, *req.Password)) {
+			sendErrorResponse(w, http.StatusUnauthorized, "Invalid username or password", ctx)
+			return
+		}
+	}
+
+	// Single sign-on users log in with the identity provider only, as anyone can send their name
+	sso, err := rt.db.HasOIDCIdentity(user.ID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("failed to check single sign-on")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+	if sso {
+		sendErrorResponse(w, http.StatusForbidden, "This account logs in with single sign-on", ctx)
+		return
+	}
+
+	rt.startSession(w, user.ID, ctx)
+}
+
+// doLogout handles revoking the session the request is authenticated with, which stops working at once
+func (rt *_router) doLogout(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Delete the session
+	if err := rt.db.DeleteUserSession(ctx.Token); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			// Revoked by a concurrent request after the authentication
+			sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("failed to delete session")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	// 2. Remove it from the cache, so that it is not accepted again
+	rt.sessions.remove(ctx.Token)
+
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.WithField("user_id", ctx.UserID).Info("user logged out")
+}
+
+// startSession sends the session token of a user who logged in. Users with two-factor authentication get a challenge
+// instead, exchanged for a session by completeLogin.
+func (rt *_router) startSession(w http.ResponseWriter, userID string, ctx reqcontext.RequestContext) {
+	twoFactor, err := rt.db.GetTwoFactor(userID)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		ctx.Logger.WithError(err).Error("failed to get two-factor settings")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		challenge, err := rt.db.CreateLoginChallenge(userID, globaltime.Now().Add(loginChallengeTTL))
+		if err != nil {
+			ctx.Logger.WithError(err).Error("failed to create login challenge")
+			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+			return
+		}
+		response := types.LoginChallengeResponse{
+			Challenge: challenge.ID,
+			ExpiresAt: challenge.ExpiresAt,
+		}
+		if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+			ctx.Logger.WithError(err).Error("failed to encode response")
+		}
+		ctx.Logger.WithField("user_id", userID).Info("login challenge created")
+		return
 	}
 
 	// Create user session (token)
-	token, err := rt.db.CreateUserSession(user.ID)
+	token, err := rt.db.CreateUserSession(userID)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
 		return
 	}
 
 	// Prepare response
-	response := LoginResponse{
+	response := types.LoginResponse{
 		Identifier: token,
-		UserID:     user.ID,
+		UserID:     userID,
 	}
 
 	// Send response
@@ -52,5 +153,66 @@ func (rt *_router) doLogin(w http.ResponseWriter, r *http.Request, ps httprouter
 		ctx.Logger.WithError(err).Error("failed to encode response")
 	}
 
-	ctx.Logger.WithField("user_id", user.ID).Info("user login successful")
+	ctx.Logger.WithField("user_id", userID).Info("user login successful")
+}
+
+// completeLogin handles the second step of the login of users with two-factor authentication: a valid TOTP or
+// recovery code exchanges the challenge returned by doLogin for a session token
+func (rt *_router) completeLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Parse request body
+	var req types.CompleteLoginRequest
+	if err := parseJSONRequest(r, &req); err != nil || req.Challenge == "" || req.Code == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+
+	// 2. Get the challenge, which must not have expired
+	challenge, err := rt.db.GetLoginChallenge(req.Challenge, globaltime.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired challenge, log in again", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("failed to get login challenge")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	// 3. Check the code; too many wrong codes void the challenge
+	valid, err := rt.checkSecondFactor(challenge.UserID, req.Code)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("failed to check two-factor code")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+	if !valid {
+		if err := rt.db.FailLoginChallenge(challenge.ID, maxLoginChallengeAttempts); err != nil {
+			ctx.Logger.WithError(err).Error("failed to record wrong two-factor code")
+		}
+		sendErrorResponse(w, http.StatusUnauthorized, "Invalid code", ctx)
+		return
+	}
+
+	// 4. Exchange the challenge for a session
+	token, err := rt.db.CompleteLoginChallenge(challenge.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired challenge, log in again", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("failed to complete login")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	// 5. Send response
+	response := types.LoginResponse{
+		Identifier: token,
+		UserID:     challenge.UserID,
+	}
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to encode response")
+	}
+
+	ctx.Logger.WithField("user_id", challenge.UserID).Info("user login successful")
 }
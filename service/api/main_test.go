@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/api"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	// The database package logs through the standard logger
+	log.SetOutput(io.Discard)
+
+	// Uploaded files are written under the working directory: run inside a scratch directory
+	dir, err := os.MkdirTemp("", "wasatext-api-")
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "creating working directory:", err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "entering working directory:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newServer starts the API router on a new database and returns its URL. The configuration can be changed by
+// configure.
+func newServer(t *testing.T, configure ...func(*api.Config)) string {
+	t.Helper()
+
+	dbconn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wasatext.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = dbconn.Close() })
+	db, err := database.New(dbconn)
+	if err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := api.Config{Logger: logger, Database: db, ValidateRequests: true, ValidateResponses: true}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	router, err := api.New(cfg)
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	srv := httptest.NewServer(router.Handler())
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newClient returns a client of the server at serverURL, logged in as name unless name is empty
+func newClient(t *testing.T, serverURL, name string) *client.Client {
+	t.Helper()
+
+	c, err := client.New(serverURL)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	if name != "" {
+		if _, err := c.Login(context.Background(), name); err != nil {
+			t.Fatalf("logging in as %s: %v", name, err)
+		}
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Number of mentions returned by getMyMentions, unless the limit query parameter says otherwise
+const (
+	defaultMentionsLimit = 50
+	maxMentionsLimit     = 100
+)
+
+// getMyMentions handles listing the messages that mention the user, newest first. Older pages are requested with the
+// before query parameter, set to the ID of the last message received.
+func (rt *_router) getMyMentions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own mentions", ctx)
+		return
+	}
+
+	// 2. Parse the paging parameters
+	limit := defaultMentionsLimit
+	if value := getQueryParam(r, "limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMentionsLimit {
+			sendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxMentionsLimit), ctx)
+			return
+		}
+		limit = n
+	}
+	before := getQueryParam(r, "before")
+	if before != "" {
+		if err := validateID(before, "before"); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+	}
+
+	// 3. Get the mentions from database
+	mentioned, err := rt.db.GetUserMentions(userID, before, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusBadRequest, "Unknown message in before", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to get mentions")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get mentions", ctx)
+		}
+		return
+	}
+
+	// 4. Convert to response format
+	response := types.MentionsResponse{
+		Mentions: make([]types.MentionedMessageResponse, len(mentioned)),
+	}
+	for i, item := range mentioned {
+		response.Mentions[i] = types.MentionedMessageResponse{
+			ConversationID:   item.Message.ConversationID,
+			ConversationName: item.ConversationName,
+			Unread:           item.Unread,
+			Message:          toMessageResponse(item.Message, ctx.UserID),
+		}
+	}
+
+	// 5. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send mentions response")
+	}
+}
@@ -1,12 +1,13 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
-	"github.com/gofrs/uuid"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -62,16 +63,18 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 		ctx.Logger.Info("Auto-created direct conversation", "conversationID", conversationID, "targetUserID", targetUser.ID)
 	}
 
-	// 5. Parse request body for text message or multipart for photo
+	// 5. Parse request body for text message or multipart for photo or file
 	contentType := r.Header.Get("Content-Type")
 	var content *string
-	var photoURL *string
+	var photoURLs []string
+	var attachment *database.Attachment
 	var replyTo *string
+	var sendAt *time.Time
 
 	switch {
 	case strings.Contains(contentType, "application/json"):
 		// Text message
-		var req SendMessageRequest
+		var req types.SendMessageRequest
 		if err := parseJSONRequest(r, &req); err != nil {
 			sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 			return
@@ -83,29 +86,48 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 			return
 		}
 
+		if req.SendAt != nil {
+			if err := validateSendAt(*req.SendAt); err != nil {
+				sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+				return
+			}
+		}
+
 		content = &req.Content
 		replyTo = req.ReplyTo
+		sendAt = req.SendAt
 	case strings.Contains(contentType, "multipart/form-data"):
-		// Photo message
-		file, header, err := getUploadedFile(r, "photo")
-		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		r.Body = http.MaxBytesReader(w, r.Body, rt.maxUploadSize())
+		if err := r.ParseMultipartForm(maxImageSize); err != nil {
+			if strings.Contains(err.Error(), "request body too large") {
+				sendErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large", ctx)
+				return
+			}
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid multipart form", ctx)
 			return
 		}
-		defer file.Close()
-
-		// Generate filename for photo
-		filename := fmt.Sprintf("%s_%s", uuid.Must(uuid.NewV4()).String(), header.Filename)
+		if _, ok := r.MultipartForm.File["file"]; ok {
+			// File message
+			attachment, replyTo, ok = rt.parseAttachmentForm(w, r, ctx)
+			if !ok {
+				return
+			}
+			break
+		}
 
-		// Save photo file
-		savedPhotoURL, err := saveUploadedImage(file, "messages", filename)
+		// Photo message: a single photo or an album, with an optional caption. Check the optional sendAt before
+		// storing the photos.
+		sendAt, err = parseSendAt(r)
 		if err != nil {
-			ctx.Logger.Error("Failed to save message photo", "error", err)
-			sendErrorResponse(w, http.StatusInternalServerError, "Failed to save photo", ctx)
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
 			return
 		}
 
-		photoURL = &savedPhotoURL
+		var ok bool
+		photoURLs, content, ok = rt.parsePhotoForm(w, r, ctx)
+		if !ok {
+			return
+		}
 
 		// Check for optional replyTo in form data
 		if replyToStr := r.FormValue("replyTo"); replyToStr != "" {
@@ -116,40 +138,62 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
-	// 7. Create message in database
-	message, err := rt.db.CreateMessage(conversationID, userID, content, photoURL, replyTo)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("Failed to create message")
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create message", ctx)
+	// 7. Messages with a sending time are stored and delivered later by the scheduler
+	if sendAt != nil {
+		scheduled, err := rt.db.CreateScheduledMessage(conversationID, userID, content, photoURLs, replyTo, *sendAt)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to schedule message")
+			if _, err := removeUploadedFiles(photoURLs); err != nil {
+				ctx.Logger.WithError(err).Warn("Failed to remove message photos")
+			}
+			switch {
+			case strings.Contains(err.Error(), "reply"):
+				sendErrorResponse(w, http.StatusBadRequest, "Invalid reply target", ctx)
+			default:
+				sendErrorResponse(w, http.StatusInternalServerError, "Failed to schedule message", ctx)
+			}
+			return
+		}
+
+		rt.clearDraft(conversationID, userID, ctx)
+		if err := sendJSONResponse(w, http.StatusAccepted, toScheduledMessageResponse(*scheduled)); err != nil {
+			ctx.Logger.WithError(err).Error("failed to send scheduled message response")
+		}
+		ctx.Logger.Info("Message scheduled successfully", "scheduledMessageID", scheduled.ID, "conversationID", conversationID)
 		return
 	}
 
-	// 8. Convert to response format
-	comments := make([]CommentResponse, len(message.Comments))
-	for i, comment := range message.Comments {
-		comments[i] = CommentResponse{
-			ID:        comment.ID,
-			UserID:    comment.UserID,
-			Username:  comment.Username,
-			Emoticon:  comment.Emoticon,
-			Timestamp: comment.CreatedAt,
+	// 8. Create message in database
+	message, err := rt.db.CreateMessage(conversationID, userID, content, photoURLs, attachment, replyTo)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to create message")
+		if _, err := removeUploadedFiles(photoURLs); err != nil {
+			ctx.Logger.WithError(err).Warn("Failed to remove message photos")
+		}
+		if attachment != nil {
+			if _, err := removeAttachmentFiles([]string{attachment.StorageKey}); err != nil {
+				ctx.Logger.WithError(err).Warn("Failed to remove attachment file")
+			}
 		}
+		switch {
+		case strings.Contains(err.Error(), "reply"):
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid reply target", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create message", ctx)
+		}
+		return
 	}
 
-	response := MessageResponse{
-		ID:             message.ID,
-		SenderID:       message.SenderID,
-		SenderUsername: message.SenderUsername,
-		Content:        message.Content,
-		PhotoURL:       message.PhotoURL,
-		ReplyToID:      message.ReplyToID,
-		Forwarded:      message.Forwarded,
-		Timestamp:      message.CreatedAt,
-		Status:         message.Status,
-		Comments:       comments,
-	}
+	// 9. The draft of the user has been sent, the preview of its link is fetched in background
+	rt.clearDraft(conversationID, userID, ctx)
+	rt.queueLinkPreview(message)
 
-	// 9. Return created message as JSON response
+	// 10. Convert to response format and notify the webhooks and the bots
+	response := toMessageResponse(*message, ctx.UserID)
+	rt.emitWebhookEvent(conversationID, database.WebhookEventMessageCreated, response)
+	rt.emitBotCommand(conversationID, response)
+
+	// 11. Return created message as JSON response
 	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
 		ctx.Logger.WithError(err).Error("failed to send message response")
 	}
@@ -170,7 +214,7 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	// 3. Parse request body to get target conversationId
-	var req ForwardMessageRequest
+	var req types.ForwardMessageRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -195,36 +239,19 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 			sendErrorResponse(w, http.StatusNotFound, "Message not found", ctx)
 		case strings.Contains(err.Error(), "not authorized") || strings.Contains(err.Error(), "not a participant"):
 			sendErrorResponse(w, http.StatusForbidden, "Unauthorized to forward message", ctx)
+		case strings.Contains(err.Error(), "system message"):
+			sendErrorResponse(w, http.StatusBadRequest, "System messages cannot be forwarded", ctx)
+		case strings.Contains(err.Error(), "poll"):
+			sendErrorResponse(w, http.StatusBadRequest, "Polls cannot be forwarded", ctx)
 		default:
 			sendErrorResponse(w, http.StatusInternalServerError, "Failed to forward message", ctx)
 		}
 		return
 	}
 
-	// 7. Convert to response format
-	comments := make([]CommentResponse, len(forwardedMessage.Comments))
-	for i, comment := range forwardedMessage.Comments {
-		comments[i] = CommentResponse{
-			ID:        comment.ID,
-			UserID:    comment.UserID,
-			Username:  comment.Username,
-			Emoticon:  comment.Emoticon,
-			Timestamp: comment.CreatedAt,
-		}
-	}
-
-	response := MessageResponse{
-		ID:             forwardedMessage.ID,
-		SenderID:       forwardedMessage.SenderID,
-		SenderUsername: forwardedMessage.SenderUsername,
-		Content:        forwardedMessage.Content,
-		PhotoURL:       forwardedMessage.PhotoURL,
-		ReplyToID:      forwardedMessage.ReplyToID,
-		Forwarded:      forwardedMessage.Forwarded,
-		Timestamp:      forwardedMessage.CreatedAt,
-		Status:         forwardedMessage.Status,
-		Comments:       comments,
-	}
+	// 7. Convert to response format and notify the webhooks
+	response := toMessageResponse(*forwardedMessage, ctx.UserID)
+	rt.emitWebhookEvent(req.ConversationID, database.WebhookEventMessageCreated, response)
 
 	// 8. Return created message as JSON response
 	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
@@ -282,7 +309,7 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	// 3. Parse request body to get emoticon
-	var req CommentMessageRequest
+	var req types.CommentMessageRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -306,20 +333,30 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 			sendErrorResponse(w, http.StatusNotFound, "Message not found", ctx)
 		case strings.Contains(err.Error(), "not authorized"):
 			sendErrorResponse(w, http.StatusForbidden, "Unauthorized to react to message", ctx)
+		case strings.Contains(err.Error(), "system message"):
+			sendErrorResponse(w, http.StatusBadRequest, "System messages cannot be reacted to", ctx)
 		default:
 			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create reaction", ctx)
 		}
 		return
 	}
 
-	// 7. Convert to response format
-	response := CommentResponse{
+	// 7. Convert to response format and notify the webhooks
+	response := types.CommentResponse{
 		ID:        reaction.ID,
 		UserID:    reaction.UserID,
 		Username:  reaction.Username,
 		Emoticon:  reaction.Emoticon,
 		Timestamp: reaction.CreatedAt,
 	}
+	if message, err := rt.db.GetMessage(messageID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get reacted message for webhooks")
+	} else {
+		rt.emitWebhookEvent(message.ConversationID, database.WebhookEventReactionAdded, ReactionEventData{
+			MessageID: messageID,
+			Reaction:  response,
+		})
+	}
 
 	// 8. Return created/updated reaction as JSON response
 	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
@@ -370,3 +407,127 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 	w.WriteHeader(http.StatusNoContent)
 	ctx.Logger.Info("Message reaction deleted successfully", "commentID", commentID, "messageID", messageID, "userID", userID)
 }
+
+// clearDraft discards the draft of a user after sending a message; the message is already sent, so errors are only
+// logged
+func (rt *_router) clearDraft(conversationID, userID string, ctx reqcontext.RequestContext) {
+	if err := rt.db.DeleteDraft(conversationID, userID); err != nil && !strings.Contains(err.Error(), "not found") {
+		ctx.Logger.WithError(err).Warn("Failed to clear draft")
+	}
+}
+
+// Kinds of messages, see MessageResponse.Type
+const (
+	messageTypeText   = "text"
+	messageTypePhoto  = "photo"
+	messageTypeFile   = "file"
+	messageTypePoll   = "poll"
+	messageTypeSystem = "system"
+)
+
+// toMessageResponse converts a message, with its comments and mentions, to its response format. Polls include the
+// votes of viewerID, if any.
+func toMessageResponse(message database.Message, viewerID string) types.MessageResponse {
+	comments := make([]types.CommentResponse, len(message.Comments))
+	for i, comment := range message.Comments {
+		comments[i] = types.CommentResponse{
+			ID:        comment.ID,
+			UserID:    comment.UserID,
+			Username:  comment.Username,
+			Emoticon:  comment.Emoticon,
+			Timestamp: comment.CreatedAt,
+		}
+	}
+
+	var mentions []types.MentionResponse
+	for _, mention := range message.Mentions {
+		mentions = append(mentions, types.MentionResponse{
+			UserID:   mention.UserID,
+			Username: mention.Username,
+			Offset:   mention.Offset,
+			Length:   mention.Length,
+		})
+	}
+
+	return types.MessageResponse{
+		ID:             message.ID,
+		SenderID:       message.SenderID,
+		SenderUsername: message.SenderUsername,
+		Content:        message.Content,
+		PhotoURL:       message.PhotoURL,
+		Photos:         message.Photos,
+		ReplyToID:      message.ReplyToID,
+		Forwarded:      message.Forwarded,
+		System:         message.System,
+		Type:           messageType(message),
+		Event:          toGroupEventResponse(message.Event),
+		Attachment:     toAttachmentResponse(message.Attachment),
+		Poll:           toPollResponse(message.Poll, viewerID),
+		Timestamp:      message.CreatedAt,
+		ExpiresAt:      message.ExpiresAt,
+		LinkPreview:    toLinkPreviewResponse(message.LinkPreview),
+		Mentions:       mentions,
+		Status:         message.Status,
+		Comments:       comments,
+	}
+}
+
+// messageType returns the kind of a message shown to clients: "system" for the announcements of the server, "photo",
+// "file", "poll" or "text" for the messages of the users
+func messageType(message database.Message) string {
+	switch {
+	case message.System:
+		return messageTypeSystem
+	case message.PhotoURL != nil:
+		return messageTypePhoto
+	case message.Attachment != nil:
+		return messageTypeFile
+	case message.Poll != nil:
+		return messageTypePoll
+	default:
+		return messageTypeText
+	}
+}
+
+// toGroupEventResponse converts a group event to its response format, nil if the message announces no event
+func toGroupEventResponse(event *database.GroupEvent) *types.GroupEventResponse {
+	if event == nil {
+		return nil
+	}
+	return &types.GroupEventResponse{
+		Type:           event.Type,
+		ActorID:        event.ActorID,
+		ActorUsername:  event.ActorUsername,
+		TargetID:       event.TargetID,
+		TargetUsername: event.TargetUsername,
+		OldName:        event.OldName,
+		NewName:        event.NewName,
+		Duration:       event.Duration,
+	}
+}
+
+// toAttachmentResponse converts an attachment to its response format, nil if the message has no attachment
+func toAttachmentResponse(attachment *database.Attachment) *types.AttachmentResponse {
+	if attachment == nil {
+		return nil
+	}
+	return &types.AttachmentResponse{
+		ID:       attachment.ID,
+		Filename: attachment.Filename,
+		MimeType: attachment.MimeType,
+		Size:     attachment.Size,
+	}
+}
+
+// toLinkPreviewResponse converts a link preview to its response format, nil if there is no preview
+func toLinkPreviewResponse(preview *database.LinkPreview) *types.LinkPreviewResponse {
+	if preview == nil {
+		return nil
+	}
+	return &types.LinkPreviewResponse{
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		ImageURL:    preview.ImageURL,
+	}
+}
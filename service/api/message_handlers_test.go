@@ -0,0 +1,60 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Daniel200273/WASA-project/client"
+)
+
+func TestForwardRequiresAccessToSource(t *testing.T) {
+	ctx := context.Background()
+	serverURL := newServer(t)
+	alice := newClient(t, serverURL, "alice")
+	bob := newClient(t, serverURL, "bobby")
+	eve := newClient(t, serverURL, "eve_1")
+	mallory := newClient(t, serverURL, "mallory")
+
+	private, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	sent, err := alice.SendFile(ctx, private.ID, "notes.pdf", bytes.NewReader([]byte("%PDF-1.4\n% private\n")), nil)
+	if err != nil {
+		t.Fatalf("SendFile: %v", err)
+	}
+
+	// Eve knows the message ID, but is not in the conversation: she cannot copy it into her own chat
+	own, err := eve.StartConversation(ctx, mallory.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, err := eve.ForwardMessage(ctx, sent.ID, own.ID); !client.IsForbidden(err) {
+		t.Fatalf("ForwardMessage from another conversation returned %v, want 403", err)
+	}
+	var buf bytes.Buffer
+	if err := eve.DownloadAttachment(ctx, sent.ID, &buf); err == nil || buf.Len() != 0 {
+		t.Fatalf("DownloadAttachment from another conversation returned %v with %d bytes", err, buf.Len())
+	}
+	detail, err := eve.GetConversation(ctx, own.ID)
+	if err != nil {
+		t.Fatalf("GetConversation: %v", err)
+	}
+	if len(detail.Messages) != 0 {
+		t.Fatalf("conversation of eve has %d messages, want none", len(detail.Messages))
+	}
+
+	// Bob is in the conversation, so he can forward the file and its copy can be downloaded
+	shared, err := bob.StartConversation(ctx, mallory.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	forwarded, err := bob.ForwardMessage(ctx, sent.ID, shared.ID)
+	if err != nil {
+		t.Fatalf("ForwardMessage: %v", err)
+	}
+	if err := mallory.DownloadAttachment(ctx, forwarded.ID, &buf); err != nil {
+		t.Fatalf("DownloadAttachment of the forwarded copy: %v", err)
+	}
+}
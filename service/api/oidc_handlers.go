@@ -0,0 +1,207 @@
+package api
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/oidc"
+	"github.com/julienschmidt/httprouter"
+)
+
+// oidcLoginTTL is how long users have to log in at the identity provider and come back
+const oidcLoginTTL = 10 * time.Minute
+
+// Longest authorization code and state accepted in requests
+const (
+	maxOIDCCodeLength  = 2048
+	maxOIDCStateLength = 128
+)
+
+// oidcUsernameAttempts is how many usernames are tried for a new single sign-on user before giving up, the first
+// one derived from the identity and the others with a random suffix
+const oidcUsernameAttempts = 5
+
+// startOIDCLogin handles starting a single sign-on login: the user is sent to the identity provider, which sends them
+// back to the redirect URL with the parameters for completeOIDCLogin
+func (rt *_router) startOIDCLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if rt.oidc == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Single sign-on is not enabled on this server", ctx)
+		return
+	}
+
+	// 1. Generate the state, the nonce and the PKCE verifier of the login
+	var login database.OIDCLogin
+	var err error
+	if login.State, err = oidc.RandomState(); err == nil {
+		if login.Nonce, err = oidc.RandomState(); err == nil {
+			login.CodeVerifier, err = oidc.GenerateVerifier()
+		}
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("failed to generate OIDC login")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+	login.ExpiresAt = globaltime.Now().Add(oidcLoginTTL)
+
+	// 2. Build the authorization URL, discovering the provider if needed
+	authURL, err := rt.oidc.AuthCodeURL(r.Context(), login.State, login.Nonce, oidc.CodeChallenge(login.CodeVerifier))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("failed to contact identity provider")
+		sendErrorResponse(w, http.StatusBadGateway, "Identity provider unavailable", ctx)
+		return
+	}
+
+	// 3. Store the login until the user comes back
+	if err := rt.db.CreateOIDCLogin(login); err != nil {
+		ctx.Logger.WithError(err).Error("failed to store OIDC login")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	response := types.OIDCLoginResponse{
+		AuthorizationURL: authURL,
+		ExpiresAt:        login.ExpiresAt.UTC(),
+	}
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to encode response")
+	}
+}
+
+// completeOIDCLogin handles the return of the user from the identity provider: the authorization code is exchanged
+// for the identity of the user, who is logged in as the WASAText user of that identity, created on first login
+func (rt *_router) completeOIDCLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	if rt.oidc == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Single sign-on is not enabled on this server", ctx)
+		return
+	}
+
+	// 1. Parse request body
+	var req types.CompleteOIDCLoginRequest
+	if err := parseJSONRequest(r, &req); err != nil || req.Code == "" || req.State == "" ||
+		len(req.Code) > maxOIDCCodeLength || len(req.State) > maxOIDCStateLength {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+
+	// 2. Consume the login the state belongs to, which must not have expired
+	login, err := rt.db.ConsumeOIDCLogin(req.State, globaltime.Now())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired login, log in again", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("failed to get OIDC login")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	// 3. Exchange the code for the verified identity of the user
+	identity, err := rt.oidc.Exchange(r.Context(), req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrRejected) {
+			ctx.Logger.WithError(err).Warn("OIDC login rejected")
+			sendErrorResponse(w, http.StatusUnauthorized, "Login rejected by the identity provider, log in again", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("failed to contact identity provider")
+		sendErrorResponse(w, http.StatusBadGateway, "Identity provider unavailable", ctx)
+		return
+	}
+
+	// 4. Get the user of the identity, creating it on first login
+	user, err := rt.db.GetUserByOIDCIdentity(identity.Issuer, identity.Subject)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		user, err = rt.createOIDCUser(identity, ctx)
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("failed to get single sign-on user")
+		sendErrorResponse(w, http.StatusInternalServerError, "Internal server error", ctx)
+		return
+	}
+
+	// 5. Send the session token, or the challenge of the second factor
+	rt.startSession(w, user.ID, ctx)
+}
+
+// createOIDCUser creates the user of an identity on its first login, with a username derived from the profile of the
+// identity. Taken usernames are never reused: a random suffix is added instead.
+func (rt *_router) createOIDCUser(identity *oidc.Identity, ctx reqcontext.RequestContext) (*database.User, error) {
+	base := oidcUsername(identity)
+	for attempt := 0; attempt < oidcUsernameAttempts; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return nil, fmt.Errorf("generating username: %w", err)
+			}
+			if len(username) > 11 {
+				username = username[:11]
+			}
+			username = fmt.Sprintf("%s-%04d", username, suffix.Int64())
+		}
+
+		user, err := rt.db.CreateOIDCUser(identity.Issuer, identity.Subject, username)
+		switch {
+		case err == nil:
+			ctx.Logger.WithField("username", username).Info("creating new single sign-on user")
+			return user, nil
+		case strings.Contains(err.Error(), "identity already exists"):
+			// Created by a concurrent login of the same user
+			return rt.db.GetUserByOIDCIdentity(identity.Issuer, identity.Subject)
+		case !strings.Contains(err.Error(), "already taken"):
+			return nil, err
+		}
+	}
+	return nil, errors.New("no username available")
+}
+
+// oidcUsername derives a valid username from the preferred username, the email address or the name of an identity,
+// replacing the characters usernames cannot contain
+func oidcUsername(identity *oidc.Identity) string {
+	email := identity.Email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		email = email[:at]
+	}
+
+	for _, candidate := range []string{identity.PreferredUsername, email, identity.Name} {
+		username := strings.Trim(strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+				return r
+			case r == '.' || r == ' ':
+				return '_'
+			default:
+				return -1
+			}
+		}, candidate), "_-")
+		if len(username) > 16 {
+			username = username[:16]
+		}
+		if validateUsername(username) == nil {
+			return username
+		}
+	}
+	return "user"
+}
+
+// pruneOIDCLogins deletes the single sign-on logins users never came back from
+func (rt *_router) pruneOIDCLogins() {
+	deleted, err := rt.db.DeleteExpiredOIDCLogins(globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting expired OIDC logins")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("expired OIDC logins deleted")
+	}
+}
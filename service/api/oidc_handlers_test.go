@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/api"
+	"github.com/Daniel200273/WASA-project/service/oidc"
+	"github.com/Daniel200273/WASA-project/service/oidc/oidctest"
+)
+
+// newOIDCServer starts a local identity provider and the API router using it for single sign-on
+func newOIDCServer(t *testing.T) (*oidctest.Provider, string) {
+	t.Helper()
+	idp := oidctest.New("wasatext", "secret")
+	t.Cleanup(idp.Close)
+	provider, err := oidc.New(oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "wasatext",
+		ClientSecret: "secret",
+		RedirectURL:  "http://wasatext.example/login/callback",
+	})
+	if err != nil {
+		t.Fatalf("creating OIDC provider: %v", err)
+	}
+	return idp, newServer(t, func(cfg *api.Config) { cfg.OIDC = provider })
+}
+
+// authorizeOIDC starts a single sign-on login and logs in at the provider, returning the code and the state the
+// provider sends back
+func authorizeOIDC(t *testing.T, idp *oidctest.Provider, c *client.Client) (string, string) {
+	t.Helper()
+	login, err := c.StartOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatalf("StartOIDCLogin: %v", err)
+	}
+	redirect, err := idp.Authorize(login.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return redirect.Query().Get("code"), redirect.Query().Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	idp, serverURL := newOIDCServer(t)
+	idp.SetUser("42", "maria.rossi", "maria@example.com")
+
+	// 1. The first login creates the user
+	c := newClient(t, serverURL, "")
+	code, state := authorizeOIDC(t, idp, c)
+	login, err := c.CompleteOIDCLogin(ctx, code, state)
+	if err != nil {
+		t.Fatalf("CompleteOIDCLogin: %v", err)
+	}
+	profile, err := c.GetUserProfile(ctx, login.UserID)
+	if err != nil {
+		t.Fatalf("GetUserProfile with the new session: %v", err)
+	}
+	if profile.Username != "maria_rossi" {
+		t.Fatalf("single sign-on user is named %q, want maria_rossi", profile.Username)
+	}
+
+	// 2. The state is used once
+	if _, err := c.CompleteOIDCLogin(ctx, code, state); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteOIDCLogin with a used state returned %v, want 401", err)
+	}
+
+	// 3. Later logins of the same identity get the same user
+	other := newClient(t, serverURL, "")
+	code, state = authorizeOIDC(t, idp, other)
+	again, err := other.CompleteOIDCLogin(ctx, code, state)
+	if err != nil {
+		t.Fatalf("CompleteOIDCLogin of a known identity: %v", err)
+	}
+	if again.UserID != login.UserID {
+		t.Fatalf("second login got user %s, want %s", again.UserID, login.UserID)
+	}
+}
+
+func TestOIDCLoginStateMismatch(t *testing.T) {
+	ctx := context.Background()
+	idp, serverURL := newOIDCServer(t)
+	c := newClient(t, serverURL, "")
+
+	// A state the server never issued
+	code, _ := authorizeOIDC(t, idp, c)
+	if _, err := c.CompleteOIDCLogin(ctx, code, "forged-state"); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteOIDCLogin with an unknown state returned %v, want 401", err)
+	}
+
+	// The code of a login with the state of another: the PKCE verifier of the other login does not match the code
+	code, _ = authorizeOIDC(t, idp, c)
+	_, otherState := authorizeOIDC(t, idp, c)
+	if _, err := c.CompleteOIDCLogin(ctx, code, otherState); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteOIDCLogin with the state of another login returned %v, want 401", err)
+	}
+
+	// A login completed too late
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTime(t, now)
+	code, state := authorizeOIDC(t, idp, c)
+	setTime(t, now.Add(11*time.Minute))
+	if _, err := c.CompleteOIDCLogin(ctx, code, state); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteOIDCLogin of an expired login returned %v, want 401", err)
+	}
+	if c.Token() != "" {
+		t.Fatal("failed logins started a session")
+	}
+}
+
+func TestOIDCLoginRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(idp *oidctest.Provider)
+	}{
+		{"bad signature", func(idp *oidctest.Provider) { idp.SignWithUnknownKey(true) }},
+		{"wrong audience", func(idp *oidctest.Provider) { idp.SetClaim("aud", "another-client") }},
+		{"wrong nonce", func(idp *oidctest.Provider) { idp.SetClaim("nonce", "another-nonce") }},
+		{"expired", func(idp *oidctest.Provider) { idp.SetIDTokenExpiry(-time.Hour) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, serverURL := newOIDCServer(t)
+			tt.setup(idp)
+			c := newClient(t, serverURL, "")
+
+			code, state := authorizeOIDC(t, idp, c)
+			if _, err := c.CompleteOIDCLogin(context.Background(), code, state); !client.IsUnauthorized(err) {
+				t.Fatalf("CompleteOIDCLogin returned %v, want 401", err)
+			}
+			if c.Token() != "" {
+				t.Fatal("rejected login started a session")
+			}
+		})
+	}
+}
+
+// The expiry of ID tokens is checked against the time of the server
+func TestOIDCLoginTokenExpiry(t *testing.T) {
+	idp, serverURL := newOIDCServer(t)
+	c := newClient(t, serverURL, "")
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTime(t, now)
+	idp.SetClaim("exp", now.Add(-2*time.Minute).Unix())
+	code, state := authorizeOIDC(t, idp, c)
+	if _, err := c.CompleteOIDCLogin(context.Background(), code, state); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteOIDCLogin with an expired token returned %v, want 401", err)
+	}
+
+	idp.SetClaim("exp", now.Add(time.Minute).Unix())
+	code, state = authorizeOIDC(t, idp, c)
+	if _, err := c.CompleteOIDCLogin(context.Background(), code, state); err != nil {
+		t.Fatalf("CompleteOIDCLogin with a token valid at the server time: %v", err)
+	}
+}
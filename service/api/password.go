@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Length of passwords, in bytes: bcrypt ignores anything after the first 72 bytes, so longer passwords are refused
+// rather than silently truncated
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// validatePassword checks if the given password can secure an account
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be between %d and %d bytes", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash stored for a password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches the stored hash
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Bounds of a poll
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 12
+	maxPollQuestionSize = 300
+	maxPollOptionSize   = 100
+)
+
+// createPoll handles sending a poll to a group
+func (rt *_router) createPoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get conversationId from URL path parameters
+	conversationID := ps.ByName("conversationId")
+
+	// 2. Validate conversationId format
+	if err := validateID(conversationID, "conversationId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Parse and validate the poll
+	var req types.CreatePollRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validatePoll(req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 4. Create the poll message (the database checks that the user is a member of a group)
+	poll := database.Poll{
+		Question:       req.Question,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+		ClosesAt:       req.ClosesAt,
+	}
+	for _, option := range req.Options {
+		poll.Options = append(poll.Options, database.PollOption{Text: option})
+	}
+	message, err := rt.db.CreatePoll(conversationID, ctx.UserID, poll)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to create poll")
+		switch {
+		case strings.Contains(err.Error(), "not a participant"):
+			sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to conversation", ctx)
+		case strings.Contains(err.Error(), "only be sent to groups"):
+			sendErrorResponse(w, http.StatusBadRequest, "Polls can only be sent to groups", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create poll", ctx)
+		}
+		return
+	}
+
+	// 5. Convert to response format and notify the webhooks
+	response := toMessageResponse(*message, ctx.UserID)
+	rt.emitWebhookEvent(conversationID, database.WebhookEventMessageCreated, response)
+
+	// 6. Return created message as JSON response
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send poll response")
+	}
+
+	ctx.Logger.Info("Poll created successfully", "messageID", message.ID, "conversationID", conversationID)
+}
+
+// votePoll handles voting in a poll, or changing a previous vote
+func (rt *_router) votePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get and validate messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 2. Parse the chosen options, validated against the poll by the database
+	var req types.VotePollRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+
+	// 3. Replace the vote of the user
+	message, err := rt.db.VotePoll(messageID, ctx.UserID, req.Options)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to vote in poll")
+		sendPollError(w, err, "Failed to vote in poll", ctx)
+		return
+	}
+
+	// 4. Return the poll with the updated results
+	if err := sendJSONResponse(w, http.StatusOK, toMessageResponse(*message, ctx.UserID)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send poll response")
+	}
+}
+
+// retractPollVote handles removing the vote of the current user from a poll
+func (rt *_router) retractPollVote(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get and validate messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 2. Remove the vote of the user
+	message, err := rt.db.RetractPollVote(messageID, ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to retract poll vote")
+		sendPollError(w, err, "Failed to retract vote", ctx)
+		return
+	}
+
+	// 3. Return the poll with the updated results
+	if err := sendJSONResponse(w, http.StatusOK, toMessageResponse(*message, ctx.UserID)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send poll response")
+	}
+}
+
+// closePoll handles closing a poll before its closing time, by its creator
+func (rt *_router) closePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get and validate messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 2. Close the poll (the database checks that the user created it)
+	message, err := rt.db.ClosePoll(messageID, ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to close poll")
+		sendPollError(w, err, "Failed to close poll", ctx)
+		return
+	}
+
+	// 3. Return the poll with its final results
+	if err := sendJSONResponse(w, http.StatusOK, toMessageResponse(*message, ctx.UserID)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send poll response")
+	}
+}
+
+// sendPollError maps the errors of the poll operations to an error response
+func sendPollError(w http.ResponseWriter, err error, fallback string, ctx reqcontext.RequestContext) {
+	switch {
+	case strings.Contains(err.Error(), "message not found"):
+		sendErrorResponse(w, http.StatusNotFound, "Message not found", ctx)
+	case strings.Contains(err.Error(), "vote not found"):
+		sendErrorResponse(w, http.StatusNotFound, "You have not voted in this poll", ctx)
+	case strings.Contains(err.Error(), "not authorized"):
+		sendErrorResponse(w, http.StatusForbidden, "Unauthorized access to poll", ctx)
+	case strings.Contains(err.Error(), "poll is closed"):
+		sendErrorResponse(w, http.StatusConflict, "Poll is closed", ctx)
+	case strings.Contains(err.Error(), "not a poll"), strings.Contains(err.Error(), "invalid vote"):
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, fallback, ctx)
+	}
+}
+
+// validatePoll validates the question, the options and the closing time of a new poll
+func validatePoll(req types.CreatePollRequest) error {
+	if req.Question == "" || len(req.Question) > maxPollQuestionSize {
+		return fmt.Errorf("poll question must be between 1 and %d characters", maxPollQuestionSize)
+	}
+	if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+		return fmt.Errorf("poll must have between %d and %d options", minPollOptions, maxPollOptions)
+	}
+	seen := make(map[string]bool, len(req.Options))
+	for _, option := range req.Options {
+		if option == "" || len(option) > maxPollOptionSize {
+			return fmt.Errorf("poll options must be between 1 and %d characters", maxPollOptionSize)
+		}
+		if seen[option] {
+			return fmt.Errorf("poll options must be unique")
+		}
+		seen[option] = true
+	}
+	if req.ClosesAt != nil && !req.ClosesAt.After(globaltime.Now()) {
+		return fmt.Errorf("closesAt must be in the future")
+	}
+	return nil
+}
+
+// toPollResponse converts a poll to its response format, nil if the message is not a poll. The voters of anonymous
+// polls are not shown, except for the votes of viewerID itself.
+func toPollResponse(poll *database.Poll, viewerID string) *types.PollResponse {
+	if poll == nil {
+		return nil
+	}
+	response := &types.PollResponse{
+		Question:       poll.Question,
+		Options:        make([]types.PollOptionResponse, len(poll.Options)),
+		MultipleChoice: poll.MultipleChoice,
+		Anonymous:      poll.Anonymous,
+		ClosesAt:       poll.ClosesAt,
+		Closed:         poll.Closed,
+	}
+	voters := make(map[string]bool)
+	for i, option := range poll.Options {
+		response.Options[i] = types.PollOptionResponse{Text: option.Text, Votes: len(option.Voters)}
+		for _, voter := range option.Voters {
+			voters[voter.UserID] = true
+			if voter.UserID == viewerID {
+				response.OwnVotes = append(response.OwnVotes, i)
+			}
+			if !poll.Anonymous {
+				response.Options[i].Voters = append(response.Options[i].Voters, types.PollVoterResponse{
+					UserID:   voter.UserID,
+					Username: voter.Username,
+				})
+			}
+		}
+	}
+	response.TotalVoters = len(voters)
+	return response
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// defaultReaperInterval is how often expired messages are deleted, unless configured otherwise
+const defaultReaperInterval = time.Minute
+
+// reaperBatchSize is the maximum number of expired messages deleted in a single transaction
+const reaperBatchSize = 500
+
+// reapExpiredMessages deletes the expired messages and their photos, in batches. Expired messages are already hidden
+// by the database read paths, so this only reclaims space.
+func (rt *_router) reapExpiredMessages() {
+	now := globaltime.Now()
+
+	var total int64
+	for {
+		deleted, mediaURLs, err := rt.db.DeleteExpiredMessages(now, reaperBatchSize)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error deleting expired messages")
+			return
+		}
+		if _, err := removeUploadedFiles(mediaURLs); err != nil {
+			rt.baseLogger.WithError(err).Error("error removing the photos of expired messages")
+		}
+
+		total += deleted
+		if deleted < reaperBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		rt.baseLogger.WithField("deleted", total).Info("expired messages deleted")
+	}
+}
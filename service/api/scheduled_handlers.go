@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getScheduledMessages handles listing the pending messages of the user
+func (rt *_router) getScheduledMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own scheduled messages", ctx)
+		return
+	}
+
+	// 2. Get pending messages from database
+	scheduled, err := rt.db.GetUserScheduledMessages(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get scheduled messages")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get scheduled messages", ctx)
+		return
+	}
+
+	// 3. Convert to response format
+	response := types.ScheduledMessagesResponse{
+		ScheduledMessages: make([]types.ScheduledMessageResponse, len(scheduled)),
+	}
+	for i, message := range scheduled {
+		response.ScheduledMessages[i] = toScheduledMessageResponse(message)
+	}
+
+	// 4. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send scheduled messages response")
+	}
+}
+
+// updateScheduledMessage handles changing the text or the sending time of a pending message
+func (rt *_router) updateScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only update your own scheduled messages", ctx)
+		return
+	}
+
+	// 2. Validate scheduledMessageId format
+	scheduledID := ps.ByName("scheduledMessageId")
+	if err := validateID(scheduledID, "scheduledMessageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Parse and validate request body
+	var req types.UpdateScheduledMessageRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if req.Content != nil {
+		if err := validateMessageContent(*req.Content); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+	}
+	if req.SendAt != nil {
+		if err := validateSendAt(*req.SendAt); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+	}
+
+	// 4. Update the pending message
+	scheduled, err := rt.db.UpdateScheduledMessage(scheduledID, userID, req.Content, req.SendAt)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to update scheduled message")
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			sendErrorResponse(w, http.StatusNotFound, "Scheduled message not found", ctx)
+		case strings.Contains(err.Error(), "photo message"):
+			sendErrorResponse(w, http.StatusBadRequest, "Cannot set the content of a photo message", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to update scheduled message", ctx)
+		}
+		return
+	}
+
+	// 5. Return the updated message
+	if err := sendJSONResponse(w, http.StatusOK, toScheduledMessageResponse(*scheduled)); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send scheduled message response")
+	}
+
+	ctx.Logger.Info("Scheduled message updated successfully", "scheduledMessageID", scheduledID)
+}
+
+// cancelScheduledMessage handles deleting a pending message before it is sent
+func (rt *_router) cancelScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only cancel your own scheduled messages", ctx)
+		return
+	}
+
+	// 2. Validate scheduledMessageId format
+	scheduledID := ps.ByName("scheduledMessageId")
+	if err := validateID(scheduledID, "scheduledMessageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Delete the pending message
+	scheduled, err := rt.db.DeleteScheduledMessage(scheduledID, userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to cancel scheduled message")
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Scheduled message not found", ctx)
+		} else {
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to cancel scheduled message", ctx)
+		}
+		return
+	}
+
+	// 4. The photos of the message will never be sent: remove them
+	if photos := scheduledPhotos(*scheduled); len(photos) > 0 {
+		if _, err := removeUploadedFiles(photos); err != nil {
+			ctx.Logger.WithError(err).Error("Failed to remove the photos of a cancelled message")
+		}
+	}
+
+	// 5. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Scheduled message cancelled successfully", "scheduledMessageID", scheduledID)
+}
+
+// toScheduledMessageResponse converts a pending message to its response format
+func toScheduledMessageResponse(message database.ScheduledMessage) types.ScheduledMessageResponse {
+	return types.ScheduledMessageResponse{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		Content:        message.Content,
+		PhotoURL:       message.PhotoURL,
+		Photos:         message.Photos,
+		ReplyToID:      message.ReplyToID,
+		SendAt:         message.SendAt,
+		CreatedAt:      message.CreatedAt,
+	}
+}
+
+// scheduledPhotos returns the photos stored for a pending message: the photos of its album, or its single photo
+func scheduledPhotos(message database.ScheduledMessage) []string {
+	if message.Photos != nil {
+		return message.Photos
+	}
+	if message.PhotoURL != nil {
+		return []string{*message.PhotoURL}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/api"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+)
+
+// testPhoto returns a photo of an album holding a small PNG image
+func testPhoto(t *testing.T, filename string) client.Photo {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return client.Photo{Filename: filename, Content: &buf}
+}
+
+// waitForMessages polls a conversation until it has n messages
+func waitForMessages(t *testing.T, c *client.Client, conversationID string, n int) []types.MessageResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		detail, err := c.GetConversation(context.Background(), conversationID)
+		if err != nil {
+			t.Fatalf("GetConversation: %v", err)
+		}
+		if len(detail.Messages) >= n {
+			return detail.Messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("conversation has %d messages, want %d", len(detail.Messages), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduleAlbumWithCaption(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTime(t, now)
+	serverURL := newServer(t, func(cfg *api.Config) { cfg.SchedulerInterval = 10 * time.Millisecond })
+	alice := newClient(t, serverURL, "alice")
+	bob := newClient(t, serverURL, "bobby")
+	conversation, err := alice.StartConversation(ctx, bob.UserID())
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	// 1. An album with a caption is scheduled with its photos in order
+	sendAt := now.Add(time.Hour)
+	photos := []client.Photo{testPhoto(t, "first.png"), testPhoto(t, "second.png")}
+	scheduled, err := alice.ScheduleAlbum(ctx, conversation.ID, photos, "Holidays", nil, sendAt)
+	if err != nil {
+		t.Fatalf("ScheduleAlbum: %v", err)
+	}
+	if len(scheduled.Photos) != 2 || scheduled.PhotoURL == nil || *scheduled.PhotoURL != scheduled.Photos[0] ||
+		scheduled.Content == nil || *scheduled.Content != "Holidays" {
+		t.Fatalf("ScheduleAlbum returned %+v, want two photos and the caption", scheduled)
+	}
+	pending, err := alice.ScheduledMessages(ctx)
+	if err != nil {
+		t.Fatalf("ScheduledMessages: %v", err)
+	}
+	if len(pending) != 1 || len(pending[0].Photos) != 2 || pending[0].Photos[1] != scheduled.Photos[1] {
+		t.Fatalf("ScheduledMessages returned %+v, want the album", pending)
+	}
+
+	// The caption of a photo message cannot be changed
+	caption := "Other caption"
+	if _, err := alice.UpdateScheduledMessage(ctx, scheduled.ID, &caption, nil); client.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("UpdateScheduledMessage of the caption returned %v, want 400", err)
+	}
+
+	// 2. A single photo with a caption too, cancelled before it is sent
+	single, err := alice.ScheduleAlbum(ctx, conversation.ID, []client.Photo{testPhoto(t, "single.png")}, "Just one", nil, sendAt)
+	if err != nil {
+		t.Fatalf("ScheduleAlbum of a single photo: %v", err)
+	}
+	if single.Photos != nil || single.PhotoURL == nil || single.Content == nil || *single.Content != "Just one" {
+		t.Fatalf("ScheduleAlbum of a single photo returned %+v", single)
+	}
+	if err := alice.CancelScheduledMessage(ctx, single.ID); err != nil {
+		t.Fatalf("CancelScheduledMessage: %v", err)
+	}
+
+	// 3. The album is delivered as sent: same photos, same order, same caption
+	setTime(t, sendAt)
+	messages := waitForMessages(t, bob, conversation.ID, 1)
+	if len(messages) != 1 {
+		t.Fatalf("conversation has %d messages, want the album only", len(messages))
+	}
+	message := messages[0]
+	if message.Type != "photo" || message.Content == nil || *message.Content != "Holidays" ||
+		len(message.Photos) != 2 || message.Photos[0] != scheduled.Photos[0] || message.Photos[1] != scheduled.Photos[1] {
+		t.Fatalf("delivered message is %+v, want the scheduled album", message)
+	}
+	if pending, err := alice.ScheduledMessages(ctx); err != nil || len(pending) != 0 {
+		t.Fatalf("ScheduledMessages after delivery returned %+v, %v", pending, err)
+	}
+}
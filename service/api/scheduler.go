@@ -0,0 +1,80 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSchedulerInterval is how often due scheduled messages are looked for, unless configured otherwise
+const defaultSchedulerInterval = 5 * time.Second
+
+// schedulerBatchSize is the maximum number of scheduled messages delivered in a single round
+const schedulerBatchSize = 100
+
+// dispatchScheduledMessages delivers the scheduled messages that are due
+func (rt *_router) dispatchScheduledMessages() {
+	due, err := rt.db.GetDueScheduledMessages(globaltime.Now(), schedulerBatchSize)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error retrieving due scheduled messages")
+		return
+	}
+
+	for _, scheduled := range due {
+		rt.deliverScheduledMessage(scheduled)
+	}
+}
+
+// deliverScheduledMessage sends a scheduled message through CreateMessage, removing it from the queue in the same
+// transaction. Messages cancelled or changed in the meantime are skipped (changed messages are delivered in a later
+// round, if still due). Messages are dropped if the sender is no longer a participant of the conversation; on other
+// errors they are retried in the next round.
+func (rt *_router) deliverScheduledMessage(scheduled database.ScheduledMessage) {
+	logger := rt.baseLogger.WithFields(logrus.Fields{
+		"scheduledMessageID": scheduled.ID,
+		"conversationID":     scheduled.ConversationID,
+	})
+
+	message, err := rt.db.DeliverScheduledMessage(scheduled, scheduled.ReplyToID)
+	if err != nil && scheduled.ReplyToID != nil && strings.Contains(err.Error(), "reply target") {
+		// The message being replied to was deleted in the meantime: send it as a plain message
+		message, err = rt.db.DeliverScheduledMessage(scheduled, nil)
+	}
+
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "scheduled message not found"):
+			logger.Info("skipping scheduled message: cancelled or changed while being delivered")
+		case strings.Contains(err.Error(), "not a participant"):
+			rt.dropScheduledMessage(scheduled, logger)
+		default:
+			logger.WithError(err).Error("error delivering scheduled message, retrying later")
+		}
+		return
+	}
+
+	rt.queueLinkPreview(message)
+	response := toMessageResponse(*message, "")
+	rt.emitWebhookEvent(message.ConversationID, database.WebhookEventMessageCreated, response)
+	rt.emitBotCommand(message.ConversationID, response)
+	logger.WithField("messageID", message.ID).Info("scheduled message delivered")
+}
+
+// dropScheduledMessage removes a scheduled message that can no longer be delivered, with its photos
+func (rt *_router) dropScheduledMessage(scheduled database.ScheduledMessage, logger *logrus.Entry) {
+	if _, err := rt.db.DeleteScheduledMessage(scheduled.ID, scheduled.SenderID); err != nil {
+		// Cancelled in the meantime: there is nothing left to remove
+		logger.WithError(err).Warning("error removing undeliverable scheduled message")
+		return
+	}
+	logger.Info("dropping scheduled message: the sender left the conversation")
+
+	if photos := scheduledPhotos(scheduled); len(photos) > 0 {
+		if _, err := removeUploadedFiles(photos); err != nil {
+			logger.WithError(err).Error("error removing the photos of a dropped scheduled message")
+		}
+	}
+}
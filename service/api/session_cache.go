@@ -0,0 +1,122 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// defaultSessionCacheSize is how many session tokens are cached, unless configured otherwise
+const defaultSessionCacheSize = 10000
+
+// defaultSessionCacheTTL is how long a session token is cached, unless configured otherwise
+const defaultSessionCacheTTL = 30 * time.Second
+
+// sessionCache caches the users session tokens belong to, so that authenticated requests do not query the database
+// each time. The least recently used tokens are evicted when the cache is full.
+//
+// Sessions revoked by this server (e.g., on logout or password change) are removed from the cache at once. Entries also
+// expire after a while, as sessions can be revoked by other processes sharing the database (e.g., wasactl).
+type sessionCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+
+	// lru holds the entries, most recently used first; byUser holds the tokens of each user, to remove them together
+	lru    *list.List
+	byUser map[string]map[string]struct{}
+}
+
+type sessionCacheEntry struct {
+	token     string
+	user      database.User
+	expiresAt time.Time
+}
+
+func newSessionCache(size int, ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		byUser:  make(map[string]map[string]struct{}),
+	}
+}
+
+// get returns the user of a session token, if cached
+func (c *sessionCache) get(token string) (database.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[token]
+	if !ok {
+		return database.User{}, false
+	}
+	entry := elem.Value.(*sessionCacheEntry)
+	if !globaltime.Now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		return database.User{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.user, true
+}
+
+// put caches the user of a session token, evicting the least recently used token if the cache is full
+func (c *sessionCache) put(token string, user database.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[token]; ok {
+		c.removeElement(elem)
+	}
+	for c.lru.Len() >= c.size {
+		c.removeElement(c.lru.Back())
+	}
+
+	c.entries[token] = c.lru.PushFront(&sessionCacheEntry{
+		token:     token,
+		user:      user,
+		expiresAt: globaltime.Now().Add(c.ttl),
+	})
+	if c.byUser[user.ID] == nil {
+		c.byUser[user.ID] = make(map[string]struct{})
+	}
+	c.byUser[user.ID][token] = struct{}{}
+}
+
+// remove removes a session token from the cache (e.g., on logout)
+func (c *sessionCache) remove(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[token]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeUser removes all the session tokens of a user from the cache, when their sessions are revoked or the user
+// changes (e.g., a new username)
+func (c *sessionCache) removeUser(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for token := range c.byUser[userID] {
+		c.removeElement(c.entries[token])
+	}
+}
+
+// removeElement removes an entry from the cache; the caller holds mu
+func (c *sessionCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*sessionCacheEntry)
+	delete(c.entries, entry.token)
+	if tokens := c.byUser[entry.user.ID]; tokens != nil {
+		delete(tokens, entry.token)
+		if len(tokens) == 0 {
+			delete(c.byUser, entry.user.ID)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	// Stop the background tasks before the uploaded files are removed
+	rt.stopBackground()
+
 	// Clean up the temporary uploads directory on shutdown
 	if err := cleanupUploadsDirectory(); err != nil {
 		rt.baseLogger.WithError(err).Warning("error cleaning up uploads directory during shutdown")
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Number of messages returned by getStarredMessages, unless the limit query parameter says otherwise
+const (
+	defaultStarredLimit = 50
+	maxStarredLimit     = 100
+)
+
+// starMessage handles bookmarking a message of a conversation of the user
+func (rt *_router) starMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get and validate messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 2. Star the message (the database checks that the user can see it)
+	if err := rt.db.StarMessage(messageID, ctx.UserID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to star message")
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			sendErrorResponse(w, http.StatusNotFound, "Message not found", ctx)
+		case strings.Contains(err.Error(), "not authorized"):
+			sendErrorResponse(w, http.StatusForbidden, "Unauthorized to star message", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to star message", ctx)
+		}
+		return
+	}
+
+	// 3. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unstarMessage handles removing the bookmark of the user from a message
+func (rt *_router) unstarMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get and validate messageId from URL path parameters
+	messageID := ps.ByName("messageId")
+	if err := validateID(messageID, "messageId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 2. Unstar the message
+	if err := rt.db.UnstarMessage(messageID, ctx.UserID); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to unstar message")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to unstar message", ctx)
+		return
+	}
+
+	// 3. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getStarredMessages handles listing the messages starred by the user across their conversations, most recently
+// starred first. Older pages are requested with the before query parameter, set to the ID of the last message
+// received.
+func (rt *_router) getStarredMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own starred messages", ctx)
+		return
+	}
+
+	// 2. Parse the paging parameters
+	limit := defaultStarredLimit
+	if value := getQueryParam(r, "limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxStarredLimit {
+			sendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxStarredLimit), ctx)
+			return
+		}
+		limit = n
+	}
+	before := getQueryParam(r, "before")
+	if before != "" {
+		if err := validateID(before, "before"); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+	}
+
+	// 3. Get the starred messages from database
+	starred, err := rt.db.GetStarredMessages(userID, before, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusBadRequest, "Unknown message in before", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to get starred messages")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get starred messages", ctx)
+		}
+		return
+	}
+
+	// 4. Convert to response format
+	response := types.StarredMessagesResponse{
+		Starred: make([]types.StarredMessageResponse, len(starred)),
+	}
+	for i, item := range starred {
+		response.Starred[i] = types.StarredMessageResponse{
+			ConversationID:   item.Message.ConversationID,
+			ConversationType: item.ConversationType,
+			ConversationName: item.ConversationName,
+			StarredAt:        item.StarredAt,
+			Message:          toMessageResponse(item.Message, ctx.UserID),
+		}
+	}
+
+	// 5. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send starred messages response")
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Number of changes read by a single sync, unless the limit query parameter says otherwise
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+)
+
+// changeLogRetention is how long changes are kept for syncing clients. Clients that did not sync for longer have to
+// load everything again.
+const changeLogRetention = 30 * 24 * time.Hour
+
+// syncChanges handles returning the changes visible to the user since a cursor, with the cursor to use next. Without
+// a cursor only the current one is returned: clients load their conversations first, then sync from there.
+func (rt *_router) syncChanges(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only sync your own conversations", ctx)
+		return
+	}
+
+	// 2. Validate the cursor and the limit
+	limit := defaultSyncLimit
+	if value := getQueryParam(r, "limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSyncLimit {
+			sendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSyncLimit), ctx)
+			return
+		}
+		limit = n
+	}
+
+	response := types.SyncResponse{
+		Conversations:        []types.ConversationResponse{},
+		Messages:             []types.SyncedMessageResponse{},
+		DeletedMessages:      []types.DeletedMessageResponse{},
+		Memberships:          []types.MembershipChangeResponse{},
+		RemovedConversations: []string{},
+	}
+
+	since := getQueryParam(r, "since")
+	if since == "" {
+		cursor, err := rt.db.GetChangeCursor()
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to get change cursor")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to sync", ctx)
+			return
+		}
+		response.Cursor = strconv.FormatInt(cursor, 10)
+		if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+			ctx.Logger.WithError(err).Error("failed to send sync response")
+		}
+		return
+	}
+	sinceSeq, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || sinceSeq < 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid cursor", ctx)
+		return
+	}
+
+	// 3. Get the changes from database
+	changes, err := rt.db.GetChanges(userID, sinceSeq, limit)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "cursor expired"):
+			sendErrorResponse(w, http.StatusGone, "Cursor expired, load the conversations again", ctx)
+		case strings.Contains(err.Error(), "invalid cursor"):
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid cursor", ctx)
+		default:
+			ctx.Logger.WithError(err).Error("Failed to get changes")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to sync", ctx)
+		}
+		return
+	}
+	response.Cursor = strconv.FormatInt(changes.Cursor, 10)
+	response.HasMore = changes.HasMore
+
+	// 4. Collapse the changes: conversations and messages are returned once, in their current state
+	var conversationIDs, messageIDs []string
+	touched := make(map[string]bool)
+	changed := make(map[string]string) // Message ID -> conversation ID
+	deleted := make(map[string]bool)
+	left := make(map[string]bool)
+	for _, change := range changes.Changes {
+		if !touched[change.ConversationID] {
+			touched[change.ConversationID] = true
+			conversationIDs = append(conversationIDs, change.ConversationID)
+		}
+
+		switch change.Kind {
+		case database.ChangeMessage:
+			if _, ok := changed[change.EntityID]; !ok {
+				changed[change.EntityID] = change.ConversationID
+				messageIDs = append(messageIDs, change.EntityID)
+			}
+		case database.ChangeMessageDeleted:
+			deleted[change.EntityID] = true
+			response.DeletedMessages = append(response.DeletedMessages, types.DeletedMessageResponse{
+				ConversationID: change.ConversationID,
+				MessageID:      change.EntityID,
+			})
+		case database.ChangeMemberJoined, database.ChangeMemberLeft:
+			action := "joined"
+			if change.Kind == database.ChangeMemberLeft {
+				action = "left"
+				if change.EntityID == userID {
+					left[change.ConversationID] = true
+				}
+			}
+			response.Memberships = append(response.Memberships, types.MembershipChangeResponse{
+				ConversationID: change.ConversationID,
+				UserID:         change.EntityID,
+				Action:         action,
+			})
+		}
+	}
+
+	// 5. Load the conversations the user still participates in; the others were left
+	if len(conversationIDs) > 0 {
+		dbConversations, err := rt.db.GetUserConversations(userID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to get conversations")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to sync", ctx)
+			return
+		}
+		current := make(map[string]database.ConversationPreview, len(dbConversations))
+		for _, dbConv := range dbConversations {
+			current[dbConv.ID] = dbConv
+		}
+
+		for _, conversationID := range conversationIDs {
+			if dbConv, ok := current[conversationID]; ok {
+				response.Conversations = append(response.Conversations, toConversationResponse(dbConv))
+				left[conversationID] = false
+			} else if left[conversationID] {
+				response.RemovedConversations = append(response.RemovedConversations, conversationID)
+			}
+		}
+	}
+
+	// 6. Load the changed messages; those that expired in the meantime are reported as deleted
+	for _, messageID := range messageIDs {
+		conversationID := changed[messageID]
+		if deleted[messageID] || left[conversationID] {
+			continue
+		}
+		message, err := rt.db.GetMessage(messageID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				response.DeletedMessages = append(response.DeletedMessages, types.DeletedMessageResponse{
+					ConversationID: conversationID,
+					MessageID:      messageID,
+				})
+				continue
+			}
+			ctx.Logger.WithError(err).Error("Failed to get message")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to sync", ctx)
+			return
+		}
+		response.Messages = append(response.Messages, types.SyncedMessageResponse{
+			ConversationID: conversationID,
+			Message:        toMessageResponse(*message, ctx.UserID),
+		})
+	}
+
+	// 7. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send sync response")
+	}
+	ctx.Logger.Info("Changes synced successfully", "changes", len(changes.Changes), "hasMore", changes.HasMore)
+}
+
+// pruneChangeLog deletes the changes older than changeLogRetention
+func (rt *_router) pruneChangeLog() {
+	deleted, err := rt.db.DeleteChangesBefore(globaltime.Now().Add(-changeLogRetention))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting old changes")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("old changes deleted")
+	}
+}
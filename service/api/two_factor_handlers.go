@@ -0,0 +1,299 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/totp"
+	"github.com/julienschmidt/httprouter"
+)
+
+// totpIssuer is the name of the service shown by authenticator apps
+const totpIssuer = "WASAText"
+
+// totpSkew is how many time steps a TOTP code may be early or late, for clocks out of sync
+const totpSkew = 1
+
+// A login challenge must be completed within loginChallengeTTL, with at most maxLoginChallengeAttempts wrong codes
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	maxLoginChallengeAttempts = 5
+)
+
+// Users get recoveryCodeCount recovery codes of recoveryCodeLength characters (base32, about 50 bits each)
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// maxTwoFactorCodeLength is the longest code accepted in requests, leaving room for recovery codes typed with spaces
+const maxTwoFactorCodeLength = 32
+
+// getTwoFactor handles returning the two-factor authentication settings of the user
+func (rt *_router) getTwoFactor(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Authorization check - user can only read their own settings
+	if ps.ByName("userId") != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only read your own two-factor settings", ctx)
+		return
+	}
+
+	// 2. Get the settings from database; users who never enrolled have two-factor authentication disabled
+	var response types.TwoFactorResponse
+	twoFactor, err := rt.db.GetTwoFactor(ctx.UserID)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		ctx.Logger.WithError(err).Error("Failed to get two-factor settings")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get two-factor settings", ctx)
+		return
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		response.Enabled = true
+		response.RecoveryCodesLeft = twoFactor.RecoveryCodesLeft
+	}
+
+	// 3. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send two-factor settings response")
+	}
+}
+
+// enrollTwoFactor handles generating a new TOTP secret for the user. Two-factor authentication is enabled only after
+// a code generated with the secret is confirmed by enableTwoFactor.
+func (rt *_router) enrollTwoFactor(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Authorization check - user can only enroll themselves, bots never log in
+	if ps.ByName("userId") != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only set up your own two-factor authentication", ctx)
+		return
+	}
+	user, err := rt.db.GetUserByID(ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get user")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set up two-factor authentication", ctx)
+		return
+	}
+	if user.IsBot {
+		sendErrorResponse(w, http.StatusForbidden, "Bots cannot use two-factor authentication", ctx)
+		return
+	}
+
+	// 2. Generate and store the secret
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to generate two-factor secret")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set up two-factor authentication", ctx)
+		return
+	}
+	if err := rt.db.StartTwoFactorEnrollment(ctx.UserID, secret); err != nil {
+		if strings.Contains(err.Error(), "already enabled") {
+			sendErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to store two-factor secret")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set up two-factor authentication", ctx)
+		return
+	}
+
+	// 3. Return the secret with its otpauth URI
+	response := types.TwoFactorEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Username, secret),
+	}
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send two-factor enrollment response")
+	}
+	ctx.Logger.Info("Two-factor enrollment started", "userID", ctx.UserID)
+}
+
+// enableTwoFactor handles confirming the enrollment with a code generated by the authenticator app, returning the
+// recovery codes. Every other session of the user is revoked.
+func (rt *_router) enableTwoFactor(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Authorization check - user can only enable their own two-factor authentication
+	if ps.ByName("userId") != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only set up your own two-factor authentication", ctx)
+		return
+	}
+
+	// 2. Parse request body
+	var req types.TwoFactorCodeRequest
+	if err := parseJSONRequest(r, &req); err != nil || !validTwoFactorCode(req.Code) {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+
+	// 3. An enrollment must be pending
+	twoFactor, err := rt.db.GetTwoFactor(ctx.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusConflict, "Start the two-factor enrollment first", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get two-factor settings")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication", ctx)
+		return
+	}
+	if twoFactor.Enabled {
+		sendErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled", ctx)
+		return
+	}
+
+	// 4. Check the code against the new secret
+	counter, ok := totp.Validate(twoFactor.Secret, req.Code, globaltime.Now(), totpSkew)
+	if !ok {
+		sendErrorResponse(w, http.StatusForbidden, "Invalid code", ctx)
+		return
+	}
+
+	// 5. Generate the recovery codes, of which only the hashes are stored
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to generate recovery codes")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication", ctx)
+		return
+	}
+	if err := rt.db.EnableTwoFactor(ctx.UserID, counter, hashes, ctx.Token); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusConflict, "Start the two-factor enrollment first", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to enable two-factor authentication")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication", ctx)
+		return
+	}
+	rt.sessions.removeUser(ctx.UserID)
+
+	// 6. Return the recovery codes, shown only this once
+	if err := sendJSONResponse(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send recovery codes response")
+	}
+	ctx.Logger.Info("Two-factor authentication enabled", "userID", ctx.UserID)
+}
+
+// disableTwoFactor handles turning two-factor authentication off, which requires a valid TOTP or recovery code. A
+// pending enrollment is cancelled without a code.
+func (rt *_router) disableTwoFactor(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Authorization check - user can only disable their own two-factor authentication
+	if ps.ByName("userId") != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only disable your own two-factor authentication", ctx)
+		return
+	}
+
+	// 2. Parse request body
+	var req types.TwoFactorCodeRequest
+	if err := parseJSONRequest(r, &req); err != nil || (req.Code != "" && !validTwoFactorCode(req.Code)) {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+
+	// 3. Check the code if two-factor authentication is enabled
+	twoFactor, err := rt.db.GetTwoFactor(ctx.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Two-factor authentication is not enabled", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to get two-factor settings")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to disable two-factor authentication", ctx)
+		return
+	}
+	if twoFactor.Enabled {
+		valid, err := rt.checkSecondFactor(ctx.UserID, req.Code)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to check two-factor code")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to disable two-factor authentication", ctx)
+			return
+		}
+		if !valid {
+			sendErrorResponse(w, http.StatusForbidden, "Invalid code", ctx)
+			return
+		}
+	}
+
+	// 4. Remove the settings and the recovery codes
+	if err := rt.db.DisableTwoFactor(ctx.UserID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Two-factor authentication is not enabled", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to disable two-factor authentication")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to disable two-factor authentication", ctx)
+		return
+	}
+
+	// 5. Return success response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Two-factor authentication disabled", "userID", ctx.UserID)
+}
+
+// checkSecondFactor reports whether code is a valid TOTP code or unused recovery code of a user with two-factor
+// authentication enabled. A valid code is used up: TOTP codes cannot be replayed and recovery codes work only once.
+func (rt *_router) checkSecondFactor(userID, code string) (bool, error) {
+	twoFactor, err := rt.db.GetTwoFactor(userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, nil
+		}
+		return false, err
+	}
+	if !twoFactor.Enabled || code == "" {
+		return false, nil
+	}
+
+	now := globaltime.Now()
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		counter, ok := totp.Validate(twoFactor.Secret, code, now, totpSkew)
+		if !ok {
+			return false, nil
+		}
+		return rt.db.UseTwoFactorCounter(userID, counter)
+	}
+	return rt.db.UseRecoveryCode(userID, hashRecoveryCode(code), now)
+}
+
+// validTwoFactorCode checks the length of a TOTP or recovery code sent by a client
+func validTwoFactorCode(code string) bool {
+	return code != "" && len(code) <= maxTwoFactorCodeLength
+}
+
+// generateRecoveryCodes returns new recovery codes, formatted as XXXXX-XXXXX, with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		random := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		code := base32.StdEncoding.EncodeToString(random)[:recoveryCodeLength]
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the hash stored for a recovery code. Codes are random, so a fast hash suffices; dashes,
+// spaces and case are ignored, as users type them back.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// pruneLoginChallenges deletes the login challenges that expired without being completed
+func (rt *_router) pruneLoginChallenges() {
+	deleted, err := rt.db.DeleteExpiredLoginChallenges(globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting expired login challenges")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("expired login challenges deleted")
+	}
+}
@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/client"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/totp"
+)
+
+// setTime fixes the time seen by the server until the end of the test
+func setTime(t *testing.T, now time.Time) {
+	t.Helper()
+	globaltime.FixedTime = now
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+}
+
+// totpCode returns the code of secret at now
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Counter(now))
+	if err != nil {
+		t.Fatalf("computing TOTP code: %v", err)
+	}
+	return code
+}
+
+// wrongCode returns a well-formed code different from code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+// loginChallenge starts a login of name, which must be asked for a second factor
+func loginChallenge(t *testing.T, serverURL, name string) (*client.Client, string) {
+	t.Helper()
+	c := newClient(t, serverURL, "")
+	_, err := c.Login(context.Background(), name)
+	var challenge *client.SecondFactorRequiredError
+	if !errors.As(err, &challenge) {
+		t.Fatalf("Login of %s returned %v, want a second factor challenge", name, err)
+	}
+	return c, challenge.Challenge
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTime(t, now)
+	serverURL := newServer(t)
+	alice := newClient(t, serverURL, "alice")
+
+	// 1. Enroll and enable with a code of the authenticator app
+	enrollment, err := alice.EnrollTwoFactor(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTwoFactor: %v", err)
+	}
+	code := totpCode(t, enrollment.Secret, now)
+	if _, err := alice.EnableTwoFactor(ctx, wrongCode(code)); !client.IsForbidden(err) {
+		t.Fatalf("EnableTwoFactor with a wrong code returned %v, want 403", err)
+	}
+	recoveryCodes, err := alice.EnableTwoFactor(ctx, code)
+	if err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+	if len(recoveryCodes) == 0 {
+		t.Fatal("EnableTwoFactor returned no recovery codes")
+	}
+
+	// 2. Logging in now requires a second factor
+	c, challenge := loginChallenge(t, serverURL, "alice")
+	if _, err := c.CompleteLogin(ctx, challenge, wrongCode(code)); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin with a wrong code returned %v, want 401", err)
+	}
+
+	// The code used to enable two-factor authentication cannot be used again
+	if _, err := c.CompleteLogin(ctx, challenge, code); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin with a used code returned %v, want 401", err)
+	}
+
+	// 3. The code of the next step completes the login; a wrong code did not void the challenge
+	next := now.Add(totp.Period)
+	setTime(t, next)
+	nextCode := totpCode(t, enrollment.Secret, next)
+	login, err := c.CompleteLogin(ctx, challenge, nextCode)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if login.UserID != alice.UserID() || c.Token() == "" {
+		t.Fatalf("CompleteLogin returned %+v, want a session of alice", login)
+	}
+	if _, err := c.GetMyConversations(ctx); err != nil {
+		t.Fatalf("GetMyConversations with the new session: %v", err)
+	}
+
+	// 4. The challenge is used up, and so is the code, also within the accepted clock skew
+	if _, err := c.CompleteLogin(ctx, challenge, nextCode); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin with a used challenge returned %v, want 401", err)
+	}
+	c, challenge = loginChallenge(t, serverURL, "alice")
+	setTime(t, next.Add(totp.Period))
+	if _, err := c.CompleteLogin(ctx, challenge, nextCode); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin replaying a code returned %v, want 401", err)
+	}
+
+	// 5. A recovery code works once
+	if _, err := c.CompleteLogin(ctx, challenge, recoveryCodes[0]); err != nil {
+		t.Fatalf("CompleteLogin with a recovery code: %v", err)
+	}
+	c, challenge = loginChallenge(t, serverURL, "alice")
+	if _, err := c.CompleteLogin(ctx, challenge, recoveryCodes[0]); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin with a used recovery code returned %v, want 401", err)
+	}
+	status, err := c.GetTwoFactor(ctx)
+	if !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Fatalf("GetTwoFactor without a session returned %+v, %v", status, err)
+	}
+}
+
+func TestTwoFactorChallengeAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTime(t, now)
+	serverURL := newServer(t)
+	alice := newClient(t, serverURL, "alice")
+
+	enrollment, err := alice.EnrollTwoFactor(ctx)
+	if err != nil {
+		t.Fatalf("EnrollTwoFactor: %v", err)
+	}
+	code := totpCode(t, enrollment.Secret, now)
+	if _, err := alice.EnableTwoFactor(ctx, code); err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+
+	// Too many wrong codes void the challenge, even for a valid code afterwards
+	c, challenge := loginChallenge(t, serverURL, "alice")
+	for i := 0; i < 5; i++ {
+		if _, err := c.CompleteLogin(ctx, challenge, wrongCode(code)); client.StatusCode(err) != http.StatusUnauthorized {
+			t.Fatalf("CompleteLogin with a wrong code returned %v, want 401", err)
+		}
+	}
+	next := now.Add(totp.Period)
+	setTime(t, next)
+	if _, err := c.CompleteLogin(ctx, challenge, totpCode(t, enrollment.Secret, next)); !client.IsUnauthorized(err) {
+		t.Fatalf("CompleteLogin after too many wrong codes returned %v, want 401", err)
+	}
+}
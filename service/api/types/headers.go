@@ -0,0 +1,19 @@
+package types
+
+// Headers of idempotent requests. The key can also be sent as the clientMessageId field of JSON bodies; responses
+// returned again for a retried request carry the replayed header.
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+// Headers sent with every webhook delivery. The timestamp is the time of the delivery attempt in Unix seconds; the
+// signature is the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret of the webhook and
+// prefixed by "sha256=". Receivers should reject deliveries whose timestamp is more than a few minutes old, so that a
+// captured delivery cannot be replayed.
+const (
+	WebhookEventHeader     = "X-WASAText-Event"
+	WebhookDeliveryHeader  = "X-WASAText-Delivery"
+	WebhookTimestampHeader = "X-WASAText-Timestamp"
+	WebhookSignatureHeader = "X-WASAText-Signature"
+)
@@ -0,0 +1,493 @@
+// Package types defines the request and response bodies of the WASAText API, shared by the server and its Go
+// client. It depends only on the standard library.
+package types
+
+import "time"
+
+// Common request/response structures for API handlers
+// These match the OpenAPI specification in doc/api.yaml
+
+// === REQUEST STRUCTURES ===
+
+// LoginRequest represents the login request body
+type LoginRequest struct {
+	Name     string  `json:"name"`
+	Password *string `json:"password,omitempty"`
+}
+
+// CompleteLoginRequest represents the request body completing a login with the second factor
+type CompleteLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// CompleteOIDCLoginRequest represents the request body completing a single sign-on login, with the parameters the
+// identity provider redirected the user back with
+type CompleteOIDCLoginRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// TwoFactorCodeRequest represents a request body carrying a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code,omitempty"`
+}
+
+// SetPasswordRequest represents the request body securing an account with a password, or changing it
+type SetPasswordRequest struct {
+	CurrentPassword *string `json:"currentPassword,omitempty"`
+	NewPassword     string  `json:"newPassword"`
+}
+
+// UpdateUsernameRequest represents username update request
+type UpdateUsernameRequest struct {
+	Name string `json:"name"`
+}
+
+// SendMessageRequest represents text message sending request
+type SendMessageRequest struct {
+	Content string  `json:"content"`
+	ReplyTo *string `json:"replyTo,omitempty"`
+
+	// SendAt schedules the message instead of sending it right away
+	SendAt *time.Time `json:"sendAt,omitempty"`
+
+	// ClientMessageID is an idempotency key, like the Idempotency-Key header
+	ClientMessageID *string `json:"clientMessageId,omitempty"`
+}
+
+// SaveDraftRequest represents the draft of a message being written in a conversation
+type SaveDraftRequest struct {
+	Content string  `json:"content"`
+	ReplyTo *string `json:"replyTo,omitempty"`
+}
+
+// SetMessageTimerRequest represents a change of the disappearing messages timer of a conversation
+type SetMessageTimerRequest struct {
+	Seconds int64 `json:"seconds"` // 0 turns the timer off
+}
+
+// UpdateScheduledMessageRequest represents a change to a pending message; omitted fields are left unchanged
+type UpdateScheduledMessageRequest struct {
+	Content *string    `json:"content,omitempty"`
+	SendAt  *time.Time `json:"sendAt,omitempty"`
+}
+
+// CreatePollRequest represents a poll sent to a group
+type CreatePollRequest struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multipleChoice,omitempty"`
+	Anonymous      bool       `json:"anonymous,omitempty"`
+	ClosesAt       *time.Time `json:"closesAt,omitempty"` // The poll closes by itself at this time
+}
+
+// VotePollRequest represents the options chosen in a poll, by index; it replaces any previous vote
+type VotePollRequest struct {
+	Options []int `json:"options"`
+}
+
+// ForwardMessageRequest represents message forwarding request
+type ForwardMessageRequest struct {
+	ConversationID  string  `json:"conversationId"`
+	ClientMessageID *string `json:"clientMessageId,omitempty"` // Idempotency key, like the Idempotency-Key header
+}
+
+// CommentMessageRequest represents message reaction request
+type CommentMessageRequest struct {
+	Emoticon string `json:"emoticon"`
+}
+
+// CreateGroupRequest represents group creation request
+type CreateGroupRequest struct {
+	Name            string   `json:"name"`
+	Members         []string `json:"members"`
+	ClientMessageID *string  `json:"clientMessageId,omitempty"` // Idempotency key, like the Idempotency-Key header
+}
+
+// AddToGroupRequest represents adding user to group request
+type AddToGroupRequest struct {
+	UserID string `json:"userId"`
+}
+
+// UpdateGroupNameRequest represents group name update request
+type UpdateGroupNameRequest struct {
+	Name string `json:"name"`
+}
+
+// StartConversationRequest represents starting a conversation request
+type StartConversationRequest struct {
+	UserID string `json:"userId"`
+}
+
+// CreateBotRequest represents the creation of a bot account
+type CreateBotRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateWebhookRequest represents the registration of a webhook. Without a conversation, the webhook receives the
+// events of all the direct conversations of the user.
+type CreateWebhookRequest struct {
+	URL            string   `json:"url"`
+	ConversationID *string  `json:"conversationId,omitempty"`
+	Events         []string `json:"events"`
+}
+
+// CreateAccessTokenRequest represents the creation of a personal access token. Without expiresAt the token does not
+// expire.
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// === RESPONSE STRUCTURES ===
+
+// LoginResponse represents the login response body
+type LoginResponse struct {
+	Identifier string `json:"identifier"`
+	UserID     string `json:"userId"`
+}
+
+// LoginChallengeResponse represents the login response of users with two-factor authentication enabled: the
+// challenge is exchanged for a session token with a valid code
+type LoginChallengeResponse struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// OIDCLoginResponse represents a single sign-on login started by the user, who logs in at the authorization URL
+type OIDCLoginResponse struct {
+	AuthorizationURL string    `json:"authorizationUrl"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+}
+
+// TwoFactorResponse represents the two-factor authentication settings of the user
+type TwoFactorResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// TwoFactorEnrollmentResponse represents a new TOTP secret, to add to an authenticator app
+type TwoFactorEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse represents the recovery codes issued when two-factor authentication is enabled
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ErrorResponse represents error response
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// UserResponse represents user information
+type UserResponse struct {
+	ID       string  `json:"id"`
+	Username string  `json:"username"`
+	PhotoURL *string `json:"photoUrl,omitempty"`
+	IsBot    bool    `json:"isBot"`
+}
+
+// SearchUsersResponse represents user search results
+type SearchUsersResponse struct {
+	Users []UserResponse `json:"users"`
+}
+
+// MessagePreview represents a message preview in conversation list
+type MessagePreview struct {
+	ID             string    `json:"id"`
+	Content        *string   `json:"content,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+	SenderUsername string    `json:"senderUsername"`
+	HasPhoto       bool      `json:"hasPhoto"`
+	AttachmentName *string   `json:"attachmentName,omitempty"` // Filename of the attached file, if any
+}
+
+// DraftResponse represents the unsent text of the user in a conversation
+type DraftResponse struct {
+	Content   string    `json:"content"`
+	ReplyToID *string   `json:"replyToId,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ConversationResponse represents a conversation in the list
+type ConversationResponse struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"` // "direct" or "group"
+	Name           string          `json:"name"`
+	PhotoURL       *string         `json:"photoUrl,omitempty"`
+	LastMessage    *MessagePreview `json:"lastMessage,omitempty"`
+	UnreadCount    int             `json:"unreadCount"`
+	UnreadMentions int             `json:"unreadMentions"`         // Unread messages mentioning the user
+	MessageTimer   int64           `json:"messageTimer,omitempty"` // Seconds new messages last, 0 if they do not expire
+	Draft          *DraftResponse  `json:"draft,omitempty"`
+}
+
+// ConversationsResponse represents the list of user's conversations
+type ConversationsResponse struct {
+	Conversations []ConversationResponse `json:"conversations"`
+}
+
+// CommentResponse represents a message reaction/comment
+type CommentResponse struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Emoticon  string    `json:"emoticon"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MessageResponse represents a message with all details
+type MessageResponse struct {
+	ID             string               `json:"id"`
+	SenderID       string               `json:"senderId"`
+	SenderUsername string               `json:"senderUsername"`
+	Content        *string              `json:"content,omitempty"`
+	PhotoURL       *string              `json:"photoUrl,omitempty"` // First photo of albums
+	Photos         []string             `json:"photos,omitempty"`   // Photos of an album, in order
+	ReplyToID      *string              `json:"replyToId,omitempty"`
+	Forwarded      bool                 `json:"forwarded,omitempty"`
+	System         bool                 `json:"system,omitempty"`     // Announcement generated by the server
+	Type           string               `json:"type"`                 // "text", "photo", "file", "poll" or "system"
+	Event          *GroupEventResponse  `json:"event,omitempty"`      // Group event announced by a system message
+	Attachment     *AttachmentResponse  `json:"attachment,omitempty"` // File attached to the message
+	Poll           *PollResponse        `json:"poll,omitempty"`       // Question, options and results of a poll
+	Timestamp      time.Time            `json:"timestamp"`
+	ExpiresAt      *time.Time           `json:"expiresAt,omitempty"`
+	LinkPreview    *LinkPreviewResponse `json:"linkPreview,omitempty"` // Added once the link has been fetched
+	Mentions       []MentionResponse    `json:"mentions,omitempty"`
+	Status         string               `json:"status"` // "sent", "delivered", "read"
+	Comments       []CommentResponse    `json:"comments"`
+}
+
+// AttachmentResponse represents a file attached to a message, downloaded from the attachment endpoint of the message
+type AttachmentResponse struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"` // Sniffed from the content of the file
+	Size     int64  `json:"size"`     // In bytes
+}
+
+// PollResponse represents a poll with its results so far, as seen by the user who requested it
+type PollResponse struct {
+	Question       string               `json:"question"`
+	Options        []PollOptionResponse `json:"options"`
+	MultipleChoice bool                 `json:"multipleChoice"`
+	Anonymous      bool                 `json:"anonymous"`
+	ClosesAt       *time.Time           `json:"closesAt,omitempty"`
+	Closed         bool                 `json:"closed"`
+	TotalVoters    int                  `json:"totalVoters"`        // Users who voted, at most once each
+	OwnVotes       []int                `json:"ownVotes,omitempty"` // Indexes of the options chosen by the user
+}
+
+// PollOptionResponse represents an option of a poll with its votes. Voters are listed for public polls only.
+type PollOptionResponse struct {
+	Text   string              `json:"text"`
+	Votes  int                 `json:"votes"`
+	Voters []PollVoterResponse `json:"voters,omitempty"`
+}
+
+// PollVoterResponse represents a user who chose an option of a public poll
+type PollVoterResponse struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// GroupEventResponse represents an event of a group (e.g., a member added) announced by a system message. Usernames
+// are those at the time of the event. Timer changes are announced in direct conversations too.
+type GroupEventResponse struct {
+	// Type is "member_added", "member_left", "member_removed", "group_renamed" or "timer_changed"
+	Type           string  `json:"type"`
+	ActorID        string  `json:"actorId"`
+	ActorUsername  string  `json:"actorUsername"`
+	TargetID       *string `json:"targetId,omitempty"`
+	TargetUsername *string `json:"targetUsername,omitempty"`
+	OldName        *string `json:"oldName,omitempty"`
+	NewName        *string `json:"newName,omitempty"`
+	Duration       *int64  `json:"duration,omitempty"` // New message timer in seconds, 0 if turned off
+}
+
+// MentionResponse represents a group member mentioned in the text of a message
+type MentionResponse struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Offset   int    `json:"offset"` // Position of "@username" in the text, in characters
+	Length   int    `json:"length"`
+}
+
+// MentionedMessageResponse represents a message mentioning the user, in the mentions feed
+type MentionedMessageResponse struct {
+	ConversationID   string          `json:"conversationId"`
+	ConversationName *string         `json:"conversationName,omitempty"`
+	Unread           bool            `json:"unread"`
+	Message          MessageResponse `json:"message"`
+}
+
+// MentionsResponse represents the mentions feed of the user
+type MentionsResponse struct {
+	Mentions []MentionedMessageResponse `json:"mentions"`
+}
+
+// StarredMessageResponse represents a message starred by the user, with the conversation it belongs to. Direct
+// conversations are named after the other participant.
+type StarredMessageResponse struct {
+	ConversationID   string          `json:"conversationId"`
+	ConversationType string          `json:"conversationType"` // "direct" or "group"
+	ConversationName *string         `json:"conversationName,omitempty"`
+	StarredAt        time.Time       `json:"starredAt"`
+	Message          MessageResponse `json:"message"`
+}
+
+// StarredMessagesResponse represents the starred messages of the user, most recently starred first
+type StarredMessagesResponse struct {
+	Starred []StarredMessageResponse `json:"starred"`
+}
+
+// SyncResponse represents the changes visible to the user since a sync cursor. Changed conversations and messages
+// are returned in their current state.
+type SyncResponse struct {
+	Cursor               string                     `json:"cursor"`  // Value of since for the next sync
+	HasMore              bool                       `json:"hasMore"` // More changes are pending: sync again right away
+	Conversations        []ConversationResponse     `json:"conversations"`
+	Messages             []SyncedMessageResponse    `json:"messages"`
+	DeletedMessages      []DeletedMessageResponse   `json:"deletedMessages"`
+	Memberships          []MembershipChangeResponse `json:"memberships"`
+	RemovedConversations []string                   `json:"removedConversations"` // Conversations the user no longer participates in
+}
+
+// SyncedMessageResponse represents a message created or changed since the sync cursor, e.g. by a reaction
+type SyncedMessageResponse struct {
+	ConversationID string          `json:"conversationId"`
+	Message        MessageResponse `json:"message"`
+}
+
+// DeletedMessageResponse represents a message deleted, or expired, since the sync cursor
+type DeletedMessageResponse struct {
+	ConversationID string `json:"conversationId"`
+	MessageID      string `json:"messageId"`
+}
+
+// MembershipChangeResponse represents a participant joining or leaving a conversation since the sync cursor
+type MembershipChangeResponse struct {
+	ConversationID string `json:"conversationId"`
+	UserID         string `json:"userId"`
+	Action         string `json:"action"` // "joined" or "left"
+}
+
+// LinkPreviewResponse represents the preview of the first link in a message
+type LinkPreviewResponse struct {
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	Description *string `json:"description,omitempty"`
+	ImageURL    *string `json:"imageUrl,omitempty"`
+}
+
+// ScheduledMessageResponse represents a message waiting to be sent
+type ScheduledMessageResponse struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversationId"`
+	Content        *string   `json:"content,omitempty"`
+	PhotoURL       *string   `json:"photoUrl,omitempty"`
+	Photos         []string  `json:"photos,omitempty"` // Photos of an album, in order
+	ReplyToID      *string   `json:"replyToId,omitempty"`
+	SendAt         time.Time `json:"sendAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ScheduledMessagesResponse represents the list of user's pending messages
+type ScheduledMessagesResponse struct {
+	ScheduledMessages []ScheduledMessageResponse `json:"scheduledMessages"`
+}
+
+// BotResponse represents a bot account owned by the user
+type BotResponse struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	PhotoURL  *string   `json:"photoUrl,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Token     string    `json:"token,omitempty"` // Returned only when the token is issued
+}
+
+// BotsResponse represents the list of user's bots
+type BotsResponse struct {
+	Bots []BotResponse `json:"bots"`
+}
+
+// WebhookResponse represents a webhook registered by the user
+type WebhookResponse struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	ConversationID *string   `json:"conversationId,omitempty"`
+	Events         []string  `json:"events"`
+	Secret         string    `json:"secret,omitempty"` // Returned only when the webhook is created
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// WebhooksResponse represents the list of user's webhooks
+type WebhooksResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+// AccessTokenResponse represents a personal access token of the user
+type AccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"` // Returned only when the token is created
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// AccessTokensResponse represents the list of user's personal access tokens
+type AccessTokensResponse struct {
+	Tokens []AccessTokenResponse `json:"tokens"`
+}
+
+// WebhookDeliveryResponse represents the delivery of an event to a webhook
+type WebhookDeliveryResponse struct {
+	ID             string     `json:"id"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"` // "pending", "delivered" or "failed"
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	LastStatusCode *int       `json:"lastStatusCode,omitempty"`
+	LastError      *string    `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// WebhookDeliveriesResponse represents the recent deliveries of a webhook, newest first
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+}
+
+// ConversationDetailResponse represents conversation details with messages
+type ConversationDetailResponse struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	Name          string            `json:"name"`
+	PhotoURL      *string           `json:"photoUrl,omitempty"`
+	CreatedAt     *time.Time        `json:"createdAt,omitempty"`
+	LastMessageAt *time.Time        `json:"lastMessageAt,omitempty"`
+	MessageTimer  int64             `json:"messageTimer,omitempty"` // Seconds new messages last, 0 if they do not expire
+	Members       []UserResponse    `json:"members"`
+	Messages      []MessageResponse `json:"messages"`
+}
+
+// GroupResponse represents a group with all details
+type GroupResponse struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	PhotoURL  *string        `json:"photoUrl,omitempty"`
+	Members   []UserResponse `json:"members"`
+	CreatedBy string         `json:"createdBy"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// EmptyResponse represents an empty success response
+type EmptyResponse struct{}
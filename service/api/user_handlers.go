@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -26,7 +28,7 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	// 3. Parse request body to get new username
-	var req UpdateUsernameRequest
+	var req types.UpdateUsernameRequest
 	if err := parseJSONRequest(r, &req); err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
 		return
@@ -52,12 +54,93 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update username", ctx)
 		return
 	}
+	rt.sessions.removeUser(ctx.UserID)
 
 	// 7. Return success response
 	w.WriteHeader(http.StatusNoContent) // 204 No Content
 	ctx.Logger.Info("Username updated successfully", "userID", ctx.UserID, "newUsername", req.Name)
 }
 
+// setMyPassword handles securing the user's account with a password (claiming it) or changing the password. Every
+// other session of the user is revoked.
+func (rt *_router) setMyPassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Authorization check - user can only set their own password
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only set your own password", ctx)
+		return
+	}
+	if !rt.passwords {
+		sendErrorResponse(w, http.StatusForbidden, "Passwords are disabled on this server", ctx)
+		return
+	}
+
+	// 2. Parse and validate request body
+	var req types.SetPasswordRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Bots authenticate with their bot token only, single sign-on users with the identity provider
+	user, err := rt.db.GetUserByID(ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get user")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set password", ctx)
+		return
+	}
+	if user.IsBot {
+		sendErrorResponse(w, http.StatusForbidden, "Bots cannot have a password", ctx)
+		return
+	}
+
+	// Accounts of single sign-on users are secured by the identity provider
+	sso, err := rt.db.HasOIDCIdentity(ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to check single sign-on")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set password", ctx)
+		return
+	}
+	if sso {
+		sendErrorResponse(w, http.StatusForbidden, "This account logs in with single sign-on", ctx)
+		return
+	}
+
+	// 4. Changing the password of a secured account requires the current one
+	hash, err := rt.db.GetUserPasswordHash(ctx.UserID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get password")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set password", ctx)
+		return
+	}
+	if hash != "" && (req.CurrentPassword == nil || !checkPassword(hash, *req.CurrentPassword)) {
+		sendErrorResponse(w, http.StatusForbidden, "Current password is incorrect", ctx)
+		return
+	}
+
+	// 5. Store the new password, logging out the other sessions
+	newHash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to hash password")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set password", ctx)
+		return
+	}
+	if err := rt.db.SetUserPassword(ctx.UserID, newHash, ctx.Token); err != nil {
+		ctx.Logger.WithError(err).Error("Failed to set password")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to set password", ctx)
+		return
+	}
+	rt.sessions.removeUser(ctx.UserID)
+
+	// 6. Return success response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Password set successfully", "userID", ctx.UserID, "claimed", hash == "")
+}
+
 // setMyPhoto handles updating a user's profile photo
 func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// 1. Get user ID from URL parameter
@@ -81,12 +164,12 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 	}
 	defer file.Close()
 
-	// 4. Generate filename (use userID to ensure uniqueness)
+	// 4. Generate a new filename for every upload, as uploaded files are cached by clients as immutable
 	fileExt := strings.ToLower(filepath.Ext(header.Filename))
 	if fileExt == "" {
 		fileExt = ".jpg" // default extension
 	}
-	filename := fmt.Sprintf("%s%s", ctx.UserID, fileExt)
+	filename := fmt.Sprintf("%s%s", uuid.Must(uuid.NewV4()).String(), fileExt)
 
 	// 5. Save photo file to temporary storage
 	photoURL, err := saveUploadedImage(file, "profiles", filename)
@@ -96,12 +179,24 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	// 6. Update user's photo_url in database
+	// 6. Update user's photo_url in database, then remove the previous photo
+	user, err := rt.db.GetUserByID(ctx.UserID)
+	if err != nil {
+		ctx.Logger.Error("Failed to get user", "error", err, "userID", ctx.UserID)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update photo", ctx)
+		return
+	}
 	if err := rt.db.UpdateUserPhoto(ctx.UserID, photoURL); err != nil {
 		ctx.Logger.Error("Failed to update user photo in database", "error", err, "userID", ctx.UserID)
 		sendErrorResponse(w, http.StatusInternalServerError, "Failed to update photo", ctx)
 		return
 	}
+	rt.sessions.removeUser(ctx.UserID)
+	if user.PhotoURL != nil && *user.PhotoURL != photoURL {
+		if _, err := removeUploadedFiles([]string{*user.PhotoURL}); err != nil {
+			ctx.Logger.WithError(err).Warn("Failed to remove previous profile photo")
+		}
+	}
 
 	// 7. Return success response
 	w.WriteHeader(http.StatusNoContent)
@@ -135,16 +230,17 @@ func (rt *_router) searchUsers(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 
 	// 5. Format response as JSON with list of matching users
-	response := SearchUsersResponse{
-		Users: make([]UserResponse, len(users)),
+	response := types.SearchUsersResponse{
+		Users: make([]types.UserResponse, len(users)),
 	}
 
 	// Convert database users to response format
 	for i, user := range users {
-		response.Users[i] = UserResponse{
+		response.Users[i] = types.UserResponse{
 			ID:       user.ID,
 			Username: user.Username,
 			PhotoURL: user.PhotoURL,
+			IsBot:    user.IsBot,
 		}
 	}
 
@@ -184,13 +280,26 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	// Convert to response format
-	response := UserResponse{
+	response := types.UserResponse{
 		ID:       user.ID,
 		Username: user.Username,
 		PhotoURL: user.PhotoURL,
+		IsBot:    user.IsBot,
+	}
+
+	// Profiles are small: the entity tag is derived from the profile itself
+	photoURL := ""
+	if user.PhotoURL != nil {
+		photoURL = *user.PhotoURL
+	}
+	etag := weakETag(fmt.Sprintf("%s:%s:%s:%t", user.ID, user.Username, photoURL, user.IsBot))
+	if matchesETag(r, etag) {
+		sendNotModified(w, etag)
+		return
 	}
 
 	// Send response
+	setETag(w, etag)
 	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
 		ctx.Logger.WithError(err).Error("failed to send user profile response")
 		return
@@ -198,3 +307,43 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 
 	ctx.Logger.Info("User profile retrieved successfully", "requestedUserID", userID, "requestingUserID", ctx.UserID)
 }
+
+// deleteAccount handles deleting the account of the authenticated user. Sessions are revoked, messages are deleted or
+// anonymised according to the configured policy, groups are left (handing off ownership), the bots of the user are
+// deleted and media files are removed.
+func (rt *_router) deleteAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only delete your own account", ctx)
+		return
+	}
+
+	// 2. Delete the account data and the bots of the user, which cannot outlive their owner
+	deleted, err := rt.db.DeleteUserAndBots(userID, rt.deletionPolicy)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "User not found", ctx)
+			return
+		}
+		ctx.Logger.WithError(err).Error("Failed to delete account")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete account", ctx)
+		return
+	}
+	for _, bot := range deleted.BotsDeleted {
+		rt.sessions.removeUser(bot.UserID)
+	}
+	rt.sessions.removeUser(userID)
+
+	// 3. Remove the media files that are no longer referenced. The account is already gone, so failures are only logged.
+	removed, err := removeUploadedFiles(deleted.MediaURLs)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to remove media files of deleted account")
+	}
+
+	// 4. Return success response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Account deleted successfully", "userID", userID, "policy", rt.deletionPolicy,
+		"messagesDeleted", deleted.MessagesDeleted, "messagesAnonymized", deleted.MessagesAnonymized,
+		"groupsHandedOff", deleted.GroupsHandedOff, "botsDeleted", len(deleted.BotsDeleted), "filesRemoved", removed)
+}
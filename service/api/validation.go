@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/Daniel200273/WASA-project/doc"
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/openapi"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// maxValidatedResponseSize is the largest response body kept in memory for validation; larger bodies are not checked
+const maxValidatedResponseSize = 1 << 20
+
+// getOpenAPISpec serves the OpenAPI specification of this API
+func (rt *_router) getOpenAPISpec(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(doc.OpenAPI); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send the OpenAPI specification")
+	}
+}
+
+// validateTraffic checks requests (and, if enabled, responses) against the OpenAPI specification. Requests that do not
+// conform are rejected with 400 Bad Request; non-conforming responses are logged, as they have already been sent.
+// Requests not described by the specification (e.g., uploaded files) are passed through untouched.
+func (rt *_router) validateTraffic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := rt.baseLogger.WithFields(logrus.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+		})
+
+		op, err := rt.spec.ValidateRequest(r)
+		if errors.Is(err, openapi.ErrUnknownOperation) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil && rt.validateRequests {
+			logger.WithError(err).Warning("request does not match the API specification")
+			if err := sendJSONResponse(w, http.StatusBadRequest, types.ErrorResponse{Message: "Invalid request: " + err.Error()}); err != nil {
+				logger.WithError(err).Error("failed to send error response")
+			}
+			return
+		}
+
+		if !rt.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.truncated {
+			return
+		}
+		if err := op.ValidateResponse(rec.statusCode, w.Header(), rec.body.Bytes()); err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"operation": op.ID,
+				"status":    rec.statusCode,
+			}).Error("response does not match the API specification")
+		}
+	})
+}
+
+// responseRecorder keeps a copy of the response status and body while sending them to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	truncated   bool
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.statusCode = statusCode
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	if !rec.truncated {
+		if rec.body.Len()+len(p) > maxValidatedResponseSize {
+			rec.truncated = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	return rec.ResponseWriter.Write(p)
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Daniel200273/WASA-project/service/api/reqcontext"
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxWebhooksPerUser is the maximum number of webhooks a user can register
+const maxWebhooksPerUser = 20
+
+// Number of deliveries returned by getWebhookDeliveries, unless the limit query parameter says otherwise
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 100
+)
+
+// createWebhook handles registering a webhook for a conversation, or for all the direct conversations of the user
+func (rt *_router) createWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only register your own webhooks", ctx)
+		return
+	}
+
+	// 2. Parse and validate request body
+	var req types.CreateWebhookRequest
+	if err := parseJSONRequest(r, &req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body", ctx)
+		return
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	events, err := validateWebhookEvents(req.Events)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	if req.ConversationID != nil {
+		if err := validateID(*req.ConversationID, "conversationId"); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+			return
+		}
+	}
+
+	// 3. Only bots receive commands
+	for _, event := range events {
+		if event != database.WebhookEventCommandReceived {
+			continue
+		}
+		user, err := rt.db.GetUserByID(userID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("Failed to get user")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create webhook", ctx)
+			return
+		}
+		if !user.IsBot {
+			sendErrorResponse(w, http.StatusBadRequest, "Only bots can subscribe to command.received", ctx)
+			return
+		}
+	}
+
+	// 4. Check the number of webhooks of the user
+	webhooks, err := rt.db.GetUserWebhooks(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get webhooks")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to create webhook", ctx)
+		return
+	}
+	if len(webhooks) >= maxWebhooksPerUser {
+		sendErrorResponse(w, http.StatusConflict, "Too many webhooks, delete one first", ctx)
+		return
+	}
+
+	// 5. Create the webhook
+	webhook, err := rt.db.CreateWebhook(userID, req.ConversationID, req.URL, events)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to create webhook")
+		switch {
+		case strings.Contains(err.Error(), "not a participant"), strings.Contains(err.Error(), "only the group admin"):
+			sendErrorResponse(w, http.StatusForbidden, "Only participants of direct conversations and group admins can register webhooks", ctx)
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to create webhook", ctx)
+		}
+		return
+	}
+
+	// 6. Return the webhook with its secret, which is never shown again
+	response := toWebhookResponse(*webhook)
+	response.Secret = webhook.Secret
+	if err := sendJSONResponse(w, http.StatusCreated, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send webhook response")
+	}
+	ctx.Logger.Info("Webhook created successfully", "webhookID", webhook.ID)
+}
+
+// getWebhooks handles listing the webhooks of the user
+func (rt *_router) getWebhooks(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own webhooks", ctx)
+		return
+	}
+
+	// 2. Get the webhooks from database
+	webhooks, err := rt.db.GetUserWebhooks(userID)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("Failed to get webhooks")
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to get webhooks", ctx)
+		return
+	}
+
+	// 3. Convert to response format
+	response := types.WebhooksResponse{
+		Webhooks: make([]types.WebhookResponse, len(webhooks)),
+	}
+	for i, webhook := range webhooks {
+		response.Webhooks[i] = toWebhookResponse(webhook)
+	}
+
+	// 4. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send webhooks response")
+	}
+}
+
+// deleteWebhook handles deleting a webhook of the user with its pending deliveries
+func (rt *_router) deleteWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only delete your own webhooks", ctx)
+		return
+	}
+
+	// 2. Validate webhookId format
+	webhookID := ps.ByName("webhookId")
+	if err := validateID(webhookID, "webhookId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+
+	// 3. Delete the webhook
+	if err := rt.db.DeleteWebhook(webhookID, userID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Webhook not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to delete webhook")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete webhook", ctx)
+		}
+		return
+	}
+
+	// 4. Return 204 No Content response
+	w.WriteHeader(http.StatusNoContent)
+	ctx.Logger.Info("Webhook deleted successfully", "webhookID", webhookID)
+}
+
+// getWebhookDeliveries handles listing the recent deliveries of a webhook of the user, newest first
+func (rt *_router) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// 1. Get user ID from URL parameter and validate authorization
+	userID := ps.ByName("userId")
+	if userID != ctx.UserID {
+		sendErrorResponse(w, http.StatusForbidden, "You can only view your own webhooks", ctx)
+		return
+	}
+
+	// 2. Validate webhookId format and the limit
+	webhookID := ps.ByName("webhookId")
+	if err := validateID(webhookID, "webhookId"); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error(), ctx)
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if value := getQueryParam(r, "limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDeliveriesLimit {
+			sendErrorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxDeliveriesLimit), ctx)
+			return
+		}
+		limit = n
+	}
+
+	// 3. Get the deliveries from database
+	deliveries, err := rt.db.GetWebhookDeliveries(webhookID, userID, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sendErrorResponse(w, http.StatusNotFound, "Webhook not found", ctx)
+		} else {
+			ctx.Logger.WithError(err).Error("Failed to get webhook deliveries")
+			sendErrorResponse(w, http.StatusInternalServerError, "Failed to get webhook deliveries", ctx)
+		}
+		return
+	}
+
+	// 4. Convert to response format
+	response := types.WebhookDeliveriesResponse{
+		Deliveries: make([]types.WebhookDeliveryResponse, len(deliveries)),
+	}
+	for i, delivery := range deliveries {
+		response.Deliveries[i] = types.WebhookDeliveryResponse{
+			ID:             delivery.ID,
+			Event:          delivery.EventType,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastAttemptAt:  delivery.LastAttemptAt,
+			LastStatusCode: delivery.LastStatusCode,
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreatedAt,
+		}
+		if delivery.Status == database.DeliveryStatusPending {
+			response.Deliveries[i].NextAttemptAt = delivery.NextAttemptAt
+		}
+	}
+
+	// 5. Return success response
+	if err := sendJSONResponse(w, http.StatusOK, response); err != nil {
+		ctx.Logger.WithError(err).Error("failed to send webhook deliveries response")
+	}
+}
+
+// toWebhookResponse converts a webhook to its response format, without the secret
+func toWebhookResponse(webhook database.Webhook) types.WebhookResponse {
+	return types.WebhookResponse{
+		ID:             webhook.ID,
+		URL:            webhook.URL,
+		ConversationID: webhook.ConversationID,
+		Events:         webhook.Events,
+		CreatedAt:      webhook.CreatedAt,
+	}
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/api/types"
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultWebhookInterval is how often pending webhook deliveries are sent, unless configured otherwise
+const defaultWebhookInterval = 5 * time.Second
+
+// webhookBatchSize is the maximum number of deliveries attempted in a single round
+const webhookBatchSize = 50
+
+// Failed deliveries are retried with exponential backoff, starting from webhookRetryBase and capped at
+// webhookRetryMax, until webhookMaxAttempts attempts have been made
+const (
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+	webhookMaxAttempts = 8
+)
+
+// webhookDeliveryRetention is how long delivered and failed deliveries are kept for the deliveries endpoint
+const webhookDeliveryRetention = 7 * 24 * time.Hour
+
+// WebhookEvent is the body of a webhook delivery
+type WebhookEvent struct {
+	ID             string      `json:"id"`
+	Type           string      `json:"type"`
+	ConversationID string      `json:"conversationId"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	Data           interface{} `json:"data"`
+}
+
+// ReactionEventData is the data of a reaction.added event
+type ReactionEventData struct {
+	MessageID string                `json:"messageId"`
+	Reaction  types.CommentResponse `json:"reaction"`
+}
+
+// MemberEventData is the data of the member.joined and member.left events
+type MemberEventData struct {
+	UserID string `json:"userId"`
+	// ActorID is the user who added or removed the member, omitted when the member joined or left on their own
+	ActorID string `json:"actorId,omitempty"`
+}
+
+// CommandEventData is the data of a command.received event
+type CommandEventData struct {
+	// Command is the name of the command, without the leading "/" and the bot username
+	Command string `json:"command"`
+	// Args is the text following the command, empty if there is none
+	Args    string                `json:"args"`
+	Message types.MessageResponse `json:"message"`
+}
+
+// botCommandPattern matches messages like "/command", "/command@botname" and "/command@botname some arguments"
+var botCommandPattern = regexp.MustCompile(`(?s)^/([a-zA-Z0-9_]{1,32})(?:@([a-zA-Z0-9_-]{3,16}))?(?:\s+(.*))?$`)
+
+// emitWebhookEvent queues an event of a conversation for the webhooks subscribed to it. Webhooks are best effort:
+// errors are logged and never fail the request that caused the event.
+func (rt *_router) emitWebhookEvent(conversationID, eventType string, data interface{}) {
+	logger := rt.baseLogger.WithFields(logrus.Fields{"conversationID": conversationID, "event": eventType})
+
+	payload, err := encodeWebhookEvent(conversationID, eventType, data)
+	if err != nil {
+		logger.WithError(err).Error("error encoding webhook event")
+		return
+	}
+
+	if _, err := rt.db.EnqueueWebhookEvent(conversationID, eventType, payload); err != nil {
+		logger.WithError(err).Error("error queueing webhook event")
+	}
+}
+
+// emitBotCommand queues a message starting with "/" as a command for the bots of its conversation. A command
+// addressed with "/command@botname" reaches only that bot. Messages that are not commands are ignored.
+func (rt *_router) emitBotCommand(conversationID string, message types.MessageResponse) {
+	if message.Content == nil {
+		return
+	}
+	match := botCommandPattern.FindStringSubmatch(*message.Content)
+	if match == nil {
+		return
+	}
+	logger := rt.baseLogger.WithFields(logrus.Fields{"conversationID": conversationID, "messageID": message.ID})
+
+	payload, err := encodeWebhookEvent(conversationID, database.WebhookEventCommandReceived, CommandEventData{
+		Command: match[1],
+		Args:    strings.TrimSpace(match[3]),
+		Message: message,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error encoding bot command")
+		return
+	}
+
+	if _, err := rt.db.EnqueueBotCommand(conversationID, message.SenderID, match[2], payload); err != nil {
+		logger.WithError(err).Error("error queueing bot command")
+	}
+}
+
+// encodeWebhookEvent returns the body of the deliveries of a new event
+func encodeWebhookEvent(conversationID, eventType string, data interface{}) ([]byte, error) {
+	return json.Marshal(WebhookEvent{
+		ID:             uuid.Must(uuid.NewV4()).String(),
+		Type:           eventType,
+		ConversationID: conversationID,
+		CreatedAt:      globaltime.Now(),
+		Data:           data,
+	})
+}
+
+// dispatchWebhooks sends the webhook deliveries that are due. Deliveries interrupted by Close stay pending, and are
+// sent again after a restart.
+func (rt *_router) dispatchWebhooks() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-rt.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	due, err := rt.db.GetDueWebhookDeliveries(globaltime.Now(), webhookBatchSize)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error retrieving due webhook deliveries")
+		return
+	}
+
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		rt.deliverWebhook(ctx, delivery)
+	}
+}
+
+// deliverWebhook makes an attempt to send a delivery and records its outcome. Any 2xx response counts as delivered.
+func (rt *_router) deliverWebhook(ctx context.Context, delivery database.WebhookDelivery) {
+	logger := rt.baseLogger.WithFields(logrus.Fields{"deliveryID": delivery.ID, "webhookID": delivery.WebhookID})
+
+	// 1. Send the event
+	statusCode, err := rt.postWebhook(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: the attempt does not count
+		return
+	}
+
+	// 2. Decide what comes next
+	attempt := database.WebhookAttempt{
+		Status: database.DeliveryStatusDelivered,
+		At:     globaltime.Now(),
+	}
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+	if err != nil {
+		message := err.Error()
+		attempt.Error = &message
+
+		attempts := delivery.Attempts + 1
+		if attempts >= webhookMaxAttempts {
+			attempt.Status = database.DeliveryStatusFailed
+			logger.WithError(err).Warning("webhook delivery failed, giving up")
+		} else {
+			next := attempt.At.Add(webhookBackoff(attempts)).UTC()
+			attempt.Status = database.DeliveryStatusPending
+			attempt.NextAttemptAt = &next
+			logger.WithError(err).Info("webhook delivery failed, retrying later")
+		}
+	}
+
+	// 3. Record the outcome
+	if err := rt.db.RecordWebhookAttempt(delivery.ID, attempt); err != nil {
+		// Deleted with its webhook while delivering
+		logger.WithError(err).Warning("error recording webhook attempt")
+	}
+}
+
+// postWebhook sends the payload of a delivery to its webhook, returning the response status code (0 if there is no
+// response) and an error unless the status code is 2xx
+func (rt *_router) postWebhook(ctx context.Context, delivery database.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WASAText-Webhooks/1.0")
+	req.Header.Set(types.WebhookEventHeader, delivery.EventType)
+	req.Header.Set(types.WebhookDeliveryHeader, delivery.ID)
+	timestamp := strconv.FormatInt(globaltime.Now().Unix(), 10)
+	req.Header.Set(types.WebhookTimestampHeader, timestamp)
+	req.Header.Set(types.WebhookSignatureHeader, signWebhookPayload(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := rt.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a bit of the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// pruneWebhookDeliveries deletes the finished deliveries older than webhookDeliveryRetention
+func (rt *_router) pruneWebhookDeliveries() {
+	deleted, err := rt.db.DeleteFinishedWebhookDeliveries(globaltime.Now().Add(-webhookDeliveryRetention))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error deleting old webhook deliveries")
+		return
+	}
+	if deleted > 0 {
+		rt.baseLogger.WithField("deleted", deleted).Info("old webhook deliveries deleted")
+	}
+}
+
+// webhookBackoff returns the delay before the next attempt, after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// signWebhookPayload returns the value of the signature header of a delivery attempt made at timestamp. Signing the
+// timestamp with the payload lets receivers reject replayed deliveries.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
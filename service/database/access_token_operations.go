@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === ACCESS TOKEN OPERATIONS ===
+
+// accessTokenColumns are the columns scanned by scanAccessToken, in order
+const accessTokenColumns = `id, user_id, name, scopes, expires_at, last_used_at, created_at`
+
+// CreateAccessToken stores a personal access token of a user, by the hash of the token. A user can have at most
+// maxTokens tokens, expired ones included until they are deleted.
+func (db *appdbimpl) CreateAccessToken(userID, name, tokenHash string, scopes []string, expiresAt *time.Time, maxTokens int) (*AccessToken, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Check the number of tokens of the user
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM access_tokens WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("error counting access tokens: %w", err)
+	}
+	if count >= maxTokens {
+		return nil, fmt.Errorf("access token limit reached")
+	}
+
+	// 2. Store the token
+	token := AccessToken{
+		ID:        uuid.Must(uuid.NewV4()).String(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		token.ExpiresAt = &utc
+	}
+	_, err = tx.Exec(`
+		INSERT INTO access_tokens (id, user_id, name, token_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.ID, userID, name, tokenHash, strings.Join(scopes, ","), token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating access token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return &token, nil
+}
+
+// GetUserAccessTokens retrieves the personal access tokens of a user, newest first
+func (db *appdbimpl) GetUserAccessTokens(userID string) ([]AccessToken, error) {
+	rows, err := db.c.Query(`SELECT `+accessTokenColumns+` FROM access_tokens WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []AccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// GetAccessTokenByHash retrieves the access token with the given hash, if it has not expired at now
+func (db *appdbimpl) GetAccessTokenByHash(tokenHash string, now time.Time) (*AccessToken, error) {
+	row := db.c.QueryRow(`
+		SELECT `+accessTokenColumns+`
+		FROM access_tokens
+		WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)`, tokenHash, now.UTC())
+	token, err := scanAccessToken(row)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("access token not found")
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// TouchAccessToken records that an access token was used at now
+func (db *appdbimpl) TouchAccessToken(tokenID string, now time.Time) error {
+	if _, err := db.c.Exec(`UPDATE access_tokens SET last_used_at = ? WHERE id = ?`, now.UTC(), tokenID); err != nil {
+		return fmt.Errorf("error updating access token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccessToken revokes a personal access token of a user
+func (db *appdbimpl) DeleteAccessToken(tokenID, userID string) error {
+	result, err := db.c.Exec(`DELETE FROM access_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting access token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("access token not found")
+	}
+	return nil
+}
+
+// DeleteExpiredAccessTokens deletes the access tokens expired at now, returning how many were deleted
+func (db *appdbimpl) DeleteExpiredAccessTokens(now time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM access_tokens WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired access tokens: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deleted, nil
+}
+
+// scanAccessToken converts a row selected with accessTokenColumns into an AccessToken. sql.ErrNoRows is wrapped, so
+// that isNotFoundError recognizes it.
+func scanAccessToken(row interface{ Scan(...interface{}) error }) (*AccessToken, error) {
+	var token AccessToken
+	var scopes string
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning access token: %w", err)
+	}
+
+	token.Scopes = strings.Split(scopes, ",")
+	return &token, nil
+}
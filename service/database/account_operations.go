@@ -0,0 +1,430 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// === ACCOUNT OPERATIONS ===
+
+// DeletedUserID is the identifier of the placeholder account that anonymised messages are attributed to. Its
+// username ("[deleted]") does not pass the API username validation, so nobody can log in as this user.
+const DeletedUserID = "deleted-user"
+
+// DeletionPolicy decides what happens to the messages of a deleted account
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete removes the messages (and their photos) of the deleted account
+	DeletionPolicyDelete DeletionPolicy = "delete"
+
+	// DeletionPolicyAnonymize keeps the messages, attributing them to the DeletedUserID placeholder
+	DeletionPolicyAnonymize DeletionPolicy = "anonymize"
+)
+
+// GetUserReactions retrieves all reactions left by a user, oldest first
+func (db *appdbimpl) GetUserReactions(userID string) ([]MessageReaction, error) {
+	query := `
+		SELECT mr.id, mr.message_id, mr.user_id, u.username, mr.emoticon, mr.created_at
+		FROM message_reactions mr
+		JOIN users u ON mr.user_id = u.id
+		WHERE mr.user_id = ?
+		ORDER BY mr.created_at ASC
+	`
+	rows, err := db.c.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []MessageReaction
+	for rows.Next() {
+		var reaction MessageReaction
+		err := rows.Scan(
+			&reaction.ID,
+			&reaction.MessageID,
+			&reaction.UserID,
+			&reaction.Username,
+			&reaction.Emoticon,
+			&reaction.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reaction: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over reactions: %w", err)
+	}
+
+	return reactions, nil
+}
+
+// GetUserGroups retrieves the groups a user is a member of, in joining order
+func (db *appdbimpl) GetUserGroups(userID string) ([]GroupMembership, error) {
+	query := `
+		SELECT c.id, c.name, c.created_by, cp.joined_at
+		FROM conversations c
+		JOIN conversation_participants cp ON c.id = cp.conversation_id
+		WHERE cp.user_id = ? AND c.type = 'group'
+		ORDER BY cp.joined_at ASC
+	`
+	rows, err := db.c.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []GroupMembership
+	for rows.Next() {
+		var group GroupMembership
+		var name, createdBy *string
+		if err := rows.Scan(&group.GroupID, &name, &createdBy, &group.JoinedAt); err != nil {
+			return nil, fmt.Errorf("error scanning group membership: %w", err)
+		}
+		if name != nil {
+			group.Name = *name
+		}
+		group.IsOwner = createdBy != nil && *createdBy == userID
+		groups = append(groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over group memberships: %w", err)
+	}
+
+	return groups, nil
+}
+
+// DeleteUser deletes a user account. All sessions, reactions, mentions, drafts, scheduled messages, webhooks,
+// idempotency keys and two-factor settings of the user are removed, and their messages are either deleted or
+// anonymised according to policy. The user leaves every conversation: group ownership is handed off to the
+// longest-standing remaining member, and conversations left without participants are deleted.
+// The returned DeletedAccount lists the uploaded files that are no longer referenced and can be removed.
+func (db *appdbimpl) DeleteUser(userID string, policy DeletionPolicy) (*DeletedAccount, error) {
+	if policy != DeletionPolicyDelete && policy != DeletionPolicyAnonymize {
+		return nil, fmt.Errorf("unknown deletion policy %q", policy)
+	}
+	if userID == DeletedUserID {
+		return nil, fmt.Errorf("cannot delete the placeholder account")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	deleted := &DeletedAccount{UserID: userID}
+
+	// 1. The profile photo is always removed
+	var photoURL *string
+	err = tx.QueryRow(`SELECT photo_url FROM users WHERE id = ?`, userID).Scan(&photoURL)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	if photoURL != nil {
+		deleted.MediaURLs = append(deleted.MediaURLs, *photoURL)
+	}
+
+	// 2. Revoke all sessions and remove reactions, mentions, poll votes and stars
+	result, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting user sessions: %w", err)
+	}
+	if deleted.SessionsRevoked, err = result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	err = recordChanges(tx, ChangeMessage, `
+		SELECT conversation_id, id AS entity_id FROM messages
+		WHERE id IN (SELECT message_id FROM message_reactions WHERE user_id = ?
+			UNION SELECT message_id FROM message_mentions WHERE user_id = ?
+			UNION SELECT message_id FROM poll_votes WHERE user_id = ?)`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_reactions WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user reactions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM message_mentions WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user mentions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM poll_votes WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user poll votes: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM starred_messages WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user stars: %w", err)
+	}
+
+	// Pending messages will never be sent
+	urls, err := queryStrings(tx, `
+		SELECT photo_url FROM scheduled_messages WHERE sender_id = ? AND photo_url IS NOT NULL
+		UNION
+		SELECT photo_url FROM scheduled_message_photos
+			WHERE scheduled_message_id IN (SELECT id FROM scheduled_messages WHERE sender_id = ?)`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving scheduled message photos: %w", err)
+	}
+	deleted.MediaURLs = append(deleted.MediaURLs, urls...)
+	if _, err := tx.Exec(`
+		DELETE FROM scheduled_message_photos
+		WHERE scheduled_message_id IN (SELECT id FROM scheduled_messages WHERE sender_id = ?)`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting scheduled albums: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM scheduled_messages WHERE sender_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting scheduled messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM drafts WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting drafts: %w", err)
+	}
+	if err := deleteWebhooksWhere(tx, `owner_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting idempotency keys: %w", err)
+	}
+	for _, table := range []string{"two_factor", "recovery_codes", "login_challenges", "oidc_identities", "access_tokens"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return nil, fmt.Errorf("error deleting %s: %w", table, err)
+		}
+	}
+
+	// 3. Apply the policy to the messages sent by the user
+	switch policy {
+	case DeletionPolicyDelete:
+		urls, err := queryStrings(tx, `
+			SELECT photo_url FROM messages WHERE sender_id = ? AND photo_url IS NOT NULL
+			UNION
+			SELECT photo_url FROM message_photos WHERE message_id IN (SELECT id FROM messages WHERE sender_id = ?)`,
+			userID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving message photos: %w", err)
+		}
+		deleted.MediaURLs = append(deleted.MediaURLs, urls...)
+
+		if deleted.MessagesDeleted, err = deleteMessagesWhere(tx, `sender_id = ?`, userID); err != nil {
+			return nil, err
+		}
+	case DeletionPolicyAnonymize:
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO users (id, username, photo_url, created_at)
+			VALUES (?, '[deleted]', NULL, ?)`, DeletedUserID, time.Now().UTC())
+		if err != nil {
+			return nil, fmt.Errorf("error creating placeholder account: %w", err)
+		}
+		err = recordChanges(tx, ChangeMessage, `SELECT conversation_id, id AS entity_id FROM messages WHERE sender_id = ?`, userID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.Exec(`UPDATE messages SET sender_id = ? WHERE sender_id = ?`, DeletedUserID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error anonymising messages: %w", err)
+		}
+		if deleted.MessagesAnonymized, err = result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("error checking anonymisation outcome: %w", err)
+		}
+	}
+
+	// 4. Leave every conversation
+	conversationIDs, err := queryStrings(tx, `SELECT conversation_id FROM conversation_participants WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user conversations: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM conversation_participants WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user memberships: %w", err)
+	}
+	for _, conversationID := range conversationIDs {
+		if err := recordChange(tx, conversationID, ChangeMemberLeft, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, conversationID := range conversationIDs {
+		var remaining int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?`, conversationID).Scan(&remaining)
+		if err != nil {
+			return nil, fmt.Errorf("error counting remaining participants: %w", err)
+		}
+
+		// Nobody is left to read this conversation: drop it with its content
+		if remaining == 0 {
+			urls, err := queryStrings(tx, `
+				SELECT photo_url FROM messages WHERE conversation_id = ? AND photo_url IS NOT NULL
+				UNION
+				SELECT photo_url FROM message_photos WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)
+				UNION
+				SELECT photo_url FROM conversations WHERE id = ? AND photo_url IS NOT NULL
+				UNION
+				SELECT photo_url FROM scheduled_messages WHERE conversation_id = ? AND photo_url IS NOT NULL
+				UNION
+				SELECT photo_url FROM scheduled_message_photos
+					WHERE scheduled_message_id IN (SELECT id FROM scheduled_messages WHERE conversation_id = ?)`,
+				conversationID, conversationID, conversationID, conversationID, conversationID)
+			if err != nil {
+				return nil, fmt.Errorf("error retrieving conversation media: %w", err)
+			}
+			deleted.MediaURLs = append(deleted.MediaURLs, urls...)
+
+			if _, err := deleteMessagesWhere(tx, `conversation_id = ?`, conversationID); err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(`
+				DELETE FROM scheduled_message_photos
+				WHERE scheduled_message_id IN (SELECT id FROM scheduled_messages WHERE conversation_id = ?)`, conversationID); err != nil {
+				return nil, fmt.Errorf("error deleting scheduled albums: %w", err)
+			}
+			if _, err := tx.Exec(`DELETE FROM scheduled_messages WHERE conversation_id = ?`, conversationID); err != nil {
+				return nil, fmt.Errorf("error deleting scheduled messages: %w", err)
+			}
+			if _, err := tx.Exec(`DELETE FROM drafts WHERE conversation_id = ?`, conversationID); err != nil {
+				return nil, fmt.Errorf("error deleting drafts: %w", err)
+			}
+			if err := deleteWebhooksWhere(tx, `conversation_id = ?`, conversationID); err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(`DELETE FROM conversations WHERE id = ?`, conversationID); err != nil {
+				return nil, fmt.Errorf("error deleting conversation: %w", err)
+			}
+			deleted.ConversationsDeleted++
+			continue
+		}
+
+		// Hand off the ownership of groups created by the user
+		result, err := tx.Exec(`
+			UPDATE conversations
+			SET created_by = (
+				SELECT user_id FROM conversation_participants
+				WHERE conversation_id = ?
+				ORDER BY joined_at ASC, user_id ASC
+				LIMIT 1
+			)
+			WHERE id = ? AND type = 'group' AND created_by = ?`, conversationID, conversationID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error handing off group ownership: %w", err)
+		}
+		handedOff, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error checking ownership hand-off: %w", err)
+		}
+		deleted.GroupsHandedOff += int(handedOff)
+		if handedOff > 0 {
+			if err := recordChange(tx, conversationID, ChangeConversation, conversationID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 5. Finally delete the user
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// DeleteUserAndBots deletes the bots owned by a user, which cannot outlive their owner, and then the user, as
+// DeleteUser does. The bots are listed in the returned DeletedAccount, and their files are added to its MediaURLs.
+func (db *appdbimpl) DeleteUserAndBots(userID string, policy DeletionPolicy) (*DeletedAccount, error) {
+	// 1. Delete the bots of the user
+	bots, err := db.GetUserBots(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user bots: %w", err)
+	}
+	var deletedBots []DeletedAccount
+	var mediaURLs []string
+	for _, bot := range bots {
+		deletedBot, err := db.DeleteUser(bot.ID, policy)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting bot %s: %w", bot.ID, err)
+		}
+		deletedBots = append(deletedBots, *deletedBot)
+		mediaURLs = append(mediaURLs, deletedBot.MediaURLs...)
+	}
+
+	// 2. Delete the user
+	deleted, err := db.DeleteUser(userID, policy)
+	if err != nil {
+		return nil, err
+	}
+	deleted.BotsDeleted = deletedBots
+	deleted.MediaURLs = append(deleted.MediaURLs, mediaURLs...)
+
+	return deleted, nil
+}
+
+// deleteMessagesWhere deletes the messages matching a single-parameter condition, with their reactions, polls and
+// stars, detaches replies pointing to them and records the deletions in the change log. It returns the number of
+// deleted messages.
+func deleteMessagesWhere(tx *sql.Tx, condition string, arg interface{}) (int64, error) {
+	selected := `SELECT id FROM messages WHERE ` + condition
+
+	// Syncing clients learn about the deletion from the change log
+	if err := recordChanges(tx, ChangeMessageDeleted, `SELECT conversation_id, id AS entity_id FROM messages WHERE `+condition, arg); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_reactions WHERE message_id IN (`+selected+`)`, arg); err != nil {
+		return 0, fmt.Errorf("error deleting message reactions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM message_mentions WHERE message_id IN (`+selected+`)`, arg); err != nil {
+		return 0, fmt.Errorf("error deleting message mentions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM message_photos WHERE message_id IN (`+selected+`)`, arg); err != nil {
+		return 0, fmt.Errorf("error deleting album photos: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM starred_messages WHERE message_id IN (`+selected+`)`, arg); err != nil {
+		return 0, fmt.Errorf("error deleting message stars: %w", err)
+	}
+	for _, table := range []string{"poll_votes", "poll_options", "polls"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE message_id IN (`+selected+`)`, arg); err != nil {
+			return 0, fmt.Errorf("error deleting polls: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE messages SET reply_to_id = NULL WHERE reply_to_id IN (`+selected+`)`, arg); err != nil {
+		return 0, fmt.Errorf("error detaching replies: %w", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM messages WHERE `+condition, arg)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting messages: %w", err)
+	}
+	deletedRows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deletedRows, nil
+}
+
+// queryStrings runs a query returning a single text column and collects the values
+func queryStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
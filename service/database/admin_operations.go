@@ -0,0 +1,257 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// === ADMINISTRATION OPERATIONS ===
+//
+// These operations are used by operator tools (cmd/wasactl) and are not exposed through the HTTP API.
+
+// ListUsers retrieves users ordered by username, with pagination
+func (db *appdbimpl) ListUsers(limit, offset int) ([]User, error) {
+	query := `
+		SELECT id, username, photo_url, created_at, is_bot
+		FROM users
+		ORDER BY username
+		LIMIT ? OFFSET ?
+	`
+	rows, err := db.c.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning users: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetUserSessions retrieves all sessions of a user, newest first
+func (db *appdbimpl) GetUserSessions(userID string) ([]UserSession, error) {
+	query := `
+		SELECT token_hash, user_id, created_at
+		FROM user_sessions
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+	rows, err := db.c.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+	for rows.Next() {
+		var session UserSession
+		if err := rows.Scan(&session.TokenHash, &session.UserID, &session.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSessions deletes all sessions of a user and returns how many were revoked
+func (db *appdbimpl) DeleteUserSessions(userID string) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting user sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// DeleteUserSessionByHash deletes the session whose token hash is hashPrefix or starts with it. The prefix must match
+// exactly one session: operators only see the first characters of the hash.
+func (db *appdbimpl) DeleteUserSessionByHash(hashPrefix string) error {
+	hashPrefix = strings.ToLower(hashPrefix)
+	if hashPrefix == "" || strings.Trim(hashPrefix, "0123456789abcdef") != "" {
+		return fmt.Errorf("invalid token hash %q", hashPrefix)
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Find the sessions matching the prefix
+	rows, err := tx.Query(`SELECT token_hash FROM user_sessions WHERE substr(token_hash, 1, ?) = ? LIMIT 2`,
+		len(hashPrefix), hashPrefix)
+	if err != nil {
+		return fmt.Errorf("error retrieving user sessions: %w", err)
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning session: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("error iterating over sessions: %w", err)
+	}
+	rows.Close()
+
+	// 2. The prefix must identify a single session
+	switch len(hashes) {
+	case 0:
+		return fmt.Errorf("session not found or already deleted")
+	case 1:
+	default:
+		return fmt.Errorf("token hash prefix %q matches more than one session", hashPrefix)
+	}
+
+	// 3. Delete it
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE token_hash = ?`, hashes[0]); err != nil {
+		return fmt.Errorf("error deleting user session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// UpdateGroupOwner transfers the ownership (created_by) of a group to one of its members
+func (db *appdbimpl) UpdateGroupOwner(groupID, userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	var conversationType string
+	err = tx.QueryRow(`SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
+	if err != nil {
+		if isNotFoundError(err) {
+			return fmt.Errorf("group not found")
+		}
+		return fmt.Errorf("error checking group existence: %w", err)
+	}
+
+	if conversationType != ConversationTypeGroup {
+		return fmt.Errorf("conversation is not a group")
+	}
+
+	isMember, err := db.IsUserInConversation(groupID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking user membership: %w", err)
+	}
+	if !isMember {
+		return fmt.Errorf("user is not a member of this group")
+	}
+
+	_, err = tx.Exec(`UPDATE conversations SET created_by = ? WHERE id = ?`, userID, groupID)
+	if err != nil {
+		return fmt.Errorf("error updating group owner: %w", err)
+	}
+
+	if err := recordChange(tx, groupID, ChangeConversation, groupID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetDatabaseStats collects row counts, the largest conversations (by number of messages) and media references
+func (db *appdbimpl) GetDatabaseStats(topConversations int) (*DatabaseStats, error) {
+	stats := &DatabaseStats{
+		TableCounts: make(map[string]int64),
+		CollectedAt: time.Now().UTC(),
+	}
+
+	// Table names cannot be bound as parameters, so they come from this fixed list only
+	tables := []string{
+		"users", "user_sessions", "conversations", "conversation_participants", "messages", "message_reactions",
+		"message_mentions", "scheduled_messages", "drafts", "link_previews", "webhooks", "webhook_deliveries",
+		"idempotency_keys", "two_factor", "recovery_codes", "login_challenges", "oidc_logins", "oidc_identities",
+		"access_tokens", "attachments", "message_photos", "polls", "poll_options", "poll_votes", "starred_messages",
+		"scheduled_message_photos",
+	}
+	for _, table := range tables {
+		var count int64
+		if err := db.c.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("error counting %s: %w", table, err)
+		}
+		stats.TableCounts[table] = count
+	}
+
+	rows, err := db.c.Query(`
+		SELECT c.id, c.type, c.name,
+			(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id) AS message_count,
+			(SELECT COUNT(*) FROM conversation_participants cp WHERE cp.conversation_id = c.id) AS participant_count
+		FROM conversations c
+		ORDER BY message_count DESC, c.created_at ASC
+		LIMIT ?`, topConversations)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving largest conversations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conv ConversationStats
+		if err := rows.Scan(&conv.ID, &conv.Type, &conv.Name, &conv.MessageCount, &conv.ParticipantCount); err != nil {
+			return nil, fmt.Errorf("error scanning conversation stats: %w", err)
+		}
+		stats.LargestConversations = append(stats.LargestConversations, conv)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over conversation stats: %w", err)
+	}
+
+	err = db.c.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE photo_url IS NOT NULL),
+			(SELECT COUNT(*) FROM conversations WHERE photo_url IS NOT NULL AND type = 'group'),
+			(SELECT COUNT(*) FROM (
+				SELECT photo_url FROM messages WHERE photo_url IS NOT NULL
+				UNION
+				SELECT photo_url FROM message_photos)),
+			(SELECT COUNT(*) FROM attachments),
+			(SELECT COALESCE(SUM(size), 0) FROM attachments)`).Scan(
+		&stats.Media.ProfilePhotos,
+		&stats.Media.GroupPhotos,
+		&stats.Media.MessagePhotos,
+		&stats.Media.Attachments,
+		&stats.Media.AttachmentBytes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error counting media references: %w", err)
+	}
+
+	return stats, nil
+}
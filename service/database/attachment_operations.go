@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gofrs/uuid"
+)
+
+// === ATTACHMENT OPERATIONS ===
+
+// unreferencedAttachments is a condition on the attachments table selecting the attachments of no message
+const unreferencedAttachments = `NOT EXISTS (SELECT 1 FROM messages m WHERE m.attachment_id = attachments.id)`
+
+// insertAttachment stores the metadata of an attachment within the transaction creating its message, so that
+// attachments never exist without a message. It returns the new attachment ID.
+func insertAttachment(tx *sql.Tx, attachment Attachment) (string, error) {
+	if attachment.Filename == "" || attachment.MimeType == "" || attachment.StorageKey == "" {
+		return "", fmt.Errorf("attachment must have a filename, a MIME type and a storage key")
+	}
+	if attachment.Size <= 0 {
+		return "", fmt.Errorf("attachment must not be empty")
+	}
+
+	attachmentID := uuid.Must(uuid.NewV4()).String()
+	_, err := tx.Exec(`
+		INSERT INTO attachments (id, filename, mime_type, size, storage_key, created_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		attachmentID, attachment.Filename, attachment.MimeType, attachment.Size, attachment.StorageKey)
+	if err != nil {
+		return "", fmt.Errorf("error creating attachment: %w", err)
+	}
+	return attachmentID, nil
+}
+
+// DeleteUnreferencedAttachments deletes the attachments left without messages, once the message and all its
+// forwarded copies are deleted or expired. It returns the storage keys of the deleted attachments, whose files can
+// then be removed.
+func (db *appdbimpl) DeleteUnreferencedAttachments() ([]string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	keys, err := queryStrings(tx, `SELECT storage_key FROM attachments WHERE `+unreferencedAttachments)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving unreferenced attachments: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM attachments WHERE ` + unreferencedAttachments); err != nil {
+		return nil, fmt.Errorf("error deleting unreferenced attachments: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return keys, nil
+}
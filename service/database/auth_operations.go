@@ -1,7 +1,10 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -11,17 +14,26 @@ import (
 
 // CreateUser creates a new user with the given username
 func (db *appdbimpl) CreateUser(username string) (*User, error) {
+	return db.createUser(username, nil)
+}
+
+// CreateSecuredUser creates a new user with the given username, secured by a password (see SetUserPassword)
+func (db *appdbimpl) CreateSecuredUser(username, passwordHash string) (*User, error) {
+	return db.createUser(username, &passwordHash)
+}
+
+func (db *appdbimpl) createUser(username string, passwordHash *string) (*User, error) {
 	// 1. Generate unique user ID
 	// Username validation is done in the API layer, so we assume it's valid here
 	userID := uuid.Must(uuid.NewV4()).String()
 
 	// 2. Insert user into database
 	query := `
-		INSERT INTO users (id, username, photo_url, created_at)
-		VALUES (?, ?, NULL, ?)
+		INSERT INTO users (id, username, photo_url, created_at, password_hash)
+		VALUES (?, ?, NULL, ?, ?)
 	`
 	createdAt := time.Now().UTC()
-	_, err := db.c.Exec(query, userID, username, createdAt)
+	_, err := db.c.Exec(query, userID, username, createdAt, passwordHash)
 	if err != nil {
 		return nil, fmt.Errorf("error creating user: %w", err)
 	}
@@ -34,7 +46,7 @@ func (db *appdbimpl) CreateUser(username string) (*User, error) {
 func (db *appdbimpl) GetUserByID(id string) (*User, error) {
 	// 1. Query user from database by ID
 	query := `
-		SELECT id, username, photo_url, created_at
+		SELECT id, username, photo_url, created_at, is_bot
 		FROM users
 		WHERE id = ?
 	`
@@ -56,7 +68,7 @@ func (db *appdbimpl) GetUserByID(id string) (*User, error) {
 func (db *appdbimpl) GetUserByUsername(username string) (*User, error) {
 	// 1. Query user from database by username
 	query := `
-		SELECT id, username, photo_url, created_at
+		SELECT id, username, photo_url, created_at, is_bot
 		FROM users
 		WHERE username = ?
 	`
@@ -75,18 +87,19 @@ func (db *appdbimpl) GetUserByUsername(username string) (*User, error) {
 }
 
 // GetUserByToken retrieves a user by their session token.
-// This query returns user details (id, username, photo_url, created_at)
-// for all users who have active sessions in the user_sessions table.
+// This query returns user details (id, username, photo_url, created_at, is_bot)
+// for all users who have active sessions in the user_sessions table, which stores
+// tokens by their hash only.
 func (db *appdbimpl) GetUserByToken(token string) (*User, error) {
 	// 1. Join user_sessions with users table
 	query := `		
-		SELECT u.id, u.username, u.photo_url, u.created_at
+		SELECT u.id, u.username, u.photo_url, u.created_at, u.is_bot
 		FROM user_sessions us
 		JOIN users u ON us.user_id = u.id
-		WHERE us.token = ? 
+		WHERE us.token_hash = ? 
 	`
-	// 2. Query by token
-	row := db.c.QueryRow(query, token)
+	// 2. Query by token hash
+	row := db.c.QueryRow(query, hashToken(token))
 	user, err := scanUser(row)
 
 	// 3. Handle token not found or expired case
@@ -105,14 +118,14 @@ func (db *appdbimpl) CreateUserSession(userID string) (string, error) {
 	// 1. Generate unique session token
 	token := uuid.Must(uuid.NewV4()).String()
 
-	// 2. Insert session into database
+	// 2. Insert session into database, storing the hash of the token
 	query := `		
-		INSERT INTO user_sessions (token, user_id, created_at)
+		INSERT INTO user_sessions (token_hash, user_id, created_at)
 		VALUES (?, ?, ?)
 	`
 	// 3. Return token or error
 	createdAt := time.Now().UTC()
-	_, err := db.c.Exec(query, token, userID, createdAt)
+	_, err := db.c.Exec(query, hashToken(token), userID, createdAt)
 	if err != nil {
 		return "", fmt.Errorf("error creating user session: %w", err)
 	}
@@ -127,9 +140,9 @@ func (db *appdbimpl) DeleteUserSession(token string) error {
 	// 1. Delete session from database by token
 	query := `		
 		DELETE FROM user_sessions
-		WHERE token = ?
+		WHERE token_hash = ?
 	`
-	result, err := db.c.Exec(query, token)
+	result, err := db.c.Exec(query, hashToken(token))
 	if err != nil {
 		return fmt.Errorf("error deleting user session: %w", err)
 	}
@@ -146,3 +159,54 @@ func (db *appdbimpl) DeleteUserSession(token string) error {
 	// 3. Return nil if deletion was successful
 	return nil
 }
+
+// GetUserPasswordHash returns the password hash of a user, or an empty string if the account is not secured by a
+// password (legacy accounts, which anyone can log in to by name until they are claimed)
+func (db *appdbimpl) GetUserPasswordHash(userID string) (string, error) {
+	var passwordHash sql.NullString
+	err := db.c.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&passwordHash)
+	if err != nil {
+		if isNotFoundError(err) {
+			return "", fmt.Errorf("user not found")
+		}
+		return "", fmt.Errorf("error retrieving password: %w", err)
+	}
+	return passwordHash.String, nil
+}
+
+// SetUserPassword secures an account with a password, or changes it, revoking every session except keepToken: whoever
+// logged in to the account by name before it was claimed, or with the old password, is logged out
+func (db *appdbimpl) SetUserPassword(userID, passwordHash, keepToken string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Update the password
+	result, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ? AND NOT is_bot`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking update outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	// 2. Revoke the other sessions
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = ? AND token_hash != ?`, userID, hashToken(keepToken)); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === BOT OPERATIONS ===
+
+// botTokenPrefix marks bot tokens, so that they can be told apart from login sessions
+const botTokenPrefix = "bot_"
+
+// CreateBot creates a bot account owned by a user, returning it with its token. Bots cannot own other bots.
+func (db *appdbimpl) CreateBot(ownerID, username string) (*User, string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Check the owner
+	var ownerIsBot bool
+	if err := tx.QueryRow(`SELECT is_bot FROM users WHERE id = ?`, ownerID).Scan(&ownerIsBot); err != nil {
+		if isNotFoundError(err) {
+			return nil, "", fmt.Errorf("user not found")
+		}
+		return nil, "", fmt.Errorf("error retrieving bot owner: %w", err)
+	}
+	if ownerIsBot {
+		return nil, "", fmt.Errorf("bots cannot create bots")
+	}
+
+	// 2. Create the account
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username = ?)`, username).Scan(&taken); err != nil {
+		return nil, "", fmt.Errorf("error checking username: %w", err)
+	}
+	if taken {
+		return nil, "", fmt.Errorf("username already taken")
+	}
+	botID := uuid.Must(uuid.NewV4()).String()
+	_, err = tx.Exec(`
+		INSERT INTO users (id, username, photo_url, created_at, is_bot, bot_owner_id)
+		VALUES (?, ?, NULL, ?, TRUE, ?)`, botID, username, time.Now().UTC(), ownerID)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating bot: %w", err)
+	}
+
+	// 3. Issue its token
+	token, err := insertBotToken(tx, botID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	bot, err := db.GetUserByID(botID)
+	if err != nil {
+		return nil, "", err
+	}
+	return bot, token, nil
+}
+
+// GetUserBots retrieves the bots owned by a user, ordered by username
+func (db *appdbimpl) GetUserBots(ownerID string) ([]User, error) {
+	query := `
+		SELECT id, username, photo_url, created_at, is_bot
+		FROM users
+		WHERE bot_owner_id = ? AND is_bot
+		ORDER BY username
+	`
+	rows, err := db.c.Query(query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying bots: %w", err)
+	}
+
+	bots, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning bots: %w", err)
+	}
+	return bots, nil
+}
+
+// GetBot retrieves a bot owned by a user. Bots owned by other users are not found.
+func (db *appdbimpl) GetBot(botID, ownerID string) (*User, error) {
+	query := `
+		SELECT id, username, photo_url, created_at, is_bot
+		FROM users
+		WHERE id = ? AND bot_owner_id = ? AND is_bot
+	`
+	bot, err := scanUser(db.c.QueryRow(query, botID, ownerID))
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("bot not found")
+		}
+		return nil, fmt.Errorf("error retrieving bot: %w", err)
+	}
+	return bot, nil
+}
+
+// RegenerateBotToken revokes the tokens of a bot owned by a user and issues a new one
+func (db *appdbimpl) RegenerateBotToken(botID, ownerID string) (string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND bot_owner_id = ? AND is_bot)`, botID, ownerID).Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving bot: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("bot not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, botID); err != nil {
+		return "", fmt.Errorf("error revoking bot tokens: %w", err)
+	}
+	token, err := insertBotToken(tx, botID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	return token, nil
+}
+
+// insertBotToken issues a new token for a bot. Bot tokens are sessions that are never created by doLogin, so they
+// last until they are regenerated or the bot is deleted.
+func insertBotToken(tx *sql.Tx, botID string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating bot token: %w", err)
+	}
+	token := botTokenPrefix + hex.EncodeToString(secret)
+
+	_, err := tx.Exec(`INSERT INTO user_sessions (token_hash, user_id, created_at) VALUES (?, ?, ?)`, hashToken(token), botID, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("error creating bot token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// === CHANGE LOG OPERATIONS ===
+
+// Kinds of changes recorded in the change log
+const (
+	ChangeConversation   = "conversation"    // Conversation created or updated; the entity is the conversation
+	ChangeMessage        = "message"         // Message created or updated (e.g., reactions); the entity is the message
+	ChangeMessageDeleted = "message.deleted" // Message deleted or expired; the entity is the message
+	ChangeMemberJoined   = "member.joined"   // Participant added to the conversation; the entity is the user
+	ChangeMemberLeft     = "member.left"     // Participant left or was removed; the entity is the user
+)
+
+// recordChange appends a change to the change log. It must run in the transaction that makes the change, so that
+// sequence numbers follow the order in which changes are committed.
+func recordChange(ex execer, conversationID, kind, entityID string) error {
+	_, err := ex.Exec(`
+		INSERT INTO change_log (conversation_id, kind, entity_id, created_at)
+		VALUES (?, ?, ?, ?)`, conversationID, kind, entityID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error recording change: %w", err)
+	}
+	return nil
+}
+
+// recordChanges appends a change to the change log for every row of a query returning the conversation and the
+// entity, e.g. for the messages deleted by a single statement
+func recordChanges(ex execer, kind, selected string, args ...interface{}) error {
+	args = append([]interface{}{kind, time.Now().UTC()}, args...)
+	_, err := ex.Exec(`
+		INSERT INTO change_log (conversation_id, kind, entity_id, created_at)
+		SELECT c.conversation_id, ?, c.entity_id, ? FROM (`+selected+`) c`, args...)
+	if err != nil {
+		return fmt.Errorf("error recording changes: %w", err)
+	}
+	return nil
+}
+
+// GetChangeCursor returns the sequence number of the latest change, where a client starts syncing after a full load
+func (db *appdbimpl) GetChangeCursor() (int64, error) {
+	var seq int64
+	err := db.c.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM sqlite_sequence WHERE name = 'change_log'`).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving change cursor: %w", err)
+	}
+	return seq, nil
+}
+
+// GetChanges returns up to limit changes visible to a user after the since cursor, in the order they were made: the
+// changes of the conversations the user participates in, and the user leaving conversations. Cursors older than the
+// oldest change kept in the log are expired, since some changes may have been pruned.
+func (db *appdbimpl) GetChanges(userID string, since int64, limit int) (*ChangeSet, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Check the cursor against the changes kept in the log
+	var latest, oldest int64
+	err = tx.QueryRow(`
+		SELECT
+			(SELECT COALESCE(MAX(seq), 0) FROM sqlite_sequence WHERE name = 'change_log'),
+			(SELECT COALESCE(MIN(seq), 0) FROM change_log)`).Scan(&latest, &oldest)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving change log bounds: %w", err)
+	}
+	if since > latest || since < 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	// An empty log has been pruned entirely: only the latest cursor is still valid
+	if (oldest == 0 && since < latest) || (oldest > 0 && since < oldest-1) {
+		return nil, fmt.Errorf("cursor expired")
+	}
+
+	// 2. Select the changes visible to the user, one more than requested to know if there are others
+	rows, err := tx.Query(`
+		SELECT seq, conversation_id, kind, entity_id, created_at
+		FROM change_log
+		WHERE seq > ?
+		AND (conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)
+			OR (kind = ? AND entity_id = ?))
+		ORDER BY seq ASC
+		LIMIT ?`, since, userID, ChangeMemberLeft, userID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving changes: %w", err)
+	}
+	defer rows.Close()
+
+	set := &ChangeSet{Cursor: latest}
+	for rows.Next() {
+		var change Change
+		if err := rows.Scan(&change.Seq, &change.ConversationID, &change.Kind, &change.EntityID, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning change: %w", err)
+		}
+		set.Changes = append(set.Changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating changes: %w", err)
+	}
+
+	// 3. With more changes pending, the cursor stops at the last returned one
+	if len(set.Changes) > limit {
+		set.Changes = set.Changes[:limit]
+		set.Cursor = set.Changes[limit-1].Seq
+		set.HasMore = true
+	}
+
+	return set, nil
+}
+
+// DeleteChangesBefore deletes the changes recorded before the given time, returning how many were deleted. Clients
+// whose cursor precedes the remaining changes have to load everything again.
+func (db *appdbimpl) DeleteChangesBefore(before time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM change_log WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting old changes: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deleted, nil
+}
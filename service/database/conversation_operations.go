@@ -13,9 +13,11 @@ import (
 func (db *appdbimpl) GetUserConversations(userID string) ([]ConversationPreview, error) {
 	// 1. Get all conversations where the user is a participant
 	query := `
-		SELECT c.id, c.type, c.name, c.photo_url, c.last_message_at
+		SELECT c.id, c.type, c.name, c.photo_url, c.last_message_at, c.message_ttl,
+			   d.content, d.reply_to_id, d.updated_at
 		FROM conversations c
 		JOIN conversation_participants cp ON c.id = cp.conversation_id
+		LEFT JOIN drafts d ON d.conversation_id = c.id AND d.user_id = cp.user_id
 		WHERE cp.user_id = ?
 		ORDER BY c.last_message_at DESC
 	`
@@ -28,20 +30,41 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]ConversationPreview,
 	// Prepare result array
 	var conversations []ConversationPreview
 
+	// Expired messages are hidden even before they are deleted
+	now := time.Now().UTC()
+
 	// Process each conversation
 	for rows.Next() {
 		var conv ConversationPreview
+		var draftContent, draftReplyToID *string
+		var draftUpdatedAt *time.Time
 		err := rows.Scan(
 			&conv.ID,
 			&conv.Type,
 			&conv.Name,
 			&conv.PhotoURL,
 			&conv.LastMessageAt,
+			&conv.MessageTTL,
+			&draftContent,
+			&draftReplyToID,
+			&draftUpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning conversation: %w", err)
 		}
 
+		// Attach the draft of the user, if any
+		if draftContent != nil {
+			conv.Draft = &Draft{
+				ConversationID: conv.ID,
+				Content:        *draftContent,
+				ReplyToID:      draftReplyToID,
+			}
+			if draftUpdatedAt != nil {
+				conv.Draft.UpdatedAt = *draftUpdatedAt
+			}
+		}
+
 		// For direct conversations, get the other participant's info
 		if conv.Type == "direct" {
 			otherUserQuery := `
@@ -90,43 +113,60 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]ConversationPreview,
 
 		// Get last message for the conversation
 		lastMessageQuery := `
-			SELECT m.id, m.content, m.photo_url, m.created_at, u.username
+			SELECT m.id, m.content, m.photo_url, att.filename, m.created_at, u.username,
+				(SELECT COUNT(*) FROM message_photos mp WHERE mp.message_id = m.id), p.question
 			FROM messages m
 			JOIN users u ON m.sender_id = u.id
-			WHERE m.conversation_id = ?
+			LEFT JOIN attachments att ON att.id = m.attachment_id
+			LEFT JOIN polls p ON p.message_id = m.id
+			WHERE m.conversation_id = ? AND ` + notExpired + `
 			ORDER BY m.created_at DESC
 			LIMIT 1
 		`
 		var msgID string
 		var content *string
 		var photoURL *string
+		var attachmentName *string
 		var timestamp time.Time
 		var senderUsername string
+		var albumSize int
+		var pollQuestion *string
 
-		err = db.c.QueryRow(lastMessageQuery, conv.ID).Scan(
+		err = db.c.QueryRow(lastMessageQuery, conv.ID, now).Scan(
 			&msgID,
 			&content,
 			&photoURL,
+			&attachmentName,
 			&timestamp,
 			&senderUsername,
+			&albumSize,
+			&pollQuestion,
 		)
 
 		// If we found a message, add it to the conversation
 		if err == nil {
 			hasPhoto := photoURL != nil
+			if albumSize > 1 {
+				content = albumSummary(albumSize, content)
+			}
+			if pollQuestion != nil {
+				summary := "📊 " + *pollQuestion
+				content = &summary
+			}
 			conv.LastMessage = &MessagePreview{
 				ID:             msgID,
 				Content:        content,
 				Timestamp:      timestamp,
 				SenderUsername: senderUsername,
 				HasPhoto:       hasPhoto,
+				AttachmentName: attachmentName,
 			}
 		} else if !isNotFoundError(err) {
 			return nil, fmt.Errorf("error retrieving last message: %w", err)
 		}
 
 		// Get unread count for the conversation
-		// Count messages newer than the user's last_read_at timestamp
+		// Count messages newer than the user's last_read_at timestamp, except the announcements of the server
 		unreadQuery := `
 			SELECT COUNT(m.id)
 			FROM messages m
@@ -135,15 +175,34 @@ func (db *appdbimpl) GetUserConversations(userID string) ([]ConversationPreview,
 			AND cp.user_id = ?
 			AND m.sender_id != ?
 			AND m.created_at > cp.last_read_at
+			AND NOT m.system
+			AND ` + notExpired + `
 		`
 		var unreadCount int
-		err = db.c.QueryRow(unreadQuery, conv.ID, userID, userID).Scan(&unreadCount)
+		err = db.c.QueryRow(unreadQuery, conv.ID, userID, userID, now).Scan(&unreadCount)
 		if err != nil {
 			// If there's an error, default to 0
 			unreadCount = 0
 		}
 		conv.UnreadCount = unreadCount
 
+		// Count the unread messages mentioning the user
+		mentionsQuery := `
+			SELECT COUNT(DISTINCT m.id)
+			FROM message_mentions mm
+			JOIN messages m ON mm.message_id = m.id
+			JOIN conversation_participants cp ON m.conversation_id = cp.conversation_id AND cp.user_id = mm.user_id
+			WHERE m.conversation_id = ?
+			AND mm.user_id = ?
+			AND m.sender_id != ?
+			AND m.created_at > cp.last_read_at
+			AND ` + notExpired + `
+		`
+		err = db.c.QueryRow(mentionsQuery, conv.ID, userID, userID, now).Scan(&conv.UnreadMentions)
+		if err != nil {
+			return nil, fmt.Errorf("error counting unread mentions: %w", err)
+		}
+
 		conversations = append(conversations, conv)
 	}
 
@@ -160,7 +219,7 @@ func (db *appdbimpl) GetConversation(conversationID, userID string) (*Conversati
 
 	// 1. Get conversation details
 	query := `
-		SELECT c.id, c.type, c.name, c.photo_url, c.created_by, c.created_at, c.last_message_at
+		SELECT c.id, c.type, c.name, c.photo_url, c.created_by, c.created_at, c.last_message_at, c.message_ttl
 		FROM conversations c
 		WHERE c.id = ?
 	`
@@ -173,7 +232,7 @@ func (db *appdbimpl) GetConversation(conversationID, userID string) (*Conversati
 
 	// 2. Get all participants
 	participantsQuery := `
-		SELECT u.id, u.username, u.photo_url, u.created_at
+		SELECT u.id, u.username, u.photo_url, u.created_at, u.is_bot
 		FROM users u
 		JOIN conversation_participants cp ON u.id = cp.user_id
 		WHERE cp.conversation_id = ?
@@ -201,7 +260,7 @@ func (db *appdbimpl) GetConversation(conversationID, userID string) (*Conversati
 		}
 	}
 
-	// Calculate unread count for this conversation
+	// Calculate unread count for this conversation, except the announcements of the server
 	unreadQuery := `
 		SELECT COUNT(m.id)
 		FROM messages m
@@ -210,9 +269,11 @@ func (db *appdbimpl) GetConversation(conversationID, userID string) (*Conversati
 		AND cp.user_id = ?
 		AND m.sender_id != ?
 		AND m.created_at > cp.last_read_at
+		AND NOT m.system
+		AND ` + notExpired + `
 	`
 	var unreadCount int
-	err = db.c.QueryRow(unreadQuery, conv.ID, userID, userID).Scan(&unreadCount)
+	err = db.c.QueryRow(unreadQuery, conv.ID, userID, userID, time.Now().UTC()).Scan(&unreadCount)
 	if err != nil {
 		// If there's an error, default to 0
 		unreadCount = 0
@@ -226,7 +287,7 @@ func (db *appdbimpl) GetConversation(conversationID, userID string) (*Conversati
 func (db *appdbimpl) GetOrCreateDirectConversation(user1ID, user2ID string) (*Conversation, error) {
 	// 1. Check if direct conversation already exists between the two users
 	query := `
-		SELECT c.id, c.type, c.name, c.photo_url, c.created_by, c.created_at, c.last_message_at
+		SELECT c.id, c.type, c.name, c.photo_url, c.created_by, c.created_at, c.last_message_at, c.message_ttl
 		FROM conversations c
 		JOIN conversation_participants cp1 ON c.id = cp1.conversation_id
 		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id
@@ -290,6 +351,21 @@ func (db *appdbimpl) GetOrCreateDirectConversation(user1ID, user2ID string) (*Co
 		return nil, fmt.Errorf("error adding user2 to conversation: %w", err)
 	}
 
+	// Record the new conversation for syncing clients
+	changes := []struct{ kind, entityID string }{
+		{ChangeConversation, conversationID},
+		{ChangeMemberJoined, user1ID},
+		{ChangeMemberJoined, user2ID},
+	}
+	for _, change := range changes {
+		if err := recordChange(tx, conversationID, change.kind, change.entityID); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+			}
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -311,3 +387,77 @@ func (db *appdbimpl) IsUserInConversation(conversationID, userID string) (bool,
 
 	return count > 0, nil
 }
+
+// GetConversationsVersion returns a fingerprint of the conversation list of a user: it changes whenever the list
+// would, i.e. on new, changed or deleted messages and reactions, membership and group changes (all recorded in the
+// change log), reads, drafts, profile changes of the other participants and messages expiring. It is much cheaper to
+// compute than the list itself.
+func (db *appdbimpl) GetConversationsVersion(userID string) (string, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM conversation_participants WHERE user_id = ?) || '/' ||
+			(SELECT COALESCE(MAX(seq), 0) FROM change_log
+				WHERE conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)) || '/' ||
+			(SELECT COALESCE(MAX(last_read_at), '') FROM conversation_participants WHERE user_id = ?) || '/' ||
+			(SELECT COUNT(*) || ':' || COALESCE(MAX(updated_at), '') FROM drafts WHERE user_id = ?) || '/' ||
+			(SELECT COUNT(*) FROM messages m
+				WHERE m.expires_at <= ?
+				AND m.conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)) || '/' ||
+			(SELECT COALESCE(group_concat(profile, ','), '') FROM (
+				SELECT u.id || ':' || u.username || ':' || COALESCE(u.photo_url, '') AS profile
+				FROM users u
+				WHERE u.id IN (
+					SELECT other.user_id
+					FROM conversation_participants cp
+					JOIN conversation_participants other ON cp.conversation_id = other.conversation_id
+					WHERE cp.user_id = ? AND other.user_id != ?)
+				ORDER BY u.id))
+	`
+
+	var version string
+	now := time.Now().UTC()
+	err := db.c.QueryRow(query, userID, userID, userID, userID, now, userID, userID, userID).Scan(&version)
+	if err != nil {
+		return "", fmt.Errorf("error computing conversations version: %w", err)
+	}
+	return version, nil
+}
+
+// GetConversationVersion returns a fingerprint of a conversation as seen by one of its participants: it changes
+// whenever its messages, reactions, members, settings (all recorded in the change log), the read status of the
+// participants or their profiles change, and when messages expire.
+func (db *appdbimpl) GetConversationVersion(conversationID, userID string) (string, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ? AND user_id = ?),
+			(SELECT COALESCE(MAX(seq), 0) FROM change_log WHERE conversation_id = ?) || '/' ||
+			(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = ? AND m.expires_at <= ?) || '/' ||
+			(SELECT COALESCE(group_concat(participant, ','), '') FROM (
+				SELECT u.id || ':' || u.username || ':' || COALESCE(u.photo_url, '') || ':' || COALESCE(cp.last_read_at, '') AS participant
+				FROM conversation_participants cp
+				JOIN users u ON cp.user_id = u.id
+				WHERE cp.conversation_id = ?
+				ORDER BY u.id))
+	`
+
+	var participant int
+	var version string
+	now := time.Now().UTC()
+	err := db.c.QueryRow(query, conversationID, userID, conversationID, conversationID, now, conversationID).Scan(&participant, &version)
+	if err != nil {
+		return "", fmt.Errorf("error computing conversation version: %w", err)
+	}
+	if participant == 0 {
+		return "", fmt.Errorf("user is not a participant in this conversation")
+	}
+	return version, nil
+}
+
+// albumSummary describes an album in the conversation list, e.g. "📷 5 photos", followed by its caption if any
+func albumSummary(photos int, caption *string) *string {
+	summary := fmt.Sprintf("📷 %d photos", photos)
+	if caption != nil {
+		summary += ": " + *caption
+	}
+	return &summary
+}
@@ -31,9 +31,14 @@ Then you can initialize the AppDatabase and pass it to the api package.
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // AppDatabase is the high level interface for the DB
@@ -48,6 +53,17 @@ type AppDatabase interface {
 	GetUserByToken(token string) (*User, error)
 	CreateUserSession(userID string) (string, error)
 	DeleteUserSession(token string) error
+	CreateSecuredUser(username, passwordHash string) (*User, error)
+	GetUserPasswordHash(userID string) (string, error)
+	SetUserPassword(userID, passwordHash, keepToken string) error
+
+	// === ACCESS TOKENS ===
+	CreateAccessToken(userID, name, tokenHash string, scopes []string, expiresAt *time.Time, maxTokens int) (*AccessToken, error)
+	GetUserAccessTokens(userID string) ([]AccessToken, error)
+	GetAccessTokenByHash(tokenHash string, now time.Time) (*AccessToken, error)
+	TouchAccessToken(tokenID string, now time.Time) error
+	DeleteAccessToken(tokenID, userID string) error
+	DeleteExpiredAccessTokens(now time.Time) (int64, error)
 
 	// === USER MANAGEMENT ===
 	GetUser(userID string) (*User, error)
@@ -55,31 +71,137 @@ type AppDatabase interface {
 	UpdateUserPhoto(userID, photoURL string) error
 	SearchUsers(query string, excludeUserID string) ([]User, error)
 
+	// === BOTS ===
+	CreateBot(ownerID, username string) (*User, string, error)
+	GetUserBots(ownerID string) ([]User, error)
+	GetBot(botID, ownerID string) (*User, error)
+	RegenerateBotToken(botID, ownerID string) (string, error)
+
 	// === CONVERSATIONS ===
 	GetUserConversations(userID string) ([]ConversationPreview, error)
 	GetConversation(conversationID, userID string) (*Conversation, error)
 	GetOrCreateDirectConversation(user1ID, user2ID string) (*Conversation, error)
+	GetConversationsVersion(userID string) (string, error)
+	GetConversationVersion(conversationID, userID string) (string, error)
 
 	// === MESSAGES ===
-	CreateMessage(conversationID, senderID string, content *string, photoURL *string, replyToID *string) (*Message, error)
+	CreateMessage(conversationID, senderID string, content *string, photoURLs []string, attachment *Attachment, replyToID *string) (*Message, error)
 	GetMessage(messageID string) (*Message, error)
 	GetConversationMessages(conversationID string) ([]Message, error)
+	ForEachConversationMessage(conversationID string, fn func(Message) error) error
+	ForEachUserMessage(userID string, fn func(Message) error) error
 	DeleteMessage(messageID, userID string) error
 	ForwardMessage(messageID, targetConversationID, userID string) (*Message, error)
 	MarkConversationAsRead(conversationID, userID string) error
 
+	// === ATTACHMENTS ===
+	DeleteUnreferencedAttachments() ([]string, error)
+
+	// === POLLS ===
+	CreatePoll(conversationID, senderID string, poll Poll) (*Message, error)
+	VotePoll(messageID, userID string, options []int) (*Message, error)
+	RetractPollVote(messageID, userID string) (*Message, error)
+	ClosePoll(messageID, userID string) (*Message, error)
+
+	// === DISAPPEARING MESSAGES ===
+	SetMessageTimer(conversationID, userID string, ttl int64) (*Message, error)
+	DeleteExpiredMessages(now time.Time, limit int) (int64, []string, error)
+
+	// === MENTIONS ===
+	GetUserMentions(userID, beforeID string, limit int) ([]MentionedMessage, error)
+
+	// === STARRED MESSAGES ===
+	StarMessage(messageID, userID string) error
+	UnstarMessage(messageID, userID string) error
+	GetStarredMessages(userID, beforeID string, limit int) ([]StarredMessage, error)
+
+	// === LINK PREVIEWS ===
+	GetLinkPreview(link string) (*LinkPreview, error)
+	SaveLinkPreview(preview LinkPreview) error
+
+	// === DRAFTS ===
+	GetDraft(conversationID, userID string) (*Draft, error)
+	SaveDraft(conversationID, userID, content string, replyToID *string) (*Draft, error)
+	DeleteDraft(conversationID, userID string) error
+
+	// === WEBHOOKS ===
+	CreateWebhook(ownerID string, conversationID *string, url string, events []string) (*Webhook, error)
+	GetUserWebhooks(ownerID string) ([]Webhook, error)
+	GetWebhook(webhookID, ownerID string) (*Webhook, error)
+	DeleteWebhook(webhookID, ownerID string) error
+	EnqueueWebhookEvent(conversationID, eventType string, payload []byte) (int, error)
+	EnqueueBotCommand(conversationID, senderID, botUsername string, payload []byte) (int, error)
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt) error
+	GetWebhookDeliveries(webhookID, ownerID string, limit int) ([]WebhookDelivery, error)
+	DeleteFinishedWebhookDeliveries(before time.Time) (int64, error)
+
+	// === IDEMPOTENCY KEYS ===
+	ReserveIdempotencyKey(userID, key, requestHash string, expiredBefore, abandonedBefore time.Time) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(userID, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(userID, key string) error
+	DeleteExpiredIdempotencyKeys(before time.Time) (int64, error)
+
+	// === SYNC ===
+	GetChangeCursor() (int64, error)
+	GetChanges(userID string, since int64, limit int) (*ChangeSet, error)
+	DeleteChangesBefore(before time.Time) (int64, error)
+
+	// === TWO-FACTOR AUTHENTICATION ===
+	StartTwoFactorEnrollment(userID, secret string) error
+	GetTwoFactor(userID string) (*TwoFactor, error)
+	EnableTwoFactor(userID string, counter int64, recoveryCodeHashes []string, keepToken string) error
+	DisableTwoFactor(userID string) error
+	UseTwoFactorCounter(userID string, counter int64) (bool, error)
+	UseRecoveryCode(userID, codeHash string, now time.Time) (bool, error)
+	CreateLoginChallenge(userID string, expiresAt time.Time) (*LoginChallenge, error)
+	GetLoginChallenge(challengeID string, now time.Time) (*LoginChallenge, error)
+	FailLoginChallenge(challengeID string, maxAttempts int) error
+	CompleteLoginChallenge(challengeID string) (string, error)
+	DeleteExpiredLoginChallenges(now time.Time) (int64, error)
+
+	// === SINGLE SIGN-ON ===
+	CreateOIDCLogin(login OIDCLogin) error
+	ConsumeOIDCLogin(state string, now time.Time) (*OIDCLogin, error)
+	DeleteExpiredOIDCLogins(now time.Time) (int64, error)
+	GetUserByOIDCIdentity(issuer, subject string) (*User, error)
+	CreateOIDCUser(issuer, subject, username string) (*User, error)
+	HasOIDCIdentity(userID string) (bool, error)
+
+	// === SCHEDULED MESSAGES ===
+	CreateScheduledMessage(conversationID, senderID string, content *string, photoURLs []string, replyToID *string, sendAt time.Time) (*ScheduledMessage, error)
+	GetUserScheduledMessages(userID string) ([]ScheduledMessage, error)
+	GetDueScheduledMessages(now time.Time, limit int) ([]ScheduledMessage, error)
+	UpdateScheduledMessage(scheduledID, userID string, content *string, sendAt *time.Time) (*ScheduledMessage, error)
+	DeleteScheduledMessage(scheduledID, userID string) (*ScheduledMessage, error)
+	DeliverScheduledMessage(scheduled ScheduledMessage, replyToID *string) (*Message, error)
+
 	// === REACTIONS ===
 	CreateMessageReaction(messageID, userID, emoticon string) (*MessageReaction, error)
 	DeleteMessageReaction(reactionID, userID string) error
 
 	// === GROUPS ===
 	CreateGroup(name, createdBy string, memberIDs []string) (*Conversation, error)
-	AddUserToGroup(groupID, userID string) error
+	AddUserToGroup(groupID, userID, addedBy string) error
 	RemoveUserFromGroup(groupID, userID string) error
 	RemoveMemberFromGroup(groupID, adminUserID, memberID string) error
-	UpdateGroupName(groupID, name string) error
+	UpdateGroupName(groupID, name, userID string) error
 	UpdateGroupPhoto(groupID, photoURL string) error
 	IsUserInConversation(conversationID, userID string) (bool, error)
+
+	// === ACCOUNTS ===
+	GetUserReactions(userID string) ([]MessageReaction, error)
+	GetUserGroups(userID string) ([]GroupMembership, error)
+	DeleteUser(userID string, policy DeletionPolicy) (*DeletedAccount, error)
+	DeleteUserAndBots(userID string, policy DeletionPolicy) (*DeletedAccount, error)
+
+	// === ADMINISTRATION ===
+	ListUsers(limit, offset int) ([]User, error)
+	GetUserSessions(userID string) ([]UserSession, error)
+	DeleteUserSessions(userID string) (int64, error)
+	DeleteUserSessionByHash(hashPrefix string) error
+	UpdateGroupOwner(groupID, userID string) error
+	GetDatabaseStats(topConversations int) (*DatabaseStats, error)
 }
 
 type appdbimpl struct {
@@ -115,12 +237,15 @@ func (db *appdbimpl) initializeSchema() error {
 		id TEXT PRIMARY KEY,
 		username TEXT UNIQUE NOT NULL,
 		photo_url TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+		bot_owner_id TEXT,
+		password_hash TEXT
 	);
 	
 	-- User sessions table
 	CREATE TABLE IF NOT EXISTS user_sessions (
-		token TEXT PRIMARY KEY,
+		token_hash TEXT PRIMARY KEY,
 		user_id TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -135,6 +260,7 @@ func (db *appdbimpl) initializeSchema() error {
 		created_by TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		last_message_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		message_ttl INTEGER NOT NULL DEFAULT 0,
 		FOREIGN KEY (created_by) REFERENCES users(id)
 	);
 	
@@ -159,11 +285,68 @@ func (db *appdbimpl) initializeSchema() error {
 		reply_to_id TEXT,
 		forwarded BOOLEAN DEFAULT FALSE,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME,
+		system BOOLEAN DEFAULT FALSE,
+		link_url TEXT,
+		event TEXT,
+		attachment_id TEXT,
 		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
 		FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
 		FOREIGN KEY (reply_to_id) REFERENCES messages(id) ON DELETE SET NULL,
-		CHECK ((content IS NOT NULL AND photo_url IS NULL) OR 
-			   (content IS NULL AND photo_url IS NOT NULL))
+		FOREIGN KEY (attachment_id) REFERENCES attachments(id)
+	);
+	
+	-- Attachments table: files sent in messages, stored outside the public uploads under storage_key. Forwarded
+	-- messages share the attachment of the original message.
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		filename TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		storage_key TEXT UNIQUE NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	
+	-- Message photos table: the photos of albums, in order. The first photo is also the photo_url of the message, so
+	-- that single photos need no rows here.
+	CREATE TABLE IF NOT EXISTS message_photos (
+		message_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		photo_url TEXT NOT NULL,
+		PRIMARY KEY (message_id, position),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	);
+	
+	-- Polls table: the polls sent in groups, one per poll message. A poll is closed by its creator (closed_at) or once
+	-- closes_at is reached.
+	CREATE TABLE IF NOT EXISTS polls (
+		message_id TEXT PRIMARY KEY,
+		question TEXT NOT NULL,
+		multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+		anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+		closes_at DATETIME,
+		closed_at DATETIME,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	);
+	
+	-- Poll options table: the options of a poll, in order
+	CREATE TABLE IF NOT EXISTS poll_options (
+		message_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		PRIMARY KEY (message_id, position),
+		FOREIGN KEY (message_id) REFERENCES polls(message_id) ON DELETE CASCADE
+	);
+	
+	-- Poll votes table: the options chosen by each voter
+	CREATE TABLE IF NOT EXISTS poll_votes (
+		message_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, position, user_id),
+		FOREIGN KEY (message_id, position) REFERENCES poll_options(message_id, position) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);
 	
 	-- Message reactions table
@@ -178,6 +361,183 @@ func (db *appdbimpl) initializeSchema() error {
 		UNIQUE (message_id, user_id)
 	);
 	
+	-- Scheduled messages table: messages waiting to be sent at send_at
+	CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id TEXT PRIMARY KEY,
+		conversation_id TEXT NOT NULL,
+		sender_id TEXT NOT NULL,
+		content TEXT,
+		photo_url TEXT,
+		reply_to_id TEXT,
+		send_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+		FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Scheduled message photos table: the photos of scheduled albums, in order, as in message_photos
+	CREATE TABLE IF NOT EXISTS scheduled_message_photos (
+		scheduled_message_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		photo_url TEXT NOT NULL,
+		PRIMARY KEY (scheduled_message_id, position),
+		FOREIGN KEY (scheduled_message_id) REFERENCES scheduled_messages(id) ON DELETE CASCADE
+	);
+	
+	-- Message mentions table: group members mentioned with @username in the text of a message
+	CREATE TABLE IF NOT EXISTS message_mentions (
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		text_offset INTEGER NOT NULL,
+		text_length INTEGER NOT NULL,
+		PRIMARY KEY (message_id, user_id, text_offset),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Starred messages table: messages bookmarked by a user, removed with the message or when the user leaves the group
+	CREATE TABLE IF NOT EXISTS starred_messages (
+		user_id TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, message_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	);
+	
+	-- Link previews table: cache of the metadata of the links sent in messages
+	CREATE TABLE IF NOT EXISTS link_previews (
+		url TEXT PRIMARY KEY,
+		title TEXT,
+		description TEXT,
+		image_url TEXT,
+		failed BOOLEAN NOT NULL DEFAULT FALSE,
+		fetched_at DATETIME NOT NULL,
+		CHECK (failed OR title IS NOT NULL)
+	);
+	
+	-- Drafts table: unsent text of a user in a conversation
+	CREATE TABLE IF NOT EXISTS drafts (
+		user_id TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		content TEXT NOT NULL,
+		reply_to_id TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, conversation_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+	);
+	
+	-- Webhooks table: URLs receiving the events of a conversation, or of all the direct conversations of the owner
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		owner_id TEXT NOT NULL,
+		conversation_id TEXT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+	);
+	
+	-- Webhook deliveries table: queue of the events to send to webhooks, with the outcome of the last attempt
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		payload BLOB NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME,
+		last_attempt_at DATETIME,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	);
+	
+	-- Idempotency keys table: responses of the requests sent with an idempotency key, replayed when they are retried
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status_code INTEGER,
+		response BLOB,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, idempotency_key),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Change log table: monotonic sequence of the changes to conversations, read by clients to sync
+	CREATE TABLE IF NOT EXISTS change_log (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		conversation_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	
+	-- Two-factor table: TOTP secrets of the users, enabled once confirmed with a code
+	CREATE TABLE IF NOT EXISTS two_factor (
+		user_id TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		last_counter INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Recovery codes table: hashes of the one-time codes replacing a TOTP code when the authenticator is lost
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		user_id TEXT NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		PRIMARY KEY (user_id, code_hash),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Login challenges table: logins of users with two-factor authentication waiting for a code
+	CREATE TABLE IF NOT EXISTS login_challenges (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- OIDC logins table: single sign-on logins waiting for the user to come back from the identity provider
+	CREATE TABLE IF NOT EXISTS oidc_logins (
+		state TEXT PRIMARY KEY,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	
+	-- OIDC identities table: users of the identity provider, by subject, and the WASAText users they log in as
+	CREATE TABLE IF NOT EXISTS oidc_identities (
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (issuer, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
+	-- Access tokens table: personal access tokens of the users, limited to some scopes, stored as hashes
+	CREATE TABLE IF NOT EXISTS access_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		scopes TEXT NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	
 	-- Indices for performance
 	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 	CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
@@ -187,6 +547,23 @@ func (db *appdbimpl) initializeSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_messages_sender_id ON messages(sender_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
 	CREATE INDEX IF NOT EXISTS idx_reactions_message_id ON message_reactions(message_id);
+	CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON message_mentions(user_id);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_send_at ON scheduled_messages(send_at);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender_id ON scheduled_messages(sender_id);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_conversation_id ON webhooks(conversation_id);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks(owner_id);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+	CREATE INDEX IF NOT EXISTS idx_change_log_conversation_id ON change_log(conversation_id, seq);
+	CREATE INDEX IF NOT EXISTS idx_change_log_created_at ON change_log(created_at);
+	CREATE INDEX IF NOT EXISTS idx_login_challenges_expires_at ON login_challenges(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_oidc_logins_expires_at ON oidc_logins(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_oidc_identities_user_id ON oidc_identities(user_id);
+	CREATE INDEX IF NOT EXISTS idx_access_tokens_user_id ON access_tokens(user_id);
+	CREATE INDEX IF NOT EXISTS idx_access_tokens_expires_at ON access_tokens(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_poll_votes_user_id ON poll_votes(user_id);
+	CREATE INDEX IF NOT EXISTS idx_starred_messages_message_id ON starred_messages(message_id);
 	`
 
 	_, err := db.c.Exec(schema)
@@ -194,5 +571,225 @@ func (db *appdbimpl) initializeSchema() error {
 		return fmt.Errorf("failed to initialize database schema: %w", err)
 	}
 
+	return db.migrateSchema()
+}
+
+// migrateSchema aggiorna i database creati da versioni precedenti, aggiungendo le colonne mancanti
+func (db *appdbimpl) migrateSchema() error {
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"conversations", "message_ttl", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "expires_at", "DATETIME"},
+		{"messages", "system", "BOOLEAN DEFAULT FALSE"},
+		{"messages", "link_url", "TEXT"},
+		{"messages", "event", "TEXT"},
+		{"messages", "attachment_id", "TEXT"},
+		{"users", "is_bot", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "bot_owner_id", "TEXT"},
+		{"users", "password_hash", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to migrate database schema: %w", err)
+		}
+	}
+
+	for _, table := range []string{"messages", "scheduled_messages"} {
+		if err := db.dropContentCheck(table); err != nil {
+			return fmt.Errorf("failed to migrate database schema: %w", err)
+		}
+	}
+
+	// Gli indici sulle colonne migrate si possono creare solo dopo averle aggiunte
+	_, err := db.c.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_messages_attachment_id ON messages(attachment_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+
+	if err := db.hashSessionTokens(); err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+	return nil
+}
+
+// hashSessionTokens sostituisce i token di sessione in chiaro dei database precedenti con il loro hash, rinominando
+// la colonna token in token_hash. La rinomina e gli hash avvengono in un'unica transazione, così la migrazione non
+// viene mai applicata due volte né lasciata a metà.
+func (db *appdbimpl) hashSessionTokens() error {
+	plaintext, err := db.hasColumn("user_sessions", "token")
+	if err != nil || !plaintext {
+		return err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Legge i token in chiaro
+	rows, err := tx.Query(`SELECT token FROM user_sessions`)
+	if err != nil {
+		return fmt.Errorf("error reading session tokens: %w", err)
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading session tokens: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading session tokens: %w", err)
+	}
+
+	// 2. Rinomina la colonna e sostituisce ogni token con il suo hash
+	if _, err := tx.Exec(`ALTER TABLE user_sessions RENAME COLUMN token TO token_hash`); err != nil {
+		return fmt.Errorf("error renaming session token column: %w", err)
+	}
+	for _, token := range tokens {
+		if _, err := tx.Exec(`UPDATE user_sessions SET token_hash = ? WHERE token_hash = ?`, hashToken(token), token); err != nil {
+			return fmt.Errorf("error hashing session token: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	log.Printf("Hashed %d session tokens", len(tokens))
+	return nil
+}
+
+// contentCheck è il vincolo dei database precedenti che ammetteva solo messaggi con un testo o una foto
+var contentCheck = regexp.MustCompile(`,\s*CHECK\s*\(\(content IS NOT NULL AND photo_url IS NULL\) OR\s*\(content IS NULL AND photo_url IS NOT NULL\)\)`)
+
+// dropContentCheck rimuove dalla tabella messages o scheduled_messages dei database precedenti il vincolo sul
+// contenuto, che escluderebbe i messaggi con un allegato e le foto con una didascalia; il contenuto dei messaggi è ora
+// validato da CreateMessage e CreateScheduledMessage. SQLite non permette di rimuovere un vincolo, quindi la tabella
+// viene ricreata senza di esso, copiando righe e indici, come indicato nella documentazione di ALTER TABLE. Le chiavi
+// esterne sono disattivate durante la copia, altrimenti eliminare la vecchia tabella cancellerebbe reazioni e
+// menzioni. Il nome della tabella proviene solo da migrateSchema.
+func (db *appdbimpl) dropContentCheck(table string) error {
+	var schema string
+	err := db.c.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&schema)
+	if err != nil {
+		return fmt.Errorf("error reading %s schema: %w", table, err)
+	}
+	if !contentCheck.MatchString(schema) {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.c.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening connection: %w", err)
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil {
+		return fmt.Errorf("error reading foreign keys setting: %w", err)
+	}
+	if foreignKeys {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return fmt.Errorf("error disabling foreign keys: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`); err != nil {
+				log.Printf("Failed to enable foreign keys: %v", err)
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Legge gli indici, eliminati insieme alla tabella
+	rows, err := tx.Query(`SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL`, table)
+	if err != nil {
+		return fmt.Errorf("error reading %s indices: %w", table, err)
+	}
+	var indices []string
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			rows.Close()
+			return fmt.Errorf("error reading %s indices: %w", table, err)
+		}
+		indices = append(indices, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading %s indices: %w", table, err)
+	}
+
+	// 2. Crea la nuova tabella con le stesse colonne, senza il vincolo, e vi copia i messaggi
+	schema = contentCheck.ReplaceAllString(schema, "")
+	schema = strings.Replace(schema, table, table+"_new", 1)
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("error creating %s table: %w", table, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO ` + table + `_new SELECT * FROM ` + table); err != nil {
+		return fmt.Errorf("error copying %s: %w", table, err)
+	}
+
+	// 3. Sostituisce la vecchia tabella e ricrea gli indici
+	if _, err := tx.Exec(`DROP TABLE ` + table); err != nil {
+		return fmt.Errorf("error dropping %s table: %w", table, err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE ` + table + `_new RENAME TO ` + table); err != nil {
+		return fmt.Errorf("error renaming %s table: %w", table, err)
+	}
+	for _, index := range indices {
+		if _, err := tx.Exec(index); err != nil {
+			return fmt.Errorf("error creating %s index: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	log.Printf("Dropped the content constraint of the %s table", table)
 	return nil
 }
+
+// addColumnIfMissing aggiunge una colonna a una tabella se non è già presente. I nomi di tabelle e colonne
+// provengono solo da migrateSchema, mai dall'input degli utenti.
+func (db *appdbimpl) addColumnIfMissing(table, column, definition string) error {
+	exists, err := db.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := db.c.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition); err != nil {
+		return fmt.Errorf("error adding column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// hasColumn indica se una tabella ha una colonna
+func (db *appdbimpl) hasColumn(table, column string) (bool, error) {
+	var exists bool
+	err := db.c.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// === DRAFT OPERATIONS ===
+
+// GetDraft retrieves the draft of a user in a conversation
+func (db *appdbimpl) GetDraft(conversationID, userID string) (*Draft, error) {
+	query := `
+		SELECT conversation_id, content, reply_to_id, updated_at
+		FROM drafts
+		WHERE conversation_id = ? AND user_id = ?
+	`
+
+	var draft Draft
+	err := db.c.QueryRow(query, conversationID, userID).Scan(
+		&draft.ConversationID,
+		&draft.Content,
+		&draft.ReplyToID,
+		&draft.UpdatedAt,
+	)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("draft not found")
+		}
+		return nil, fmt.Errorf("error retrieving draft: %w", err)
+	}
+
+	return &draft, nil
+}
+
+// SaveDraft creates or replaces the draft of a user in a conversation
+func (db *appdbimpl) SaveDraft(conversationID, userID, content string, replyToID *string) (*Draft, error) {
+	// 1. Validate that the user is a participant in the conversation
+	isParticipant, err := db.IsUserInConversation(conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if !isParticipant {
+		return nil, fmt.Errorf("user is not a participant in this conversation")
+	}
+
+	// 2. If replyToID is provided, validate that the message exists in the same conversation
+	if replyToID != nil && *replyToID != "" {
+		replyMessage, err := db.GetMessage(*replyToID)
+		if err != nil {
+			return nil, fmt.Errorf("reply target message not found: %w", err)
+		}
+		if replyMessage.ConversationID != conversationID {
+			return nil, fmt.Errorf("cannot reply to message from different conversation")
+		}
+	}
+
+	// 3. Insert or replace the draft
+	query := `
+		INSERT INTO drafts (user_id, conversation_id, content, reply_to_id, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE
+		SET content = excluded.content, reply_to_id = excluded.reply_to_id, updated_at = excluded.updated_at
+	`
+	_, err = db.c.Exec(query, userID, conversationID, content, replyToID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error saving draft: %w", err)
+	}
+
+	return db.GetDraft(conversationID, userID)
+}
+
+// DeleteDraft deletes the draft of a user in a conversation
+func (db *appdbimpl) DeleteDraft(conversationID, userID string) error {
+	result, err := db.c.Exec(`DELETE FROM drafts WHERE conversation_id = ? AND user_id = ?`, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting draft: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deletion result: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("draft not found")
+	}
+
+	return nil
+}
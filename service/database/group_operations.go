@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -64,6 +65,16 @@ func (db *appdbimpl) CreateGroup(name, createdBy string, memberIDs []string) (*C
 		}
 	}
 
+	// Record the new group for syncing clients
+	if err := recordChange(tx, groupID, ChangeConversation, groupID); err != nil {
+		return nil, err
+	}
+	for _, participantID := range append([]string{createdBy}, memberIDs...) {
+		if err := recordChange(tx, groupID, ChangeMemberJoined, participantID); err != nil {
+			return nil, err
+		}
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("error committing group creation transaction: %w", err)
@@ -78,11 +89,21 @@ func (db *appdbimpl) CreateGroup(name, createdBy string, memberIDs []string) (*C
 	return group, nil
 }
 
-// AddUserToGroup adds a user to an existing group
-func (db *appdbimpl) AddUserToGroup(groupID, userID string) error {
+// AddUserToGroup adds a user to an existing group, announced with a system message of addedBy
+func (db *appdbimpl) AddUserToGroup(groupID, userID, addedBy string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify group exists and is of type 'group'
 	var conversationType string
-	err := db.c.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -106,7 +127,7 @@ func (db *appdbimpl) AddUserToGroup(groupID, userID string) error {
 
 	// 3. Add user to conversation_participants
 	now := time.Now()
-	_, err = db.c.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO conversation_participants (conversation_id, user_id, joined_at, last_read_at)
 		VALUES (?, ?, ?, ?)`,
 		groupID, userID, now, now)
@@ -114,14 +135,37 @@ func (db *appdbimpl) AddUserToGroup(groupID, userID string) error {
 		return fmt.Errorf("error adding user to group: %w", err)
 	}
 
+	// 4. Announce the new member in the group
+	if _, err := insertGroupEvent(tx, groupID, GroupEvent{Type: GroupEventMemberAdded, ActorID: addedBy, TargetID: &userID}); err != nil {
+		return err
+	}
+
+	// 5. Record the new member for syncing clients
+	if err := recordChange(tx, groupID, ChangeMemberJoined, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
-// RemoveUserFromGroup removes a user from a group
+// RemoveUserFromGroup removes a user from a group, who leaves it with a system message
 func (db *appdbimpl) RemoveUserFromGroup(groupID, userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify group exists and is of type 'group'
 	var conversationType string
-	err := db.c.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -144,7 +188,7 @@ func (db *appdbimpl) RemoveUserFromGroup(groupID, userID string) error {
 	}
 
 	// 3. Remove user from conversation_participants
-	result, err := db.c.Exec(`
+	result, err := tx.Exec(`
 		DELETE FROM conversation_participants 
 		WHERE conversation_id = ? AND user_id = ?`,
 		groupID, userID)
@@ -160,15 +204,50 @@ func (db *appdbimpl) RemoveUserFromGroup(groupID, userID string) error {
 		return fmt.Errorf("user was not found in group")
 	}
 
+	// 4. Drop the draft the user was writing in the group, their stars and the webhooks they registered for it
+	if _, err := tx.Exec(`DELETE FROM drafts WHERE conversation_id = ? AND user_id = ?`, groupID, userID); err != nil {
+		return fmt.Errorf("error deleting draft: %w", err)
+	}
+	if err := deleteStars(tx, groupID, userID); err != nil {
+		return err
+	}
+	if err := deleteWebhooksWhere(tx, `conversation_id = ? AND owner_id = ?`, groupID, userID); err != nil {
+		return err
+	}
+
+	// 5. Announce the departure in the group
+	if _, err := insertGroupEvent(tx, groupID, GroupEvent{Type: GroupEventMemberLeft, ActorID: userID}); err != nil {
+		return err
+	}
+
+	// 6. Record the departure for syncing clients
+	if err := recordChange(tx, groupID, ChangeMemberLeft, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
-// UpdateGroupName updates a group's name
-func (db *appdbimpl) UpdateGroupName(groupID, name string) error {
-	// 1. Verify group exists and is of type 'group'
+// UpdateGroupName updates a group's name, announced with a system message of userID
+func (db *appdbimpl) UpdateGroupName(groupID, name, userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Verify group exists and is of type 'group', reading the current name
 	var conversationType string
-	err := db.c.QueryRow(`
-		SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
+	var oldName *string
+	err = tx.QueryRow(`
+		SELECT type, name FROM conversations WHERE id = ?`, groupID).Scan(&conversationType, &oldName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return fmt.Errorf("group not found")
@@ -181,7 +260,7 @@ func (db *appdbimpl) UpdateGroupName(groupID, name string) error {
 	}
 
 	// 2. Update conversation name
-	result, err := db.c.Exec(`
+	result, err := tx.Exec(`
 		UPDATE conversations SET name = ? WHERE id = ? AND type = 'group'`,
 		name, groupID)
 	if err != nil {
@@ -196,14 +275,40 @@ func (db *appdbimpl) UpdateGroupName(groupID, name string) error {
 		return fmt.Errorf("group not found or not updated")
 	}
 
+	// 3. Announce the new name in the group, unless it did not change
+	if oldName == nil || *oldName != name {
+		event := GroupEvent{Type: GroupEventRenamed, ActorID: userID, OldName: oldName, NewName: &name}
+		if _, err := insertGroupEvent(tx, groupID, event); err != nil {
+			return err
+		}
+	}
+
+	// 4. Record the change for syncing clients
+	if err := recordChange(tx, groupID, ChangeConversation, groupID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
 // UpdateGroupPhoto updates a group's photo URL
 func (db *appdbimpl) UpdateGroupPhoto(groupID, photoURL string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify group exists and is of type 'group'
 	var conversationType string
-	err := db.c.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -217,7 +322,7 @@ func (db *appdbimpl) UpdateGroupPhoto(groupID, photoURL string) error {
 	}
 
 	// 2. Update conversation photo_url
-	result, err := db.c.Exec(`
+	result, err := tx.Exec(`
 		UPDATE conversations SET photo_url = ? WHERE id = ? AND type = 'group'`,
 		photoURL, groupID)
 	if err != nil {
@@ -232,14 +337,32 @@ func (db *appdbimpl) UpdateGroupPhoto(groupID, photoURL string) error {
 		return fmt.Errorf("group not found or not updated")
 	}
 
+	// 3. Record the change for syncing clients
+	if err := recordChange(tx, groupID, ChangeConversation, groupID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
 // RemoveMemberFromGroup removes a specific member from a group (admin action)
 func (db *appdbimpl) RemoveMemberFromGroup(groupID, adminUserID, memberID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify group exists and is actually a group
 	var conversationType string
-	err := db.c.QueryRow(`SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
+	err = tx.QueryRow(`SELECT type FROM conversations WHERE id = ?`, groupID).Scan(&conversationType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return fmt.Errorf("group not found")
@@ -277,7 +400,7 @@ func (db *appdbimpl) RemoveMemberFromGroup(groupID, adminUserID, memberID string
 	}
 
 	// 5. Remove the member from the group
-	result, err := db.c.Exec(`
+	result, err := tx.Exec(`
 		DELETE FROM conversation_participants WHERE conversation_id = ? AND user_id = ?`,
 		groupID, memberID)
 	if err != nil {
@@ -293,15 +416,98 @@ func (db *appdbimpl) RemoveMemberFromGroup(groupID, adminUserID, memberID string
 		return fmt.Errorf("member was not removed from group")
 	}
 
+	// 6. Drop the draft the member was writing in the group, their stars and the webhooks they registered for it
+	if _, err := tx.Exec(`DELETE FROM drafts WHERE conversation_id = ? AND user_id = ?`, groupID, memberID); err != nil {
+		return fmt.Errorf("error deleting draft: %w", err)
+	}
+	if err := deleteStars(tx, groupID, memberID); err != nil {
+		return err
+	}
+	if err := deleteWebhooksWhere(tx, `conversation_id = ? AND owner_id = ?`, groupID, memberID); err != nil {
+		return err
+	}
+
+	// 7. Announce the removal in the group
+	event := GroupEvent{Type: GroupEventMemberRemoved, ActorID: adminUserID, TargetID: &memberID}
+	if _, err := insertGroupEvent(tx, groupID, event); err != nil {
+		return err
+	}
+
+	// 8. Record the removal for syncing clients
+	if err := recordChange(tx, groupID, ChangeMemberLeft, memberID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
+// insertGroupEvent announces an event of a group with a system message sent by the actor, within the transaction of
+// the operation, and returns the ID of the message. The usernames are filled in, and the text of the message describes
+// the event for clients that only show the content. Like the other announcements, the message does not expire. Timer
+// changes are announced this way in direct conversations too.
+func insertGroupEvent(tx *sql.Tx, conversationID string, event GroupEvent) (string, error) {
+	// 1. Fill in the current usernames
+	if err := tx.QueryRow(`SELECT username FROM users WHERE id = ?`, event.ActorID).Scan(&event.ActorUsername); err != nil {
+		return "", fmt.Errorf("error retrieving group event actor: %w", err)
+	}
+	if event.TargetID != nil {
+		var username string
+		if err := tx.QueryRow(`SELECT username FROM users WHERE id = ?`, *event.TargetID).Scan(&username); err != nil {
+			return "", fmt.Errorf("error retrieving group event target: %w", err)
+		}
+		event.TargetUsername = &username
+	}
+
+	// 2. Describe the event
+	var notice string
+	switch event.Type {
+	case GroupEventMemberAdded:
+		notice = event.ActorUsername + " added " + *event.TargetUsername
+	case GroupEventMemberLeft:
+		notice = event.ActorUsername + " left the group"
+	case GroupEventMemberRemoved:
+		notice = event.ActorUsername + " removed " + *event.TargetUsername
+	case GroupEventRenamed:
+		notice = event.ActorUsername + " renamed the group to \"" + *event.NewName + "\""
+	case GroupEventTimerChanged:
+		notice = event.ActorUsername + " turned off disappearing messages"
+		if *event.Duration > 0 {
+			notice = event.ActorUsername + " set disappearing messages to " + describeMessageTTL(*event.Duration)
+		}
+	default:
+		return "", fmt.Errorf("unknown group event %q", event.Type)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("error encoding group event: %w", err)
+	}
+
+	// 3. Send the system message
+	messageID := uuid.Must(uuid.NewV4()).String()
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, conversation_id, sender_id, content, forwarded, system, event, created_at)
+		VALUES (?, ?, ?, ?, FALSE, TRUE, ?, CURRENT_TIMESTAMP)`, messageID, conversationID, event.ActorID, notice, string(payload))
+	if err != nil {
+		return "", fmt.Errorf("error creating system message: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE conversations SET last_message_at = CURRENT_TIMESTAMP WHERE id = ?`, conversationID); err != nil {
+		return "", fmt.Errorf("error updating conversation last_message_at: %w", err)
+	}
+	if err := recordChange(tx, conversationID, ChangeMessage, messageID); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
 // getConversationWithParticipants retrieves a conversation with all its participants
 func (db *appdbimpl) getConversationWithParticipants(conversationID string) (*Conversation, error) {
 	// Get conversation details
 	conversation := &Conversation{}
 	err := db.c.QueryRow(`
-		SELECT id, type, name, photo_url, created_by, created_at, last_message_at
+		SELECT id, type, name, photo_url, created_by, created_at, last_message_at, message_ttl
 		FROM conversations WHERE id = ?`, conversationID).Scan(
 		&conversation.ID,
 		&conversation.Type,
@@ -309,14 +515,15 @@ func (db *appdbimpl) getConversationWithParticipants(conversationID string) (*Co
 		&conversation.PhotoURL,
 		&conversation.CreatedBy,
 		&conversation.CreatedAt,
-		&conversation.LastMessageAt)
+		&conversation.LastMessageAt,
+		&conversation.MessageTTL)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving conversation: %w", err)
 	}
 
 	// Get participants
 	rows, err := db.c.Query(`
-		SELECT u.id, u.username, u.photo_url
+		SELECT u.id, u.username, u.photo_url, u.is_bot
 		FROM users u
 		JOIN conversation_participants cp ON u.id = cp.user_id
 		WHERE cp.conversation_id = ?
@@ -329,7 +536,7 @@ func (db *appdbimpl) getConversationWithParticipants(conversationID string) (*Co
 	var participants []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.PhotoURL)
+		err := rows.Scan(&user.ID, &user.Username, &user.PhotoURL, &user.IsBot)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning participant: %w", err)
 		}
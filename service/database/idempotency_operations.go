@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// === IDEMPOTENCY KEY OPERATIONS ===
+
+// ReserveIdempotencyKey reserves an idempotency key of a user for a new request. If the key is free, it is reserved
+// and nil is returned; otherwise the request that already used the key is returned, without reserving anything.
+// Keys created before expiredBefore, and reservations made before abandonedBefore that never completed (e.g., the
+// server stopped while handling the request), are free again.
+func (db *appdbimpl) ReserveIdempotencyKey(userID, key, requestHash string, expiredBefore, abandonedBefore time.Time) (*IdempotencyRecord, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Free the key if it is no longer valid
+	_, err = tx.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ?
+		AND (created_at < ? OR (status_code IS NULL AND created_at < ?))`,
+		userID, key, expiredBefore.UTC(), abandonedBefore.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error deleting expired idempotency key: %w", err)
+	}
+
+	// 2. Reserve the key, unless it is taken
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO idempotency_keys (user_id, idempotency_key, request_hash, status_code, response, created_at)
+		VALUES (?, ?, ?, NULL, NULL, ?)`,
+		userID, key, requestHash, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+	reserved, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error checking reservation outcome: %w", err)
+	}
+
+	// 3. Return the request holding the key
+	var record *IdempotencyRecord
+	if reserved == 0 {
+		record = &IdempotencyRecord{}
+		err := tx.QueryRow(`
+			SELECT user_id, idempotency_key, request_hash, status_code, response, created_at
+			FROM idempotency_keys
+			WHERE user_id = ? AND idempotency_key = ?`, userID, key).Scan(
+			&record.UserID,
+			&record.Key,
+			&record.RequestHash,
+			&record.StatusCode,
+			&record.Response,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving idempotency key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return record, nil
+}
+
+// CompleteIdempotencyKey saves the response of the request that reserved an idempotency key
+func (db *appdbimpl) CompleteIdempotencyKey(userID, key string, statusCode int, response []byte) error {
+	result, err := db.c.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = ?, response = ?
+		WHERE user_id = ? AND idempotency_key = ? AND status_code IS NULL`,
+		statusCode, response, userID, key)
+	if err != nil {
+		return fmt.Errorf("error saving idempotent response: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking update outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("idempotency key not found")
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees an idempotency key reserved by a request that did not complete, so that the request can
+// be retried. Completed keys are left untouched.
+func (db *appdbimpl) ReleaseIdempotencyKey(userID, key string) error {
+	_, err := db.c.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ? AND status_code IS NULL`, userID, key)
+	if err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the idempotency keys created before the given time, returning how many were
+// deleted
+func (db *appdbimpl) DeleteExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deleted, nil
+}
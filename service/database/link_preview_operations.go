@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// === LINK PREVIEW OPERATIONS ===
+
+// maxLinkLength is the length of the longest link that gets a preview
+const maxLinkLength = 2048
+
+// linkPattern matches the http(s) links in the text of a message
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// GetLinkPreview retrieves the cached preview of a URL, including failed fetches
+func (db *appdbimpl) GetLinkPreview(link string) (*LinkPreview, error) {
+	query := `SELECT url, title, description, image_url, failed, fetched_at FROM link_previews WHERE url = ?`
+
+	var preview LinkPreview
+	var title *string
+	err := db.c.QueryRow(query, link).Scan(
+		&preview.URL,
+		&title,
+		&preview.Description,
+		&preview.ImageURL,
+		&preview.Failed,
+		&preview.FetchedAt,
+	)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("link preview not found")
+		}
+		return nil, fmt.Errorf("error retrieving link preview: %w", err)
+	}
+	if title != nil {
+		preview.Title = *title
+	}
+
+	return &preview, nil
+}
+
+// SaveLinkPreview stores the preview of a URL, replacing the cached one. Failed previews are stored without metadata.
+func (db *appdbimpl) SaveLinkPreview(preview LinkPreview) error {
+	var title *string
+	if preview.Failed {
+		preview.Description, preview.ImageURL = nil, nil
+	} else {
+		if preview.Title == "" {
+			return fmt.Errorf("link preview must have a title")
+		}
+		title = &preview.Title
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	query := `
+		INSERT INTO link_previews (url, title, description, image_url, failed, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE
+		SET title = excluded.title, description = excluded.description, image_url = excluded.image_url,
+			failed = excluded.failed, fetched_at = excluded.fetched_at
+	`
+	_, err = tx.Exec(query, preview.URL, title, preview.Description, preview.ImageURL, preview.Failed, preview.FetchedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error saving link preview: %w", err)
+	}
+
+	// The messages linking the URL now show the preview
+	if !preview.Failed {
+		err := recordChanges(tx, ChangeMessage, `SELECT conversation_id, id AS entity_id FROM messages WHERE link_url = ?`, preview.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// findLink returns the first link in the text of a message, nil if there is none
+func findLink(content *string) *string {
+	if content == nil {
+		return nil
+	}
+
+	for _, link := range linkPattern.FindAllString(*content, -1) {
+		// Punctuation closing a sentence or a parenthesis is not part of the link
+		link = strings.TrimRight(link, ".,;:!?'")
+		if strings.HasSuffix(link, ")") && !strings.Contains(link, "(") {
+			link = strings.TrimRight(link, ")")
+		}
+		if u, err := url.Parse(link); err == nil && u.Host != "" && len(link) <= maxLinkLength {
+			return &link
+		}
+	}
+	return nil
+}
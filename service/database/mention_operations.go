@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// === MENTION OPERATIONS ===
+
+// mentionPattern matches the @username tokens in the text of a message
+var mentionPattern = regexp.MustCompile(`@([a-zA-Z0-9_-]+)`)
+
+// GetUserMentions retrieves up to limit messages mentioning a user, newest first. If beforeID is not empty, only the
+// messages older than that message are returned, to read the next page. Messages of conversations the user has left
+// and expired messages are not returned.
+func (db *appdbimpl) GetUserMentions(userID, beforeID string, limit int) ([]MentionedMessage, error) {
+	// Messages sent in the same second are ordered by insertion
+	cursor := `TRUE`
+	args := []interface{}{userID, userID}
+	if beforeID != "" {
+		var exists bool
+		err := db.c.QueryRow(`SELECT EXISTS (SELECT 1 FROM messages WHERE id = ?)`, beforeID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking cursor message: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("cursor message not found")
+		}
+		cursor = `(m.created_at, m.rowid) < (SELECT created_at, rowid FROM messages WHERE id = ?)`
+		args = append(args, beforeID)
+	}
+	args = append(args, time.Now().UTC(), limit)
+
+	query := `
+		SELECT ` + messageColumns + `, c.type, c.name, m.created_at > cp.last_read_at
+		FROM ` + messageTables + `
+		JOIN conversations c ON m.conversation_id = c.id
+		JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?
+		WHERE m.id IN (SELECT message_id FROM message_mentions WHERE user_id = ?)
+		AND ` + cursor + ` AND ` + notExpired + `
+		ORDER BY m.created_at DESC, m.rowid DESC
+		LIMIT ?
+	`
+
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentioned []MentionedMessage
+	for rows.Next() {
+		var item MentionedMessage
+		item.Message, err = scanMessage(withColumns(rows, &item.ConversationType, &item.ConversationName, &item.Unread))
+		if err != nil {
+			return nil, fmt.Errorf("error scanning mention: %w", err)
+		}
+		mentioned = append(mentioned, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over mentions: %w", err)
+	}
+	rows.Close()
+
+	// Load reactions and mentions once the rows are closed
+	for i := range mentioned {
+		if err := db.loadMessageDetails(&mentioned[i].Message); err != nil {
+			return nil, err
+		}
+	}
+
+	return mentioned, nil
+}
+
+// getMessageMentions retrieves the mentions of a message, in text order
+func (db *appdbimpl) getMessageMentions(messageID string) ([]Mention, error) {
+	query := `
+		SELECT mm.user_id, u.username, mm.text_offset, mm.text_length
+		FROM message_mentions mm
+		JOIN users u ON mm.user_id = u.id
+		WHERE mm.message_id = ?
+		ORDER BY mm.text_offset ASC
+	`
+
+	rows, err := db.c.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+	for rows.Next() {
+		var mention Mention
+		if err := rows.Scan(&mention.UserID, &mention.Username, &mention.Offset, &mention.Length); err != nil {
+			return nil, fmt.Errorf("error scanning mention: %w", err)
+		}
+		mentions = append(mentions, mention)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over mentions: %w", err)
+	}
+
+	return mentions, nil
+}
+
+// insertMentions resolves the @username tokens in the text of a new group message against the members of the group
+// and stores them. Tokens not matching a member are left as plain text, as are mentions of the sender.
+func insertMentions(tx *sql.Tx, messageID, conversationID, senderID string, content *string) error {
+	if content == nil {
+		return nil
+	}
+
+	var conversationType string
+	if err := tx.QueryRow(`SELECT type FROM conversations WHERE id = ?`, conversationID).Scan(&conversationType); err != nil {
+		return fmt.Errorf("error retrieving conversation type: %w", err)
+	}
+	if conversationType != "group" {
+		return nil
+	}
+
+	for _, token := range findMentions(*content) {
+		var userID string
+		err := tx.QueryRow(`
+			SELECT u.id
+			FROM users u
+			JOIN conversation_participants cp ON u.id = cp.user_id
+			WHERE cp.conversation_id = ? AND u.username = ?`, conversationID, token.username).Scan(&userID)
+		if isNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error resolving mention: %w", err)
+		}
+		if userID == senderID {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO message_mentions (message_id, user_id, text_offset, text_length) VALUES (?, ?, ?, ?)`,
+			messageID, userID, token.offset, token.length)
+		if err != nil {
+			return fmt.Errorf("error creating mention: %w", err)
+		}
+	}
+	return nil
+}
+
+// mentionToken is an @username token found in the text of a message. Offset and length are in characters and
+// include the "@".
+type mentionToken struct {
+	username       string
+	offset, length int
+}
+
+// findMentions returns the @username tokens in content. Tokens preceded by a letter or a digit (e.g. in e-mail
+// addresses) and names that are not valid usernames are skipped.
+func findMentions(content string) []mentionToken {
+	var tokens []mentionToken
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		username := content[loc[2]:loc[3]]
+		if len(username) < 3 || len(username) > 16 {
+			continue
+		}
+		if start > 0 {
+			if prev := content[start-1]; isWordByte(prev) || prev == '@' {
+				continue
+			}
+		}
+
+		tokens = append(tokens, mentionToken{
+			username: username,
+			offset:   utf8.RuneCountInString(content[:start]),
+			length:   end - start,
+		})
+	}
+	return tokens
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_'
+}
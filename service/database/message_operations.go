@@ -1,15 +1,27 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
 
 // === MESSAGE OPERATIONS ===
 
-// CreateMessage creates a new message in a conversation
-func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *string, photoURL *string, replyToID *string) (*Message, error) {
+// CreateMessage creates a new message in a conversation: a text, one or more photos with an optional caption (the
+// content), or a file attachment, whose file must already be stored under its storage key. Several photos are sent as
+// an album, in the given order.
+func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *string, photoURLs []string, attachment *Attachment, replyToID *string) (*Message, error) {
+	return db.createMessage(conversationID, senderID, content, photoURLs, attachment, replyToID, nil)
+}
+
+// createMessage implements CreateMessage. If claim is not nil, it runs first in the transaction inserting the
+// message, which is not created if claim fails.
+func (db *appdbimpl) createMessage(conversationID, senderID string, content *string, photoURLs []string, attachment *Attachment, replyToID *string, claim func(tx *sql.Tx) error) (*Message, error) {
 	// 1. Validate that sender is a participant in the conversation
 	isParticipant, err := db.IsUserInConversation(conversationID, senderID)
 	if err != nil {
@@ -19,9 +31,19 @@ func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *str
 		return nil, fmt.Errorf("user is not a participant in this conversation")
 	}
 
-	// 2. Validate that either content or photoURL is provided (not both null)
-	if (content == nil && photoURL == nil) || (content != nil && photoURL != nil) {
-		return nil, fmt.Errorf("must provide either content or photo, not both or neither")
+	// 2. Validate that exactly one of content, photos and attachment is provided; photos can have a caption
+	provided := 0
+	for _, set := range []bool{content != nil && len(photoURLs) == 0, len(photoURLs) > 0, attachment != nil} {
+		if set {
+			provided++
+		}
+	}
+	if provided != 1 {
+		return nil, fmt.Errorf("must provide exactly one of content, photos or attachment")
+	}
+	var photoURL *string
+	if len(photoURLs) > 0 {
+		photoURL = &photoURLs[0]
 	}
 
 	// 3. If replyToID is provided, validate that the message exists in the same conversation
@@ -33,6 +55,9 @@ func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *str
 		if replyMessage.ConversationID != conversationID {
 			return nil, fmt.Errorf("cannot reply to message from different conversation")
 		}
+		if replyMessage.System {
+			return nil, fmt.Errorf("cannot reply to a system message")
+		}
 	}
 
 	// 4. Generate message ID and insert into database
@@ -44,12 +69,44 @@ func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *str
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
 
+	// Take whatever the message is created from, e.g. a scheduled message
+	if claim != nil {
+		if err := claim(tx); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+			}
+			return nil, err
+		}
+	}
+
+	// Messages expire if the conversation has a timer
+	expiresAt, err := messageExpiry(tx, conversationID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
+	// Insert the attachment, if any
+	var attachmentID *string
+	if attachment != nil {
+		id, err := insertAttachment(tx, *attachment)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+			}
+			return nil, err
+		}
+		attachmentID = &id
+	}
+
 	// Insert the message
 	messageQuery := `
-		INSERT INTO messages (id, conversation_id, sender_id, content, photo_url, reply_to_id, forwarded, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, FALSE, CURRENT_TIMESTAMP)
+		INSERT INTO messages (id, conversation_id, sender_id, content, photo_url, attachment_id, reply_to_id, forwarded, created_at, expires_at, link_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, FALSE, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err = tx.Exec(messageQuery, messageID, conversationID, senderID, content, photoURL, replyToID)
+	_, err = tx.Exec(messageQuery, messageID, conversationID, senderID, content, photoURL, attachmentID, replyToID, expiresAt, findLink(content))
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return nil, fmt.Errorf("error creating message: %w (rollback failed: %w)", err, rollbackErr)
@@ -57,6 +114,29 @@ func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *str
 		return nil, fmt.Errorf("error creating message: %w", err)
 	}
 
+	// Albums keep the order of their photos
+	if err := insertAlbum(tx, messageID, photoURLs); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
+	// Resolve the mentions of group members
+	if err := insertMentions(tx, messageID, conversationID, senderID, content); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
+	if err := recordChange(tx, conversationID, ChangeMessage, messageID); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
 	// Update the conversation's last_message_at field
 	updateQuery := `
 		UPDATE conversations 
@@ -80,32 +160,34 @@ func (db *appdbimpl) CreateMessage(conversationID, senderID string, content *str
 	return db.GetMessage(messageID)
 }
 
-// GetMessage retrieves a message by its ID
+// insertAlbum stores the photos of an album in order. Single photos are stored in the photo_url of the message only.
+func insertAlbum(tx *sql.Tx, messageID string, photoURLs []string) error {
+	if len(photoURLs) < 2 {
+		return nil
+	}
+	for position, photoURL := range photoURLs {
+		if photoURL == "" {
+			return fmt.Errorf("album photo URL cannot be empty")
+		}
+		_, err := tx.Exec(`INSERT INTO message_photos (message_id, position, photo_url) VALUES (?, ?, ?)`,
+			messageID, position, photoURL)
+		if err != nil {
+			return fmt.Errorf("error creating album: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetMessage retrieves a message by its ID. Expired messages are not found.
 func (db *appdbimpl) GetMessage(messageID string) (*Message, error) {
 	// Query message from database by ID with sender username
 	query := `
-		SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, 
-			   m.photo_url, m.reply_to_id, m.forwarded, m.created_at
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.id = ?
+		SELECT ` + messageColumns + `
+		FROM ` + messageTables + `
+		WHERE m.id = ? AND ` + notExpired + `
 	`
 
-	row := db.c.QueryRow(query, messageID)
-
-	var msg Message
-	err := row.Scan(
-		&msg.ID,
-		&msg.ConversationID,
-		&msg.SenderID,
-		&msg.SenderUsername,
-		&msg.Content,
-		&msg.PhotoURL,
-		&msg.ReplyToID,
-		&msg.Forwarded,
-		&msg.CreatedAt,
-	)
-
+	msg, err := scanMessage(db.c.QueryRow(query, messageID, time.Now().UTC()))
 	if err != nil {
 		if isNotFoundError(err) {
 			return nil, fmt.Errorf("message not found")
@@ -113,24 +195,30 @@ func (db *appdbimpl) GetMessage(messageID string) (*Message, error) {
 		return nil, fmt.Errorf("error retrieving message: %w", err)
 	}
 
-	// Set message status (for now, just set as "sent")
-	msg.Status = "sent"
-
-	// Get reactions/comments for this message
-	msg.Comments, err = db.getMessageReactions(msg.ID)
-	if err != nil {
-		return nil, fmt.Errorf("error getting message reactions: %w", err)
+	// Get reactions/comments and mentions for this message
+	if err := db.loadMessageDetails(&msg); err != nil {
+		return nil, err
 	}
 
 	return &msg, nil
 }
 
-// DeleteMessage deletes a message (only by the sender)
+// DeleteMessage deletes a message (only by the sender), with its reactions and mentions
 func (db *appdbimpl) DeleteMessage(messageID, userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify that the user is the sender of the message
 	query := `SELECT sender_id FROM messages WHERE id = ?`
 	var senderID string
-	err := db.c.QueryRow(query, messageID).Scan(&senderID)
+	err = tx.QueryRow(query, messageID).Scan(&senderID)
 	if err != nil {
 		if isNotFoundError(err) {
 			return fmt.Errorf("message not found")
@@ -142,44 +230,54 @@ func (db *appdbimpl) DeleteMessage(messageID, userID string) error {
 		return fmt.Errorf("unauthorized: user can only delete their own messages")
 	}
 
-	// 2. Delete the message from database
-	// Note: Reactions and replies will be handled by cascade DELETE constraints
-	deleteQuery := `DELETE FROM messages WHERE id = ?`
-	result, err := db.c.Exec(deleteQuery, messageID)
+	// 2. Delete the message from database, recording the deletion for syncing clients
+	rowsAffected, err := deleteMessagesWhere(tx, `id = ?`, messageID)
 	if err != nil {
-		return fmt.Errorf("error deleting message: %w", err)
+		return err
 	}
 
 	// 3. Verify deletion was successful
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error checking deletion result: %w", err)
-	}
 	if rowsAffected == 0 {
 		return fmt.Errorf("message not found or already deleted")
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
 
 // ForwardMessage forwards a message to another conversation
 func (db *appdbimpl) ForwardMessage(messageID, targetConversationID, userID string) (*Message, error) {
-	// 1. Verify user has access to source message
-	// This would require checking if the user can access the conversation containing the message
+	// 1. Get original message content/photos/attachment; the copy shares the attachment of the original
+	originalMessage, err := db.GetMessage(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving original message: %w", err)
+	}
 
-	// 2. Verify user can send messages to target conversation
-	isParticipant, err := db.IsUserInConversation(targetConversationID, userID)
+	// 2. Verify user has access to source message: only its participants can read it, and its attachment
+	isParticipant, err := db.IsUserInConversation(originalMessage.ConversationID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error checking conversation participation: %w", err)
 	}
 	if !isParticipant {
-		return nil, fmt.Errorf("user is not a participant in the target conversation")
+		return nil, fmt.Errorf("user is not a participant in the source conversation")
 	}
 
-	// 3. Get original message content/photo
-	originalMessage, err := db.GetMessage(messageID)
+	// 3. Verify user can send messages to target conversation
+	isParticipant, err = db.IsUserInConversation(targetConversationID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving original message: %w", err)
+		return nil, fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if !isParticipant {
+		return nil, fmt.Errorf("user is not a participant in the target conversation")
+	}
+	if originalMessage.System {
+		return nil, fmt.Errorf("cannot forward a system message")
+	}
+	if originalMessage.Poll != nil {
+		return nil, fmt.Errorf("cannot forward a poll")
 	}
 
 	// 4. Create new message in target conversation with forwarded flag
@@ -191,13 +289,26 @@ func (db *appdbimpl) ForwardMessage(messageID, targetConversationID, userID stri
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
 
+	// The forwarded copy follows the timer of the target conversation
+	expiresAt, err := messageExpiry(tx, targetConversationID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
 	// Insert the forwarded message
 	insertQuery := `
-		INSERT INTO messages (id, conversation_id, sender_id, content, photo_url, reply_to_id, forwarded, created_at)
-		VALUES (?, ?, ?, ?, ?, NULL, TRUE, CURRENT_TIMESTAMP)
+		INSERT INTO messages (id, conversation_id, sender_id, content, photo_url, attachment_id, reply_to_id, forwarded, created_at, expires_at, link_url)
+		VALUES (?, ?, ?, ?, ?, ?, NULL, TRUE, CURRENT_TIMESTAMP, ?, ?)
 	`
+	var attachmentID *string
+	if originalMessage.Attachment != nil {
+		attachmentID = &originalMessage.Attachment.ID
+	}
 	_, err = tx.Exec(insertQuery, forwardedMessageID, targetConversationID, userID,
-		originalMessage.Content, originalMessage.PhotoURL)
+		originalMessage.Content, originalMessage.PhotoURL, attachmentID, expiresAt, originalMessage.LinkURL)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return nil, fmt.Errorf("error creating forwarded message: %w (rollback failed: %w)", err, rollbackErr)
@@ -205,6 +316,25 @@ func (db *appdbimpl) ForwardMessage(messageID, targetConversationID, userID stri
 		return nil, fmt.Errorf("error creating forwarded message: %w", err)
 	}
 
+	// The copy shares the photos of an album too
+	_, err = tx.Exec(`
+		INSERT INTO message_photos (message_id, position, photo_url)
+		SELECT ?, position, photo_url FROM message_photos WHERE message_id = ?`,
+		forwardedMessageID, messageID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("error copying album photos: %w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("error copying album photos: %w", err)
+	}
+
+	if err := recordChange(tx, targetConversationID, ChangeMessage, forwardedMessageID); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %w)", err, rollbackErr)
+		}
+		return nil, err
+	}
+
 	// Update the conversation's last_message_at field
 	updateQuery := `
 		UPDATE conversations 
@@ -228,19 +358,17 @@ func (db *appdbimpl) ForwardMessage(messageID, targetConversationID, userID stri
 	return db.GetMessage(forwardedMessageID)
 }
 
-// GetConversationMessages retrieves all messages in a conversation
+// GetConversationMessages retrieves all messages in a conversation, except the expired ones
 func (db *appdbimpl) GetConversationMessages(conversationID string) ([]Message, error) {
 	// Query to get all messages in the conversation with sender usernames
 	query := `
-		SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, 
-			   m.photo_url, m.reply_to_id, m.forwarded, m.created_at
-		FROM messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = ?
+		SELECT ` + messageColumns + `
+		FROM ` + messageTables + `
+		WHERE m.conversation_id = ? AND ` + notExpired + `
 		ORDER BY m.created_at ASC
 	`
 
-	rows, err := db.c.Query(query, conversationID)
+	rows, err := db.c.Query(query, conversationID, time.Now().UTC())
 	if err != nil {
 		return nil, fmt.Errorf("error querying conversation messages: %w", err)
 	}
@@ -248,29 +376,14 @@ func (db *appdbimpl) GetConversationMessages(conversationID string) ([]Message,
 
 	var messages []Message
 	for rows.Next() {
-		var msg Message
-		err := rows.Scan(
-			&msg.ID,
-			&msg.ConversationID,
-			&msg.SenderID,
-			&msg.SenderUsername,
-			&msg.Content,
-			&msg.PhotoURL,
-			&msg.ReplyToID,
-			&msg.Forwarded,
-			&msg.CreatedAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning message: %w", err)
 		}
 
-		// Set message status (for now, just set as "sent" - this would be enhanced with read receipts)
-		msg.Status = "sent"
-
-		// Get reactions/comments for this message
-		msg.Comments, err = db.getMessageReactions(msg.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error getting message reactions: %w", err)
+		// Get reactions/comments and mentions for this message
+		if err := db.loadMessageDetails(&msg); err != nil {
+			return nil, err
 		}
 
 		messages = append(messages, msg)
@@ -283,6 +396,26 @@ func (db *appdbimpl) GetConversationMessages(conversationID string) ([]Message,
 	return messages, nil
 }
 
+// loadMessageDetails loads the reactions and the mentions of a message, and the options of polls
+func (db *appdbimpl) loadMessageDetails(msg *Message) error {
+	var err error
+	if msg.Poll != nil {
+		msg.Poll.Options, err = db.getPollOptions(msg.ID)
+		if err != nil {
+			return fmt.Errorf("error getting poll options: %w", err)
+		}
+	}
+	msg.Comments, err = db.getMessageReactions(msg.ID)
+	if err != nil {
+		return fmt.Errorf("error getting message reactions: %w", err)
+	}
+	msg.Mentions, err = db.getMessageMentions(msg.ID)
+	if err != nil {
+		return fmt.Errorf("error getting message mentions: %w", err)
+	}
+	return nil
+}
+
 // getMessageReactions retrieves all reactions for a specific message
 func (db *appdbimpl) getMessageReactions(messageID string) ([]MessageReaction, error) {
 	query := `
@@ -348,3 +481,53 @@ func (db *appdbimpl) MarkConversationAsRead(conversationID, userID string) error
 
 	return nil
 }
+
+// ForEachConversationMessage calls fn for every message in a conversation, oldest first, without loading the whole
+// conversation in memory. Iteration stops at the first error returned by fn.
+func (db *appdbimpl) ForEachConversationMessage(conversationID string, fn func(Message) error) error {
+	return db.forEachMessage(`m.conversation_id = ?`, conversationID, fn)
+}
+
+// ForEachUserMessage calls fn for every message sent by a user, oldest first. Iteration stops at the first error
+// returned by fn.
+func (db *appdbimpl) ForEachUserMessage(userID string, fn func(Message) error) error {
+	return db.forEachMessage(`m.sender_id = ?`, userID, fn)
+}
+
+// forEachMessage streams the messages matching a single-parameter condition, with their reactions. Expired messages
+// are skipped.
+func (db *appdbimpl) forEachMessage(condition string, arg string, fn func(Message) error) error {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM ` + messageTables + `
+		WHERE ` + condition + ` AND ` + notExpired + `
+		ORDER BY m.created_at ASC
+	`
+
+	rows, err := db.c.Query(query, arg, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning message: %w", err)
+		}
+
+		if err := db.loadMessageDetails(&msg); err != nil {
+			return err
+		}
+
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over messages: %w", err)
+	}
+
+	return nil
+}
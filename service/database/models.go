@@ -8,11 +8,12 @@ type User struct {
 	Username  string    `json:"username" db:"username"`
 	PhotoURL  *string   `json:"photoUrl,omitempty" db:"photo_url"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	IsBot     bool      `json:"isBot" db:"is_bot"` // Account di automazione creato da un utente, si autentica con un token
 }
 
 // UserSession rappresenta una sessione di autenticazione
 type UserSession struct {
-	Token     string    `db:"token"`
+	TokenHash string    `db:"token_hash"` // Hash SHA-256 del token: il token in chiaro non viene mai salvato
 	UserID    string    `db:"user_id"`
 	CreatedAt time.Time `db:"created_at"`
 }
@@ -26,6 +27,7 @@ type Conversation struct {
 	CreatedBy     *string   `json:"createdBy,omitempty" db:"created_by"`
 	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
 	LastMessageAt time.Time `json:"lastMessageAt" db:"last_message_at"`
+	MessageTTL    int64     `json:"messageTtl" db:"message_ttl"` // Durata dei nuovi messaggi in secondi, 0 = non scadono
 
 	// Campi calcolati per l'API (non salvati nel DB)
 	Members          []User    `json:"members,omitempty"`
@@ -38,18 +40,248 @@ type Conversation struct {
 
 // Message rappresenta un messaggio in una conversazione
 type Message struct {
+	ID             string      `json:"id" db:"id"`
+	ConversationID string      `json:"-" db:"conversation_id"`
+	SenderID       string      `json:"senderId" db:"sender_id"`
+	SenderUsername string      `json:"senderUsername"` // Campo joined dalle query
+	Content        *string     `json:"content,omitempty" db:"content"`
+	PhotoURL       *string     `json:"photoUrl,omitempty" db:"photo_url"` // Prima foto, anche per gli album
+	Photos         []string    `json:"photos,omitempty"`                  // Foto degli album in ordine, nil per le foto singole
+	ReplyToID      *string     `json:"replyToId,omitempty" db:"reply_to_id"`
+	Forwarded      bool        `json:"forwarded" db:"forwarded"`
+	System         bool        `json:"system" db:"system"` // Notifica generata dal server (es. cambio del timer)
+	Status         string      `json:"status"`             // "sent", "delivered", "read"
+	CreatedAt      time.Time   `json:"timestamp" db:"created_at"`
+	ExpiresAt      *time.Time  `json:"expiresAt,omitempty" db:"expires_at"` // Nil se il messaggio non scade
+	LinkURL        *string     `json:"-" db:"link_url"`                     // Primo link trovato nel testo
+	Event          *GroupEvent `json:"event,omitempty" db:"event"`          // Evento annunciato dai messaggi di sistema dei gruppi
+	Attachment     *Attachment `json:"attachment,omitempty"`                // File allegato, nil per testi e foto
+	Poll           *Poll       `json:"poll,omitempty"`                      // Sondaggio, nil per gli altri messaggi
+
+	LinkPreview *LinkPreview      `json:"linkPreview,omitempty"` // Nil finché l'anteprima non è disponibile
+	Mentions    []Mention         `json:"mentions,omitempty"`
+	Comments    []MessageReaction `json:"comments,omitempty"`
+}
+
+// Attachment rappresenta un file allegato a un messaggio. Il file è salvato fuori dagli upload pubblici con il nome
+// StorageKey e viene scaricato solo dai partecipanti della conversazione.
+type Attachment struct {
+	ID         string    `json:"id" db:"id"`
+	Filename   string    `json:"filename" db:"filename"`  // Nome del file inviato dall'utente
+	MimeType   string    `json:"mimeType" db:"mime_type"` // Rilevato dal contenuto del file
+	Size       int64     `json:"size" db:"size"`
+	StorageKey string    `json:"-" db:"storage_key"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Poll rappresenta un sondaggio inviato in un gruppo, con i voti ricevuti finora
+type Poll struct {
+	Question       string       `json:"question" db:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multipleChoice" db:"multiple_choice"` // Se falso, ogni utente sceglie una sola opzione
+	Anonymous      bool         `json:"anonymous" db:"anonymous"`            // Se vero, i votanti non sono mostrati agli altri utenti
+	ClosesAt       *time.Time   `json:"closesAt,omitempty" db:"closes_at"`   // Chiusura automatica, nil se assente
+	ClosedAt       *time.Time   `json:"closedAt,omitempty" db:"closed_at"`   // Chiusura da parte del creatore, nil se aperto
+	Closed         bool         `json:"closed"`                              // Calcolato alla lettura da ClosesAt e ClosedAt
+}
+
+// PollOption rappresenta un'opzione di un sondaggio con i suoi votanti, in ordine di voto
+type PollOption struct {
+	Text   string      `json:"text" db:"text"`
+	Voters []PollVoter `json:"voters,omitempty"`
+}
+
+// PollVoter rappresenta il voto di un utente per un'opzione di un sondaggio
+type PollVoter struct {
+	UserID   string    `json:"userId" db:"user_id"`
+	Username string    `json:"username"` // Campo joined dalle query
+	VotedAt  time.Time `json:"votedAt" db:"created_at"`
+}
+
+// Tipi degli eventi di gruppo annunciati con un messaggio di sistema. Le modifiche del timer dei messaggi sono
+// annunciate così anche nelle conversazioni dirette.
+const (
+	GroupEventMemberAdded   = "member_added"
+	GroupEventMemberLeft    = "member_left"
+	GroupEventMemberRemoved = "member_removed"
+	GroupEventRenamed       = "group_renamed"
+	GroupEventTimerChanged  = "timer_changed"
+)
+
+// GroupEvent rappresenta un evento di un gruppo (es. un membro aggiunto), salvato come JSON nel messaggio di sistema
+// che lo annuncia. I nomi degli utenti sono quelli al momento dell'evento.
+type GroupEvent struct {
+	Type           string  `json:"type"`
+	ActorID        string  `json:"actorId"` // Chi ha compiuto l'azione, anche mittente del messaggio
+	ActorUsername  string  `json:"actorUsername"`
+	TargetID       *string `json:"targetId,omitempty"` // Membro aggiunto o rimosso
+	TargetUsername *string `json:"targetUsername,omitempty"`
+	OldName        *string `json:"oldName,omitempty"` // Nomi del gruppo prima e dopo la rinomina
+	NewName        *string `json:"newName,omitempty"`
+	Duration       *int64  `json:"duration,omitempty"` // Nuovo timer dei messaggi in secondi, 0 se disattivato
+}
+
+// Mention rappresenta un membro del gruppo menzionato con @username nel testo di un messaggio. Offset e Length
+// indicano la posizione del token "@username" nel testo, in caratteri.
+type Mention struct {
+	UserID   string `json:"userId" db:"user_id"`
+	Username string `json:"username"` // Nome attuale dell'utente, campo joined dalle query
+	Offset   int    `json:"offset" db:"text_offset"`
+	Length   int    `json:"length" db:"text_length"`
+}
+
+// MentionedMessage rappresenta un messaggio in cui l'utente è menzionato, con la conversazione a cui appartiene
+type MentionedMessage struct {
+	ConversationType string  `json:"conversationType"`
+	ConversationName *string `json:"conversationName,omitempty"`
+	Unread           bool    `json:"unread"` // Inviato dopo l'ultima lettura della conversazione
+	Message          Message `json:"message"`
+}
+
+// StarredMessage rappresenta un messaggio salvato dall'utente, con la conversazione a cui appartiene
+type StarredMessage struct {
+	ConversationType string    `json:"conversationType"`
+	ConversationName *string   `json:"conversationName,omitempty"`
+	StarredAt        time.Time `json:"starredAt"`
+	Message          Message   `json:"message"`
+}
+
+// LinkPreview rappresenta i metadati di una pagina linkata in un messaggio. Le anteprime non disponibili vengono
+// salvate con Failed, per non richiedere di nuovo la pagina a ogni messaggio.
+type LinkPreview struct {
+	URL         string    `json:"url" db:"url"`
+	Title       string    `json:"title" db:"title"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	ImageURL    *string   `json:"imageUrl,omitempty" db:"image_url"`
+	Failed      bool      `json:"-" db:"failed"`
+	FetchedAt   time.Time `json:"fetchedAt" db:"fetched_at"`
+}
+
+// Draft rappresenta il testo non ancora inviato di un utente in una conversazione
+type Draft struct {
+	ConversationID string    `json:"conversationId"`
+	Content        string    `json:"content"`
+	ReplyToID      *string   `json:"replyToId,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// ScheduledMessage rappresenta un messaggio in attesa di essere inviato
+type ScheduledMessage struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversationId"`
+	SenderID       string    `json:"senderId"`
+	Content        *string   `json:"content,omitempty"`  // Testo, o didascalia delle foto
+	PhotoURL       *string   `json:"photoUrl,omitempty"` // Prima foto, anche per gli album
+	Photos         []string  `json:"photos,omitempty"`   // Foto degli album in ordine, nil per le foto singole
+	ReplyToID      *string   `json:"replyToId,omitempty"`
+	SendAt         time.Time `json:"sendAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Webhook rappresenta un URL registrato da un utente per ricevere gli eventi di una conversazione. Se
+// ConversationID è nil, il webhook riceve gli eventi di tutte le conversazioni dirette dell'utente.
+type Webhook struct {
 	ID             string    `json:"id" db:"id"`
-	ConversationID string    `json:"-" db:"conversation_id"`
-	SenderID       string    `json:"senderId" db:"sender_id"`
-	SenderUsername string    `json:"senderUsername"` // Campo joined dalle query
-	Content        *string   `json:"content,omitempty" db:"content"`
-	PhotoURL       *string   `json:"photoUrl,omitempty" db:"photo_url"`
-	ReplyToID      *string   `json:"replyTo,omitempty" db:"reply_to_id"`
-	Forwarded      bool      `json:"forwarded" db:"forwarded"`
-	Status         string    `json:"status"` // "sent", "delivered", "read"
-	CreatedAt      time.Time `json:"timestamp" db:"created_at"`
+	OwnerID        string    `json:"-" db:"owner_id"`
+	ConversationID *string   `json:"conversationId,omitempty" db:"conversation_id"`
+	URL            string    `json:"url" db:"url"`
+	Secret         string    `json:"-" db:"secret"` // Chiave HMAC con cui vengono firmati gli eventi
+	Events         []string  `json:"events" db:"events"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+// WebhookDelivery rappresenta l'invio di un evento a un webhook, con l'esito dell'ultimo tentativo
+type WebhookDelivery struct {
+	ID             string     `json:"id" db:"id"`
+	WebhookID      string     `json:"webhookId" db:"webhook_id"`
+	EventType      string     `json:"event" db:"event_type"`
+	Payload        []byte     `json:"-" db:"payload"`
+	Status         string     `json:"status" db:"status"` // "pending", "delivered", "failed"
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty" db:"next_attempt_at"` // Nil quando l'invio è concluso
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty" db:"last_attempt_at"`
+	LastStatusCode *int       `json:"lastStatusCode,omitempty" db:"last_status_code"`
+	LastError      *string    `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
 
-	Comments []MessageReaction `json:"comments,omitempty"`
+	// Campi joined dal webhook, usati per l'invio
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt rappresenta l'esito di un tentativo di invio di un evento
+type WebhookAttempt struct {
+	Status        string     // Nuovo stato dell'invio
+	At            time.Time  // Momento del tentativo
+	StatusCode    *int       // Nil se non è stata ricevuta una risposta
+	Error         *string    // Nil se l'evento è stato consegnato
+	NextAttemptAt *time.Time // Prossimo tentativo, solo se lo stato resta "pending"
+}
+
+// IdempotencyRecord rappresenta una richiesta inviata con una chiave di idempotenza. StatusCode è nil finché la
+// richiesta è in elaborazione; poi la risposta salvata viene restituita di nuovo ai tentativi successivi.
+type IdempotencyRecord struct {
+	UserID      string    `db:"user_id"`
+	Key         string    `db:"idempotency_key"`
+	RequestHash string    `db:"request_hash"` // Impronta di metodo, percorso e corpo della richiesta
+	StatusCode  *int      `db:"status_code"`
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Change rappresenta una modifica registrata nel change log, con un numero di sequenza crescente
+type Change struct {
+	Seq            int64     `db:"seq"`
+	ConversationID string    `db:"conversation_id"`
+	Kind           string    `db:"kind"`      // "conversation", "message", "message.deleted", "member.joined", "member.left"
+	EntityID       string    `db:"entity_id"` // Conversazione, messaggio o utente a seconda del tipo
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// ChangeSet raccoglie le modifiche visibili a un utente dopo un cursore, in ordine di sequenza
+type ChangeSet struct {
+	Changes []Change
+	Cursor  int64 // Cursore da cui riprendere la sincronizzazione
+	HasMore bool  // True se ci sono altre modifiche dopo il cursore
+}
+
+// TwoFactor rappresenta l'autenticazione a due fattori (TOTP) di un utente. Finché Enabled è false l'attivazione non
+// è stata confermata con un codice e il login non richiede il secondo fattore.
+type TwoFactor struct {
+	UserID            string    `db:"user_id"`
+	Secret            string    `db:"secret"` // Segreto condiviso con l'app di autenticazione, in base32
+	Enabled           bool      `db:"enabled"`
+	LastCounter       int64     `db:"last_counter"` // Ultimo passo temporale usato, i codici precedenti sono rifiutati
+	RecoveryCodesLeft int       // Codici di recupero non ancora usati
+	CreatedAt         time.Time `db:"created_at"`
+}
+
+// LoginChallenge rappresenta un login in attesa del codice del secondo fattore
+type LoginChallenge struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	Attempts  int       `db:"attempts"` // Codici errati inviati finora
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// AccessToken rappresenta un token di accesso personale, usato dagli script al posto di una sessione. Il token non è
+// salvato, solo il suo hash.
+type AccessToken struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	Name       string     `db:"name"`
+	Scopes     []string   `db:"scopes"`     // Permessi concessi al token
+	ExpiresAt  *time.Time `db:"expires_at"` // Nil se il token non scade
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// OIDCLogin rappresenta un login single sign-on in attesa che l'utente torni dal provider di identità
+type OIDCLogin struct {
+	State        string    `db:"state"`         // Valore casuale che lega il ritorno dal provider a questo login
+	Nonce        string    `db:"nonce"`         // Valore atteso nell'ID token
+	CodeVerifier string    `db:"code_verifier"` // Verificatore PKCE del codice di autorizzazione
+	ExpiresAt    time.Time `db:"expires_at"`
 }
 
 // MessagePreview rappresenta un'anteprima di messaggio per la lista conversazioni
@@ -59,6 +291,7 @@ type MessagePreview struct {
 	Timestamp      time.Time `json:"timestamp"`
 	SenderUsername string    `json:"senderUsername"`
 	HasPhoto       bool      `json:"hasPhoto"`
+	AttachmentName *string   `json:"attachmentName,omitempty"` // Nome del file allegato, se presente
 }
 
 // MessageReaction rappresenta una reazione emoji a un messaggio
@@ -90,13 +323,16 @@ type Group struct {
 
 // ConversationPreview rappresenta un'anteprima di conversazione per la lista conversazioni
 type ConversationPreview struct {
-	ID            string          `json:"id"`
-	Type          string          `json:"type"` // "direct" | "group"
-	Name          *string         `json:"name,omitempty"`
-	PhotoURL      *string         `json:"photoUrl,omitempty"`
-	LastMessageAt time.Time       `json:"lastMessageAt"`
-	LastMessage   *MessagePreview `json:"lastMessage,omitempty"`
-	UnreadCount   int             `json:"unreadCount"`
+	ID             string          `json:"id"`
+	Type           string          `json:"type"` // "direct" | "group"
+	Name           *string         `json:"name,omitempty"`
+	PhotoURL       *string         `json:"photoUrl,omitempty"`
+	LastMessageAt  time.Time       `json:"lastMessageAt"`
+	MessageTTL     int64           `json:"messageTtl"`
+	LastMessage    *MessagePreview `json:"lastMessage,omitempty"`
+	Draft          *Draft          `json:"draft,omitempty"` // Bozza dell'utente che richiede la lista
+	UnreadCount    int             `json:"unreadCount"`
+	UnreadMentions int             `json:"unreadMentions"` // Messaggi non letti che menzionano l'utente
 
 	// For direct conversations only
 	OtherParticipant *struct {
@@ -105,3 +341,51 @@ type ConversationPreview struct {
 		PhotoURL *string `json:"photoUrl,omitempty"`
 	} `json:"otherParticipant,omitempty"`
 }
+
+// DatabaseStats rappresenta le statistiche del database per gli strumenti di amministrazione
+type DatabaseStats struct {
+	TableCounts          map[string]int64    `json:"tableCounts"`
+	LargestConversations []ConversationStats `json:"largestConversations"`
+	Media                MediaStats          `json:"media"`
+	CollectedAt          time.Time           `json:"collectedAt"`
+}
+
+// ConversationStats rappresenta la dimensione di una conversazione
+type ConversationStats struct {
+	ID               string  `json:"id"`
+	Type             string  `json:"type"`
+	Name             *string `json:"name,omitempty"`
+	MessageCount     int64   `json:"messageCount"`
+	ParticipantCount int64   `json:"participantCount"`
+}
+
+// MediaStats rappresenta il numero di file multimediali referenziati dal database
+type MediaStats struct {
+	ProfilePhotos int64 `json:"profilePhotos"`
+	GroupPhotos   int64 `json:"groupPhotos"`
+	MessagePhotos int64 `json:"messagePhotos"` // Foto distinte dei messaggi, compresi gli album e le copie inoltrate
+
+	// Attachments e AttachmentBytes sono il numero e la dimensione totale dei file allegati ai messaggi
+	Attachments     int64 `json:"attachments"`
+	AttachmentBytes int64 `json:"attachmentBytes"`
+}
+
+// GroupMembership rappresenta l'appartenenza di un utente a un gruppo
+type GroupMembership struct {
+	GroupID  string    `json:"groupId"`
+	Name     string    `json:"name"`
+	IsOwner  bool      `json:"isOwner"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// DeletedAccount riassume l'esito della cancellazione di un account
+type DeletedAccount struct {
+	UserID               string           `json:"userId"`
+	SessionsRevoked      int64            `json:"sessionsRevoked"`
+	MessagesDeleted      int64            `json:"messagesDeleted"`
+	MessagesAnonymized   int64            `json:"messagesAnonymized"`
+	GroupsHandedOff      int              `json:"groupsHandedOff"`
+	ConversationsDeleted int              `json:"conversationsDeleted"`
+	BotsDeleted          []DeletedAccount `json:"botsDeleted,omitempty"`
+	MediaURLs            []string         `json:"mediaUrls,omitempty"`
+}
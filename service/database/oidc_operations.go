@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === SINGLE SIGN-ON OPERATIONS ===
+
+// CreateOIDCLogin stores a single sign-on login started by a user, until the identity provider sends them back
+func (db *appdbimpl) CreateOIDCLogin(login OIDCLogin) error {
+	_, err := db.c.Exec(`INSERT INTO oidc_logins (state, nonce, code_verifier, expires_at) VALUES (?, ?, ?, ?)`,
+		login.State, login.Nonce, login.CodeVerifier, login.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("error creating OIDC login: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLogin deletes the login with the given state and returns it, if it has not expired at now. A login can
+// be consumed only once, so that the authorization code of the provider cannot be replayed.
+func (db *appdbimpl) ConsumeOIDCLogin(state string, now time.Time) (*OIDCLogin, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	var login OIDCLogin
+	err = tx.QueryRow(`SELECT state, nonce, code_verifier, expires_at FROM oidc_logins WHERE state = ?`, state).
+		Scan(&login.State, &login.Nonce, &login.CodeVerifier, &login.ExpiresAt)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("login not found")
+		}
+		return nil, fmt.Errorf("error retrieving OIDC login: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM oidc_logins WHERE state = ?`, state); err != nil {
+		return nil, fmt.Errorf("error deleting OIDC login: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	if !login.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("login not found")
+	}
+	return &login, nil
+}
+
+// DeleteExpiredOIDCLogins deletes the logins expired at now, returning how many were deleted
+func (db *appdbimpl) DeleteExpiredOIDCLogins(now time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM oidc_logins WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired OIDC logins: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deleted, nil
+}
+
+// GetUserByOIDCIdentity retrieves the user a subject of the identity provider logs in as
+func (db *appdbimpl) GetUserByOIDCIdentity(issuer, subject string) (*User, error) {
+	row := db.c.QueryRow(`
+		SELECT u.id, u.username, u.photo_url, u.created_at, u.is_bot
+		FROM oidc_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ?`, issuer, subject)
+	user, err := scanUser(row)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// CreateOIDCUser creates a new user with the given username for a subject of the identity provider, on its first
+// login. Existing users are never linked to an identity, as owning a username says nothing about who logs in.
+func (db *appdbimpl) CreateOIDCUser(issuer, subject, username string) (*User, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Check that the username and the identity are free
+	var existing string
+	err = tx.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&existing)
+	if err == nil {
+		return nil, fmt.Errorf("username already taken")
+	} else if !isNotFoundError(err) {
+		return nil, fmt.Errorf("error checking username availability: %w", err)
+	}
+	err = tx.QueryRow(`SELECT user_id FROM oidc_identities WHERE issuer = ? AND subject = ?`, issuer, subject).Scan(&existing)
+	if err == nil {
+		return nil, fmt.Errorf("identity already exists")
+	} else if !isNotFoundError(err) {
+		return nil, fmt.Errorf("error checking identity: %w", err)
+	}
+
+	// 2. Create the user and link the identity
+	userID := uuid.Must(uuid.NewV4()).String()
+	createdAt := time.Now().UTC()
+	_, err = tx.Exec(`INSERT INTO users (id, username, photo_url, created_at) VALUES (?, ?, NULL, ?)`, userID, username, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO oidc_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)`,
+		issuer, subject, userID, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("error linking identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return db.GetUserByID(userID)
+}
+
+// HasOIDCIdentity reports whether a user logs in with single sign-on
+func (db *appdbimpl) HasOIDCIdentity(userID string) (bool, error) {
+	var exists bool
+	err := db.c.QueryRow(`SELECT EXISTS (SELECT 1 FROM oidc_identities WHERE user_id = ?)`, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking OIDC identity: %w", err)
+	}
+	return exists, nil
+}
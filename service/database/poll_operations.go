@@ -0,0 +1,292 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === POLL OPERATIONS ===
+
+// CreatePoll sends a poll to a group. The poll is a message without content; its question and options are stored
+// separately, in the given order.
+func (db *appdbimpl) CreatePoll(conversationID, senderID string, poll Poll) (*Message, error) {
+	if poll.Question == "" {
+		return nil, fmt.Errorf("poll question cannot be empty")
+	}
+	if len(poll.Options) < 2 {
+		return nil, fmt.Errorf("poll must have at least two options")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Verify that the sender is a participant of a group
+	var conversationType string
+	err = tx.QueryRow(`
+		SELECT c.type
+		FROM conversations c
+		JOIN conversation_participants cp ON c.id = cp.conversation_id
+		WHERE c.id = ? AND cp.user_id = ?`, conversationID, senderID).Scan(&conversationType)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("user is not a participant in this conversation")
+		}
+		return nil, fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if conversationType != "group" {
+		return nil, fmt.Errorf("polls can only be sent to groups")
+	}
+
+	// 2. Insert the message; like any other message, it expires if the conversation has a timer
+	expiresAt, err := messageExpiry(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messageID := uuid.Must(uuid.NewV4()).String()
+	_, err = tx.Exec(`
+		INSERT INTO messages (id, conversation_id, sender_id, forwarded, created_at, expires_at)
+		VALUES (?, ?, ?, FALSE, CURRENT_TIMESTAMP, ?)`, messageID, conversationID, senderID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating message: %w", err)
+	}
+
+	// 3. Insert the poll and its options
+	var closesAt interface{}
+	if poll.ClosesAt != nil {
+		closesAt = poll.ClosesAt.UTC()
+	}
+	_, err = tx.Exec(`
+		INSERT INTO polls (message_id, question, multiple_choice, anonymous, closes_at)
+		VALUES (?, ?, ?, ?, ?)`, messageID, poll.Question, poll.MultipleChoice, poll.Anonymous, closesAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating poll: %w", err)
+	}
+	for position, option := range poll.Options {
+		_, err := tx.Exec(`INSERT INTO poll_options (message_id, position, text) VALUES (?, ?, ?)`,
+			messageID, position, option.Text)
+		if err != nil {
+			return nil, fmt.Errorf("error creating poll option: %w", err)
+		}
+	}
+
+	// 4. Update the conversation and record the change for syncing clients
+	if _, err := tx.Exec(`UPDATE conversations SET last_message_at = CURRENT_TIMESTAMP WHERE id = ?`, conversationID); err != nil {
+		return nil, fmt.Errorf("error updating conversation last_message_at: %w", err)
+	}
+	if err := recordChange(tx, conversationID, ChangeMessage, messageID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.GetMessage(messageID)
+}
+
+// VotePoll sets the options chosen by a user in a poll, given by their index, replacing the previous vote. Polls with
+// a single choice take exactly one option.
+func (db *appdbimpl) VotePoll(messageID, userID string, options []int) (*Message, error) {
+	message, err := db.openPoll(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Validate the chosen options
+	if len(options) == 0 {
+		return nil, fmt.Errorf("invalid vote: must choose at least one option")
+	}
+	if !message.Poll.MultipleChoice && len(options) > 1 {
+		return nil, fmt.Errorf("invalid vote: poll allows a single option")
+	}
+	chosen := make(map[int]bool, len(options))
+	for _, option := range options {
+		if option < 0 || option >= len(message.Poll.Options) {
+			return nil, fmt.Errorf("invalid vote: poll option %d does not exist", option)
+		}
+		if chosen[option] {
+			return nil, fmt.Errorf("invalid vote: poll option %d chosen more than once", option)
+		}
+		chosen[option] = true
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 2. Replace the previous vote of the user, if any
+	if _, err := tx.Exec(`DELETE FROM poll_votes WHERE message_id = ? AND user_id = ?`, messageID, userID); err != nil {
+		return nil, fmt.Errorf("error removing previous vote: %w", err)
+	}
+	for _, option := range options {
+		_, err := tx.Exec(`
+			INSERT INTO poll_votes (message_id, position, user_id, created_at)
+			VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, messageID, option, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error recording vote: %w", err)
+		}
+	}
+
+	if err := recordChange(tx, message.ConversationID, ChangeMessage, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.GetMessage(messageID)
+}
+
+// RetractPollVote removes the vote of a user from an open poll
+func (db *appdbimpl) RetractPollVote(messageID, userID string) (*Message, error) {
+	message, err := db.openPoll(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM poll_votes WHERE message_id = ? AND user_id = ?`, messageID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error removing vote: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error checking delete result: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("vote not found")
+	}
+
+	if err := recordChange(tx, message.ConversationID, ChangeMessage, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.GetMessage(messageID)
+}
+
+// ClosePoll closes a poll before its closing time (only by its creator). Votes can no longer be changed.
+func (db *appdbimpl) ClosePoll(messageID, userID string) (*Message, error) {
+	message, err := db.openPoll(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID {
+		return nil, fmt.Errorf("user not authorized to close this poll")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	if _, err := tx.Exec(`UPDATE polls SET closed_at = CURRENT_TIMESTAMP WHERE message_id = ?`, messageID); err != nil {
+		return nil, fmt.Errorf("error closing poll: %w", err)
+	}
+	if err := recordChange(tx, message.ConversationID, ChangeMessage, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.GetMessage(messageID)
+}
+
+// openPoll retrieves a poll message that a user can still vote in: the user must be a participant of its group and
+// the poll must not be closed.
+func (db *appdbimpl) openPoll(messageID, userID string) (*Message, error) {
+	message, err := db.GetMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	isParticipant, err := db.IsUserInConversation(message.ConversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if !isParticipant {
+		return nil, fmt.Errorf("user not authorized to access this poll")
+	}
+	if message.Poll == nil {
+		return nil, fmt.Errorf("message is not a poll")
+	}
+	if message.Poll.Closed {
+		return nil, fmt.Errorf("poll is closed")
+	}
+	return message, nil
+}
+
+// getPollOptions retrieves the options of a poll in order, each with its voters in the order they voted
+func (db *appdbimpl) getPollOptions(messageID string) ([]PollOption, error) {
+	rows, err := db.c.Query(`
+		SELECT po.position, po.text, pv.user_id, u.username, pv.created_at
+		FROM poll_options po
+		LEFT JOIN poll_votes pv ON pv.message_id = po.message_id AND pv.position = po.position
+		LEFT JOIN users u ON pv.user_id = u.id
+		WHERE po.message_id = ?
+		ORDER BY po.position ASC, pv.created_at ASC, pv.rowid ASC`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying poll options: %w", err)
+	}
+	defer rows.Close()
+
+	var options []PollOption
+	for rows.Next() {
+		var position int
+		var text string
+		var voterID, voterUsername *string
+		var votedAt *time.Time
+		if err := rows.Scan(&position, &text, &voterID, &voterUsername, &votedAt); err != nil {
+			return nil, fmt.Errorf("error scanning poll option: %w", err)
+		}
+		if position >= len(options) {
+			options = append(options, PollOption{Text: text})
+		}
+		if voterID != nil && voterUsername != nil && votedAt != nil {
+			options[position].Voters = append(options[position].Voters, PollVoter{
+				UserID:   *voterID,
+				Username: *voterUsername,
+				VotedAt:  *votedAt,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over poll options: %w", err)
+	}
+
+	return options, nil
+}
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/gofrs/uuid"
 )
@@ -24,38 +27,56 @@ func (db *appdbimpl) CreateMessageReaction(messageID, userID, emoticon string) (
 	if !isParticipant {
 		return nil, fmt.Errorf("user not authorized to react to this message")
 	}
+	if message.System {
+		return nil, fmt.Errorf("cannot react to a system message")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
 
 	// 2. Check if user already reacted to this message (UPSERT behavior)
 	checkQuery := `SELECT id FROM message_reactions WHERE message_id = ? AND user_id = ?`
-	var existingID string
-	err = db.c.QueryRow(checkQuery, messageID, userID).Scan(&existingID)
+	var reactionID string
+	err = tx.QueryRow(checkQuery, messageID, userID).Scan(&reactionID)
 
 	if err == nil {
 		// Update existing reaction
 		updateQuery := `UPDATE message_reactions SET emoticon = ? WHERE id = ?`
-		_, err = db.c.Exec(updateQuery, emoticon, existingID)
+		_, err = tx.Exec(updateQuery, emoticon, reactionID)
 		if err != nil {
 			return nil, fmt.Errorf("error updating reaction: %w", err)
 		}
-
-		// Return updated reaction
-		return db.getMessageReactionByID(existingID)
 	} else if !isNotFoundError(err) {
 		return nil, fmt.Errorf("error checking existing reaction: %w", err)
+	} else {
+		// 3. Create new reaction
+		reactionID = uuid.Must(uuid.NewV4()).String()
+		insertQuery := `
+			INSERT INTO message_reactions (id, message_id, user_id, emoticon, created_at)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`
+		_, err = tx.Exec(insertQuery, reactionID, messageID, userID, emoticon)
+		if err != nil {
+			return nil, fmt.Errorf("error creating reaction: %w", err)
+		}
 	}
 
-	// 3. Create new reaction
-	reactionID := uuid.Must(uuid.NewV4()).String()
-	insertQuery := `
-		INSERT INTO message_reactions (id, message_id, user_id, emoticon, created_at)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`
-	_, err = db.c.Exec(insertQuery, reactionID, messageID, userID, emoticon)
-	if err != nil {
-		return nil, fmt.Errorf("error creating reaction: %w", err)
+	// The message changed for syncing clients
+	if err := recordChange(tx, message.ConversationID, ChangeMessage, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
 
-	// 4. Return created reaction with username
+	// 4. Return created or updated reaction with username
 	return db.getMessageReactionByID(reactionID)
 }
 
@@ -91,10 +112,24 @@ func (db *appdbimpl) getMessageReactionByID(reactionID string) (*MessageReaction
 
 // DeleteMessageReaction deletes a reaction (only by the user who created it)
 func (db *appdbimpl) DeleteMessageReaction(reactionID, userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
 	// 1. Verify that the user owns the reaction
-	checkQuery := `SELECT user_id FROM message_reactions WHERE id = ?`
-	var ownerID string
-	err := db.c.QueryRow(checkQuery, reactionID).Scan(&ownerID)
+	checkQuery := `
+		SELECT mr.user_id, m.id, m.conversation_id
+		FROM message_reactions mr
+		JOIN messages m ON mr.message_id = m.id
+		WHERE mr.id = ?`
+	var ownerID, messageID, conversationID string
+	err = tx.QueryRow(checkQuery, reactionID).Scan(&ownerID, &messageID, &conversationID)
 	if err != nil {
 		if isNotFoundError(err) {
 			return fmt.Errorf("reaction not found")
@@ -108,7 +143,7 @@ func (db *appdbimpl) DeleteMessageReaction(reactionID, userID string) error {
 
 	// 2. Delete the reaction from database
 	deleteQuery := `DELETE FROM message_reactions WHERE id = ?`
-	result, err := db.c.Exec(deleteQuery, reactionID)
+	result, err := tx.Exec(deleteQuery, reactionID)
 	if err != nil {
 		return fmt.Errorf("error deleting reaction: %w", err)
 	}
@@ -122,5 +157,13 @@ func (db *appdbimpl) DeleteMessageReaction(reactionID, userID string) error {
 		return fmt.Errorf("reaction not found or already deleted")
 	}
 
+	// 4. The message changed for syncing clients
+	if err := recordChange(tx, conversationID, ChangeMessage, messageID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === SCHEDULED MESSAGE OPERATIONS ===
+
+// scheduledMessageColumns is the column list shared by the scheduled message queries, in scanScheduledMessage order
+const scheduledMessageColumns = `id, conversation_id, sender_id, content, photo_url, reply_to_id, send_at, created_at,
+	(SELECT GROUP_CONCAT(sp.photo_url, ' ' ORDER BY sp.position) FROM scheduled_message_photos sp
+		WHERE sp.scheduled_message_id = scheduled_messages.id)`
+
+// CreateScheduledMessage stores a message to be sent to a conversation at sendAt: a text, or one or more photos with
+// an optional caption, as in CreateMessage. The same checks of CreateMessage are applied now, so that mistakes are
+// reported to the sender instead of being found at delivery time.
+func (db *appdbimpl) CreateScheduledMessage(conversationID, senderID string, content *string, photoURLs []string, replyToID *string, sendAt time.Time) (*ScheduledMessage, error) {
+	// 1. Validate that sender is a participant in the conversation
+	isParticipant, err := db.IsUserInConversation(conversationID, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if !isParticipant {
+		return nil, fmt.Errorf("user is not a participant in this conversation")
+	}
+
+	// 2. Validate that content or photos are provided; photos can have a caption
+	if content == nil && len(photoURLs) == 0 {
+		return nil, fmt.Errorf("must provide content or photos")
+	}
+	var photoURL *string
+	if len(photoURLs) > 0 {
+		photoURL = &photoURLs[0]
+	}
+
+	// 3. If replyToID is provided, validate that the message exists in the same conversation
+	if replyToID != nil && *replyToID != "" {
+		replyMessage, err := db.GetMessage(*replyToID)
+		if err != nil {
+			return nil, fmt.Errorf("reply target message not found: %w", err)
+		}
+		if replyMessage.ConversationID != conversationID {
+			return nil, fmt.Errorf("cannot reply to message from different conversation")
+		}
+		if replyMessage.System {
+			return nil, fmt.Errorf("cannot reply to a system message")
+		}
+	}
+
+	// 4. Insert the scheduled message with its album, if any
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	scheduledID := uuid.Must(uuid.NewV4()).String()
+	query := `
+		INSERT INTO scheduled_messages (id, conversation_id, sender_id, content, photo_url, reply_to_id, send_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(query, scheduledID, conversationID, senderID, content, photoURL, replyToID, sendAt.UTC(), time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error creating scheduled message: %w", err)
+	}
+	if err := insertScheduledAlbum(tx, scheduledID, photoURLs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.getScheduledMessage(scheduledID, senderID)
+}
+
+// insertScheduledAlbum stores the photos of a scheduled album in order, as insertAlbum does for messages
+func insertScheduledAlbum(tx *sql.Tx, scheduledID string, photoURLs []string) error {
+	if len(photoURLs) < 2 {
+		return nil
+	}
+	for position, photoURL := range photoURLs {
+		if photoURL == "" {
+			return fmt.Errorf("album photo URL cannot be empty")
+		}
+		_, err := tx.Exec(`INSERT INTO scheduled_message_photos (scheduled_message_id, position, photo_url) VALUES (?, ?, ?)`,
+			scheduledID, position, photoURL)
+		if err != nil {
+			return fmt.Errorf("error creating scheduled album: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetUserScheduledMessages retrieves the pending messages of a user, the next to be sent first
+func (db *appdbimpl) GetUserScheduledMessages(userID string) ([]ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages WHERE sender_id = ? ORDER BY send_at ASC, created_at ASC`
+	rows, err := db.c.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying scheduled messages: %w", err)
+	}
+	return scanScheduledMessages(rows)
+}
+
+// GetDueScheduledMessages retrieves up to limit scheduled messages whose sending time is not after now, oldest first
+func (db *appdbimpl) GetDueScheduledMessages(now time.Time, limit int) ([]ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages WHERE send_at <= ? ORDER BY send_at ASC, created_at ASC LIMIT ?`
+	rows, err := db.c.Query(query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due scheduled messages: %w", err)
+	}
+	return scanScheduledMessages(rows)
+}
+
+// UpdateScheduledMessage changes the text and/or the sending time of a pending message of the user. Nil values are
+// left unchanged; the text of photo messages, their caption, cannot be set.
+func (db *appdbimpl) UpdateScheduledMessage(scheduledID, userID string, content *string, sendAt *time.Time) (*ScheduledMessage, error) {
+	// 1. Verify that the scheduled message exists and belongs to the user
+	scheduled, err := db.getScheduledMessage(scheduledID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Only text messages can change their content
+	if content != nil {
+		if scheduled.PhotoURL != nil {
+			return nil, fmt.Errorf("cannot set the content of a photo message")
+		}
+		scheduled.Content = content
+	}
+	if sendAt != nil {
+		scheduled.SendAt = sendAt.UTC()
+	}
+
+	// 3. Save the changes
+	query := `UPDATE scheduled_messages SET content = ?, send_at = ? WHERE id = ? AND sender_id = ?`
+	result, err := db.c.Exec(query, scheduled.Content, scheduled.SendAt.UTC(), scheduledID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating scheduled message: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error checking update result: %w", err)
+	}
+	if rowsAffected == 0 {
+		// Delivered or cancelled in the meantime
+		return nil, fmt.Errorf("scheduled message not found")
+	}
+
+	return db.getScheduledMessage(scheduledID, userID)
+}
+
+// DeleteScheduledMessage removes a pending message of the user, returning it so that its photos can be cleaned up
+func (db *appdbimpl) DeleteScheduledMessage(scheduledID, userID string) (*ScheduledMessage, error) {
+	scheduled, err := db.getScheduledMessage(scheduledID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM scheduled_messages WHERE id = ? AND sender_id = ?`, scheduledID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting scheduled message: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error checking deletion result: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("scheduled message not found")
+	}
+	if _, err := tx.Exec(`DELETE FROM scheduled_message_photos WHERE scheduled_message_id = ?`, scheduledID); err != nil {
+		return nil, fmt.Errorf("error deleting scheduled album: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return scheduled, nil
+}
+
+// DeliverScheduledMessage sends a due scheduled message through CreateMessage, replying to replyToID, and removes it
+// from the queue in the same transaction, so that it is sent exactly once. If the scheduled message was cancelled or
+// changed since it was retrieved, nothing is sent and "scheduled message not found" is returned.
+func (db *appdbimpl) DeliverScheduledMessage(scheduled ScheduledMessage, replyToID *string) (*Message, error) {
+	photoURLs := scheduled.Photos
+	if photoURLs == nil && scheduled.PhotoURL != nil {
+		photoURLs = []string{*scheduled.PhotoURL}
+	}
+
+	return db.createMessage(scheduled.ConversationID, scheduled.SenderID, scheduled.Content, photoURLs, nil, replyToID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM scheduled_messages WHERE id = ? AND send_at = ? AND content IS ?`,
+			scheduled.ID, scheduled.SendAt.UTC(), scheduled.Content)
+		if err != nil {
+			return fmt.Errorf("error claiming scheduled message: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error checking claim result: %w", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("scheduled message not found")
+		}
+		if _, err := tx.Exec(`DELETE FROM scheduled_message_photos WHERE scheduled_message_id = ?`, scheduled.ID); err != nil {
+			return fmt.Errorf("error claiming scheduled album: %w", err)
+		}
+		return nil
+	})
+}
+
+// getScheduledMessage retrieves a scheduled message of a user. Messages scheduled by other users are not found.
+func (db *appdbimpl) getScheduledMessage(scheduledID, userID string) (*ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages WHERE id = ? AND sender_id = ?`
+
+	scheduled, err := scanScheduledMessage(db.c.QueryRow(query, scheduledID, userID))
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("scheduled message not found")
+		}
+		return nil, fmt.Errorf("error retrieving scheduled message: %w", err)
+	}
+
+	return &scheduled, nil
+}
+
+// scanScheduledMessage converts a row selected with scheduledMessageColumns into a ScheduledMessage
+func scanScheduledMessage(row rowScanner) (ScheduledMessage, error) {
+	var scheduled ScheduledMessage
+	var album *string
+	err := row.Scan(
+		&scheduled.ID,
+		&scheduled.ConversationID,
+		&scheduled.SenderID,
+		&scheduled.Content,
+		&scheduled.PhotoURL,
+		&scheduled.ReplyToID,
+		&scheduled.SendAt,
+		&scheduled.CreatedAt,
+		&album,
+	)
+	if err != nil {
+		return ScheduledMessage{}, err
+	}
+
+	// The photos of albums are named by the server, their URLs contain no spaces
+	if album != nil {
+		scheduled.Photos = strings.Fields(*album)
+	}
+	return scheduled, nil
+}
+
+// scanScheduledMessages converts rows selected with scheduledMessageColumns into ScheduledMessage structs
+func scanScheduledMessages(rows *sql.Rows) ([]ScheduledMessage, error) {
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		scheduled, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning scheduled message: %w", err)
+		}
+		messages = append(messages, scheduled)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over scheduled messages: %w", err)
+	}
+
+	return messages, nil
+}
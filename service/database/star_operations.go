@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// === STARRED MESSAGE OPERATIONS ===
+
+// StarMessage bookmarks a message for a user, who must be a participant of its conversation. Starring a message
+// twice has no effect.
+func (db *appdbimpl) StarMessage(messageID, userID string) error {
+	// 1. Verify message exists and user has access to it
+	message, err := db.GetMessage(messageID)
+	if err != nil {
+		return err
+	}
+	isParticipant, err := db.IsUserInConversation(message.ConversationID, userID)
+	if err != nil {
+		return fmt.Errorf("error checking conversation participation: %w", err)
+	}
+	if !isParticipant {
+		return fmt.Errorf("user not authorized to star this message")
+	}
+
+	// 2. Keep the time of the first star, which orders the starred messages
+	_, err = db.c.Exec(`
+		INSERT OR IGNORE INTO starred_messages (user_id, message_id, created_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)`, userID, messageID)
+	if err != nil {
+		return fmt.Errorf("error starring message: %w", err)
+	}
+	return nil
+}
+
+// UnstarMessage removes the bookmark of a user from a message. Unstarring a message that is not starred has no
+// effect.
+func (db *appdbimpl) UnstarMessage(messageID, userID string) error {
+	if _, err := db.c.Exec(`DELETE FROM starred_messages WHERE user_id = ? AND message_id = ?`, userID, messageID); err != nil {
+		return fmt.Errorf("error unstarring message: %w", err)
+	}
+	return nil
+}
+
+// GetStarredMessages retrieves up to limit messages starred by a user, most recently starred first. If beforeID is
+// not empty, only the messages starred before that message are returned, to read the next page. Direct
+// conversations are named after the other participant. Expired messages are not returned.
+func (db *appdbimpl) GetStarredMessages(userID, beforeID string, limit int) ([]StarredMessage, error) {
+	// Messages starred in the same second are ordered by insertion
+	cursor := `TRUE`
+	args := []interface{}{userID, userID, userID}
+	if beforeID != "" {
+		var exists bool
+		err := db.c.QueryRow(`SELECT EXISTS (SELECT 1 FROM starred_messages WHERE user_id = ? AND message_id = ?)`,
+			userID, beforeID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("error checking cursor message: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("cursor message not found")
+		}
+		cursor = `(s.created_at, s.rowid) < (SELECT created_at, rowid FROM starred_messages WHERE user_id = ? AND message_id = ?)`
+		args = append(args, userID, beforeID)
+	}
+	args = append(args, time.Now().UTC(), limit)
+
+	query := `
+		SELECT ` + messageColumns + `, c.type, COALESCE(c.name, (
+				SELECT ou.username FROM conversation_participants ocp
+				JOIN users ou ON ocp.user_id = ou.id
+				WHERE ocp.conversation_id = c.id AND ocp.user_id != ?
+				LIMIT 1)), s.created_at
+		FROM ` + messageTables + `
+		JOIN starred_messages s ON s.message_id = m.id AND s.user_id = ?
+		JOIN conversations c ON m.conversation_id = c.id
+		JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?
+		WHERE ` + cursor + ` AND ` + notExpired + `
+		ORDER BY s.created_at DESC, s.rowid DESC
+		LIMIT ?
+	`
+
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying starred messages: %w", err)
+	}
+	defer rows.Close()
+
+	var starred []StarredMessage
+	for rows.Next() {
+		var item StarredMessage
+		item.Message, err = scanMessage(withColumns(rows, &item.ConversationType, &item.ConversationName, &item.StarredAt))
+		if err != nil {
+			return nil, fmt.Errorf("error scanning starred message: %w", err)
+		}
+		starred = append(starred, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over starred messages: %w", err)
+	}
+	rows.Close()
+
+	// Load reactions and mentions once the rows are closed
+	for i := range starred {
+		if err := db.loadMessageDetails(&starred[i].Message); err != nil {
+			return nil, err
+		}
+	}
+
+	return starred, nil
+}
+
+// deleteStars removes the stars of a user from the messages of a conversation, once the user is no longer a
+// participant
+func deleteStars(tx *sql.Tx, conversationID, userID string) error {
+	_, err := tx.Exec(`
+		DELETE FROM starred_messages
+		WHERE user_id = ? AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)`, userID, conversationID)
+	if err != nil {
+		return fmt.Errorf("error deleting starred messages: %w", err)
+	}
+	return nil
+}
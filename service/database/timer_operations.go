@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// === DISAPPEARING MESSAGE OPERATIONS ===
+
+// SetMessageTimer sets how long new messages of a conversation last, in seconds (0 turns the timer off). The change
+// is announced in the conversation with a system message carrying a timer_changed event, which is returned; nil is
+// returned if the timer was already set to ttl.
+func (db *appdbimpl) SetMessageTimer(conversationID, userID string, ttl int64) (*Message, error) {
+	if ttl < 0 {
+		return nil, fmt.Errorf("message timer cannot be negative")
+	}
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Verify that the user is a participant and read the current timer
+	var current int64
+	err = tx.QueryRow(`
+		SELECT c.message_ttl
+		FROM conversations c
+		JOIN conversation_participants cp ON c.id = cp.conversation_id
+		WHERE c.id = ? AND cp.user_id = ?`, conversationID, userID).Scan(&current)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("user is not a participant in this conversation")
+		}
+		return nil, fmt.Errorf("error retrieving message timer: %w", err)
+	}
+	if current == ttl {
+		return nil, nil
+	}
+
+	// 2. Update the timer: it applies to messages sent from now on
+	if _, err := tx.Exec(`UPDATE conversations SET message_ttl = ? WHERE id = ?`, ttl, conversationID); err != nil {
+		return nil, fmt.Errorf("error updating message timer: %w", err)
+	}
+
+	// 3. Announce the change in the conversation; the announcement itself does not expire
+	messageID, err := insertGroupEvent(tx, conversationID, GroupEvent{Type: GroupEventTimerChanged, ActorID: userID, Duration: &ttl})
+	if err != nil {
+		return nil, err
+	}
+	if err := recordChange(tx, conversationID, ChangeConversation, conversationID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return db.GetMessage(messageID)
+}
+
+// DeleteExpiredMessages deletes up to limit messages that expired at now, with their reactions. It returns the number
+// of deleted messages and the photos that are no longer referenced by any message and can be removed.
+func (db *appdbimpl) DeleteExpiredMessages(now time.Time, limit int) (int64, []string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// The batch is selected again by each statement: nothing changes expires_at inside the transaction
+	condition := `id IN (SELECT id FROM messages WHERE expires_at <= ? ORDER BY expires_at ASC, id ASC LIMIT ` +
+		strconv.Itoa(limit) + `)`
+
+	urls, err := queryStrings(tx, `
+		SELECT photo_url FROM messages WHERE `+condition+` AND photo_url IS NOT NULL
+		UNION
+		SELECT photo_url FROM message_photos WHERE message_id IN (SELECT id FROM messages WHERE `+condition+`)`,
+		now.UTC(), now.UTC())
+	if err != nil {
+		return 0, nil, fmt.Errorf("error retrieving expired message photos: %w", err)
+	}
+
+	deleted, err := deleteMessagesWhere(tx, condition, now.UTC())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Forwarded copies share the photo of the original message
+	urls, err = unreferencedMedia(tx, urls)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return deleted, urls, nil
+}
+
+// messageExpiry returns the expiration time of a message sent now to a conversation, nil if the conversation has no
+// timer
+func messageExpiry(tx *sql.Tx, conversationID string) (*time.Time, error) {
+	var ttl int64
+	err := tx.QueryRow(`SELECT message_ttl FROM conversations WHERE id = ?`, conversationID).Scan(&ttl)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("conversation not found")
+		}
+		return nil, fmt.Errorf("error retrieving message timer: %w", err)
+	}
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	expiresAt := time.Now().UTC().Add(time.Duration(ttl) * time.Second)
+	return &expiresAt, nil
+}
+
+// unreferencedMedia filters the photo URLs that are not used by any message or scheduled message
+func unreferencedMedia(tx *sql.Tx, urls []string) ([]string, error) {
+	var unreferenced []string
+	for _, url := range urls {
+		var references int
+		err := tx.QueryRow(`
+			SELECT (SELECT COUNT(*) FROM messages WHERE photo_url = ?) +
+				(SELECT COUNT(*) FROM message_photos WHERE photo_url = ?) +
+				(SELECT COUNT(*) FROM scheduled_messages WHERE photo_url = ?) +
+				(SELECT COUNT(*) FROM scheduled_message_photos WHERE photo_url = ?)`, url, url, url, url).Scan(&references)
+		if err != nil {
+			return nil, fmt.Errorf("error counting media references: %w", err)
+		}
+		if references == 0 {
+			unreferenced = append(unreferenced, url)
+		}
+	}
+	return unreferenced, nil
+}
+
+// describeMessageTTL formats a message timer for system messages, e.g. "24 hours" or "7 days"
+func describeMessageTTL(ttl int64) string {
+	units := []struct {
+		seconds int64
+		name    string
+	}{
+		{86400, "day"},
+		{3600, "hour"},
+		{60, "minute"},
+		{1, "second"},
+	}
+	for _, unit := range units {
+		// A single day reads better as 24 hours
+		if ttl%unit.seconds != 0 || (unit.seconds == 86400 && ttl == 86400) {
+			continue
+		}
+		n := ttl / unit.seconds
+		if n == 1 {
+			return "1 " + unit.name
+		}
+		return strconv.FormatInt(n, 10) + " " + unit.name + "s"
+	}
+	return strconv.FormatInt(ttl, 10) + " seconds"
+}
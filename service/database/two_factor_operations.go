@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === TWO-FACTOR AUTHENTICATION OPERATIONS ===
+
+// StartTwoFactorEnrollment stores a new TOTP secret for a user, not enabled until EnableTwoFactor confirms it. A
+// previous enrollment that was never confirmed is replaced.
+func (db *appdbimpl) StartTwoFactorEnrollment(userID, secret string) error {
+	result, err := db.c.Exec(`
+		INSERT INTO two_factor (user_id, secret, enabled, last_counter, created_at)
+		VALUES (?, ?, FALSE, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at
+		WHERE NOT two_factor.enabled`, userID, secret, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error storing two-factor secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking enrollment outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("two-factor already enabled")
+	}
+	return nil
+}
+
+// GetTwoFactor retrieves the two-factor settings of a user, with the number of recovery codes left
+func (db *appdbimpl) GetTwoFactor(userID string) (*TwoFactor, error) {
+	var tf TwoFactor
+	err := db.c.QueryRow(`
+		SELECT user_id, secret, enabled, last_counter, created_at,
+			(SELECT COUNT(*) FROM recovery_codes WHERE user_id = two_factor.user_id AND used_at IS NULL)
+		FROM two_factor
+		WHERE user_id = ?`, userID).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastCounter, &tf.CreatedAt, &tf.RecoveryCodesLeft)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("two-factor not found")
+		}
+		return nil, fmt.Errorf("error retrieving two-factor settings: %w", err)
+	}
+	return &tf, nil
+}
+
+// EnableTwoFactor enables a pending enrollment, confirmed by the code of the given time step, and replaces the
+// recovery codes of the user. Every session except keepToken is revoked, as it was not opened with the second factor.
+func (db *appdbimpl) EnableTwoFactor(userID string, counter int64, recoveryCodeHashes []string, keepToken string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Enable the pending enrollment
+	result, err := tx.Exec(`UPDATE two_factor SET enabled = TRUE, last_counter = ? WHERE user_id = ? AND NOT enabled`, counter, userID)
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking update outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("two-factor enrollment not found")
+	}
+
+	// 2. Replace the recovery codes
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return fmt.Errorf("error storing recovery code: %w", err)
+		}
+	}
+
+	// 3. Revoke the other sessions
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = ? AND token_hash != ?`, userID, hashToken(keepToken)); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableTwoFactor removes the two-factor settings and the recovery codes of a user, with the pending login challenges
+func (db *appdbimpl) DisableTwoFactor(userID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("two-factor not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("error deleting login challenges: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// UseTwoFactorCounter records the time step of a valid TOTP code. It returns false if a code of the same or a later
+// step was already used, so that codes cannot be replayed.
+func (db *appdbimpl) UseTwoFactorCounter(userID string, counter int64) (bool, error) {
+	result, err := db.c.Exec(`UPDATE two_factor SET last_counter = ? WHERE user_id = ? AND enabled AND last_counter < ?`,
+		counter, userID, counter)
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking update outcome: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// UseRecoveryCode marks the recovery code with the given hash as used. It returns false if the user has no such code
+// or it was already used.
+func (db *appdbimpl) UseRecoveryCode(userID, codeHash string, now time.Time) (bool, error) {
+	result, err := db.c.Exec(`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		now.UTC(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking update outcome: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// CreateLoginChallenge creates a challenge for a user who logged in with two-factor authentication enabled. The
+// challenge is exchanged for a session with CompleteLoginChallenge once a valid code is sent.
+func (db *appdbimpl) CreateLoginChallenge(userID string, expiresAt time.Time) (*LoginChallenge, error) {
+	challenge := LoginChallenge{
+		ID:        uuid.Must(uuid.NewV4()).String(),
+		UserID:    userID,
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	_, err := db.c.Exec(`
+		INSERT INTO login_challenges (id, user_id, attempts, expires_at, created_at)
+		VALUES (?, ?, 0, ?, ?)`, challenge.ID, challenge.UserID, challenge.ExpiresAt, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error creating login challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// GetLoginChallenge retrieves a login challenge that has not expired at now
+func (db *appdbimpl) GetLoginChallenge(challengeID string, now time.Time) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	err := db.c.QueryRow(`
+		SELECT id, user_id, attempts, expires_at
+		FROM login_challenges
+		WHERE id = ? AND expires_at > ?`, challengeID, now.UTC()).Scan(&challenge.ID, &challenge.UserID, &challenge.Attempts, &challenge.ExpiresAt)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, fmt.Errorf("challenge not found")
+		}
+		return nil, fmt.Errorf("error retrieving login challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// FailLoginChallenge counts a wrong code sent for a login challenge, deleting the challenge after maxAttempts wrong
+// codes so that codes cannot be guessed
+func (db *appdbimpl) FailLoginChallenge(challengeID string, maxAttempts int) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	if _, err := tx.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?`, challengeID); err != nil {
+		return fmt.Errorf("error updating login challenge: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE id = ? AND attempts >= ?`, challengeID, maxAttempts); err != nil {
+		return fmt.Errorf("error deleting login challenge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// CompleteLoginChallenge deletes a login challenge and creates a session for its user, returning the session token.
+// A challenge can be completed only once.
+func (db *appdbimpl) CompleteLoginChallenge(challengeID string) (string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	// 1. Consume the challenge
+	var userID string
+	err = tx.QueryRow(`SELECT user_id FROM login_challenges WHERE id = ?`, challengeID).Scan(&userID)
+	if err != nil {
+		if isNotFoundError(err) {
+			return "", fmt.Errorf("challenge not found")
+		}
+		return "", fmt.Errorf("error retrieving login challenge: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE id = ?`, challengeID); err != nil {
+		return "", fmt.Errorf("error deleting login challenge: %w", err)
+	}
+
+	// 2. Create the session
+	token := uuid.Must(uuid.NewV4()).String()
+	_, err = tx.Exec(`INSERT INTO user_sessions (token_hash, user_id, created_at) VALUES (?, ?, ?)`, hashToken(token), userID, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("error creating user session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	return token, nil
+}
+
+// DeleteExpiredLoginChallenges deletes the login challenges expired at now, returning how many were deleted
+func (db *appdbimpl) DeleteExpiredLoginChallenges(now time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM login_challenges WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired login challenges: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion outcome: %w", err)
+	}
+	return deleted, nil
+}
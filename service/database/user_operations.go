@@ -70,10 +70,11 @@ func (db *appdbimpl) UpdateUserPhoto(userID, photoURL string) error {
 func (db *appdbimpl) SearchUsers(query string, excludeUserID string) ([]User, error) {
 	// 1. Search users by username (case-insensitive LIKE query)
 	sqlQuery := `
-		SELECT id, username, photo_url, created_at
+		SELECT id, username, photo_url, created_at, is_bot
 		FROM users
 		WHERE username LIKE ? COLLATE NOCASE
 		AND id != ?
+		AND id != ?
 		ORDER BY username
 		LIMIT 20
 	`
@@ -81,7 +82,7 @@ func (db *appdbimpl) SearchUsers(query string, excludeUserID string) ([]User, er
 	searchPattern := "%" + query + "%"
 
 	// 3. Execute query
-	rows, err := db.c.Query(sqlQuery, searchPattern, excludeUserID)
+	rows, err := db.c.Query(sqlQuery, searchPattern, excludeUserID, DeletedUserID)
 	if err != nil {
 		return nil, fmt.Errorf("error searching users: %w", err)
 	}
@@ -99,7 +100,7 @@ func (db *appdbimpl) SearchUsers(query string, excludeUserID string) ([]User, er
 // GetUser retrieves a user by their ID
 func (db *appdbimpl) GetUser(userID string) (*User, error) {
 	query := `
-		SELECT id, username, photo_url, created_at
+		SELECT id, username, photo_url, created_at, is_bot
 		FROM users 
 		WHERE id = ?
 	`
@@ -112,6 +113,7 @@ func (db *appdbimpl) GetUser(userID string) (*User, error) {
 		&user.Username,
 		&user.PhotoURL,
 		&user.CreatedAt,
+		&user.IsBot,
 	)
 
 	if err != nil {
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 // === DATABASE UTILITIES ===
@@ -14,7 +20,7 @@ import (
 
 // scanUser converts a single database row into a User struct.
 // Used after QueryRow() calls to map database columns to User fields.
-// Expected column order: id, username, photo_url, created_at
+// Expected column order: id, username, photo_url, created_at, is_bot
 func scanUser(row *sql.Row) (*User, error) {
 	var user User
 	err := row.Scan(
@@ -22,6 +28,7 @@ func scanUser(row *sql.Row) (*User, error) {
 		&user.Username,
 		&user.PhotoURL,
 		&user.CreatedAt,
+		&user.IsBot,
 	)
 	if err != nil {
 		return nil, err
@@ -31,7 +38,7 @@ func scanUser(row *sql.Row) (*User, error) {
 
 // scanUsers converts multiple database rows into a slice of User structs.
 // Used after Query() calls when retrieving multiple users.
-// Expected column order: id, username, photo_url, created_at
+// Expected column order: id, username, photo_url, created_at, is_bot
 // Automatically handles closing rows and iterating through all records.
 func scanUsers(rows *sql.Rows) ([]User, error) {
 	var users []User
@@ -44,6 +51,7 @@ func scanUsers(rows *sql.Rows) ([]User, error) {
 			&user.Username,
 			&user.PhotoURL,
 			&user.CreatedAt,
+			&user.IsBot,
 		)
 		if err != nil {
 			return nil, err
@@ -62,7 +70,7 @@ func scanUsers(rows *sql.Rows) ([]User, error) {
 
 // scanConversation converts a single database row into a Conversation struct.
 // Used after QueryRow() calls to map database columns to Conversation fields.
-// Expected column order: id, type, name, photo_url, created_by, created_at, last_message_at
+// Expected column order: id, type, name, photo_url, created_by, created_at, last_message_at, message_ttl
 func scanConversation(row *sql.Row) (*Conversation, error) {
 	var conv Conversation
 	err := row.Scan(
@@ -73,6 +81,7 @@ func scanConversation(row *sql.Row) (*Conversation, error) {
 		&conv.CreatedBy,
 		&conv.CreatedAt,
 		&conv.LastMessageAt,
+		&conv.MessageTTL,
 	)
 	if err != nil {
 		return nil, err
@@ -80,6 +89,151 @@ func scanConversation(row *sql.Row) (*Conversation, error) {
 	return &conv, nil
 }
 
+// === MESSAGE SCANNING FUNCTIONS ===
+
+// messageColumns is the column list expected by scanMessage.
+// Queries must select them from messageTables.
+const messageColumns = `m.id, m.conversation_id, m.sender_id, u.username, m.content,
+	m.photo_url, m.reply_to_id, m.forwarded, m.system, m.created_at, m.expires_at,
+	m.link_url, m.event, lp.title, lp.description, lp.image_url, lp.fetched_at,
+	att.id, att.filename, att.mime_type, att.size, att.storage_key, att.created_at,
+	(SELECT GROUP_CONCAT(mp.photo_url, ' ' ORDER BY mp.position) FROM message_photos mp WHERE mp.message_id = m.id),
+	p.question, p.multiple_choice, p.anonymous, p.closes_at, p.closed_at`
+
+// messageTables joins the messages table (aliased as "m") with the sender ("u"), the link preview ("lp"), the
+// attachment ("att") and the poll ("p").
+const messageTables = `messages m
+	JOIN users u ON m.sender_id = u.id
+	LEFT JOIN link_previews lp ON lp.url = m.link_url AND NOT lp.failed
+	LEFT JOIN attachments att ON att.id = m.attachment_id
+	LEFT JOIN polls p ON p.message_id = m.id`
+
+// notExpired is a condition on the messages table (aliased as "m") excluding expired messages.
+// It takes the current time as its only parameter.
+const notExpired = `(m.expires_at IS NULL OR m.expires_at > ?)`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// extraColumns scans the columns selected after messageColumns, see withColumns
+type extraColumns struct {
+	row  rowScanner
+	dest []interface{}
+}
+
+func (e extraColumns) Scan(dest ...interface{}) error {
+	return e.row.Scan(append(dest, e.dest...)...)
+}
+
+// withColumns wraps a row selecting messageColumns followed by other columns, scanned into dest, so that it can be
+// passed to scanMessage.
+func withColumns(row rowScanner, dest ...interface{}) rowScanner {
+	return extraColumns{row: row, dest: dest}
+}
+
+// scanMessage converts a database row selected with messageColumns into a Message struct.
+// Reactions are not loaded.
+func scanMessage(row rowScanner) (Message, error) {
+	var msg Message
+	var preview LinkPreview
+	var previewTitle *string
+	var previewFetchedAt *time.Time
+	var event *string
+	var attachment Attachment
+	var attachmentID, attachmentFilename, attachmentMimeType, attachmentStorageKey *string
+	var attachmentSize *int64
+	var attachmentCreatedAt *time.Time
+	var album *string
+	var pollQuestion *string
+	var pollMultipleChoice, pollAnonymous *bool
+	var pollClosesAt, pollClosedAt *time.Time
+	err := row.Scan(
+		&msg.ID,
+		&msg.ConversationID,
+		&msg.SenderID,
+		&msg.SenderUsername,
+		&msg.Content,
+		&msg.PhotoURL,
+		&msg.ReplyToID,
+		&msg.Forwarded,
+		&msg.System,
+		&msg.CreatedAt,
+		&msg.ExpiresAt,
+		&msg.LinkURL,
+		&event,
+		&previewTitle,
+		&preview.Description,
+		&preview.ImageURL,
+		&previewFetchedAt,
+		&attachmentID,
+		&attachmentFilename,
+		&attachmentMimeType,
+		&attachmentSize,
+		&attachmentStorageKey,
+		&attachmentCreatedAt,
+		&album,
+		&pollQuestion,
+		&pollMultipleChoice,
+		&pollAnonymous,
+		&pollClosesAt,
+		&pollClosedAt,
+	)
+	if err != nil {
+		return Message{}, err
+	}
+
+	// The photos of albums are named by the server, their URLs contain no spaces
+	if album != nil {
+		msg.Photos = strings.Fields(*album)
+	}
+
+	// Polls are closed by their creator or once their closing time is reached. Options are loaded separately.
+	if pollQuestion != nil && pollMultipleChoice != nil && pollAnonymous != nil {
+		msg.Poll = &Poll{
+			Question:       *pollQuestion,
+			MultipleChoice: *pollMultipleChoice,
+			Anonymous:      *pollAnonymous,
+			ClosesAt:       pollClosesAt,
+			ClosedAt:       pollClosedAt,
+			Closed:         pollClosedAt != nil || (pollClosesAt != nil && !pollClosesAt.After(time.Now().UTC())),
+		}
+	}
+
+	// Messages without an attachment have all the attachment columns null
+	if attachmentID != nil && attachmentFilename != nil && attachmentMimeType != nil && attachmentSize != nil &&
+		attachmentStorageKey != nil && attachmentCreatedAt != nil {
+		attachment.ID = *attachmentID
+		attachment.Filename = *attachmentFilename
+		attachment.MimeType = *attachmentMimeType
+		attachment.Size = *attachmentSize
+		attachment.StorageKey = *attachmentStorageKey
+		attachment.CreatedAt = *attachmentCreatedAt
+		msg.Attachment = &attachment
+	}
+
+	// Group events are stored as JSON
+	if event != nil {
+		msg.Event = &GroupEvent{}
+		if err := json.Unmarshal([]byte(*event), msg.Event); err != nil {
+			return Message{}, fmt.Errorf("error decoding group event: %w", err)
+		}
+	}
+
+	// The preview is available once the link has been fetched successfully
+	if msg.LinkURL != nil && previewTitle != nil && previewFetchedAt != nil {
+		preview.URL = *msg.LinkURL
+		preview.Title = *previewTitle
+		preview.FetchedAt = *previewFetchedAt
+		msg.LinkPreview = &preview
+	}
+
+	// Set message status (for now, just set as "sent" - this would be enhanced with read receipts)
+	msg.Status = "sent"
+	return msg, nil
+}
+
 // === UTILITY FUNCTIONS ===
 
 // isNotFoundError checks if an error is sql.ErrNoRows (record not found).
@@ -88,3 +242,10 @@ func scanConversation(row *sql.Row) (*Conversation, error) {
 func isNotFoundError(err error) bool {
 	return errors.Is(err, sql.ErrNoRows)
 }
+
+// hashToken returns the hash a session token is stored as, so that a leaked database does not grant access.
+// Session tokens are random enough that a fast hash cannot be reversed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
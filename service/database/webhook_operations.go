@@ -0,0 +1,372 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// === WEBHOOK OPERATIONS ===
+
+// Conversation events that webhooks can subscribe to
+const (
+	WebhookEventMessageCreated = "message.created"
+	WebhookEventReactionAdded  = "reaction.added"
+	WebhookEventMemberJoined   = "member.joined"
+	WebhookEventMemberLeft     = "member.left"
+
+	// WebhookEventCommandReceived is only sent to bots, for messages starting with "/"
+	WebhookEventCommandReceived = "command.received"
+)
+
+// WebhookEvents lists the events that webhooks can subscribe to
+var WebhookEvents = []string{
+	WebhookEventMessageCreated,
+	WebhookEventReactionAdded,
+	WebhookEventMemberJoined,
+	WebhookEventMemberLeft,
+	WebhookEventCommandReceived,
+}
+
+// Status of a webhook delivery
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// webhookColumns is the column list shared by the webhook queries, in scanWebhooks order
+const webhookColumns = `id, owner_id, conversation_id, url, secret, events, created_at`
+
+// deliveryColumns is the column list shared by the delivery queries (deliveries aliased as "d", webhooks as "w"), in
+// scanDeliveries order
+const deliveryColumns = `d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_attempt_at, d.last_status_code, d.last_error, d.created_at, w.url, w.secret`
+
+// CreateWebhook registers a webhook of a user. If conversationID is nil the webhook receives the events of all the
+// direct conversations of the owner; otherwise the owner must be a participant of the conversation and, for groups,
+// its admin.
+func (db *appdbimpl) CreateWebhook(ownerID string, conversationID *string, url string, events []string) (*Webhook, error) {
+	// 1. Validate that the owner can watch the conversation
+	if conversationID != nil {
+		var conversationType, createdBy string
+		err := db.c.QueryRow(`
+			SELECT c.type, COALESCE(c.created_by, '')
+			FROM conversations c
+			JOIN conversation_participants cp ON c.id = cp.conversation_id
+			WHERE c.id = ? AND cp.user_id = ?`, *conversationID, ownerID).Scan(&conversationType, &createdBy)
+		if err != nil {
+			if isNotFoundError(err) {
+				return nil, fmt.Errorf("user is not a participant in this conversation")
+			}
+			return nil, fmt.Errorf("error checking conversation participation: %w", err)
+		}
+		if conversationType == ConversationTypeGroup && createdBy != ownerID {
+			return nil, fmt.Errorf("only the group admin can register webhooks for a group")
+		}
+	}
+
+	// 2. Generate the signing secret
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating webhook secret: %w", err)
+	}
+
+	// 3. Insert the webhook
+	webhookID := uuid.Must(uuid.NewV4()).String()
+	_, err := db.c.Exec(`
+		INSERT INTO webhooks (id, owner_id, conversation_id, url, secret, events, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		webhookID, ownerID, conversationID, url, hex.EncodeToString(secret), strings.Join(events, ","), time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+
+	return db.GetWebhook(webhookID, ownerID)
+}
+
+// GetUserWebhooks retrieves the webhooks registered by a user, oldest first
+func (db *appdbimpl) GetUserWebhooks(ownerID string) ([]Webhook, error) {
+	rows, err := db.c.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE owner_id = ? ORDER BY created_at ASC`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhooks: %w", err)
+	}
+	return scanWebhooks(rows)
+}
+
+// GetWebhook retrieves a webhook of a user. Webhooks registered by other users are not found.
+func (db *appdbimpl) GetWebhook(webhookID, ownerID string) (*Webhook, error) {
+	rows, err := db.c.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND owner_id = ?`, webhookID, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving webhook: %w", err)
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return &webhooks[0], nil
+}
+
+// DeleteWebhook deletes a webhook of a user with its deliveries
+func (db *appdbimpl) DeleteWebhook(webhookID, ownerID string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ? AND owner_id = ?`, webhookID, ownerID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deletion result: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, webhookID); err != nil {
+		return fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent queues the delivery of an event of a conversation to the webhooks subscribed to it: the webhooks
+// of the conversation and, for direct conversations, the webhooks of the participants covering all their direct
+// chats. Webhooks of users who are no longer participants, or no longer admins of the group, are skipped. It returns
+// the number of queued deliveries.
+func (db *appdbimpl) EnqueueWebhookEvent(conversationID, eventType string, payload []byte) (int, error) {
+	return db.enqueueDeliveries(eventType, payload, `
+		SELECT w.id
+		FROM webhooks w
+		JOIN conversation_participants cp ON cp.conversation_id = ? AND cp.user_id = w.owner_id
+		JOIN conversations c ON c.id = cp.conversation_id
+		WHERE (w.conversation_id = c.id OR (w.conversation_id IS NULL AND c.type = 'direct'))
+		AND (c.type = 'direct' OR c.created_by = w.owner_id)
+		AND (',' || w.events || ',') LIKE ('%,' || ? || ',%')`, conversationID, eventType)
+}
+
+// EnqueueBotCommand queues a command sent in a conversation for the bots taking part in it, through their webhooks
+// subscribed to command.received. If botUsername is not empty, only that bot receives the command. The sender of the
+// command never receives it. It returns the number of queued deliveries.
+func (db *appdbimpl) EnqueueBotCommand(conversationID, senderID, botUsername string, payload []byte) (int, error) {
+	return db.enqueueDeliveries(WebhookEventCommandReceived, payload, `
+		SELECT w.id
+		FROM webhooks w
+		JOIN users u ON u.id = w.owner_id AND u.is_bot
+		JOIN conversation_participants cp ON cp.conversation_id = ? AND cp.user_id = w.owner_id
+		WHERE (w.conversation_id IS NULL OR w.conversation_id = cp.conversation_id)
+		AND w.owner_id != ? AND (? = '' OR u.username = ?)
+		AND (',' || w.events || ',') LIKE ('%,' || ? || ',%')`,
+		conversationID, senderID, botUsername, botUsername, WebhookEventCommandReceived)
+}
+
+// enqueueDeliveries queues the delivery of an event to the webhooks selected by query
+func (db *appdbimpl) enqueueDeliveries(eventType string, payload []byte, query string, args ...interface{}) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+	}()
+
+	webhookIDs, err := queryStrings(tx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error querying subscribed webhooks: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, webhookID := range webhookIDs {
+		_, err := tx.Exec(`
+			INSERT INTO webhook_deliveries (id, webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, 0, ?, ?)`,
+			uuid.Must(uuid.NewV4()).String(), webhookID, eventType, payload, DeliveryStatusPending, now, now)
+		if err != nil {
+			return 0, fmt.Errorf("error queueing webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return len(webhookIDs), nil
+}
+
+// GetDueWebhookDeliveries retrieves up to limit pending deliveries whose next attempt is not after now, oldest first
+func (db *appdbimpl) GetDueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.c.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at ASC, d.created_at ASC
+		LIMIT ?`, DeliveryStatusPending, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due webhook deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+// RecordWebhookAttempt saves the outcome of an attempt to deliver an event. A pending status keeps the delivery in
+// the queue until attempt.NextAttemptAt.
+func (db *appdbimpl) RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt) error {
+	result, err := db.c.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, last_attempt_at = ?, last_status_code = ?, last_error = ?,
+			next_attempt_at = ?
+		WHERE id = ? AND status = ?`,
+		attempt.Status, attempt.At.UTC(), attempt.StatusCode, attempt.Error, attempt.NextAttemptAt, deliveryID,
+		DeliveryStatusPending)
+	if err != nil {
+		return fmt.Errorf("error recording webhook attempt: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking update result: %w", err)
+	}
+	if rowsAffected == 0 {
+		// The webhook was deleted while delivering
+		return fmt.Errorf("webhook delivery not found")
+	}
+	return nil
+}
+
+// GetWebhookDeliveries retrieves up to limit deliveries of a webhook of a user, newest first
+func (db *appdbimpl) GetWebhookDeliveries(webhookID, ownerID string, limit int) ([]WebhookDelivery, error) {
+	if _, err := db.GetWebhook(webhookID, ownerID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.c.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE d.webhook_id = ?
+		ORDER BY d.created_at DESC, d.rowid DESC
+		LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying webhook deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+// DeleteFinishedWebhookDeliveries deletes the delivered and failed deliveries created before the given time,
+// returning how many were deleted
+func (db *appdbimpl) DeleteFinishedWebhookDeliveries(before time.Time) (int64, error) {
+	result, err := db.c.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`,
+		DeliveryStatusPending, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking deletion result: %w", err)
+	}
+	return deleted, nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// deleteWebhooksWhere deletes the webhooks matching condition, with their deliveries
+func deleteWebhooksWhere(ex execer, condition string, args ...interface{}) error {
+	selected := `SELECT id FROM webhooks WHERE ` + condition
+	if _, err := ex.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id IN (`+selected+`)`, args...); err != nil {
+		return fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+	if _, err := ex.Exec(`DELETE FROM webhooks WHERE `+condition, args...); err != nil {
+		return fmt.Errorf("error deleting webhooks: %w", err)
+	}
+	return nil
+}
+
+// scanWebhooks converts rows selected with webhookColumns into Webhook structs
+func scanWebhooks(rows *sql.Rows) ([]Webhook, error) {
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.OwnerID,
+			&webhook.ConversationID,
+			&webhook.URL,
+			&webhook.Secret,
+			&events,
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %w", err)
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// scanDeliveries converts rows selected with deliveryColumns into WebhookDelivery structs
+func scanDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
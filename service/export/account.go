@@ -0,0 +1,120 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// Session is the metadata of a login session as stored in archives. Tokens are never exported.
+type Session struct {
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Group is a group membership as stored in archives
+type Group struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	IsOwner  bool      `json:"isOwner"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// AccountReaction is a reaction left by the exported user
+type AccountReaction struct {
+	MessageID string    `json:"messageId"`
+	Emoticon  string    `json:"emoticon"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Profile is the exported user profile. Photo is the path of the profile photo inside the archive.
+type Profile struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Photo     *string   `json:"photo,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WriteAccount writes the ZIP archive of the personal data of a user to w. The archive contains account.json (profile,
+// sessions metadata, group memberships, reactions and all the messages sent by the user), the media/ directory with
+// the profile photo and the photos sent by the user, and the attachments/ directory with the files they sent.
+func (e *Exporter) WriteAccount(w io.Writer, userID string) error {
+	user, err := e.DB.GetUserByID(userID)
+	if err != nil {
+		return fmt.Errorf("retrieving user: %w", err)
+	}
+	sessions, err := e.DB.GetUserSessions(userID)
+	if err != nil {
+		return fmt.Errorf("retrieving sessions: %w", err)
+	}
+	groups, err := e.DB.GetUserGroups(userID)
+	if err != nil {
+		return fmt.Errorf("retrieving groups: %w", err)
+	}
+	reactions, err := e.DB.GetUserReactions(userID)
+	if err != nil {
+		return fmt.Errorf("retrieving reactions: %w", err)
+	}
+
+	document := accountDocument{
+		Format:     "wasatext.account.v1",
+		ExportedAt: globaltime.Now().UTC(),
+		Profile:    Profile{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+		Sessions:   make([]Session, len(sessions)),
+		Groups:     make([]Group, len(groups)),
+		Reactions:  make([]AccountReaction, len(reactions)),
+	}
+	if user.PhotoURL != nil {
+		p := mediaArchivePath(*user.PhotoURL)
+		document.Profile.Photo = &p
+	}
+	for i, s := range sessions {
+		document.Sessions[i] = Session{CreatedAt: s.CreatedAt}
+	}
+	for i, g := range groups {
+		document.Groups[i] = Group{ID: g.GroupID, Name: g.Name, IsOwner: g.IsOwner, JoinedAt: g.JoinedAt}
+	}
+	for i, r := range reactions {
+		document.Reactions[i] = AccountReaction{MessageID: r.MessageID, Emoticon: r.Emoticon, Timestamp: r.CreatedAt}
+	}
+
+	zw := zip.NewWriter(w)
+
+	// 1. account.json, streaming the messages
+	fw, err := createEntry(zw, "account.json", document.ExportedAt)
+	if err != nil {
+		return err
+	}
+	media, err := writeMessagesDocument(fw, document, true, func(fn func(database.Message) error) error {
+		return e.DB.ForEachUserMessage(userID, fn)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 2. media files
+	if user.PhotoURL != nil {
+		media.photos = append(media.photos, *user.PhotoURL)
+	}
+	if err := e.writeMediaFiles(zw, media, document.ExportedAt); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+	return nil
+}
+
+// accountDocument is the part of account.json preceding the messages array
+type accountDocument struct {
+	Format     string            `json:"format"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Profile    Profile           `json:"profile"`
+	Sessions   []Session         `json:"sessions"`
+	Groups     []Group           `json:"groups"`
+	Reactions  []AccountReaction `json:"reactions"`
+}
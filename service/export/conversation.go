@@ -0,0 +1,144 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// Conversation is the conversation header as stored in archives
+type Conversation struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Name      *string   `json:"name,omitempty"`
+	PhotoURL  *string   `json:"photoUrl,omitempty"`
+	CreatedBy *string   `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WriteConversation writes the ZIP archive of a conversation to w. Messages are read from the database one at a time,
+// once per archive entry, so memory usage does not depend on the size of the conversation.
+func (e *Exporter) WriteConversation(w io.Writer, conversationID string) error {
+	conv, err := e.DB.GetConversation(conversationID, "")
+	if err != nil {
+		return fmt.Errorf("retrieving conversation: %w", err)
+	}
+
+	header := Conversation{
+		ID:        conv.ID,
+		Type:      conv.Type,
+		Name:      conv.Name,
+		PhotoURL:  conv.PhotoURL,
+		CreatedBy: conv.CreatedBy,
+		CreatedAt: conv.CreatedAt,
+	}
+	members := make([]User, len(conv.Participants))
+	for i, p := range conv.Participants {
+		members[i] = User{ID: p.ID, Username: p.Username, PhotoURL: p.PhotoURL}
+	}
+	exportedAt := globaltime.Now().UTC()
+
+	zw := zip.NewWriter(w)
+
+	// 1. conversation.json, collecting the referenced media along the way
+	media, err := e.writeConversationJSON(zw, header, members, exportedAt)
+	if err != nil {
+		return err
+	}
+
+	// 2. transcript.html
+	if err := e.writeConversationHTML(zw, header, members, exportedAt); err != nil {
+		return err
+	}
+
+	// 3. media files
+	if err := e.writeMediaFiles(zw, media, exportedAt); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+	return nil
+}
+
+// writeConversationJSON writes conversation.json and returns the photos and the attached files it references
+func (e *Exporter) writeConversationJSON(zw *zip.Writer, header Conversation, members []User, exportedAt time.Time) (archiveMedia, error) {
+	fw, err := createEntry(zw, "conversation.json", exportedAt)
+	if err != nil {
+		return archiveMedia{}, err
+	}
+
+	prefix := struct {
+		Format       string       `json:"format"`
+		ExportedAt   time.Time    `json:"exportedAt"`
+		Conversation Conversation `json:"conversation"`
+		Members      []User       `json:"members"`
+	}{"wasatext.conversation.v1", exportedAt, header, members}
+
+	return writeMessagesDocument(fw, prefix, false, func(fn func(database.Message) error) error {
+		return e.DB.ForEachConversationMessage(header.ID, fn)
+	})
+}
+
+// writeMessagesDocument writes the JSON object prefix followed by a "messages" array, streamed from forEach. The
+// document is written piece by piece so that messages are never held in memory all together. withConversation adds
+// the conversation identifier to each message. It returns the photos and the attached files referenced by the
+// messages.
+func writeMessagesDocument(w io.Writer, prefix interface{}, withConversation bool, forEach func(fn func(database.Message) error) error) (archiveMedia, error) {
+	var media archiveMedia
+	encodedPrefix, err := json.Marshal(prefix)
+	if err != nil {
+		return media, fmt.Errorf("encoding document: %w", err)
+	}
+	// Drop the closing brace to append the messages array
+	if _, err := fmt.Fprintf(w, "%s,\"messages\":[", encodedPrefix[:len(encodedPrefix)-1]); err != nil {
+		return media, err
+	}
+
+	seen := make(map[string]bool)
+	first := true
+	err = forEach(func(msg database.Message) error {
+		for _, url := range messagePhotos(msg) {
+			if !seen[url] {
+				seen[url] = true
+				media.photos = append(media.photos, url)
+			}
+		}
+		// Forwarded copies share the attachment of the original message
+		if msg.Attachment != nil && !seen[msg.Attachment.ID] {
+			seen[msg.Attachment.ID] = true
+			media.attachments = append(media.attachments, *msg.Attachment)
+		}
+
+		out := newMessage(msg)
+		if withConversation {
+			out.ConversationID = msg.ConversationID
+		}
+		encoded, err := json.Marshal(out)
+		if err != nil {
+			return fmt.Errorf("encoding message %s: %w", msg.ID, err)
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return media, fmt.Errorf("writing messages: %w", err)
+	}
+
+	if _, err := io.WriteString(w, "]}\n"); err != nil {
+		return media, err
+	}
+	return media, nil
+}
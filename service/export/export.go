@@ -0,0 +1,300 @@
+/*
+Package export builds downloadable archives of WASAText data. Archives are ZIP files written directly to an io.Writer
+(e.g., an http.ResponseWriter or a file), so that large conversations are streamed instead of being buffered in memory.
+
+A conversation archive contains:
+
+	conversation.json   machine-readable document with the conversation, members and messages
+	transcript.html     offline HTML transcript with photos embedded as data URIs
+	media/              original photo files, referenced by conversation.json
+	attachments/        files attached to messages, referenced by conversation.json and linked by the transcript
+
+An account archive contains the personal data of a user:
+
+	account.json        profile, sessions metadata, group memberships, reactions and all the messages sent
+	media/              profile photo and photos sent by the user, referenced by account.json
+	attachments/        files attached to the messages sent by the user, referenced by account.json
+
+The package is used by both the API server and the wasactl command line tool. Access control is a responsibility of
+the caller.
+*/
+package export
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+)
+
+// Exporter writes archives using data from an AppDatabase, media files from MediaDir and attachment files from
+// AttachmentDir
+type Exporter struct {
+	// DB is where conversations and messages are read from
+	DB database.AppDatabase
+
+	// MediaDir is the directory holding the files served under "/uploads/" (e.g., "tmp/uploads")
+	MediaDir string
+
+	// AttachmentDir is the directory holding the files attached to messages, named by storage key (e.g.,
+	// "tmp/attachments")
+	AttachmentDir string
+}
+
+// User is a user as stored in archives
+type User struct {
+	ID       string  `json:"id"`
+	Username string  `json:"username"`
+	PhotoURL *string `json:"photoUrl,omitempty"`
+}
+
+// Reaction is a message reaction as stored in archives
+type Reaction struct {
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Emoticon  string    `json:"emoticon"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Message is a message as stored in archives. Photo is the path of the photo inside the archive; the photos of albums
+// are listed in order in Photos, starting with Photo.
+type Message struct {
+	ID             string      `json:"id"`
+	ConversationID string      `json:"conversationId,omitempty"`
+	SenderID       string      `json:"senderId"`
+	SenderUsername string      `json:"senderUsername"`
+	Content        *string     `json:"content,omitempty"`
+	Photo          *string     `json:"photo,omitempty"`
+	Photos         []string    `json:"photos,omitempty"`
+	Attachment     *Attachment `json:"attachment,omitempty"`
+	Poll           *Poll       `json:"poll,omitempty"`
+	ReplyToID      *string     `json:"replyToId,omitempty"`
+	Forwarded      bool        `json:"forwarded"`
+	System         bool        `json:"system,omitempty"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Reactions      []Reaction  `json:"reactions"`
+}
+
+// Attachment is a file attached to a message as stored in archives. File is the path of the file inside the archive.
+type Attachment struct {
+	File     string `json:"file"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// Poll is a poll with its results as stored in archives. The voters of anonymous polls are not exported.
+type Poll struct {
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multipleChoice"`
+	Anonymous      bool         `json:"anonymous"`
+	Closed         bool         `json:"closed"`
+}
+
+// PollOption is an option of a poll as stored in archives, with the usernames of its voters
+type PollOption struct {
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// messagePhotos returns the uploads URLs of the photos of a message: the photos of an album, or its single photo
+func messagePhotos(msg database.Message) []string {
+	if len(msg.Photos) > 0 {
+		return msg.Photos
+	}
+	if msg.PhotoURL != nil {
+		return []string{*msg.PhotoURL}
+	}
+	return nil
+}
+
+// newMessage converts a database message into its archive representation
+func newMessage(msg database.Message) Message {
+	out := Message{
+		ID:             msg.ID,
+		SenderID:       msg.SenderID,
+		SenderUsername: msg.SenderUsername,
+		Content:        msg.Content,
+		ReplyToID:      msg.ReplyToID,
+		Forwarded:      msg.Forwarded,
+		System:         msg.System,
+		Timestamp:      msg.CreatedAt,
+		Reactions:      make([]Reaction, len(msg.Comments)),
+	}
+	if msg.PhotoURL != nil {
+		p := mediaArchivePath(*msg.PhotoURL)
+		out.Photo = &p
+	}
+	for _, url := range msg.Photos {
+		out.Photos = append(out.Photos, mediaArchivePath(url))
+	}
+	if msg.Attachment != nil {
+		out.Attachment = &Attachment{
+			File:     attachmentArchivePath(*msg.Attachment),
+			Filename: msg.Attachment.Filename,
+			MimeType: msg.Attachment.MimeType,
+			Size:     msg.Attachment.Size,
+		}
+	}
+	if msg.Poll != nil {
+		out.Poll = newPoll(*msg.Poll)
+	}
+	for i, r := range msg.Comments {
+		out.Reactions[i] = Reaction{
+			UserID:    r.UserID,
+			Username:  r.Username,
+			Emoticon:  r.Emoticon,
+			Timestamp: r.CreatedAt,
+		}
+	}
+	return out
+}
+
+// newPoll converts a poll into its archive representation
+func newPoll(poll database.Poll) *Poll {
+	out := &Poll{
+		Question:       poll.Question,
+		Options:        make([]PollOption, len(poll.Options)),
+		MultipleChoice: poll.MultipleChoice,
+		Anonymous:      poll.Anonymous,
+		Closed:         poll.Closed,
+	}
+	for i, option := range poll.Options {
+		out.Options[i] = PollOption{Text: option.Text, Votes: len(option.Voters)}
+		if !poll.Anonymous {
+			for _, voter := range option.Voters {
+				out.Options[i].Voters = append(out.Options[i].Voters, voter.Username)
+			}
+		}
+	}
+	return out
+}
+
+// mediaArchivePath maps an uploads URL (e.g., "/uploads/messages/x.png") to its path inside the archive
+func mediaArchivePath(url string) string {
+	return path.Join("media", path.Base(url))
+}
+
+// attachmentArchivePath returns the path of an attached file inside the archive. Files are kept in a directory per
+// attachment, so that they keep their original names.
+func attachmentArchivePath(attachment database.Attachment) string {
+	return path.Join("attachments", attachment.ID, path.Base(attachment.Filename))
+}
+
+// MediaPath maps an uploads URL (e.g., "/uploads/messages/x.png") to the path of its file inside mediaDir. URLs
+// outside of "/uploads/" or escaping mediaDir are rejected.
+func MediaPath(mediaDir string, url string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(url, "/uploads/"))
+	if !strings.HasPrefix(url, "/uploads/") || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid media URL %q", url)
+	}
+	return filepath.Join(mediaDir, filepath.FromSlash(rel)), nil
+}
+
+// openMedia opens the file behind an uploads URL
+func (e *Exporter) openMedia(url string) (*os.File, error) {
+	p, err := MediaPath(e.MediaDir, url)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// createEntry adds a compressed file to the archive, stamped with the export time
+func createEntry(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", name, err)
+	}
+	return fw, nil
+}
+
+// archiveMedia lists the files referenced by the messages of an archive
+type archiveMedia struct {
+	// photos are the uploads URLs of the photos
+	photos []string
+
+	// attachments are the files attached to the messages
+	attachments []database.Attachment
+}
+
+// writeMediaFiles adds the photos and the attached files referenced by an archive. Missing files are skipped.
+func (e *Exporter) writeMediaFiles(zw *zip.Writer, media archiveMedia, modified time.Time) error {
+	for _, url := range media.photos {
+		p, err := MediaPath(e.MediaDir, url)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(zw, p, mediaArchivePath(url), modified); err != nil {
+			return err
+		}
+	}
+	for _, attachment := range media.attachments {
+		p := filepath.Join(e.AttachmentDir, filepath.Base(attachment.StorageKey))
+		if err := writeFile(zw, p, attachmentArchivePath(attachment), modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile copies the file at p to the archive entry name
+func writeFile(zw *zip.Writer, p string, name string, modified time.Time) error {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	fw, err := createEntry(zw, name, modified)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, f); err != nil {
+		return fmt.Errorf("copying %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeDataURI writes the file behind an uploads URL as a base64 data URI. It returns false if the file is missing.
+func (e *Exporter) writeDataURI(w io.Writer, url string) (bool, error) {
+	f, err := e.openMedia(url)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(url)))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	if _, err := fmt.Fprintf(w, "data:%s;base64,", mimeType); err != nil {
+		return false, err
+	}
+
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(enc, f); err != nil {
+		return false, fmt.Errorf("encoding %s: %w", url, err)
+	}
+	return true, enc.Close()
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/database"
+)
+
+// transcriptTemplates renders the offline HTML transcript. The page is split in three templates (header, message,
+// footer) so that messages can be streamed one at a time.
+var transcriptTemplates = template.Must(template.New("transcript").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - WASAText export</title>
+<style>
+body { font-family: sans-serif; background: #f0f2f5; margin: 0; padding: 2em; }
+main { max-width: 48em; margin: 0 auto; }
+header { margin-bottom: 2em; }
+.message { background: #fff; border-radius: 8px; padding: 0.6em 0.9em; margin: 0.6em 0; }
+.meta { color: #667781; font-size: 0.8em; }
+.system { background: #fff5c4; text-align: center; font-style: italic; }
+.sender { font-weight: bold; color: #1f7aec; }
+.reply { display: block; border-left: 3px solid #1f7aec; padding-left: 0.5em; color: #667781; font-size: 0.85em; }
+.reactions { font-size: 0.85em; margin-top: 0.3em; }
+.attachment { background: #f0f2f5; border-radius: 6px; padding: 0.4em 0.6em; }
+.poll { background: #f0f2f5; border-radius: 6px; padding: 0.4em 0.6em; }
+img { max-width: 100%; border-radius: 6px; margin-top: 0.3em; }
+</style>
+</head>
+<body>
+<main>
+<header>
+<h1>{{.Title}}</h1>
+<p class="meta">{{.Type}} conversation &middot; exported on {{.ExportedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+<p>Members: {{range $i, $m := .Members}}{{if $i}}, {{end}}{{$m.Username}}{{end}}</p>
+</header>
+{{end}}
+
+{{define "message-start"}}<article class="message{{if .System}} system{{end}}" id="m-{{.ID}}">
+<div class="meta"><span class="sender">{{.SenderUsername}}</span> &middot; {{.Timestamp.Format "2006-01-02 15:04:05"}}{{if .Forwarded}} &middot; forwarded{{end}}</div>
+{{if .ReplyToID}}<a class="reply" href="#m-{{.ReplyToID}}">in reply to a message</a>{{end}}
+{{if .Content}}<p>{{.Content}}</p>{{end}}
+{{with .Attachment}}<p class="attachment">&#128206; <a href="{{.File}}">{{.Filename}}</a> <span class="meta">{{.MimeType}}, {{.Size}} bytes</span></p>{{end}}
+{{with .Poll}}<div class="poll"><p>&#128202; <strong>{{.Question}}</strong>{{if .Closed}} <span class="meta">closed</span>{{end}}</p>
+<ul>{{range .Options}}<li>{{.Text}} <span class="meta">{{.Votes}} votes{{if .Voters}}: {{range $i, $v := .Voters}}{{if $i}}, {{end}}{{$v}}{{end}}{{end}}</span></li>{{end}}</ul></div>{{end}}
+{{end}}
+
+{{define "message-end"}}{{if .Reactions}}<div class="reactions">{{range .Reactions}}<span title="{{.Username}}">{{.Emoticon}}</span> {{end}}</div>{{end}}
+</article>
+{{end}}
+
+{{define "footer"}}</main>
+</body>
+</html>
+{{end}}
+`))
+
+// transcriptHeader is the data for the "header" template
+type transcriptHeader struct {
+	Title      string
+	Type       string
+	ExportedAt time.Time
+	Members    []User
+}
+
+// writeConversationHTML writes transcript.html, embedding photos as data URIs
+func (e *Exporter) writeConversationHTML(zw *zip.Writer, header Conversation, members []User, exportedAt time.Time) error {
+	fw, err := createEntry(zw, "transcript.html", exportedAt)
+	if err != nil {
+		return err
+	}
+
+	title := "Conversation"
+	if header.Name != nil && *header.Name != "" {
+		title = *header.Name
+	} else if header.Type == "direct" {
+		title = "Direct conversation"
+	}
+
+	err = transcriptTemplates.ExecuteTemplate(fw, "header", transcriptHeader{
+		Title:      title,
+		Type:       header.Type,
+		ExportedAt: exportedAt,
+		Members:    members,
+	})
+	if err != nil {
+		return fmt.Errorf("rendering transcript header: %w", err)
+	}
+
+	err = e.DB.ForEachConversationMessage(header.ID, func(msg database.Message) error {
+		return e.writeTranscriptMessage(fw, newMessage(msg), messagePhotos(msg))
+	})
+	if err != nil {
+		return fmt.Errorf("rendering transcript messages: %w", err)
+	}
+
+	if err := transcriptTemplates.ExecuteTemplate(fw, "footer", nil); err != nil {
+		return fmt.Errorf("rendering transcript footer: %w", err)
+	}
+	return nil
+}
+
+// writeTranscriptMessage renders a single message. The photos are streamed one at a time between the two halves of
+// the message template, so they are never held in memory as a whole.
+func (e *Exporter) writeTranscriptMessage(w io.Writer, msg Message, photoURLs []string) error {
+	if err := transcriptTemplates.ExecuteTemplate(w, "message-start", msg); err != nil {
+		return err
+	}
+
+	for _, photoURL := range photoURLs {
+		if _, err := io.WriteString(w, `<img alt="photo" src="`); err != nil {
+			return err
+		}
+		found, err := e.writeDataURI(w, photoURL)
+		if err != nil {
+			return err
+		}
+		if !found {
+			// Close the tag with an empty source and explain why the photo is missing
+			if _, err := io.WriteString(w, `"><p class="meta">[photo unavailable]</p>`); err != nil {
+				return err
+			}
+		} else if _, err := io.WriteString(w, `">`); err != nil {
+			return err
+		}
+	}
+
+	return transcriptTemplates.ExecuteTemplate(w, "message-end", msg)
+}
@@ -0,0 +1,76 @@
+package linkpreview
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headEnd   = regexp.MustCompile(`(?i)</head\s*>|<body[\s>]`)
+	tagRegexp = regexp.MustCompile(`(?is)<(meta|link)\b([^>]*)>`)
+	titleTag  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title\s*>`)
+	attribute = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// metadata maps the names of the metadata found in a page (e.g. "og:title", "description", "title") to their values.
+// The oEmbed JSON endpoint is stored as "oembed".
+type metadata map[string]string
+
+// first returns the value of the first name present in m
+func (m metadata) first(names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(m[name]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseHTML extracts the metadata from the head of an HTML page. This is not a full HTML parser: it looks for meta,
+// link and title tags, which is enough for the well-formed heads that preview metadata are written for.
+func parseHTML(page []byte) metadata {
+	head := string(page)
+	if loc := headEnd.FindStringIndex(head); loc != nil {
+		head = head[:loc[0]]
+	}
+
+	meta := make(metadata)
+	set := func(name, value string) {
+		// The first occurrence wins, as in most link preview implementations
+		if _, ok := meta[name]; !ok && value != "" {
+			meta[name] = html.UnescapeString(value)
+		}
+	}
+
+	for _, tag := range tagRegexp.FindAllStringSubmatch(head, -1) {
+		attrs := parseAttributes(tag[2])
+		switch strings.ToLower(tag[1]) {
+		case "meta":
+			// Open Graph uses property, other vocabularies use name
+			name := attrs["property"]
+			if name == "" {
+				name = attrs["name"]
+			}
+			set(strings.ToLower(name), attrs["content"])
+		case "link":
+			if strings.EqualFold(attrs["type"], "application/json+oembed") {
+				set("oembed", attrs["href"])
+			}
+		}
+	}
+
+	if title := titleTag.FindStringSubmatch(head); title != nil {
+		set("title", title[1])
+	}
+	return meta
+}
+
+// parseAttributes returns the attributes of a tag, with lowercase names
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attribute.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(match[1])] = match[2] + match[3] + match[4]
+	}
+	return attrs
+}
@@ -0,0 +1,219 @@
+/*
+Package linkpreview fetches the metadata shown in the preview of a link: title, description and preview image.
+
+Metadata are read from the Open Graph and Twitter card tags of HTML pages, falling back to the title and description
+tags, and to the oEmbed endpoint advertised by the page when it lacks a title or an image. Pages are fetched with a
+netguard client, so links to the internal network are refused, and both the time spent and the size read are
+limited.
+
+The API server depends on the Fetcher interface only, so that tests can replace it or point New at a local server
+with Config.AllowPrivate.
+*/
+package linkpreview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Daniel200273/WASA-project/service/netguard"
+)
+
+// Limits on the text of a preview, in characters
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxImageURLLength    = 2048
+)
+
+// ErrNoPreview is returned when a page has no metadata to build a preview from
+var ErrNoPreview = errors.New("no preview available")
+
+// Preview is the metadata of a linked page
+type Preview struct {
+	Title       string
+	Description string // Empty if the page has no description
+	ImageURL    string // Absolute http(s) URL, empty if the page has no preview image
+}
+
+// Fetcher retrieves the preview of a URL
+type Fetcher interface {
+	// Fetch returns the preview of rawURL, or ErrNoPreview if the page has nothing to show
+	Fetch(ctx context.Context, rawURL string) (*Preview, error)
+}
+
+// Config is used to tune the Fetcher returned by New
+type Config struct {
+	// Timeout limits each request, including redirects and reading the body (default: 5 seconds)
+	Timeout time.Duration
+
+	// MaxBodySize is the maximum number of bytes read from a page; larger pages are truncated (default: 512 KiB)
+	MaxBodySize int64
+
+	// UserAgent is sent with every request (default: "WASAText-LinkPreview/1.0")
+	UserAgent string
+
+	// AllowPrivate allows fetching pages from private addresses. It exists for tests against local servers only.
+	AllowPrivate bool
+}
+
+type httpFetcher struct {
+	client      *http.Client
+	maxBodySize int64
+	userAgent   string
+}
+
+// New returns a Fetcher reading previews over HTTP
+func New(cfg Config) Fetcher {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 512 << 10
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "WASAText-LinkPreview/1.0"
+	}
+
+	return &httpFetcher{
+		client: netguard.NewClient(netguard.Config{
+			Timeout:      cfg.Timeout,
+			AllowPrivate: cfg.AllowPrivate,
+		}),
+		maxBodySize: cfg.MaxBodySize,
+		userAgent:   cfg.UserAgent,
+	}
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	// 1. Fetch the page
+	body, pageURL, err := f.get(ctx, rawURL, "text/html", "application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Read the metadata from its tags
+	meta := parseHTML(body)
+	preview := &Preview{
+		Title:       meta.first("og:title", "twitter:title", "title"),
+		Description: meta.first("og:description", "twitter:description", "description"),
+		ImageURL:    meta.first("og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"),
+	}
+
+	// 3. Complete the preview with oEmbed, if the page advertises an endpoint
+	if oembed := meta.first("oembed"); oembed != "" && (preview.Title == "" || preview.ImageURL == "") {
+		if endpoint, err := pageURL.Parse(oembed); err == nil {
+			f.completeFromOEmbed(ctx, endpoint.String(), preview)
+		}
+	}
+
+	// 4. Clean up the result
+	preview.Title = clean(preview.Title, maxTitleLength)
+	preview.Description = clean(preview.Description, maxDescriptionLength)
+	preview.ImageURL = absoluteURL(pageURL, preview.ImageURL)
+	if preview.Title == "" {
+		return nil, ErrNoPreview
+	}
+	return preview, nil
+}
+
+// completeFromOEmbed fills the title and the image of preview from an oEmbed endpoint. oEmbed is optional: errors
+// leave the preview unchanged.
+func (f *httpFetcher) completeFromOEmbed(ctx context.Context, endpoint string, preview *Preview) {
+	body, _, err := f.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return
+	}
+
+	var oembed struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.Unmarshal(body, &oembed); err != nil {
+		return
+	}
+	if preview.Title == "" {
+		preview.Title = oembed.Title
+	}
+	if preview.Description == "" {
+		preview.Description = oembed.AuthorName
+	}
+	if preview.ImageURL == "" {
+		preview.ImageURL = oembed.ThumbnailURL
+	}
+}
+
+// get fetches rawURL, checking that the response has one of the accepted media types. It returns at most
+// maxBodySize bytes of the body and the final URL, after redirects.
+func (f *httpFetcher) get(ctx context.Context, rawURL string, accept ...string) ([]byte, *url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil, fmt.Errorf("unsupported URL %q", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", strings.Join(accept, ", "))
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, ErrNoPreview
+	}
+	accepted := false
+	for _, mt := range accept {
+		accepted = accepted || mediaType == mt
+	}
+	if !accepted {
+		return nil, nil, ErrNoPreview
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, f.maxBodySize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", u.Host, err)
+	}
+	return body, res.Request.URL, nil
+}
+
+// clean collapses the whitespace of s and truncates it to limit characters
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// absoluteURL resolves ref against base, returning an empty string for anything but http(s) URLs
+func absoluteURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.String()) > maxImageURLLength {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,166 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/netguard"
+)
+
+// newSite starts a server answering every path with a page of the given content type
+func newSite(t *testing.T, pages map[string]string, contentType string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", contentType)
+		}
+		_, _ = w.Write([]byte(page))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchOpenGraph(t *testing.T) {
+	srv := newSite(t, map[string]string{
+		"/article": `<!DOCTYPE html>
+<html><head>
+	<title>Fallback title</title>
+	<meta property="og:title" content="Tom &amp; Jerry
+		return">
+	<meta name="description" content='Plain description'>
+	<meta property="og:description" content="Open Graph description">
+	<meta property="og:image" content="/images/cover.png">
+</head><body><meta property="og:title" content="Not in the head"></body></html>`,
+	}, "text/html; charset=utf-8")
+
+	preview, err := New(Config{AllowPrivate: true}).Fetch(context.Background(), srv.URL+"/article")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	want := Preview{
+		Title:       "Tom & Jerry return",
+		Description: "Open Graph description",
+		ImageURL:    srv.URL + "/images/cover.png",
+	}
+	if *preview != want {
+		t.Fatalf("Fetch returned %+v, want %+v", *preview, want)
+	}
+}
+
+func TestFetchFallbacks(t *testing.T) {
+	srv := newSite(t, map[string]string{
+		"/title":  `<html><head><TITLE>  Just a   title </TITLE><meta name="twitter:image" content="javascript:alert(1)"></head></html>`,
+		"/oembed": `<html><head><link rel="alternate" type="application/json+oembed" href="/oembed.json"></head></html>`,
+		"/oembed.json": `{"title": "Video", "author_name": "Maria",
+			"thumbnail_url": "https://cdn.example/thumb.jpg"}`,
+		"/empty": `<html><head></head><body><h1>No metadata</h1></body></html>`,
+	}, "text/html")
+	fetcher := New(Config{AllowPrivate: true})
+
+	preview, err := fetcher.Fetch(context.Background(), srv.URL+"/title")
+	if err != nil {
+		t.Fatalf("Fetch of a page with a title only: %v", err)
+	}
+	if (*preview != Preview{Title: "Just a title"}) {
+		t.Fatalf("Fetch returned %+v, want the title only", *preview)
+	}
+
+	preview, err = fetcher.Fetch(context.Background(), srv.URL+"/oembed")
+	if err != nil {
+		t.Fatalf("Fetch of a page with oEmbed: %v", err)
+	}
+	if (*preview != Preview{Title: "Video", Description: "Maria", ImageURL: "https://cdn.example/thumb.jpg"}) {
+		t.Fatalf("Fetch returned %+v, want the oEmbed metadata", *preview)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), srv.URL+"/empty"); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("Fetch of a page without metadata returned %v, want ErrNoPreview", err)
+	}
+}
+
+func TestFetchLongTitle(t *testing.T) {
+	srv := newSite(t, map[string]string{
+		"/long": `<html><head><title>` + strings.Repeat("è", 300) + `</title></head></html>`,
+	}, "text/html")
+
+	preview, err := New(Config{AllowPrivate: true}).Fetch(context.Background(), srv.URL+"/long")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if want := strings.Repeat("è", maxTitleLength-1) + "…"; preview.Title != want {
+		t.Fatalf("Fetch returned a title of %d characters, want it truncated to %d", len([]rune(preview.Title)), maxTitleLength)
+	}
+}
+
+func TestFetchBodySizeLimit(t *testing.T) {
+	// The title comes after the first KiB of the page
+	page := `<html><head><!--` + strings.Repeat("x", 2048) + `--><title>Late title</title></head></html>`
+	srv := newSite(t, map[string]string{"/big": page}, "text/html")
+
+	if _, err := New(Config{AllowPrivate: true, MaxBodySize: 1024}).Fetch(context.Background(), srv.URL+"/big"); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("Fetch beyond the size limit returned %v, want ErrNoPreview", err)
+	}
+
+	preview, err := New(Config{AllowPrivate: true}).Fetch(context.Background(), srv.URL+"/big")
+	if err != nil || preview.Title != "Late title" {
+		t.Fatalf("Fetch within the default size limit returned %+v, %v", preview, err)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	start := time.Now()
+	_, err := New(Config{AllowPrivate: true, Timeout: 50 * time.Millisecond}).Fetch(context.Background(), srv.URL)
+	if err == nil || errors.Is(err, ErrNoPreview) {
+		t.Fatalf("Fetch of a slow page returned %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Fetch returned after %v, want about 50ms", elapsed)
+	}
+}
+
+func TestFetchRejectedResponses(t *testing.T) {
+	image := newSite(t, map[string]string{"/cat.png": "<html><head><title>Not a page</title></head></html>"}, "image/png")
+	fetcher := New(Config{AllowPrivate: true})
+
+	if _, err := fetcher.Fetch(context.Background(), image.URL+"/cat.png"); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Fetch of an image returned %v, want ErrNoPreview", err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), image.URL+"/missing"); err == nil || errors.Is(err, ErrNoPreview) {
+		t.Errorf("Fetch of a missing page returned %v, want a status error", err)
+	}
+	for _, rawURL := range []string{"ftp://example.com/file", "/relative", "http://"} {
+		if _, err := fetcher.Fetch(context.Background(), rawURL); err == nil {
+			t.Errorf("Fetch(%q) succeeded, want an error", rawURL)
+		}
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := newSite(t, map[string]string{"/": "<html><head><title>Internal</title></head></html>"}, "text/html")
+
+	if _, err := New(Config{}).Fetch(context.Background(), srv.URL+"/"); !errors.Is(err, netguard.ErrForbiddenAddress) {
+		t.Fatalf("Fetch of a loopback address returned %v, want netguard.ErrForbiddenAddress", err)
+	}
+}
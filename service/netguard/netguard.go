@@ -0,0 +1,132 @@
+/*
+Package netguard provides HTTP clients for fetching URLs chosen by users (e.g., links in messages) without exposing
+the internal network to server-side request forgery.
+
+Addresses are checked when connections are dialed, after DNS resolution, so that host names resolving to private
+addresses and DNS rebinding are blocked as well as IP literals. Proxies from the environment are ignored, since they
+would dial on behalf of the client, and redirects are only followed to http and https URLs.
+*/
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a connection to a non-public address is attempted
+var ErrForbiddenAddress = errors.New("netguard: address is not public")
+
+// blockedNetworks are special-purpose ranges not covered by the net.IP predicates used in IsPublic
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"100.64.0.0/10",   // carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // TEST-NET-1
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // TEST-NET-2
+	"203.0.113.0/24",  // TEST-NET-3
+	"240.0.0.0/4",     // reserved, including the broadcast address
+	"64:ff9b::/96",    // NAT64, may translate to private IPv4 addresses
+	"64:ff9b:1::/48",  // local-use NAT64
+	"2001:db8::/32",   // documentation
+	"2002::/16",       // 6to4, embeds arbitrary IPv4 addresses
+	"2001::/32",       // Teredo, embeds arbitrary IPv4 addresses
+)
+
+// Config describes a guarded HTTP client
+type Config struct {
+	// Timeout limits the whole request, including redirects and reading the body (default: 5 seconds)
+	Timeout time.Duration
+
+	// MaxRedirects is the maximum number of redirects followed (default: 3)
+	MaxRedirects int
+
+	// AllowPrivate disables the address checks. It exists for tests against local servers only.
+	AllowPrivate bool
+}
+
+// IsPublic reports whether ip is a globally routable unicast address
+func IsPublic(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewClient returns an HTTP client that refuses to connect to non-public addresses
+func NewClient(cfg Config) *http.Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = 3
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = controlAddress
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// controlAddress is the net.Dialer Control function rejecting non-public addresses. It is called with the resolved
+// address of every connection attempt.
+func controlAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
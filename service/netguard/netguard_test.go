@@ -0,0 +1,159 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+
+		{"127.0.0.1", false},
+		{"127.255.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"100.64.0.1", false},
+		{"198.51.100.7", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::7f00:1", false},
+		{"2002:7f00:1::", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublic(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("IsPublic(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+// newTarget starts a server counting the requests it receives
+func newTarget(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		_, _ = w.Write([]byte("internal"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestClientRefusesLocalAddresses(t *testing.T) {
+	srv, hits := newTarget(t)
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(Config{})
+	for _, target := range []string{
+		srv.URL,
+		"http://localhost:" + port + "/",
+		"http://[::1]:" + port + "/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/",
+	} {
+		res, err := client.Get(target)
+		if err == nil {
+			_ = res.Body.Close()
+			t.Errorf("GET %s succeeded, want an error", target)
+			continue
+		}
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("GET %s returned %v, want ErrForbiddenAddress", target, err)
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 0 {
+		t.Fatalf("local server received %d requests", n)
+	}
+}
+
+func TestClientRefusesRedirectToLoopback(t *testing.T) {
+	internal, hits := newTarget(t)
+	var redirects int32
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&redirects, 1)
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	}))
+	t.Cleanup(front.Close)
+
+	// public.example stands for a public host: it is dialed without the checks, and redirects to 127.0.0.1
+	client := NewClient(Config{})
+	transport := client.Transport.(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == "public.example:80" {
+			var d net.Dialer
+			return d.DialContext(ctx, network, front.Listener.Addr().String())
+		}
+		return dial(ctx, network, address)
+	}
+
+	res, err := client.Get("http://public.example/")
+	if err == nil {
+		_ = res.Body.Close()
+		t.Fatal("redirect to 127.0.0.1 was followed")
+	}
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("GET returned %v, want ErrForbiddenAddress", err)
+	}
+	if n := atomic.LoadInt32(&redirects); n != 1 {
+		t.Fatalf("public server received %d requests, want 1", n)
+	}
+	if n := atomic.LoadInt32(hits); n != 0 {
+		t.Fatalf("internal server received %d requests", n)
+	}
+}
+
+func TestClientRedirects(t *testing.T) {
+	target, _ := newTarget(t)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/scheme":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, srv.URL+"/loop", http.StatusFound)
+		default:
+			http.Redirect(w, r, target.URL, http.StatusFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// Local servers need AllowPrivate; the redirect rules still apply
+	client := NewClient(Config{AllowPrivate: true, MaxRedirects: 2})
+
+	res, err := client.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("GET with a single redirect: %v", err)
+	}
+	_ = res.Body.Close()
+
+	for _, path := range []string{"/scheme", "/loop"} {
+		res, err := client.Get(srv.URL + path)
+		if err == nil {
+			_ = res.Body.Close()
+			t.Errorf("GET %s succeeded, want an error", path)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// clockSkew is the tolerance on the times in ID tokens, for clocks out of sync with the provider
+const clockSkew = time.Minute
+
+// minKeyRefresh is how long the key set is kept before fetching it again for a token signed with an unknown key
+const minKeyRefresh = time.Minute
+
+// jsonWebKey is a public key of the provider's JWKS (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// Elliptic curve keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// idTokenClaims are the claims of an ID token checked or read by Exchange
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	NotBefore         int64    `json:"nbf"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	Name              string   `json:"name"`
+}
+
+// audience is the aud claim, either a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks the signature and the claims of a compact-serialized ID token (RFC 7519) and returns the identity
+func (p *provider) verify(ctx context.Context, rawToken, nonce string) (*Identity, error) {
+	// 1. Decode the header, the claims and the signature
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed ID token", ErrRejected)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token header", ErrRejected)
+	}
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token claims", ErrRejected)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token signature", ErrRejected)
+	}
+
+	// 2. Check the signature with the key of the provider
+	key, err := p.key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	// 3. Check the claims: the token must be issued by the provider, for this client and this login, and be valid now
+	now := globaltime.Now()
+	switch {
+	case claims.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: ID token issued by %q", ErrRejected, claims.Issuer)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: ID token not issued for this client", ErrRejected)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		return nil, fmt.Errorf("%w: ID token authorized for another party", ErrRejected)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: ID token without subject", ErrRejected)
+	case claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: ID token expired", ErrRejected)
+	case claims.NotBefore != 0 && time.Unix(claims.NotBefore, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: ID token not valid yet", ErrRejected)
+	case claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: ID token issued in the future", ErrRejected)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: ID token nonce does not match the login", ErrRejected)
+	}
+
+	return &Identity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		PreferredUsername: claims.PreferredUsername,
+		Email:             claims.Email,
+		Name:              claims.Name,
+	}, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// key returns the public key with the given key ID for alg, fetching the key set of the provider if it is not known
+// yet or the key is missing (e.g., after a key rotation). Without a key ID, the only key of the set is used.
+func (p *provider) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	jwk, ok := p.findKey(kid)
+	if !ok && time.Since(p.keysAt) >= minKeyRefresh {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+		jwk, ok = p.findKey(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: ID token signed with unknown key %q", ErrRejected, kid)
+	}
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, fmt.Errorf("%w: key %q is not for %s", ErrRejected, kid, alg)
+	}
+	return jwk.publicKey()
+}
+
+// findKey looks up a signing key in the cached key set; p.mu must be held
+func (p *provider) findKey(kid string) (jsonWebKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, jwk := range p.keys {
+			return jwk, true
+		}
+	}
+	jwk, ok := p.keys[kid]
+	return jwk, ok
+}
+
+// fetchKeys replaces the cached key set with the one published by the provider; p.mu must be held
+func (p *provider) fetchKeys(ctx context.Context) error {
+	if p.discovery == nil {
+		return errors.New("oidc: provider not discovered")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.discovery.JWKSURI, nil)
+	if err != nil {
+		return fmt.Errorf("oidc: building JWKS request: %w", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("oidc: JWKS endpoint returned status %d", status)
+	}
+
+	p.keys = make(map[string]jsonWebKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use == "" || jwk.Use == "sig" {
+			p.keys[jwk.Kid] = jwk
+		}
+	}
+	p.keysAt = time.Now()
+	return nil
+}
+
+// publicKey decodes an RSA or elliptic curve public key
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, errN := decodeBigInt(k.N)
+		e, errE := decodeBigInt(k.E)
+		if errN != nil || errE != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("oidc: malformed RSA key %q", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("oidc: malformed EC key %q", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verifySignature checks a JWS signature (RFC 7518) of the signed input. The algorithm must match the type of key, so
+// that a token cannot pick a weaker verification (e.g., "none").
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return errors.New("invalid ID token signature")
+		}
+	case *ecdsa.PublicKey:
+		bits := k.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		if alg != fmt.Sprintf("ES%d", bits) || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match the EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid ID token signature")
+		}
+	default:
+		return errors.New("unsupported key")
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+/*
+Package oidc implements the client side of the OpenID Connect authorization code flow with PKCE, for single sign-on.
+
+The provider is discovered from its issuer URL (/.well-known/openid-configuration) on first use. ID tokens returned by
+the token endpoint are verified against the keys published by the provider (JWKS), which are fetched again when a
+token is signed with an unknown key, e.g. after a key rotation. RS256, RS384, RS512, ES256 and ES384 signatures are
+supported.
+
+The API server depends on the Provider interface only, so that tests can replace it or point New at a local provider
+such as the one in package oidctest.
+*/
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResponseSize limits the bytes read from the responses of the provider
+const maxResponseSize = 1 << 20
+
+// ErrRejected is returned by Exchange when the provider refuses the authorization code, or returns an ID token that
+// does not pass verification: the login has to be started again
+var ErrRejected = errors.New("oidc: login rejected")
+
+// Identity is the user authenticated by the provider, as described by the claims of the verified ID token
+type Identity struct {
+	Issuer  string
+	Subject string // Identifier of the user at the provider, never reassigned
+
+	// Profile claims, empty if the provider does not send them
+	PreferredUsername string
+	Email             string
+	Name              string
+}
+
+// Provider is an OpenID Connect provider users log in with
+type Provider interface {
+	// AuthCodeURL returns the URL of the provider where the user logs in. The provider redirects the user to the
+	// redirect URL with the state and an authorization code; codeChallenge is the S256 PKCE challenge of the verifier
+	// later sent to Exchange.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+
+	// Exchange redeems an authorization code and returns the identity of the user, verifying that the ID token was
+	// signed by the provider for this client and carries the nonce of the login
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// Config is used to configure the Provider returned by New
+type Config struct {
+	// Issuer is the URL identifying the provider (e.g., "https://accounts.example.com")
+	Issuer string
+
+	// ClientID and ClientSecret are the credentials of WASAText at the provider. The secret is sent with HTTP basic
+	// authentication; public clients without a secret rely on PKCE only.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is where the provider sends users back after logging in, as registered with the provider
+	RedirectURL string
+
+	// Scopes requested to the provider (default: openid, profile and email)
+	Scopes []string
+
+	// Timeout limits each request to the provider (default: 10 seconds)
+	Timeout time.Duration
+}
+
+type provider struct {
+	cfg    Config
+	client *http.Client
+
+	// mu protects the discovery document and the key set, which are fetched lazily
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]jsonWebKey
+	keysAt    time.Time
+}
+
+// discoveryDocument holds the metadata of the provider used by the authorization code flow
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New returns a Provider for the given configuration. The provider is contacted only when it is first used.
+func New(cfg Config) (Provider, error) {
+	issuer, err := url.Parse(cfg.Issuer)
+	if err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" {
+		return nil, fmt.Errorf("oidc: issuer must be an http or https URL, got %q", cfg.Issuer)
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("oidc: client ID is required")
+	}
+	if _, err := url.ParseRequestURI(cfg.RedirectURL); err != nil {
+		return nil, fmt.Errorf("oidc: invalid redirect URL %q", cfg.RedirectURL)
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// GenerateVerifier returns a new random PKCE code verifier
+func GenerateVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallenge returns the S256 PKCE challenge of a code verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes, base64url-encoded, e.g. for states and nonces
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("oidc: generating random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RandomState returns a new random value for the state or the nonce of a login
+func RandomState() (string, error) {
+	return randomString(32)
+}
+
+func (p *provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Redeem the code at the token endpoint
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: building token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: token endpoint: %s %s", ErrRejected, token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint returned status %d", status)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in the token response", ErrRejected)
+	}
+
+	// 2. Verify the ID token
+	return p.verify(ctx, token.IDToken, nonce)
+}
+
+// discover returns the discovery document of the provider, fetching it on first use
+func (p *provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: building discovery request: %w", err)
+	}
+	var doc discoveryDocument
+	status, err := p.doJSON(req, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned status %d", status)
+	}
+
+	// The issuer must be exactly the configured one, as ID tokens are checked against it
+	if doc.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks the authorization, token or JWKS endpoint")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// doJSON sends a request and decodes the JSON body of the response into out, returning the status code. Bodies of
+// failed responses are decoded too, as they may carry an OAuth error.
+func (p *provider) doJSON(req *http.Request, out interface{}) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: contacting the provider: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("oidc: reading the response of the provider: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil && res.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("oidc: decoding the response of the provider: %w", err)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+	"github.com/Daniel200273/WASA-project/service/oidc/oidctest"
+)
+
+const (
+	testClientID     = "wasatext"
+	testClientSecret = "secret"
+	testNonce        = "nonce"
+)
+
+// newTestProvider starts a local provider and returns it with a client of it
+func newTestProvider(t *testing.T) (*oidctest.Provider, Provider) {
+	t.Helper()
+	idp := oidctest.New(testClientID, testClientSecret)
+	t.Cleanup(idp.Close)
+	p, err := New(Config{
+		Issuer:       idp.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "http://wasatext.example/login/callback",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return idp, p
+}
+
+// authorize logs in at the provider as a browser would, and returns the authorization code and the PKCE verifier
+func authorize(t *testing.T, idp *oidctest.Provider, p Provider) (string, string) {
+	t.Helper()
+	verifier, err := GenerateVerifier()
+	if err != nil {
+		t.Fatalf("GenerateVerifier: %v", err)
+	}
+	authURL, err := p.AuthCodeURL(context.Background(), "state", testNonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	redirect, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state := redirect.Query().Get("state"); state != "state" {
+		t.Fatalf("provider redirected with state %q, want %q", state, "state")
+	}
+	return redirect.Query().Get("code"), verifier
+}
+
+func TestExchange(t *testing.T) {
+	idp, p := newTestProvider(t)
+	idp.SetUser("42", "maria", "maria@example.com")
+
+	code, verifier := authorize(t, idp, p)
+	identity, err := p.Exchange(context.Background(), code, verifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Issuer: idp.URL, Subject: "42", PreferredUsername: "maria", Email: "maria@example.com"}
+	if *identity != want {
+		t.Fatalf("Exchange returned %+v, want %+v", *identity, want)
+	}
+
+	// Codes are redeemed once
+	if _, err := p.Exchange(context.Background(), code, verifier, testNonce); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Exchange of a used code returned %v, want ErrRejected", err)
+	}
+}
+
+func TestExchangeRejectsPKCEMismatch(t *testing.T) {
+	idp, p := newTestProvider(t)
+
+	code, _ := authorize(t, idp, p)
+	other, err := GenerateVerifier()
+	if err != nil {
+		t.Fatalf("GenerateVerifier: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, other, testNonce); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Exchange with another verifier returned %v, want ErrRejected", err)
+	}
+}
+
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(idp *oidctest.Provider)
+		nonce string
+	}{
+		{"bad signature", func(idp *oidctest.Provider) { idp.SignWithUnknownKey(true) }, testNonce},
+		{"wrong audience", func(idp *oidctest.Provider) { idp.SetClaim("aud", "another-client") }, testNonce},
+		{"other audiences", func(idp *oidctest.Provider) {
+			idp.SetClaim("aud", []string{testClientID, "another-client"})
+		}, testNonce},
+		{"wrong issuer", func(idp *oidctest.Provider) { idp.SetClaim("iss", "https://evil.example") }, testNonce},
+		{"wrong nonce", func(*oidctest.Provider) {}, "another-nonce"},
+		{"no subject", func(idp *oidctest.Provider) { idp.SetClaim("sub", "") }, testNonce},
+		{"expired", func(idp *oidctest.Provider) { idp.SetIDTokenExpiry(-2 * clockSkew) }, testNonce},
+		{"not valid yet", func(idp *oidctest.Provider) {
+			idp.SetClaim("nbf", time.Now().Add(2*clockSkew).Unix())
+		}, testNonce},
+		{"issued in the future", func(idp *oidctest.Provider) {
+			idp.SetClaim("iat", time.Now().Add(2*clockSkew).Unix())
+		}, testNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, p := newTestProvider(t)
+			tt.setup(idp)
+
+			code, verifier := authorize(t, idp, p)
+			identity, err := p.Exchange(context.Background(), code, verifier, tt.nonce)
+			if !errors.Is(err, ErrRejected) {
+				t.Fatalf("Exchange returned %+v, %v, want ErrRejected", identity, err)
+			}
+		})
+	}
+}
+
+func TestExchangeChecksTimesAgainstGlobalTime(t *testing.T) {
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+	idp, p := newTestProvider(t)
+
+	// The token is valid for an hour from issued, with the tolerance on the clocks on both ends
+	issued := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	idp.SetClaim("iat", issued.Unix())
+	idp.SetClaim("nbf", issued.Unix())
+	idp.SetClaim("exp", issued.Add(time.Hour).Unix())
+
+	tests := []struct {
+		now   time.Time
+		valid bool
+	}{
+		{issued.Add(-clockSkew - time.Second), false},
+		{issued.Add(-clockSkew), true},
+		{issued.Add(time.Hour + clockSkew), true},
+		{issued.Add(time.Hour + clockSkew + time.Second), false},
+	}
+	for _, tt := range tests {
+		globaltime.FixedTime = tt.now
+		code, verifier := authorize(t, idp, p)
+		_, err := p.Exchange(context.Background(), code, verifier, testNonce)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("Exchange at %v returned %v, want valid %v", tt.now, err, tt.valid)
+		}
+	}
+}
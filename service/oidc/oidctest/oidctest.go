@@ -0,0 +1,329 @@
+/*
+Package oidctest provides a local OpenID Connect provider, to test single sign-on without a real identity provider.
+
+The provider serves the discovery document, the authorization endpoint, the token endpoint and the JWKS from an
+httptest server. The authorization endpoint logs in the current user (see SetUser) without asking anything, and
+redirects back with an authorization code; the token endpoint checks the client credentials and the PKCE verifier,
+and returns an ID token signed with a generated RSA key published in the JWKS.
+
+	provider := oidctest.New("wasatext", "secret")
+	defer provider.Close()
+	provider.SetUser("42", "maria", "maria@example.com")
+	redirect, err := provider.Authorize(authorizationURL) // redirect carries the code and the state
+*/
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Daniel200273/WASA-project/service/globaltime"
+)
+
+// keyID is the key ID of the signing key in the JWKS
+const keyID = "oidctest"
+
+// Provider is a local OpenID Connect provider. Its URL is the issuer.
+type Provider struct {
+	*httptest.Server
+
+	clientID, clientSecret string
+
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	user          user
+	codes         map[string]authorization
+	unknownKey    *rsa.PrivateKey
+	idTokenExpiry time.Duration
+	claims        map[string]interface{}
+}
+
+// user is the user logged in by the authorization endpoint
+type user struct {
+	subject, preferredUsername, email string
+}
+
+// authorization is an authorization code waiting to be redeemed
+type authorization struct {
+	user          user
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// New starts a provider for the client with the given credentials. The logged-in user is "alice" (subject "1") until
+// SetUser is called.
+func New(clientID, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: generating key: %v", err))
+	}
+
+	p := &Provider{
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		key:           key,
+		user:          user{subject: "1", preferredUsername: "alice", email: "alice@example.com"},
+		codes:         make(map[string]authorization),
+		idTokenExpiry: time.Hour,
+		claims:        make(map[string]interface{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// SetUser sets the user logged in by the following authorizations
+func (p *Provider) SetUser(subject, preferredUsername, email string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user{subject: subject, preferredUsername: preferredUsername, email: email}
+}
+
+// SignWithUnknownKey makes the token endpoint sign ID tokens with a key missing from the JWKS, which clients must
+// refuse
+func (p *Provider) SignWithUnknownKey(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unknownKey = nil
+	if enabled {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(fmt.Sprintf("oidctest: generating key: %v", err))
+		}
+		p.unknownKey = key
+	}
+}
+
+// SetIDTokenExpiry sets how long the ID tokens are valid after they are issued (default: 1 hour). A negative value
+// issues expired tokens.
+func (p *Provider) SetIDTokenExpiry(expiry time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idTokenExpiry = expiry
+}
+
+// SetClaim overrides a claim of the following ID tokens, e.g. to issue tokens for another audience or with a "nbf"
+// in the future. A nil value restores the claim the provider would issue.
+func (p *Provider) SetClaim(name string, value interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if value == nil {
+		delete(p.claims, name)
+		return
+	}
+	p.claims[name] = value
+}
+
+// Authorize follows an authorization URL returned by the client, as a browser would, and returns the URL the
+// provider redirects to, carrying the authorization code and the state
+func (p *Provider) Authorize(authorizationURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get(authorizationURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("oidctest: authorization returned status %d", res.StatusCode)
+	}
+	return res.Location()
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize logs in the current user and redirects back to the client with a new authorization code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	switch {
+	case query.Get("client_id") != p.clientID:
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	case err != nil || !redirectURI.IsAbs():
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		user:          p.user,
+		redirectURI:   redirectURI.String(),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", query.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems an authorization code, once, for an ID token
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	// 1. Authenticate the client
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != p.clientID || clientSecret != p.clientSecret {
+		oauthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	// 2. Redeem the code, checking the redirect URI and the PKCE verifier
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	p.mu.Lock()
+	auth, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	signingKey, expiry := p.key, p.idTokenExpiry
+	if p.unknownKey != nil {
+		signingKey = p.unknownKey
+	}
+	overrides := make(map[string]interface{}, len(p.claims))
+	for name, value := range p.claims {
+		overrides[name] = value
+	}
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || auth.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		oauthError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	// 3. Issue the ID token, at the time seen by the server under test
+	now := globaltime.Now()
+	claims := map[string]interface{}{
+		"iss":                p.URL,
+		"sub":                auth.user.subject,
+		"aud":                p.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(expiry).Unix(),
+		"nonce":              auth.nonce,
+		"preferred_username": auth.user.preferredUsername,
+		"email":              auth.user.email,
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	idToken, err := sign(signingKey, claims)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// jwks publishes the public signing key
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// sign returns a compact-serialized JWT signed with RS256
+func sign(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.New("oidctest: signing ID token")
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func oauthError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("oidctest: generating random value: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,369 @@
+/*
+Package openapi validates HTTP traffic against an OpenAPI 3.0 specification (e.g., doc/api.yaml).
+
+The package supports the subset of OpenAPI used by the WASAText specification: path, query and header parameters,
+JSON and multipart request bodies, responses referenced by status code, and schemas with types, formats, enums,
+lengths, patterns, ranges, required and additional properties, nullable values, allOf/anyOf/oneOf and local "$ref"s.
+
+Example:
+
+	spec, err := openapi.Load(doc.OpenAPI)
+	if err != nil {
+		return err
+	}
+
+	op, err := spec.ValidateRequest(r)
+	if errors.Is(err, openapi.ErrUnknownOperation) {
+		// the request is not described by the specification
+	} else if err != nil {
+		// err is a *openapi.ValidationError listing every violation
+	}
+*/
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrUnknownOperation is returned when no operation of the specification matches a request
+var ErrUnknownOperation = errors.New("operation not found in the specification")
+
+// Spec is a parsed OpenAPI specification, ready to validate requests and responses
+type Spec struct {
+	operations []*Operation
+}
+
+// Operation is a single method + path template of the specification
+type Operation struct {
+	// ID is the operationId
+	ID string
+
+	// Method is the HTTP method, in upper case
+	Method string
+
+	// Path is the path template, e.g. "/users/{userId}"
+	Path string
+
+	// Secured is true when the operation requires authentication
+	Secured bool
+
+	Parameters  []*Parameter
+	RequestBody *RequestBody
+	Responses   map[string]*Response
+
+	segments []string
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// MediaType describes the content of a body for a single content type
+type MediaType struct {
+	Schema  *Schema         `json:"schema"`
+	Example json.RawMessage `json:"example"`
+}
+
+// RequestBody describes the accepted request bodies
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response for a status code
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// document is the part of an OpenAPI document used by the validator
+type document struct {
+	Security   []map[string][]string                 `json:"security"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Responses  map[string]*Response  `json:"responses"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// operationDocument is an operation as written in the document
+type operationDocument struct {
+	OperationID string                 `json:"operationId"`
+	Security    *[]map[string][]string `json:"security"`
+	Parameters  []*Parameter           `json:"parameters"`
+	RequestBody *RequestBody           `json:"requestBody"`
+	Responses   map[string]*Response   `json:"responses"`
+}
+
+// methods are the path item keys that describe operations
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Load parses a YAML (or JSON) OpenAPI document and resolves its references
+func Load(data []byte) (*Spec, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing specification: %w", err)
+	}
+	// yaml.v2 decodes maps with interface{} keys, which cannot be encoded as JSON
+	encoded, err := json.Marshal(stringKeys(raw))
+	if err != nil {
+		return nil, fmt.Errorf("converting specification: %w", err)
+	}
+	var doc document
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, fmt.Errorf("decoding specification: %w", err)
+	}
+
+	r := resolver{doc: &doc, done: make(map[*Schema]bool)}
+	for _, s := range doc.Components.Schemas {
+		if err := r.schema(s); err != nil {
+			return nil, err
+		}
+	}
+
+	spec := &Spec{}
+	for path, item := range doc.Paths {
+		var shared []*Parameter
+		if rawParams, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(rawParams, &shared); err != nil {
+				return nil, fmt.Errorf("decoding parameters of %s: %w", path, err)
+			}
+		}
+
+		for _, method := range methods {
+			rawOp, ok := item[method]
+			if !ok {
+				continue
+			}
+			var od operationDocument
+			if err := json.Unmarshal(rawOp, &od); err != nil {
+				return nil, fmt.Errorf("decoding %s %s: %w", strings.ToUpper(method), path, err)
+			}
+
+			op := &Operation{
+				ID:          od.OperationID,
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				Secured:     len(doc.Security) > 0,
+				Parameters:  append(append([]*Parameter(nil), shared...), od.Parameters...),
+				RequestBody: od.RequestBody,
+				Responses:   od.Responses,
+				segments:    strings.Split(strings.Trim(path, "/"), "/"),
+			}
+			if od.Security != nil {
+				op.Secured = len(*od.Security) > 0
+			}
+			if err := r.operation(op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", op.Method, path, err)
+			}
+			spec.operations = append(spec.operations, op)
+		}
+	}
+
+	sort.Slice(spec.operations, func(i, j int) bool {
+		if spec.operations[i].Path != spec.operations[j].Path {
+			return spec.operations[i].Path < spec.operations[j].Path
+		}
+		return spec.operations[i].Method < spec.operations[j].Method
+	})
+	return spec, nil
+}
+
+// Operations returns all the operations of the specification, sorted by path and method
+func (s *Spec) Operations() []*Operation {
+	return append([]*Operation(nil), s.operations...)
+}
+
+// FindOperation returns the operation matching a method and a path, with the values of the path parameters. When
+// several templates match, the one with more literal segments wins (e.g., "/users/{id}/export" over "/users/{id}/{x}").
+func (s *Spec) FindOperation(method string, path string) (*Operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var best *Operation
+	bestScore := -1
+	for _, op := range s.operations {
+		if op.Method != method || len(op.segments) != len(segments) {
+			continue
+		}
+		score := 0
+		for i, seg := range op.segments {
+			if isTemplate(seg) {
+				if segments[i] == "" {
+					score = -1
+					break
+				}
+				continue
+			}
+			if seg != segments[i] {
+				score = -1
+				break
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = op, score
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	params := make(map[string]string)
+	for i, seg := range best.segments {
+		if isTemplate(seg) {
+			params[seg[1:len(seg)-1]] = segments[i]
+		}
+	}
+	return best, params
+}
+
+// FindResponse returns the response documented for a status code, falling back to ranges ("2XX") and "default"
+func (op *Operation) FindResponse(statusCode int) *Response {
+	code := fmt.Sprint(statusCode)
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		if res, ok := op.Responses[key]; ok {
+			return res
+		}
+	}
+	return nil
+}
+
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// stringKeys converts the maps decoded by yaml.v2 into maps with string keys
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			out[fmt.Sprint(k)] = stringKeys(value)
+		}
+		return out
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// resolver replaces local references ("#/components/...") with the referenced objects
+type resolver struct {
+	doc  *document
+	done map[*Schema]bool
+}
+
+func (r *resolver) operation(op *Operation) error {
+	for i, p := range op.Parameters {
+		if p.Ref != "" {
+			target, ok := r.doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			if !ok {
+				return fmt.Errorf("unresolved reference %q", p.Ref)
+			}
+			op.Parameters[i], p = target, target
+		}
+		if err := r.schema(p.Schema); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody != nil {
+		for _, mt := range op.RequestBody.Content {
+			if err := r.schema(mt.Schema); err != nil {
+				return err
+			}
+		}
+	}
+
+	for code, res := range op.Responses {
+		if res.Ref != "" {
+			target, ok := r.doc.Components.Responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+			if !ok {
+				return fmt.Errorf("unresolved reference %q", res.Ref)
+			}
+			op.Responses[code], res = target, target
+		}
+		for _, mt := range res.Content {
+			if err := r.schema(mt.Schema); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *resolver) schema(s *Schema) error {
+	if s == nil || r.done[s] {
+		return nil
+	}
+	r.done[s] = true
+
+	if s.Ref != "" {
+		target, ok := r.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("unresolved reference %q", s.Ref)
+		}
+		s.ref = target
+		return r.schema(target)
+	}
+
+	if err := s.compile(); err != nil {
+		return err
+	}
+
+	children := []*Schema{s.Items, s.additional}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	children = append(children, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	for _, child := range children {
+		if err := r.schema(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mediaType returns the media type of a Content-Type header, without parameters
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.ToLower(strings.SplitN(contentType, ";", 2)[0]))
+}
+
+// findMediaType returns the content entry matching a Content-Type header
+func findMediaType(content map[string]MediaType, contentType string) (MediaType, bool) {
+	mt := mediaType(contentType)
+	if entry, ok := content[mt]; ok {
+		return entry, true
+	}
+	if slash := strings.Index(mt, "/"); slash >= 0 {
+		if entry, ok := content[mt[:slash]+"/*"]; ok {
+			return entry, true
+		}
+	}
+	entry, ok := content["*/*"]
+	return entry, ok
+}
+
+// isJSON tells if a media type carries a JSON document
+func isJSON(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
@@ -0,0 +1,286 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref string `json:"$ref"`
+
+	Type     string        `json:"type"`
+	Format   string        `json:"format"`
+	Nullable bool          `json:"nullable"`
+	Enum     []interface{} `json:"enum"`
+	Example  interface{}   `json:"example"`
+
+	Pattern   string `json:"pattern"`
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+
+	Minimum          *float64 `json:"minimum"`
+	Maximum          *float64 `json:"maximum"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum"`
+
+	Items    *Schema `json:"items"`
+	MinItems *int    `json:"minItems"`
+	MaxItems *int    `json:"maxItems"`
+
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+
+	AllOf []*Schema `json:"allOf"`
+	AnyOf []*Schema `json:"anyOf"`
+	OneOf []*Schema `json:"oneOf"`
+
+	// ref is the resolved target of Ref
+	ref *Schema
+
+	// pattern is the compiled Pattern
+	pattern *regexp.Regexp
+
+	// noAdditional is true when additionalProperties is false; additional is set when it is a schema
+	noAdditional bool
+	additional   *Schema
+}
+
+// compile prepares the schema for validation
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additional = &Schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("invalid additionalProperties: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Resolved follows the reference of the schema, if any
+func (s *Schema) Resolved() *Schema {
+	for s.ref != nil {
+		s = s.ref
+	}
+	return s
+}
+
+// validate checks a decoded JSON value (numbers as json.Number) and appends the violations found at location
+func (s *Schema) validate(location string, value interface{}, violations []Violation) []Violation {
+	if s == nil {
+		return violations
+	}
+	s = s.Resolved()
+
+	report := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			report("must not be null")
+		}
+		return violations
+	}
+
+	for _, sub := range s.AllOf {
+		violations = sub.validate(location, value, violations)
+	}
+	if len(s.AnyOf) > 0 && countMatches(s.AnyOf, location, value) == 0 {
+		report("must match at least one schema of anyOf")
+	}
+	if len(s.OneOf) > 0 {
+		if n := countMatches(s.OneOf, location, value); n != 1 {
+			report("must match exactly one schema of oneOf (matches %d)", n)
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		report("must be one of %v", s.Enum)
+	}
+
+	switch s.Type {
+	case "":
+		// Any type
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			report("must be an object")
+			return violations
+		}
+		violations = s.validateObject(location, obj, violations)
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			report("must be an array")
+			return violations
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			report("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			report("must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range arr {
+			violations = s.Items.validate(fmt.Sprintf("%s[%d]", location, i), item, violations)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			report("must be a string")
+			return violations
+		}
+		violations = s.validateString(location, str, violations)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			report("must be of type %s", s.Type)
+			return violations
+		}
+		f, err := n.Float64()
+		if err != nil || (s.Type == "integer" && f != math.Trunc(f)) {
+			report("must be of type %s", s.Type)
+			return violations
+		}
+		if s.Minimum != nil && (f < *s.Minimum || (s.ExclusiveMinimum && f == *s.Minimum)) {
+			report("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && (f > *s.Maximum || (s.ExclusiveMaximum && f == *s.Maximum)) {
+			report("must be at most %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("must be a boolean")
+		}
+	}
+	return violations
+}
+
+func (s *Schema) validateObject(location string, obj map[string]interface{}, violations []Violation) []Violation {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			violations = append(violations, Violation{Location: location, Message: fmt.Sprintf("missing required property %q", name)})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := location + "." + name
+		if prop, ok := s.Properties[name]; ok {
+			violations = prop.validate(child, obj[name], violations)
+		} else if s.noAdditional {
+			violations = append(violations, Violation{Location: child, Message: "unknown property"})
+		} else if s.additional != nil {
+			violations = s.additional.validate(child, obj[name], violations)
+		}
+	}
+	return violations
+}
+
+func (s *Schema) validateString(location string, str string, violations []Violation) []Violation {
+	report := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Binary strings are raw file contents: lengths are in bytes and patterns do not apply
+	if s.Format == "binary" {
+		return violations
+	}
+
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		report("must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		report("must be at most %d characters long", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		report("must match the pattern %s", s.Pattern)
+	}
+
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+			report("must be an RFC 3339 date-time")
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", str); err != nil {
+			report("must be a full date (YYYY-MM-DD)")
+		}
+	}
+	return violations
+}
+
+// countMatches counts the schemas that a value satisfies
+func countMatches(schemas []*Schema, location string, value interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if len(s.validate(location, value, nil)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// inEnum tells if a value is one of the allowed values. Numbers are compared by value.
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if n, ok := value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				if a, ok := allowed.(float64); ok && a == f {
+					return true
+				}
+			}
+			continue
+		}
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseParameter converts the raw text of a parameter to the JSON value described by the schema, so that it can be
+// validated like a body value. Values that cannot be converted are returned as strings.
+func (s *Schema) parseParameter(raw string) interface{} {
+	if s == nil {
+		return raw
+	}
+	switch s.Resolved().Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
@@ -0,0 +1,225 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxMultipartMemory is the memory used to parse multipart bodies; larger files are stored on disk
+const maxMultipartMemory = 10 << 20
+
+// Violation is a single mismatch between an HTTP message and the specification
+type Violation struct {
+	// Location is where the mismatch is, e.g. "path.userId", "query.q", "body.messages[0].id"
+	Location string
+
+	// Message describes the mismatch
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Location + ": " + v.Message
+}
+
+// ValidationError lists the violations found while validating a request or a response
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// asError returns nil when there are no violations, a *ValidationError otherwise
+func asError(violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// ValidateRequest checks a request against the matching operation, which is returned. ErrUnknownOperation is returned
+// if no operation matches. JSON and multipart bodies are read to be validated: the request body is restored (JSON) or
+// left parsed in r.MultipartForm (multipart), so that handlers can still use it.
+func (s *Spec) ValidateRequest(r *http.Request) (*Operation, error) {
+	op, pathParams := s.FindOperation(r.Method, r.URL.Path)
+	if op == nil {
+		return nil, ErrUnknownOperation
+	}
+
+	var violations []Violation
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = pathParams[p.Name]
+		case "query":
+			if values, ok := query[p.Name]; ok && len(values) > 0 {
+				raw, present = values[0], true
+			}
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+
+		location := p.In + "." + p.Name
+		if !present {
+			if p.Required {
+				violations = append(violations, Violation{Location: location, Message: "missing required parameter"})
+			}
+			continue
+		}
+		violations = p.Schema.validate(location, p.Schema.parseParameter(raw), violations)
+	}
+
+	bodyViolations, err := op.validateRequestBody(r)
+	if err != nil {
+		return op, err
+	}
+	violations = append(violations, bodyViolations...)
+
+	return op, asError(violations)
+}
+
+// validateRequestBody checks the body of a request. The returned error is not nil only when the body cannot be read.
+func (op *Operation) validateRequestBody(r *http.Request) ([]Violation, error) {
+	hasBody := r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+	if op.RequestBody == nil {
+		return nil, nil
+	}
+	if !hasBody {
+		if op.RequestBody.Required {
+			return []Violation{{Location: "body", Message: "missing required request body"}}, nil
+		}
+		return nil, nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	entry, ok := findMediaType(op.RequestBody.Content, contentType)
+	if !ok {
+		return []Violation{{Location: "header.Content-Type", Message: fmt.Sprintf("unsupported content type %q", contentType)}}, nil
+	}
+
+	mt := mediaType(contentType)
+	switch {
+	case isJSON(mt):
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(data))
+
+		value, err := decodeJSON(data)
+		if err != nil {
+			return []Violation{{Location: "body", Message: "invalid JSON: " + err.Error()}}, nil
+		}
+		return entry.Schema.validate("body", value, nil), nil
+
+	case mt == "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return []Violation{{Location: "body", Message: "invalid multipart body: " + err.Error()}}, nil
+		}
+		return entry.Schema.validateForm(r), nil
+	}
+	return nil, nil
+}
+
+// validateForm checks the fields of a parsed multipart form against an object schema
+func (s *Schema) validateForm(r *http.Request) []Violation {
+	if s == nil {
+		return nil
+	}
+	s = s.Resolved()
+
+	var violations []Violation
+	for _, name := range s.Required {
+		_, isValue := r.MultipartForm.Value[name]
+		_, isFile := r.MultipartForm.File[name]
+		if !isValue && !isFile {
+			violations = append(violations, Violation{Location: "body", Message: fmt.Sprintf("missing required field %q", name)})
+		}
+	}
+	for name, values := range r.MultipartForm.Value {
+		location := "body." + name
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.noAdditional {
+				violations = append(violations, Violation{Location: location, Message: "unknown field"})
+			}
+			continue
+		}
+		for _, value := range values {
+			violations = prop.validate(location, prop.parseParameter(value), violations)
+		}
+	}
+	for name := range r.MultipartForm.File {
+		if _, ok := s.Properties[name]; !ok && s.noAdditional {
+			violations = append(violations, Violation{Location: "body." + name, Message: "unknown field"})
+		}
+	}
+	return violations
+}
+
+// ValidateResponse checks a response produced for an operation. Only JSON bodies are validated against their schema;
+// for other content types only the Content-Type header is checked.
+func (op *Operation) ValidateResponse(statusCode int, header http.Header, body []byte) error {
+	res := op.FindResponse(statusCode)
+	if res == nil {
+		return asError([]Violation{{Location: "status", Message: fmt.Sprintf("undocumented status code %d", statusCode)}})
+	}
+
+	if len(res.Content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return asError([]Violation{{Location: "body", Message: "unexpected body for a response without content"}})
+		}
+		return nil
+	}
+
+	contentType := header.Get("Content-Type")
+	entry, ok := findMediaType(res.Content, contentType)
+	if !ok {
+		return asError([]Violation{{Location: "header.Content-Type", Message: fmt.Sprintf("undocumented content type %q", contentType)}})
+	}
+	if !isJSON(mediaType(contentType)) {
+		return nil
+	}
+
+	return entry.Schema.ValidateJSON(body)
+}
+
+// ValidateJSON checks a JSON document (e.g., an example of the specification) against the schema
+func (s *Schema) ValidateJSON(data []byte) error {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return asError([]Violation{{Location: "body", Message: "invalid JSON: " + err.Error()}})
+	}
+	return asError(s.validate("body", value, nil))
+}
+
+// decodeJSON decodes a JSON document keeping numbers as json.Number
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
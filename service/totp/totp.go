@@ -0,0 +1,105 @@
+/*
+Package totp implements time-based one-time passwords (RFC 6238) as used by authenticator apps: 6-digit codes derived
+with HMAC-SHA1 from a shared secret and the current 30-second time step.
+
+The time is always passed by the caller (e.g., globaltime.Now()), so that codes can be checked deterministically.
+*/
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the duration of a time step: a code is valid for one period
+	Period = 30 * time.Second
+
+	// Digits is the number of digits of a code
+	Digits = 6
+
+	// secretSize is the size of generated secrets in bytes, the length of an HMAC-SHA1 key recommended by RFC 4226
+	secretSize = 20
+)
+
+// encoding is the base32 encoding of secrets, without padding as expected by authenticator apps
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32-encoded
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("totp: generating secret: %w", err)
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns the otpauth URI of a secret, usually shown as a QR code, which authenticator apps use to add the
+// account. The issuer is the name of the service, the account is the name of the user.
+func URI(issuer, account, secret string) string {
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + issuer + ":" + account,
+		RawQuery: url.Values{
+			"secret":    {secret},
+			"issuer":    {issuer},
+			"algorithm": {"SHA1"},
+			"digits":    {fmt.Sprint(Digits)},
+			"period":    {fmt.Sprint(int(Period / time.Second))},
+		}.Encode(),
+	}
+	return u.String()
+}
+
+// Counter returns the time step of t, from which the code valid at t is derived
+func Counter(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of a base32-encoded secret for a time step
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("totp: decoding secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226, section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate checks a code against the time steps around t, accepting up to skew steps before or after it to tolerate
+// clocks out of sync. It returns the matching time step: callers should refuse codes of steps already used, so that a
+// code cannot be replayed.
+func Validate(secret, code string, t time.Time, skew int) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Counter(t)
+	for step := current - int64(skew); step <= current+int64(skew); step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
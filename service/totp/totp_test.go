@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the test vectors of RFC 6238 (appendix B), "12345678901234567890", base32-encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA-1 test vectors of RFC 6238, truncated to the last Digits digits of the 8-digit codes
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Counter(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+
+	// Secrets are typed back by users in any case
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Counter(time.Unix(59, 0)))
+	if err != nil || lower != "287082" {
+		t.Errorf("Code with a lowercase secret = %s, %v, want 287082", lower, err)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, at, 1)
+		if !ok || step != Counter(at) {
+			t.Errorf("Validate(%s) at %d = %d, %v, want step %d", v.code, v.unix, step, ok, Counter(at))
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	// 1111111111 is in step 37037037; the code of that step is 050471
+	at := time.Unix(1111111111, 0)
+	const code = "050471"
+	step := Counter(at)
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		skew  int
+		valid bool
+	}{
+		{"same step", at, 0, true},
+		{"one step later, no skew", at.Add(Period), 0, false},
+		{"one step later", at.Add(Period), 1, true},
+		{"one step earlier", at.Add(-Period), 1, true},
+		{"two steps later", at.Add(2 * Period), 1, false},
+		{"two steps earlier", at.Add(-2 * Period), 1, false},
+	}
+	for _, tt := range tests {
+		got, ok := Validate(rfcSecret, code, tt.at, tt.skew)
+		if ok != tt.valid {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, ok, tt.valid)
+			continue
+		}
+		// The matching step stays the same, so that callers can refuse the code once used
+		if ok && got != step {
+			t.Errorf("%s: Validate returned step %d, want %d", tt.name, got, step)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870822", "94287082", "28708a"} {
+		if _, ok := Validate(rfcSecret, code, at, 1); ok {
+			t.Errorf("Validate(%q) succeeded", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretSize {
+		t.Fatalf("GenerateSecret returned %q, want %d base32-encoded bytes", secret, secretSize)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Fatal("GenerateSecret returned the same secret twice")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("WASAText", "maria", rfcSecret))
+	if err != nil {
+		t.Fatalf("parsing URI: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/WASAText:maria" {
+		t.Errorf("URI = %s", u)
+	}
+	query := u.Query()
+	if query.Get("secret") != rfcSecret || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("URI has parameters %v", query)
+	}
+}